@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/forms"
+	"github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/migrate"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/songtianlun/diarum/internal/api"
+	"github.com/songtianlun/diarum/internal/apitoken"
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/embedding"
+)
+
+// runMigrations applies pending migrations, like serve does on startup,
+// so commands also work on a data directory that was never served by this version
+func runMigrations(app *pocketbase.PocketBase) error {
+	runner, err := migrate.NewRunner(app.DB(), migrations.AppMigrations)
+	if err != nil {
+		return err
+	}
+	if _, err := runner.Up(); err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	return nil
+}
+
+// mcpCommand serves the journal of an API token's owner over the Model Context Protocol on stdio.
+// Logs go to stderr, stdout carries only protocol messages.
+func mcpCommand(app *pocketbase.PocketBase) *cobra.Command {
+	var tokenFlag string
+
+	cmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Serve the diary to AI assistants over the Model Context Protocol (stdio)",
+		Long: "Serve the diary to AI assistants over the Model Context Protocol on stdin and stdout.\n" +
+			"The API token picks the user and the tools: diaries:read is required, diaries:write adds\n" +
+			"append_to_today and chat adds semantic_search. The token can also be set with DIARUM_API_TOKEN.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secret := tokenFlag
+			if secret == "" {
+				secret = os.Getenv("DIARUM_API_TOKEN")
+			}
+			if secret == "" {
+				return errors.New("an API token is required, pass --token or set DIARUM_API_TOKEN")
+			}
+
+			if err := runMigrations(app); err != nil {
+				return err
+			}
+
+			token, err := apitoken.NewTokenService(app).Authenticate(secret, "stdio")
+			if err != nil {
+				return err
+			}
+			if !token.HasScope(apitoken.ScopeDiariesRead) {
+				return fmt.Errorf("the API token is missing the %s scope", apitoken.ScopeDiariesRead)
+			}
+
+			var embeddingService *embedding.EmbeddingService
+			if vectorDB, err := embedding.NewVectorDB(app.DataDir()); err != nil {
+				log.Printf("Warning: Failed to initialize vector database, semantic search is disabled: %v", err)
+			} else {
+				embeddingService = embedding.NewEmbeddingService(app, vectorDB)
+			}
+
+			log.Printf("Serving MCP over stdio for token %s", token.Prefix)
+			server := api.NewMCPServer(app, embeddingService, Version, token)
+			return server.ServeStdio(cmd.Context(), os.Stdin, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVar(&tokenFlag, "token", "", "API token of the user whose diary is served")
+	return cmd
+}
+
+// readPassword reads a password from the first line of stdin, or prompts for it twice on the terminal.
+// Passwords are never taken as arguments, which end up in the shell history and the process list.
+func readPassword(cmd *cobra.Command, fromStdin bool) (string, error) {
+	if fromStdin {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", errors.New("no password on stdin")
+		}
+		return password, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no terminal to prompt for the password, pass --password-stdin")
+	}
+	prompt := func(label string) (string, error) {
+		fmt.Fprint(cmd.ErrOrStderr(), label)
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(cmd.ErrOrStderr())
+		return string(password), err
+	}
+
+	password, err := prompt("Password: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if password == "" {
+		return "", errors.New("the password can't be empty")
+	}
+	confirm, err := prompt("Repeat password: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if confirm != password {
+		return "", errors.New("the passwords don't match")
+	}
+	return password, nil
+}
+
+// findUser looks up a user by id, email or username
+func findUser(app *pocketbase.PocketBase, ref string) (*models.Record, error) {
+	if ref == "" {
+		return nil, errors.New("a user is required, pass --user with an id, email or username")
+	}
+	if user, err := app.Dao().FindRecordById("users", ref); err == nil {
+		return user, nil
+	}
+	if strings.Contains(ref, "@") {
+		if user, err := app.Dao().FindAuthRecordByEmail("users", ref); err == nil {
+			return user, nil
+		}
+	}
+	if user, err := app.Dao().FindAuthRecordByUsername("users", ref); err == nil {
+		return user, nil
+	}
+	return nil, fmt.Errorf("user %q not found", ref)
+}
+
+// exportRequest turns the --range flag into an export request of all data.
+// The range is 1m, 3m, 6m, 1y, all or a custom START..END with days as YYYY-MM-DD.
+func exportRequest(dateRange string) api.ExportRequest {
+	req := api.ExportRequest{
+		DateRange:            dateRange,
+		IncludeDiaries:       true,
+		IncludeMedia:         true,
+		IncludeConversations: true,
+	}
+	if start, end, ok := strings.Cut(dateRange, ".."); ok {
+		req.DateRange, req.StartDate, req.EndDate = "custom", start, end
+	}
+	return req
+}
+
+// exportCommand writes the export archive of a user to a file, the same archive POST /api/export returns
+func exportCommand(app *pocketbase.PocketBase) *cobra.Command {
+	var userFlag, rangeFlag, formatFlag, outFlag string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the diaries, media and conversations of a user",
+		Long: "Export the diaries, media and conversations of a user.\n" +
+			"--range takes 1m, 3m, 6m, 1y, all or START..END (e.g. 2025-01-01..2025-12-31).\n" +
+			"--format zip writes the archive /api/import and the import command read, json only diarum_export.json without media.",
+		Example:      "  diarum export --user alice --range 2025-01-01..2025-12-31 --out diary-2025.zip",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := runMigrations(app); err != nil {
+				return err
+			}
+			user, err := findUser(app, userFlag)
+			if err != nil {
+				return err
+			}
+
+			out := outFlag
+			if out == "" {
+				out = "diarum_export." + formatFlag
+			}
+			var w io.Writer = cmd.OutOrStdout()
+			var file *os.File
+			if out != "-" {
+				if file, err = os.Create(out); err != nil {
+					return err
+				}
+				w = file
+			}
+
+			stats, err := api.ExportTo(app, user.Id, exportRequest(rangeFlag), formatFlag, w)
+			if file != nil {
+				if closeErr := file.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					os.Remove(out)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d diaries, %d media and %d conversations from %s to %s to %s\n",
+				stats.Diaries.ActualExported, stats.Media.ActualExported, stats.Conversations.ActualExported,
+				stats.StartDate, stats.EndDate, out)
+			for _, item := range stats.FailedItems {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Failed %s %s: %s\n", item.Type, item.ID, item.Reason)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&userFlag, "user", "", "id, email or username of the user")
+	cmd.Flags().StringVar(&rangeFlag, "range", "all", "date range of the export")
+	cmd.Flags().StringVar(&formatFlag, "format", api.ExportFormatZip, "zip or json")
+	cmd.Flags().StringVar(&outFlag, "out", "", `output file, "-" for stdout (default "diarum_export.<format>")`)
+	return cmd
+}
+
+// importCommand imports an export archive into a user's data, like POST /api/import
+func importCommand(app *pocketbase.PocketBase) *cobra.Command {
+	var userFlag, strategyFlag string
+	var dryRunFlag bool
+
+	cmd := &cobra.Command{
+		Use:          "import <zip>",
+		Short:        "Import an export archive into a user's diary",
+		Long:         "Import an archive written by the export command or /api/export into a user's diary.\nRun reindex afterwards to update the vectors for semantic search.",
+		Example:      "  diarum import diary-2025.zip --user alice\n  diarum import laptop.zip --user alice --strategy keep-newer --dry-run",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := runMigrations(app); err != nil {
+				return err
+			}
+			user, err := findUser(app, userFlag)
+			if err != nil {
+				return err
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			info, err := file.Stat()
+			if err != nil {
+				return err
+			}
+
+			stats, err := api.ImportArchive(app, user.Id, file, info.Size(), api.ImportOptions{Strategy: strategyFlag, DryRun: dryRunFlag})
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if stats.DryRun {
+				w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ACTION\tKIND\tITEM\tREASON")
+				for _, item := range stats.Plan {
+					name := item.Name
+					if item.Kind == "diary" {
+						name = strings.TrimSpace(item.Date + " " + item.Time)
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.Action, item.Kind, name, item.Reason)
+				}
+				w.Flush()
+				fmt.Fprintln(out, "\nDry run, nothing was written:")
+			}
+			fmt.Fprintf(out, "Diaries:       %d imported, %d updated, %d skipped, %d failed of %d\n", stats.Diaries.Imported, stats.Diaries.Updated, stats.Diaries.Skipped, stats.Diaries.Failed, stats.Diaries.Total)
+			fmt.Fprintf(out, "Media:         %d imported, %d skipped, %d failed of %d\n", stats.Media.Imported, stats.Media.Skipped, stats.Media.Failed, stats.Media.Total)
+			fmt.Fprintf(out, "Conversations: %d imported, %d skipped, %d failed of %d\n", stats.Conversations.Imported, stats.Conversations.Skipped, stats.Conversations.Failed, stats.Conversations.Total)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&userFlag, "user", "", "id, email or username of the user")
+	cmd.Flags().StringVar(&strategyFlag, "strategy", api.ImportStrategySkip, "what to do with entries at the day and time of an existing entry: "+strings.Join(api.ImportStrategies, ", "))
+	cmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "list what the import would do without writing anything")
+	return cmd
+}
+
+// reindexCommand rebuilds the semantic search vectors of one or all users
+func reindexCommand(app *pocketbase.PocketBase) *cobra.Command {
+	var userFlag string
+	var allFlag bool
+
+	cmd := &cobra.Command{
+		Use:          "reindex",
+		Short:        "Rebuild the vectors for semantic search and chat",
+		Long:         "Rebuild the vectors for semantic search and chat of one user, or with --all of every user with AI features enabled.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if allFlag == (userFlag != "") {
+				return errors.New("pass either --user or --all")
+			}
+			if err := runMigrations(app); err != nil {
+				return err
+			}
+
+			var users []*models.Record
+			if allFlag {
+				records, err := app.Dao().FindRecordsByFilter("users", "id != ''", "created", -1, 0)
+				if err != nil {
+					return err
+				}
+				configService := config.NewConfigService(app)
+				for _, user := range records {
+					if enabled, _ := configService.GetBool(user.Id, "ai.enabled"); enabled {
+						users = append(users, user)
+					}
+				}
+			} else {
+				user, err := findUser(app, userFlag)
+				if err != nil {
+					return err
+				}
+				users = append(users, user)
+			}
+
+			vectorDB, err := embedding.NewVectorDB(app.DataDir())
+			if err != nil {
+				return fmt.Errorf("failed to open the vector database: %w", err)
+			}
+			defer vectorDB.Close()
+			embeddingService := embedding.NewEmbeddingService(app, vectorDB)
+
+			var failed int
+			out := cmd.OutOrStdout()
+			for _, user := range users {
+				result, err := embeddingService.BuildAllVectors(cmd.Context(), user.Id)
+				if err != nil {
+					failed++
+					fmt.Fprintf(out, "%s: %v\n", user.Username(), err)
+					continue
+				}
+				fmt.Fprintf(out, "%s: %d diaries, %d built, %d failed\n", user.Username(), result.Total, result.Success, result.Failed)
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to rebuild the vectors of %d of %d users", failed, len(users))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&userFlag, "user", "", "id, email or username of the user")
+	cmd.Flags().BoolVar(&allFlag, "all", false, "rebuild every user with AI features enabled")
+	return cmd
+}
+
+// usersCommand manages user accounts, for setups where signups are closed
+func usersCommand(app *pocketbase.PocketBase) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "users",
+		Short: "Manage user accounts",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return runMigrations(app)
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List all users",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			users, err := app.Dao().FindRecordsByFilter("users", "id != ''", "created", -1, 0)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tNAME\tCREATED")
+			for _, user := range users {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", user.Id, user.Username(), user.Email(), user.GetString("name"), user.GetDateTime("created").Time().Format("2006-01-02"))
+			}
+			return w.Flush()
+		},
+	})
+
+	var username, name string
+	var createPasswordStdin bool
+	create := &cobra.Command{
+		Use:          "create <email>",
+		Short:        "Create a user, prompting for the password",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := readPassword(cmd, createPasswordStdin)
+			if err != nil {
+				return err
+			}
+
+			collection, err := app.Dao().FindCollectionByNameOrId("users")
+			if err != nil {
+				return err
+			}
+			user := models.NewRecord(collection)
+
+			// The form validates the email, username and password like a signup
+			form := forms.NewRecordUpsert(app, user)
+			form.SetFullManageAccess(true)
+			data := map[string]any{
+				"email":           args[0],
+				"password":        password,
+				"passwordConfirm": password,
+				"name":            name,
+				"verified":        true,
+			}
+			if username != "" {
+				data["username"] = username
+			}
+			if err := form.LoadData(data); err != nil {
+				return err
+			}
+			if err := form.Submit(); err != nil {
+				return fmt.Errorf("failed to create user: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Created user %s (%s)\n", user.Username(), user.Id)
+			return nil
+		},
+	}
+	create.Flags().StringVar(&username, "username", "", "username, generated when empty")
+	create.Flags().StringVar(&name, "name", "", "display name")
+	create.Flags().BoolVar(&createPasswordStdin, "password-stdin", false, "read the password from the first line of stdin")
+	cmd.AddCommand(create)
+
+	var resetPasswordStdin bool
+	resetPassword := &cobra.Command{
+		Use:          "reset-password <user>",
+		Short:        "Set a new password for a user, prompting for it",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := findUser(app, args[0])
+			if err != nil {
+				return err
+			}
+			password, err := readPassword(cmd, resetPasswordStdin)
+			if err != nil {
+				return err
+			}
+
+			form := forms.NewRecordUpsert(app, user)
+			form.SetFullManageAccess(true)
+			if err := form.LoadData(map[string]any{"password": password, "passwordConfirm": password}); err != nil {
+				return err
+			}
+			if err := form.Submit(); err != nil {
+				return fmt.Errorf("failed to reset password: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Password of %s reset, existing sessions are signed out\n", user.Username())
+			return nil
+		},
+	}
+	resetPassword.Flags().BoolVar(&resetPasswordStdin, "password-stdin", false, "read the password from the first line of stdin")
+	cmd.AddCommand(resetPassword)
+
+	var yes bool
+	remove := &cobra.Command{
+		Use:          "delete <user>",
+		Short:        "Delete a user with all their diaries, media and conversations",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := findUser(app, args[0])
+			if err != nil {
+				return err
+			}
+			if !yes {
+				return fmt.Errorf("deleting %s removes all their data, pass --yes to confirm", user.Username())
+			}
+
+			// Owned records are removed by the cascading owner relations
+			if err := app.Dao().DeleteRecord(user); err != nil {
+				return fmt.Errorf("failed to delete user: %w", err)
+			}
+			if vectorDB, err := embedding.NewVectorDB(app.DataDir()); err == nil {
+				if err := vectorDB.DeleteCollection(user.Id); err != nil {
+					log.Printf("Warning: Failed to delete the vectors of %s: %v", user.Id, err)
+				}
+				vectorDB.Close()
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted user %s (%s)\n", user.Username(), user.Id)
+			return nil
+		},
+	}
+	remove.Flags().BoolVar(&yes, "yes", false, "confirm the deletion")
+	cmd.AddCommand(remove)
+
+	return cmd
+}
@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestExportRequest(t *testing.T) {
+	req := exportRequest("1y")
+	if req.DateRange != "1y" || req.StartDate != "" || !req.IncludeDiaries || !req.IncludeMedia || !req.IncludeConversations {
+		t.Errorf("exportRequest(1y) = %+v", req)
+	}
+
+	req = exportRequest("2025-01-01..2025-12-31")
+	if req.DateRange != "custom" || req.StartDate != "2025-01-01" || req.EndDate != "2025-12-31" {
+		t.Errorf("custom range = %+v", req)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/songtianlun/diarum/internal/config"
 	"github.com/songtianlun/diarum/internal/embedding"
 	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/ratelimit"
 )
 
 // ModelInfo represents a model from the API
@@ -35,8 +36,68 @@ type ModelsResponse struct {
 	Data   []ModelInfo `json:"data"`
 }
 
+// AISettings are the AI provider settings of a user
+type AISettings struct {
+	APIKey         string `json:"api_key"`
+	BaseURL        string `json:"base_url"`
+	ChatModel      string `json:"chat_model"`
+	EmbeddingModel string `json:"embedding_model"`
+	Enabled        bool   `json:"enabled"`
+}
+
+// ModelsRequest asks an OpenAI-compatible API for its models
+type ModelsRequest struct {
+	APIKey  string `json:"api_key"`
+	BaseURL string `json:"base_url"`
+}
+
+// ModelList lists the models of an OpenAI-compatible API
+type ModelList struct {
+	Models []ModelInfo `json:"models"`
+}
+
+// Conversation is an AI chat conversation
+type Conversation struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Created string `json:"created"`
+	Updated string `json:"updated"`
+}
+
+// ConversationSummary is a conversation in the conversation list
+type ConversationSummary struct {
+	Conversation
+	MessageCount int `json:"message_count"`
+}
+
+// ConversationTitle creates or renames a conversation
+type ConversationTitle struct {
+	Title string `json:"title"`
+}
+
+// ChatMessage is a message of a conversation
+type ChatMessage struct {
+	ID                string   `json:"id"`
+	Role              string   `json:"role"`
+	Content           string   `json:"content"`
+	ReferencedDiaries []string `json:"referenced_diaries"`
+	Created           string   `json:"created"`
+}
+
+// ConversationDetail is a conversation with its messages
+type ConversationDetail struct {
+	Conversation Conversation  `json:"conversation"`
+	Messages     []ChatMessage `json:"messages"`
+}
+
+// ChatRequest sends a message to a conversation
+type ChatRequest struct {
+	ConversationID string `json:"conversation_id"`
+	Content        string `json:"content"`
+}
+
 // RegisterAIRoutes registers AI-related API endpoints
-func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService) {
+func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService, rateLimits *ratelimit.Limits) {
 	configService := config.NewConfigService(app)
 
 	// Get AI settings
@@ -54,12 +115,12 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 		embeddingModel, _ := configService.GetString(userId, "ai.embedding_model")
 		enabled, _ := configService.GetBool(userId, "ai.enabled")
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"api_key":         apiKey,
-			"base_url":        baseUrl,
-			"chat_model":      chatModel,
-			"embedding_model": embeddingModel,
-			"enabled":         enabled,
+		return c.JSON(http.StatusOK, AISettings{
+			APIKey:         apiKey,
+			BaseURL:        baseUrl,
+			ChatModel:      chatModel,
+			EmbeddingModel: embeddingModel,
+			Enabled:        enabled,
 		})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
@@ -72,13 +133,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 
 		userId := authRecord.Id
 
-		var body struct {
-			APIKey         string `json:"api_key"`
-			BaseURL        string `json:"base_url"`
-			ChatModel      string `json:"chat_model"`
-			EmbeddingModel string `json:"embedding_model"`
-			Enabled        bool   `json:"enabled"`
-		}
+		var body AISettings
 		if err := c.Bind(&body); err != nil {
 			return apis.NewBadRequestError("Invalid request body", err)
 		}
@@ -102,9 +157,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewBadRequestError("Failed to save AI settings", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"success": true,
-		})
+		return c.JSON(http.StatusOK, SuccessResponse{Success: true})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Fetch models from OpenAI-compatible API
@@ -114,10 +167,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
 		}
 
-		var body struct {
-			APIKey  string `json:"api_key"`
-			BaseURL string `json:"base_url"`
-		}
+		var body ModelsRequest
 		if err := c.Bind(&body); err != nil {
 			return apis.NewBadRequestError("Invalid request body", err)
 		}
@@ -132,9 +182,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewBadRequestError("Failed to fetch models: "+err.Error(), nil)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"models": models,
-		})
+		return c.JSON(http.StatusOK, ModelList{Models: models})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Build all vectors for user's diaries
@@ -161,7 +209,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 		}
 
 		return c.JSON(http.StatusOK, result)
-	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth(), RateLimit(rateLimits, ratelimit.GroupVectors))
 
 	// Initialize chat service
 	chatService := chat.NewChatService(app, embeddingService)
@@ -189,7 +237,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 		}
 
 		return c.JSON(http.StatusOK, result)
-	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth(), RateLimit(rateLimits, ratelimit.GroupVectors))
 
 	// Get vector stats for user's diaries
 	e.Router.GET("/api/ai/vectors/stats", func(c echo.Context) error {
@@ -232,16 +280,13 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewBadRequestError("Failed to fetch conversations", err)
 		}
 
-		result := make([]map[string]any, 0, len(conversations))
+		result := make([]ConversationSummary, 0, len(conversations))
 		for _, conv := range conversations {
 			// Get message count for this conversation
 			messageCount, _ := chatService.GetConversationMessageCount(conv.Id)
-			result = append(result, map[string]any{
-				"id":            conv.Id,
-				"title":         conv.GetString("title"),
-				"created":       conv.Created.String(),
-				"updated":       conv.Updated.String(),
-				"message_count": messageCount,
+			result = append(result, ConversationSummary{
+				Conversation: conversationJSON(conv),
+				MessageCount: messageCount,
 			})
 		}
 
@@ -255,9 +300,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
 		}
 
-		var body struct {
-			Title string `json:"title"`
-		}
+		var body ConversationTitle
 		c.Bind(&body)
 
 		collection, err := app.Dao().FindCollectionByNameOrId("ai_conversations")
@@ -273,12 +316,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewBadRequestError("Failed to create conversation", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"id":      record.Id,
-			"title":   record.GetString("title"),
-			"created": record.Created.String(),
-			"updated": record.Updated.String(),
-		})
+		return c.JSON(http.StatusOK, conversationJSON(record))
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Get conversation with messages
@@ -310,25 +348,20 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewBadRequestError("Failed to fetch messages", err)
 		}
 
-		msgList := make([]map[string]any, 0, len(messages))
+		msgList := make([]ChatMessage, 0, len(messages))
 		for _, msg := range messages {
-			msgList = append(msgList, map[string]any{
-				"id":                 msg.Id,
-				"role":               msg.GetString("role"),
-				"content":            msg.GetString("content"),
-				"referenced_diaries": msg.Get("referenced_diaries"),
-				"created":            msg.Created.String(),
+			msgList = append(msgList, ChatMessage{
+				ID:                msg.Id,
+				Role:              msg.GetString("role"),
+				Content:           msg.GetString("content"),
+				ReferencedDiaries: msg.GetStringSlice("referenced_diaries"),
+				Created:           msg.Created.String(),
 			})
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"conversation": map[string]any{
-				"id":      conv.Id,
-				"title":   conv.GetString("title"),
-				"created": conv.Created.String(),
-				"updated": conv.Updated.String(),
-			},
-			"messages": msgList,
+		return c.JSON(http.StatusOK, ConversationDetail{
+			Conversation: conversationJSON(conv),
+			Messages:     msgList,
 		})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
@@ -353,7 +386,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewBadRequestError("Failed to delete conversation", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{"success": true})
+		return c.JSON(http.StatusOK, SuccessResponse{Success: true})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Update conversation title
@@ -373,9 +406,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewForbiddenError("Access denied", nil)
 		}
 
-		var body struct {
-			Title string `json:"title"`
-		}
+		var body ConversationTitle
 		if err := c.Bind(&body); err != nil {
 			return apis.NewBadRequestError("Invalid request body", err)
 		}
@@ -385,11 +416,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewBadRequestError("Failed to update conversation", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"id":      conv.Id,
-			"title":   conv.GetString("title"),
-			"updated": conv.Updated.String(),
-		})
+		return c.JSON(http.StatusOK, conversationJSON(conv))
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Streaming chat endpoint
@@ -399,10 +426,7 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
 		}
 
-		var body struct {
-			ConversationID string `json:"conversation_id"`
-			Content        string `json:"content"`
-		}
+		var body ChatRequest
 		if err := c.Bind(&body); err != nil {
 			return apis.NewBadRequestError("Invalid request body", err)
 		}
@@ -498,7 +522,17 @@ func RegisterAIRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingS
 		writer.Flush()
 
 		return nil
-	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth(), RateLimit(rateLimits, ratelimit.GroupAIChat))
+}
+
+// conversationJSON is the API representation of a conversation
+func conversationJSON(record *models.Record) Conversation {
+	return Conversation{
+		ID:      record.Id,
+		Title:   record.GetString("title"),
+		Created: record.Created.String(),
+		Updated: record.Updated.String(),
+	}
 }
 
 // fetchModels fetches available models from an OpenAI-compatible API
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/apitoken"
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/ical"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/openapi"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+const (
+	// maxCalendarImportSize is the largest .ics file accepted by the import
+	maxCalendarImportSize = 10 * 1024 * 1024
+	// calendarDescriptionLines is the number of text lines of an entry shown in its event
+	calendarDescriptionLines = 3
+	// calendarEventsHeading starts the section an import adds to a day
+	calendarEventsHeading = "Events of the day"
+)
+
+// Calendar import modes
+const (
+	// calendarModeAppend creates entries for days without one and appends to the last entry of other days
+	calendarModeAppend = "append"
+	// calendarModePrefill only creates entries for days without one
+	calendarModePrefill = "prefill"
+)
+
+// CalendarImportUpload is the multipart form of a calendar import
+type CalendarImportUpload struct {
+	File openapi.Binary `json:"file"`
+	// Mode is "append" (default) or "prefill"
+	Mode string `json:"mode,omitempty"`
+	// Start and End limit the imported days, YYYY-MM-DD
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// CalendarImportResult counts what a calendar import did
+type CalendarImportResult struct {
+	Events   int `json:"events"`
+	Days     int `json:"days"`
+	Created  int `json:"created"`
+	Appended int `json:"appended"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// RegisterCalendarRoutes registers the calendar feed of diary entries and the import of calendar files
+func RegisterCalendarRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, rateLimits *ratelimit.Limits) {
+	configService := config.NewConfigService(app)
+	tokenService := apitoken.NewTokenService(app)
+
+	// One all-day event per entry, to subscribe to in calendar apps with ?token=.
+	// Private and trashed entries are never included, ?tag= and ?mood= filter like the feeds.
+	e.Router.GET("/api/v1/calendar.ics", func(c echo.Context) error {
+		userId, err := publicUser(c, tokenService, apitoken.ScopeDiariesRead)
+		if err != nil {
+			return err
+		}
+
+		filter, filterParams := feedFilter(c, userId)
+		records, err := app.Dao().FindRecordsByFilter("diaries", filter, diaryEntrySort, -1, 0, filterParams)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query diaries"})
+		}
+
+		user, err := app.Dao().FindRecordById("users", userId)
+		if err != nil {
+			return apis.NewNotFoundError("User not found", nil)
+		}
+
+		base := c.Scheme() + "://" + c.Request().Host
+		cal := &ical.Calendar{
+			ProdID: "-//Diarum//Diary//EN",
+			Name:   displayName(user) + "'s diary",
+			Events: make([]ical.Event, 0, len(records)),
+		}
+		tagNames := getTagNamesBatch(app.Dao(), records)
+		for _, record := range records {
+			cal.Events = append(cal.Events, calendarEvent(record, tagNames[record.Id], base))
+		}
+
+		return c.Blob(http.StatusOK, ical.ContentType, cal.Encode())
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+
+	// Import the events of an .ics file as "events of the day" sections.
+	// Days without an entry get a new one, mode=append also adds the section to the last
+	// entry of other days. A day already holding the same section is skipped, so a file
+	// can be imported again.
+	e.Router.POST("/api/import/ics", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+		return importCalendar(app, c, configService, authRecord.Id)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
+
+// calendarEvent converts a diary entry into an all-day event
+func calendarEvent(record *models.Record, tags []string, base string) ical.Event {
+	diary := diaryEntry(record, tags)
+
+	summary := "Diary"
+	if diary.Time != "" {
+		summary = diary.Time + " " + summary
+	}
+	if diary.Mood != "" {
+		summary += " · " + diary.Mood
+	}
+
+	link := base + "/diary/" + diary.Date
+	var lines []string
+	for _, line := range strings.Split(textutil.StripHTML(diary.Content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, truncateRunes(line, feedSummaryLength))
+		}
+		if len(lines) == calendarDescriptionLines {
+			break
+		}
+	}
+	lines = append(lines, "", link)
+
+	start, _ := time.Parse(dateutil.DayLayout, diary.Date)
+	return ical.Event{
+		UID:         record.Id + "@diarum",
+		Summary:     summary,
+		Description: strings.TrimSpace(strings.Join(lines, "\n")),
+		URL:         link,
+		Categories:  diary.Tags,
+		Start:       start,
+		AllDay:      true,
+		Stamp:       record.GetDateTime("updated").Time(),
+	}
+}
+
+// importCalendar adds the events of an uploaded .ics file to the days they take place on
+func importCalendar(app *pocketbase.PocketBase, c echo.Context, configService *config.ConfigService, userID string) error {
+	mode := c.FormValue("mode")
+	switch mode {
+	case "":
+		mode = calendarModeAppend
+	case calendarModeAppend, calendarModePrefill:
+	default:
+		return apis.NewBadRequestError("Invalid mode, expected append or prefill", nil)
+	}
+	start, end := c.FormValue("start"), c.FormValue("end")
+	if (start != "" && !dateutil.ValidDay(start)) || (end != "" && !dateutil.ValidDay(end)) {
+		return apis.NewBadRequestError("Invalid date, expected YYYY-MM-DD", nil)
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return apis.NewBadRequestError("Missing upload file", err)
+	}
+	if fh.Size > maxCalendarImportSize {
+		return apis.NewBadRequestError("File too large (max 10MB)", nil)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return apis.NewBadRequestError("Failed to open upload", err)
+	}
+	defer f.Close()
+
+	loc := userLocation(c, configService, userID)
+	events, err := ical.Parse(io.LimitReader(f, maxCalendarImportSize), loc)
+	if err != nil {
+		return apis.NewBadRequestError("Failed to read calendar: "+err.Error(), nil)
+	}
+
+	// Group the events by the days they take place on
+	byDay := map[string][]ical.Event{}
+	result := CalendarImportResult{}
+	for _, event := range events {
+		if event.Cancelled() {
+			continue
+		}
+		result.Events++
+		for _, day := range event.Days(loc) {
+			if (start != "" && day < start) || (end != "" && day > end) {
+				continue
+			}
+			byDay[day] = append(byDay[day], event)
+		}
+	}
+	days := make([]string, 0, len(byDay))
+	for day := range byDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	result.Days = len(days)
+
+	collection, err := app.Dao().FindCollectionByNameOrId("diaries")
+	if err != nil {
+		return apis.NewBadRequestError("Failed to find diaries collection", err)
+	}
+
+	for _, day := range days {
+		section := calendarSection(day, byDay[day], loc)
+
+		records, err := findDayEntries(app, userID, day, "")
+		if err != nil {
+			result.Failed++
+			continue
+		}
+
+		if len(records) == 0 {
+			record := models.NewRecord(collection)
+			record.Set("owner", userID)
+			input := diaryInput{Date: &day, Content: &section}
+			if err := input.apply(app.Dao(), record, loc); err != nil {
+				result.Failed++
+				continue
+			}
+			if err := app.Dao().SaveRecord(record); err != nil {
+				logger.Error("[Calendar Import] failed to create diary %s for user %s: %v", day, userID, err)
+				result.Failed++
+				continue
+			}
+			if err := triggerRecordCreated(app, c, record); err != nil {
+				logger.Warn("[Calendar Import] after-create hooks failed for diary %s: %v", record.Id, err)
+			}
+			result.Created++
+			continue
+		}
+
+		if mode == calendarModePrefill || dayHasSection(records, section) {
+			result.Skipped++
+			continue
+		}
+
+		record := records[len(records)-1]
+		record.Set("content", record.GetString("content")+section)
+		if err := app.Dao().SaveRecord(record); err != nil {
+			logger.Error("[Calendar Import] failed to update diary %s: %v", record.Id, err)
+			result.Failed++
+			continue
+		}
+		if err := triggerRecordUpdated(app, c, record); err != nil {
+			logger.Warn("[Calendar Import] after-update hooks failed for diary %s: %v", record.Id, err)
+		}
+		result.Appended++
+	}
+
+	logger.Info("[Calendar Import] completed for user %s: %+v", userID, result)
+	return c.JSON(http.StatusOK, result)
+}
+
+// calendarSection renders the events of a day as an HTML section, all-day events first
+func calendarSection(day string, events []ical.Event, loc *time.Location) string {
+	events = append([]ical.Event(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].AllDay != events[j].AllDay {
+			return events[i].AllDay
+		}
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	var sb strings.Builder
+	sb.WriteString("<h3>" + calendarEventsHeading + "</h3><ul>")
+	for _, event := range events {
+		summary := strings.TrimSpace(event.Summary)
+		if summary == "" {
+			summary = "(untitled)"
+		}
+		item := html.EscapeString(summary)
+		if !event.AllDay {
+			item = calendarEventTime(day, event, loc) + " " + item
+		}
+		if location := strings.TrimSpace(event.Location); location != "" {
+			item += " (" + html.EscapeString(location) + ")"
+		}
+		sb.WriteString("<li>" + item + "</li>")
+	}
+	sb.WriteString("</ul>")
+	return sb.String()
+}
+
+// calendarEventTime formats the hours of a timed event on day, e.g. "09:00–09:15".
+// An event continuing from or into another day shows the day boundary instead.
+func calendarEventTime(day string, event ical.Event, loc *time.Location) string {
+	start := event.Start.In(loc)
+	from := start.Format(dateutil.TimeLayout)
+	if start.Format(dateutil.DayLayout) != day {
+		from = "00:00"
+	}
+	if !event.End.After(event.Start) {
+		return from
+	}
+
+	end := event.End.In(loc)
+	to := end.Format(dateutil.TimeLayout)
+	if end.Format(dateutil.DayLayout) != day {
+		to = "24:00"
+	}
+	return fmt.Sprintf("%s–%s", from, to)
+}
+
+// dayHasSection reports whether an entry of the day already holds the section
+func dayHasSection(records []*models.Record, section string) bool {
+	for _, record := range records {
+		if strings.Contains(record.GetString("content"), section) {
+			return true
+		}
+	}
+	return false
+}
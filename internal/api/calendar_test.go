@@ -0,0 +1,39 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/songtianlun/diarum/internal/ical"
+)
+
+func TestCalendarSection(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+	at := func(day, clock string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", day+" "+clock, berlin)
+		return t
+	}
+
+	events := []ical.Event{
+		{Summary: "Dentist", Location: "Main St <3>", Start: at("2026-01-05", "14:00"), End: at("2026-01-05", "14:30")},
+		{Summary: "Standup", Start: at("2026-01-05", "09:00")},
+		{Summary: "Holiday", AllDay: true, Start: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{Summary: "Night train", Start: at("2026-01-04", "22:00"), End: at("2026-01-05", "06:00")},
+	}
+	want := "<h3>Events of the day</h3><ul>" +
+		"<li>Holiday</li>" +
+		"<li>00:00–06:00 Night train</li>" +
+		"<li>09:00 Standup</li>" +
+		"<li>14:00–14:30 Dentist (Main St &lt;3&gt;)</li>" +
+		"</ul>"
+	if got := calendarSection("2026-01-05", events, berlin); got != want {
+		t.Errorf("calendarSection() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := calendarEventTime("2026-01-04", events[3], berlin); got != "22:00–24:00" {
+		t.Errorf("first day of an overnight event = %q", got)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/revision"
+)
+
+// DiaryETag is the entity tag of a diary version, clients send it back as If-Match.
+// It is the updated timestamp in RFC 3339, entity tags can't contain spaces.
+func DiaryETag(record *models.Record) string {
+	return `"` + record.GetDateTime("updated").Time().Format(time.RFC3339Nano) + `"`
+}
+
+// DiaryConflict is the 409 response to a write based on an outdated version of a diary
+type DiaryConflict struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Server  *DiaryRecord `json:"server"`
+	// Merge suggests a merge of the client's and the server content, when the write carries content
+	Merge *revision.MergeResult `json:"merge,omitempty"`
+}
+
+// diaryBaseVersion returns the diary version a write was based on: the If-Match header or
+// the updated field of the request body. It is empty when the client sent neither,
+// such writes are applied unconditionally.
+func diaryBaseVersion(c echo.Context) string {
+	if match := strings.TrimSpace(c.Request().Header.Get("If-Match")); match != "" && match != "*" {
+		return strings.Trim(strings.TrimPrefix(match, "W/"), `"`)
+	}
+	if updated, ok := apis.RequestInfo(c).Data["updated"].(string); ok {
+		return updated
+	}
+	return ""
+}
+
+// DiaryWriteBased reports whether a write carried the version of the diary it was based on
+func DiaryWriteBased(c echo.Context) bool {
+	return c != nil && diaryBaseVersion(c) != ""
+}
+
+// DiaryWriteConflict checks a write against the version of the diary the client last saw.
+// When the diary has changed since, it answers 409 with the current server copy and,
+// if the write carries content, a suggested merge of both contents, and reports true.
+// diary is the stored record before the write, content the client's new content or nil.
+func DiaryWriteConflict(c echo.Context, dao *daos.Dao, revisionService *revision.RevisionService, diary *models.Record, content *string) (bool, error) {
+	base := diaryBaseVersion(c)
+	if base == "" || sameUpdated(diary, base) {
+		return false, nil
+	}
+
+	body := DiaryConflict{
+		Code:    http.StatusConflict,
+		Message: "The diary was changed since you last loaded it.",
+		Server:  diaryRecordJSON(dao, diary),
+	}
+	if content != nil {
+		merge := diaryMerge(revisionService, diary, base, *content)
+		body.Merge = &merge
+	}
+
+	c.Response().Header().Set("ETag", DiaryETag(diary))
+	return true, c.JSON(http.StatusConflict, body)
+}
+
+// diaryMerge suggests a merge of a client's content, based on an outdated version, with the diary
+func diaryMerge(revisionService *revision.RevisionService, diary *models.Record, base, content string) revision.MergeResult {
+	// An unparsable base leaves the zero time, which has no revision, so it merges without a base
+	parsed, _ := types.ParseDateTime(base)
+	return revisionService.MergeSuggestion(diary, parsed, content)
+}
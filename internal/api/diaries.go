@@ -2,17 +2,82 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
 	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/search"
+	"github.com/songtianlun/diarum/internal/stats"
 )
 
+// DiaryEntry is the API representation of a single diary entry
+type DiaryEntry struct {
+	ID      string   `json:"id"`
+	Date    string   `json:"date"`
+	Time    string   `json:"time"`
+	Content string   `json:"content"`
+	Mood    string   `json:"mood"`
+	Weather string   `json:"weather"`
+	Tags    []string `json:"tags"`
+	Private bool     `json:"private"`
+}
+
+// DiaryDay lists the entries of a day in order.
+// The fields of the first entry are also set at the top level for clients that expect a single diary per day.
+type DiaryDay struct {
+	DiaryEntry
+	Exists  bool         `json:"exists"`
+	Entries []DiaryEntry `json:"entries"`
+	Count   int          `json:"count"`
+}
+
+// DiaryDates lists the days that have diary entries
+type DiaryDates struct {
+	Dates []string `json:"dates"`
+}
+
+// DiaryStreak summarizes the writing streak of a user
+type DiaryStreak struct {
+	Total         int `json:"total"`
+	Streak        int `json:"streak"`
+	LongestStreak int `json:"longest_streak"`
+}
+
+// SearchResult is a diary matching a search
+type SearchResult struct {
+	ID      string   `json:"id"`
+	Date    string   `json:"date"`
+	Time    string   `json:"time"`
+	Snippet string   `json:"snippet"`
+	Score   float64  `json:"score"`
+	Mood    string   `json:"mood"`
+	Weather string   `json:"weather"`
+	Tags    []string `json:"tags"`
+}
+
+// SearchResults is a page of search results in ranking order
+type SearchResults struct {
+	Query      *search.Query  `json:"query"`
+	Results    []SearchResult `json:"results"`
+	Total      int            `json:"total"`
+	Page       int            `json:"page"`
+	PerPage    int            `json:"perPage"`
+	TotalPages int            `json:"totalPages"`
+}
+
 // RegisterDiaryRoutes registers custom API endpoints for diary operations
 func RegisterDiaryRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
+	configService := config.NewConfigService(app)
+
 	// Get diary by date
 	e.Router.GET("/api/diaries/by-date/:date", func(c echo.Context) error {
 		dateStr := c.PathParam("date")
@@ -25,40 +90,22 @@ func RegisterDiaryRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 
 		userId := authRecord.Id
 
-		// Parse date and create time range for the entire day
-		// Input format: "2026-01-28"
-		// Create range: "2026-01-28 00:00:00" to "2026-01-28 23:59:59"
-		startTime := dateStr + " 00:00:00.000Z"
-		endTime := dateStr + " 23:59:59.999Z"
-
-		// Query diary by date range and owner
-		record, err := app.Dao().FindFirstRecordByFilter(
-			"diaries",
-			"date >= {:start} && date <= {:end} && owner = {:owner}",
-			map[string]any{
-				"start": startTime,
-				"end":   endTime,
-				"owner": userId,
-			},
-		)
+		// Diary dates are calendar days, see dateutil
+		// Input format: "2026-01-28", "today" is resolved in the user's timezone
+		if dateStr == "today" {
+			dateStr = dateutil.Today(userLocation(c, configService, userId))
+		}
+		if !dateutil.ValidDay(dateStr) {
+			return apis.NewBadRequestError("Invalid date, expected YYYY-MM-DD", nil)
+		}
 
+		// Query all entries of the day in order
+		records, err := findDayEntries(app, userId, dateStr, "")
 		if err != nil {
-			// Return empty diary if not found
-			return c.JSON(http.StatusOK, map[string]any{
-				"date":    dateStr,
-				"content": "",
-				"exists":  false,
-			})
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query diaries"})
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"id":      record.GetId(),
-			"date":    dateStr, // Return original date format
-			"content": record.GetString("content"),
-			"mood":    record.GetString("mood"),
-			"weather": record.GetString("weather"),
-			"exists":  true,
-		})
+		return c.JSON(http.StatusOK, dayResponse(app, dateStr, records))
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Check which dates have diaries
@@ -76,52 +123,53 @@ func RegisterDiaryRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 
 		// Parse date range
 		if start == "" || end == "" {
-			// Default to current month
-			now := time.Now()
-			start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
-			end = time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+			// Default to the current month in the user's timezone
+			today := dateutil.TodayDate(userLocation(c, configService, userId))
+			start = time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC).Format(dateutil.DayLayout)
+			end = time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, time.UTC).Format(dateutil.DayLayout)
 		}
 
 		// Convert to full timestamp range
-		startTime := start + " 00:00:00.000Z"
-		endTime := end + " 23:59:59.999Z"
+		startTime := dateutil.DayStart(start)
+		endTime := dateutil.DayEnd(end)
+
+		// Query all diaries in date range, optionally narrowed to a tag
+		filterParams := map[string]any{
+			"start": startTime,
+			"end":   endTime,
+			"owner": userId,
+		}
+		filter := appendTagFilter("date >= {:start} && date <= {:end} && owner = {:owner} && deleted_at = ''", filterParams, c.QueryParam("tag"))
 
-		// Query all diaries in date range
 		records, err := app.Dao().FindRecordsByFilter(
 			"diaries",
-			"date >= {:start} && date <= {:end} && owner = {:owner}",
+			filter,
 			"-date",
 			-1,
 			0,
-			map[string]any{
-				"start": startTime,
-				"end":   endTime,
-				"owner": userId,
-			},
+			filterParams,
 		)
 
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": "Failed to query diaries",
-			})
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query diaries"})
 		}
 
-		// Extract dates (convert from timestamp to YYYY-MM-DD format)
+		// Extract dates (convert from timestamp to YYYY-MM-DD format), a day may hold several entries
 		dates := make([]string, 0, len(records))
+		seen := make(map[string]bool, len(records))
 		for _, record := range records {
-			dateTime := record.GetString("date")
-			// Extract just the date part (YYYY-MM-DD) from "YYYY-MM-DD HH:MM:SS.SSSZ"
-			if len(dateTime) >= 10 {
-				dates = append(dates, dateTime[:10])
+			day := dateutil.DayOf(record.GetString("date"))
+			if !seen[day] {
+				seen[day] = true
+				dates = append(dates, day)
 			}
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"dates": dates,
-		})
+		return c.JSON(http.StatusOK, DiaryDates{Dates: dates})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Get diary stats (streak and total)
+	statsService := stats.NewStatsService(app)
 	e.Router.GET("/api/diaries/stats", func(c echo.Context) error {
 		// Get authenticated user
 		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
@@ -131,82 +179,22 @@ func RegisterDiaryRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 
 		userId := authRecord.Id
 
-		// Get timezone from query param, default to UTC
-		tz := c.QueryParam("tz")
-		loc := time.UTC
-		if tz != "" {
-			if parsedLoc, err := time.LoadLocation(tz); err == nil {
-				loc = parsedLoc
-			}
-		}
-
-		// Get total count using COUNT query for better performance
-		var total int
-		err := app.Dao().DB().
-			NewQuery("SELECT COUNT(*) FROM diaries WHERE owner = {:owner}").
-			Bind(map[string]any{"owner": userId}).
-			Row(&total)
+		// Streaks follow the user's timezone, the full report is served by /api/stats
+		report, err := statsService.Get(userId, userLocation(c, configService, userId), stats.PeriodMonth)
 		if err != nil {
-			total = 0
-		}
-
-		// Calculate streak - only fetch recent records (last 365 days max)
-		streak := 0
-		now := time.Now().In(loc)
-		today := now.Format("2006-01-02")
-		oneYearAgo := now.AddDate(-1, 0, 0).Format("2006-01-02")
-
-		records, err := app.Dao().FindRecordsByFilter(
-			"diaries",
-			"owner = {:owner} && date >= {:start}",
-			"-date",
-			365,
-			0,
-			map[string]any{
-				"owner": userId,
-				"start": oneYearAgo + " 00:00:00.000Z",
-			},
-		)
-
-		if err == nil && len(records) > 0 {
-			// Create a set of dates for quick lookup
-			dateSet := make(map[string]bool)
-			for _, record := range records {
-				dateTime := record.GetString("date")
-				if len(dateTime) >= 10 {
-					dateSet[dateTime[:10]] = true
-				}
-			}
-
-			// Start counting from today or yesterday
-			yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
-			var checkDate time.Time
-			if dateSet[today] {
-				checkDate = now
-			} else if dateSet[yesterday] {
-				checkDate = now.AddDate(0, 0, -1)
-			}
-
-			if !checkDate.IsZero() {
-				for {
-					dateStr := checkDate.Format("2006-01-02")
-					if dateSet[dateStr] {
-						streak++
-						checkDate = checkDate.AddDate(0, 0, -1)
-					} else {
-						break
-					}
-				}
-			}
+			logger.Error("[Stats] failed to compute statistics for user %s: %v", userId, err)
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute statistics"})
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"total":  total,
-			"streak": streak,
+		return c.JSON(http.StatusOK, DiaryStreak{
+			Total:         report.Total,
+			Streak:        report.CurrentStreak.Days,
+			LongestStreak: report.LongestStreak.Days,
 		})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
-	// Search diaries
+	// Search diaries with full-text ranking and highlighted snippets
+	searchService := search.NewSearchService(app)
 	e.Router.GET("/api/diaries/search", func(c echo.Context) error {
 		query := c.QueryParam("q")
 
@@ -222,54 +210,158 @@ func RegisterDiaryRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 
 		userId := authRecord.Id
 
-		// Search in content
-		records, err := app.Dao().FindRecordsByFilter(
-			"diaries",
-			"content ~ {:query} && owner = {:owner}",
-			"-date",
-			50, // Limit to 50 results
-			0,
-			map[string]any{
-				"query": query,
-				"owner": userId,
-			},
-		)
+		// Pagination, following PocketBase list conventions
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		if page < 1 {
+			page = 1
+		}
+		perPage, _ := strconv.Atoi(c.QueryParam("perPage"))
+		if perPage < 1 {
+			perPage = 20
+		}
+		if perPage > 100 {
+			perPage = 100
+		}
 
+		// Parse the structured query, the tag parameter narrows it further
+		parsed, err := search.ParseQuery(query)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": "Search failed",
-			})
+			return apis.NewBadRequestError("Invalid search query: "+err.Error(), nil)
+		}
+		if tag := normalizeTagName(c.QueryParam("tag")); tag != "" {
+			parsed.Tags = append(parsed.Tags, tag)
+		}
+		if parsed.IsEmpty() {
+			return apis.NewBadRequestError("Query parameter 'q' is required", nil)
 		}
 
-		// Format results
-		results := make([]map[string]any, 0, len(records))
-		for _, record := range records {
-			content := record.GetString("content")
-			// Get snippet (first 200 chars)
-			snippet := content
-			if len(content) > 200 {
-				snippet = content[:200] + "..."
+		opts := parsed.Options(userId)
+		opts.SortByDate = c.QueryParam("sort") == "date"
+		opts.Limit = perPage
+		opts.Offset = (page - 1) * perPage
+
+		hits, total, err := searchService.Search(opts)
+		if err != nil {
+			logger.Error("[GET /api/diaries/search] error: %v", err)
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Search failed"})
+		}
+
+		// Load the matched diaries for mood, weather and tags
+		ids := make([]string, 0, len(hits))
+		for _, hit := range hits {
+			ids = append(ids, hit.ID)
+		}
+		recordsByID := make(map[string]*models.Record, len(hits))
+		if len(ids) > 0 {
+			records, err := app.Dao().FindRecordsByIds("diaries", ids)
+			if err == nil {
+				for _, record := range records {
+					recordsByID[record.Id] = record
+				}
 			}
+		}
 
-			// Extract date part from timestamp
-			dateTime := record.GetString("date")
-			dateStr := dateTime
-			if len(dateTime) >= 10 {
-				dateStr = dateTime[:10]
+		// Format results in ranking order
+		records := make([]*models.Record, 0, len(recordsByID))
+		for _, record := range recordsByID {
+			records = append(records, record)
+		}
+		tagNames := getTagNamesBatch(app.Dao(), records)
+		results := make([]SearchResult, 0, len(hits))
+		for _, hit := range hits {
+			record, ok := recordsByID[hit.ID]
+			if !ok {
+				continue
 			}
 
-			results = append(results, map[string]any{
-				"id":      record.GetId(),
-				"date":    dateStr,
-				"snippet": snippet,
-				"mood":    record.GetString("mood"),
-				"weather": record.GetString("weather"),
+			results = append(results, SearchResult{
+				ID:      hit.ID,
+				Date:    hit.Date,
+				Time:    record.GetString("time"),
+				Snippet: hit.Snippet,
+				Score:   hit.Score,
+				Mood:    record.GetString("mood"),
+				Weather: record.GetString("weather"),
+				Tags:    tagNames[record.Id],
 			})
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"results": results,
-			"total":   len(results),
+		return c.JSON(http.StatusOK, SearchResults{
+			Query:      parsed,
+			Results:    results,
+			Total:      total,
+			Page:       page,
+			PerPage:    perPage,
+			TotalPages: (total + perPage - 1) / perPage,
 		})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 }
+
+// diaryEntrySort orders diary entries within a day, entries without a time come first
+const diaryEntrySort = "date,time,created"
+
+// findDayEntries loads the user's live diary entries of a calendar day, optionally narrowed to a tag
+func findDayEntries(app *pocketbase.PocketBase, userID, day, tag string) ([]*models.Record, error) {
+	params := map[string]any{
+		"start": dateutil.DayStart(day),
+		"end":   dateutil.DayEnd(day),
+		"owner": userID,
+	}
+	filter := appendTagFilter("date >= {:start} && date <= {:end} && owner = {:owner} && deleted_at = ''", params, tag)
+	return app.Dao().FindRecordsByFilter("diaries", filter, diaryEntrySort, -1, 0, params)
+}
+
+// diaryEntryJSON is the API representation of a single diary entry
+func diaryEntryJSON(dao *daos.Dao, record *models.Record) DiaryEntry {
+	return diaryEntry(record, getTagNames(dao, record))
+}
+
+// diaryEntriesJSON is the API representation of a list of diary entries, their tags are loaded in one query
+func diaryEntriesJSON(dao *daos.Dao, records []*models.Record) []DiaryEntry {
+	tagNames := getTagNamesBatch(dao, records)
+	entries := make([]DiaryEntry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, diaryEntry(record, tagNames[record.Id]))
+	}
+	return entries
+}
+
+// diaryEntry builds the API representation of a diary entry with the names of its tags
+func diaryEntry(record *models.Record, tags []string) DiaryEntry {
+	return DiaryEntry{
+		ID:      record.GetId(),
+		Date:    dateutil.DayOf(record.GetString("date")),
+		Time:    record.GetString("time"),
+		Content: record.GetString("content"),
+		Mood:    record.GetString("mood"),
+		Weather: record.GetString("weather"),
+		Tags:    tags,
+		Private: record.GetBool("private"),
+	}
+}
+
+// dayResponse lists the entries of a day in order
+func dayResponse(app *pocketbase.PocketBase, day string, records []*models.Record) DiaryDay {
+	entries := diaryEntriesJSON(app.Dao(), records)
+
+	response := DiaryDay{
+		DiaryEntry: DiaryEntry{Tags: []string{}},
+		Exists:     len(entries) > 0,
+		Entries:    entries,
+		Count:      len(entries),
+	}
+	if len(entries) > 0 {
+		response.DiaryEntry = entries[0]
+	}
+	response.Date = day
+	return response
+}
+
+// userLocation returns the timezone for a user's date logic.
+// The user.timezone setting wins, the tz query parameter sent by clients is the fallback.
+func userLocation(c echo.Context, configService *config.ConfigService, userID string) *time.Location {
+	if configService.HasTimezone(userID) {
+		return configService.GetLocation(userID)
+	}
+	return dateutil.LoadLocation(c.QueryParam("tz"))
+}
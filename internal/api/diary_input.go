@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/dateutil"
+)
+
+// maxDiaryFieldLength is the longest mood or weather value the diaries schema accepts
+const maxDiaryFieldLength = 50
+
+// diaryInput is a diary written through a custom endpoint.
+// Fields left nil keep their current value on update.
+type diaryInput struct {
+	Date    *string   `json:"date"`
+	Time    *string   `json:"time"`
+	Content *string   `json:"content"`
+	Mood    *string   `json:"mood"`
+	Weather *string   `json:"weather"`
+	Tags    *[]string `json:"tags"`
+	Private *bool     `json:"private"`
+}
+
+// apply validates the input and sets it on the record.
+// Records saved with Dao.SaveRecord skip schema validation, so every field is checked here.
+// The date may be a day or an instant, see dateutil.NormalizeDate, loc is the owner's timezone.
+func (in *diaryInput) apply(dao *daos.Dao, record *models.Record, loc *time.Location) error {
+	if in.Date != nil {
+		date, ok := dateutil.NormalizeDate(*in.Date, loc)
+		if !ok {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD or a timestamp", *in.Date)
+		}
+		if in.Time == nil {
+			if clock := dateutil.ClockOf(*in.Date, loc); clock != "" {
+				record.Set("time", clock)
+			}
+		}
+		record.Set("date", date)
+	} else if record.GetString("date") == "" {
+		return fmt.Errorf("date is required")
+	}
+
+	if in.Time != nil {
+		if *in.Time != "" && !dateutil.ValidTime(*in.Time) {
+			return fmt.Errorf("invalid time %q, expected HH:MM", *in.Time)
+		}
+		record.Set("time", *in.Time)
+	}
+	if in.Content != nil {
+		record.Set("content", *in.Content)
+	}
+	if in.Mood != nil {
+		if utf8.RuneCountInString(*in.Mood) > maxDiaryFieldLength {
+			return fmt.Errorf("mood must be at most %d characters", maxDiaryFieldLength)
+		}
+		record.Set("mood", *in.Mood)
+	}
+	if in.Weather != nil {
+		if utf8.RuneCountInString(*in.Weather) > maxDiaryFieldLength {
+			return fmt.Errorf("weather must be at most %d characters", maxDiaryFieldLength)
+		}
+		record.Set("weather", *in.Weather)
+	}
+	if in.Private != nil {
+		record.Set("private", *in.Private)
+	}
+	if in.Tags != nil {
+		tagIDs, err := findOrCreateTags(dao, record.GetString("owner"), *in.Tags)
+		if err != nil {
+			return err
+		}
+		record.Set("tags", tagIDs)
+	}
+	return nil
+}
@@ -2,9 +2,11 @@ package api
 
 import (
 	"archive/zip"
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,14 +17,22 @@ import (
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
 	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/list"
+	"github.com/pocketbase/pocketbase/tools/types"
 
 	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
 	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/importer"
+	"github.com/songtianlun/diarum/internal/jobs"
 	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+	"github.com/songtianlun/diarum/internal/trash"
 )
 
-const maxImportSize = 200 << 20     // 200MB total upload
 const maxSingleFileSize = 100 << 20 // 100MB per file (ZIP bomb protection)
 
 // ---------- Export Request ----------
@@ -35,6 +45,8 @@ type ExportRequest struct {
 	StartDate string `json:"start_date,omitempty"`
 	// EndDate: required when DateRange is "custom" (format: YYYY-MM-DD)
 	EndDate string `json:"end_date,omitempty"`
+	// Tag: optional, only export diaries carrying this tag
+	Tag string `json:"tag,omitempty"`
 	// Content types to export
 	IncludeDiaries       bool `json:"include_diaries"`
 	IncludeMedia         bool `json:"include_media"`
@@ -52,11 +64,15 @@ type exportData struct {
 }
 
 type exportDiary struct {
-	ID      string `json:"id"`
-	Date    string `json:"date"`
-	Content string `json:"content"`
-	Mood    string `json:"mood,omitempty"`
-	Weather string `json:"weather,omitempty"`
+	ID      string   `json:"id"`
+	Date    string   `json:"date"`
+	Time    string   `json:"time,omitempty"`
+	Content string   `json:"content"`
+	Mood    string   `json:"mood,omitempty"`
+	Weather string   `json:"weather,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	// Updated is when the diary was last changed, compared by the keep-newer import strategy
+	Updated string `json:"updated,omitempty"`
 }
 
 type exportMedia struct {
@@ -80,7 +96,8 @@ type exportMessage struct {
 	ReferencedDiaries  []string `json:"referenced_diaries,omitempty"`
 }
 
-type exportStats struct {
+// ExportStats reports what an export contains
+type ExportStats struct {
 	// Date range info
 	DateRangeType string `json:"date_range_type"`
 	StartDate     string `json:"start_date"`
@@ -106,10 +123,14 @@ type exportFailedItem struct {
 	Reason string `json:"reason"`
 }
 
-type importStats struct {
+// ImportStats reports the outcome of an import per kind of data
+type ImportStats struct {
 	Diaries       importCounters `json:"diaries"`
 	Media         importCounters `json:"media"`
 	Conversations importCounters `json:"conversations"`
+	// DryRun is set when nothing was written, Plan then lists what the import would do with each item
+	DryRun bool             `json:"dry_run,omitempty"`
+	Plan   []ImportPlanItem `json:"plan,omitempty"`
 }
 
 type importCounters struct {
@@ -117,23 +138,35 @@ type importCounters struct {
 	Imported int `json:"imported"`
 	Skipped  int `json:"skipped"`
 	Failed   int `json:"failed"`
+	// Updated counts existing entries that were overwritten or appended to
+	Updated int `json:"updated"`
 }
 
 // ---------- Route Registration ----------
 
-func RegisterExportImportRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService) {
+// RegisterExportImportRoutes registers the export and import of Diarum archives.
+// With ?async=true they run as background jobs, see RegisterJobRoutes.
+func RegisterExportImportRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService, jobService *jobs.JobService, rateLimits *ratelimit.Limits) {
 	e.Router.POST("/api/export", func(c echo.Context) error {
-		return handleExport(c, app)
-	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+		return handleExport(c, app, jobService)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth(), RateLimit(rateLimits, ratelimit.GroupExport))
 
 	e.Router.POST("/api/import", func(c echo.Context) error {
-		return handleImport(c, app, embeddingService)
+		return handleImport(c, app, embeddingService, jobService)
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 }
 
 // ---------- Export Handler ----------
 
-func handleExport(c echo.Context, app *pocketbase.PocketBase) error {
+// Export formats
+const (
+	// ExportFormatZip is the full archive with diarum_export.json, Markdown files and media
+	ExportFormatZip = "zip"
+	// ExportFormatJSON is diarum_export.json alone, without media
+	ExportFormatJSON = "json"
+)
+
+func handleExport(c echo.Context, app *pocketbase.PocketBase, jobService *jobs.JobService) error {
 	authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
 	if authRecord == nil {
 		return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
@@ -152,18 +185,99 @@ func handleExport(c echo.Context, app *pocketbase.PocketBase) error {
 		}
 	}
 
+	loc := userLocation(c, config.NewConfigService(app), userID)
+
+	// The data is collected and the archive written by a background job,
+	// which is downloaded once it is ready. Only the request is checked here.
+	if c.QueryParam("async") == "true" {
+		if _, _, err := checkExportRequest(&req, ExportFormatZip, loc); err != nil {
+			return err
+		}
+		return startExportJob(c, app, jobService, userID, req, loc)
+	}
+
+	export, err := prepareExport(app, userID, req, ExportFormatZip, loc)
+	if err != nil {
+		return err
+	}
+
+	// 序列化 stats 放入 header，媒体文件在开始写入前已确认存在
+	statsJSON, _ := json.Marshal(export.stats)
+
+	// 流式返回 ZIP 响应
+	c.Response().Header().Set("Content-Type", "application/zip")
+	c.Response().Header().Set("Content-Disposition", "attachment; filename=diarum_export.zip")
+	c.Response().Header().Set("X-Export-Stats", string(statsJSON))
+	c.Response().Header().Set("Access-Control-Expose-Headers", "X-Export-Stats")
+	c.Response().WriteHeader(http.StatusOK)
+	if err := export.write(c.Response()); err != nil {
+		// The response has started, the client gets a truncated archive
+		logger.Error("[Export] failed to stream export for user %s: %v", userID, err)
+	}
+
+	return nil
+}
+
+// ExportTo writes the export of a user's data to w in the given format, with dates in the user's timezone.
+// It backs the export command, errors of an invalid request are *apis.ApiError.
+func ExportTo(app *pocketbase.PocketBase, userID string, req ExportRequest, format string, w io.Writer) (*ExportStats, error) {
+	loc := config.NewConfigService(app).GetLocation(userID)
+	export, err := prepareExport(app, userID, req, format, loc)
+	if err != nil {
+		return nil, err
+	}
+	if err := export.write(w); err != nil {
+		return nil, err
+	}
+	return export.stats, nil
+}
+
+// preparedExport is an export whose data is collected and whose media files were found,
+// ready to be streamed. Only the media files are read while writing.
+type preparedExport struct {
+	app    *pocketbase.PocketBase
+	userID string
+	format string
+	stats  *ExportStats
+	data   exportData
+	// media are the records of data.Media by id
+	media map[string]*models.Record
+	// progress follows the export file by file, nil for none
+	progress Progress
+}
+
+// checkExportRequest applies the defaults of an export request and returns its date range
+// in the user's timezone. Errors are *apis.ApiError.
+func checkExportRequest(req *ExportRequest, format string, loc *time.Location) (time.Time, time.Time, error) {
+	switch format {
+	case ExportFormatZip:
+	case ExportFormatJSON:
+		// Media files can't be part of a bare JSON export
+		req.IncludeMedia = false
+	default:
+		return time.Time{}, time.Time{}, apis.NewBadRequestError("Invalid export format, expected zip or json", nil)
+	}
+
 	// Apply defaults for empty values
 	if req.DateRange == "" {
 		req.DateRange = "3m"
 	}
 
-	// Calculate date range
-	startDate, endDate, err := calculateDateRange(req)
+	startDate, endDate, err := calculateDateRange(*req, loc)
 	if err != nil {
-		return apis.NewBadRequestError(err.Error(), nil)
+		return time.Time{}, time.Time{}, apis.NewBadRequestError(err.Error(), nil)
 	}
+	return startDate, endDate, nil
+}
 
-	stats := exportStats{
+// prepareExport collects the requested data of a user, errors of an invalid request are *apis.ApiError
+func prepareExport(app *pocketbase.PocketBase, userID string, req ExportRequest, format string, loc *time.Location) (*preparedExport, error) {
+	startDate, endDate, err := checkExportRequest(&req, format, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := ExportStats{
 		DateRangeType: req.DateRange,
 		StartDate:     startDate.Format("2006-01-02"),
 		EndDate:       endDate.Format("2006-01-02"),
@@ -172,13 +286,22 @@ func handleExport(c echo.Context, app *pocketbase.PocketBase) error {
 
 	// Get total counts in system first
 	allDiaries, _ := app.Dao().FindRecordsByFilter(
-		"diaries", "owner = {:owner}", "-date", -1, 0,
+		"diaries", "owner = {:owner} && deleted_at = ''", "-date,time,created", -1, 0,
 		map[string]any{"owner": userID},
 	)
 	stats.Diaries.TotalInSystem = len(allDiaries)
 
+	// Narrow diaries to the requested tag
+	if req.Tag != "" {
+		tagParams := map[string]any{"owner": userID}
+		allDiaries, _ = app.Dao().FindRecordsByFilter(
+			"diaries", appendTagFilter("owner = {:owner} && deleted_at = ''", tagParams, req.Tag), "-date,time,created", -1, 0,
+			tagParams,
+		)
+	}
+
 	allMedia, _ := app.Dao().FindRecordsByFilter(
-		"media", "owner = {:owner}", "-created", -1, 0,
+		"media", "owner = {:owner} && deleted_at = ''", "-created", -1, 0,
 		map[string]any{"owner": userID},
 	)
 	stats.Media.TotalInSystem = len(allMedia)
@@ -208,8 +331,8 @@ func handleExport(c echo.Context, app *pocketbase.PocketBase) error {
 	// Filter and export media (based on creation date)
 	if req.IncludeMedia {
 		for _, m := range allMedia {
-			createdStr := m.GetString("created")
-			if isDateInRange(extractExportDate(createdStr), startDate, endDate) {
+			createdDay := dateutil.LocalDay(m.GetString("created"), loc)
+			if isDateInRange(createdDay, startDate, endDate) {
 				mediaRecords = append(mediaRecords, m)
 			}
 		}
@@ -219,8 +342,8 @@ func handleExport(c echo.Context, app *pocketbase.PocketBase) error {
 	// Filter and export conversations (based on update date)
 	if req.IncludeConversations {
 		for _, c := range allConversations {
-			updatedStr := c.GetString("updated")
-			if isDateInRange(extractExportDate(updatedStr), startDate, endDate) {
+			updatedDay := dateutil.LocalDay(c.GetString("updated"), loc)
+			if isDateInRange(updatedDay, startDate, endDate) {
 				conversations = append(conversations, c)
 			}
 		}
@@ -228,21 +351,49 @@ func handleExport(c echo.Context, app *pocketbase.PocketBase) error {
 	stats.Conversations.ShouldExport = len(conversations)
 
 	// Build diary list
+	tagNames := getTagNamesBatch(app.Dao(), diaries)
 	exportDiaries := make([]exportDiary, 0, len(diaries))
 	for _, d := range diaries {
 		exportDiaries = append(exportDiaries, exportDiary{
 			ID:      d.Id,
 			Date:    extractExportDate(d.GetString("date")),
+			Time:    d.GetString("time"),
 			Content: d.GetString("content"),
 			Mood:    d.GetString("mood"),
 			Weather: d.GetString("weather"),
+			Tags:    tagNames[d.Id],
+			Updated: d.GetDateTime("updated").String(),
 		})
 	}
 	stats.Diaries.ActualExported = len(exportDiaries)
 
-	// Build media list
+	// Build media list, leaving out files missing from storage so the stats are known before streaming
+	var fsys *filesystem.System
+	if len(mediaRecords) > 0 {
+		fsys, err = app.NewFilesystem()
+		if err != nil {
+			logger.Error("[Export] failed to init filesystem: %v", err)
+			return nil, apis.NewBadRequestError("Failed to initialize filesystem", err)
+		}
+		defer fsys.Close()
+	}
 	exportMediaList := make([]exportMedia, 0, len(mediaRecords))
+	mediaByID := make(map[string]*models.Record, len(mediaRecords))
 	for _, m := range mediaRecords {
+		if m.GetString("file") == "" {
+			continue
+		}
+		fileKey := m.BaseFilesPath() + "/" + m.GetString("file")
+		if exists, err := fsys.Exists(fileKey); !exists {
+			logger.Warn("[Export] media file %s not found: %v", fileKey, err)
+			stats.FailedItems = append(stats.FailedItems, exportFailedItem{
+				Type:   "media",
+				ID:     m.Id,
+				Reason: "file not found in storage",
+			})
+			continue
+		}
+		mediaByID[m.Id] = m
 		diaryIDs := m.GetStringSlice("diary")
 		exportMediaList = append(exportMediaList, exportMedia{
 			ID:    m.Id,
@@ -299,121 +450,128 @@ func handleExport(c echo.Context, app *pocketbase.PocketBase) error {
 	}
 	stats.Conversations.ActualExported = len(exportConvs)
 
-	// 序列化 JSON
-	data := exportData{
-		Version:       1,
-		ExportedAt:    time.Now().UTC().Format(time.RFC3339),
-		Diaries:       exportDiaries,
-		Media:         exportMediaList,
-		Conversations: exportConvs,
-	}
-	jsonBytes, err := json.MarshalIndent(data, "", "  ")
+	return &preparedExport{
+		app:    app,
+		userID: userID,
+		format: format,
+		stats:  &stats,
+		data: exportData{
+			Version:       1,
+			ExportedAt:    time.Now().UTC().Format(time.RFC3339),
+			Diaries:       exportDiaries,
+			Media:         exportMediaList,
+			Conversations: exportConvs,
+		},
+		media: mediaByID,
+	}, nil
+}
+
+// write streams the export to w, media files are copied from storage one at a time
+func (e *preparedExport) write(w io.Writer) error {
+	jsonBytes, err := json.MarshalIndent(e.data, "", "  ")
 	if err != nil {
-		return apis.NewBadRequestError("Failed to serialize export data", err)
+		return fmt.Errorf("failed to serialize export data: %w", err)
 	}
 
-	// 初始化 filesystem（本地/S3 透明）
-	fsys, err := app.NewFilesystem()
-	if err != nil {
-		logger.Error("[Export] failed to init filesystem: %v", err)
-		return apis.NewBadRequestError("Failed to initialize filesystem", err)
+	if e.format == ExportFormatJSON {
+		if _, err := w.Write(jsonBytes); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+		logExport(e.userID, e.stats)
+		return nil
 	}
-	defer fsys.Close()
 
-	// 构建 ZIP
-	var buf bytes.Buffer
-	zipWriter := zip.NewWriter(&buf)
+	// 构建 ZIP，直接写入 w
+	zipWriter := zip.NewWriter(w)
 
 	// 写入 diarum_export.json
-	if w, err := zipWriter.Create("diarum_export.json"); err == nil {
-		w.Write(jsonBytes)
+	f, err := zipWriter.Create("diarum_export.json")
+	if err != nil {
+		return err
 	}
-
-	// 写入 markdown/ 目录
-	for _, d := range exportDiaries {
-		filename := d.Date + ".md"
-		if d.Mood != "" {
-			filename = d.Date + "_" + d.Mood + ".md"
-		}
-		md := generateMarkdown(d)
-		if w, err := zipWriter.Create("markdown/" + filename); err == nil {
-			w.Write([]byte(md))
-		}
+	if _, err := f.Write(jsonBytes); err != nil {
+		return err
 	}
 
-	// 写入 media/ 目录
-	mediaExportedCount := 0
-	for _, m := range exportMediaList {
-		if m.File == "" {
-			continue
+	// 写入 markdown/ 目录，同一天的多篇日记合并为一个文件
+	for _, day := range groupDiariesByDay(e.data.Diaries) {
+		filename := day[0].Date + ".md"
+		if len(day) == 1 && day[0].Mood != "" {
+			filename = day[0].Date + "_" + day[0].Mood + ".md"
 		}
-		// 找到对应的 record 来获取 BaseFilesPath
-		record, err := app.Dao().FindRecordById("media", m.ID)
+		f, err := zipWriter.Create("markdown/" + filename)
 		if err != nil {
-			logger.Warn("[Export] media record %s not found: %v", m.ID, err)
-			stats.FailedItems = append(stats.FailedItems, exportFailedItem{
-				Type:   "media",
-				ID:     m.ID,
-				Reason: fmt.Sprintf("record not found: %v", err),
-			})
-			continue
+			return err
 		}
-
-		fileKey := record.BaseFilesPath() + "/" + m.File
-		reader, err := fsys.GetFile(fileKey)
-		if err != nil {
-			logger.Warn("[Export] failed to read media file %s: %v", fileKey, err)
-			stats.FailedItems = append(stats.FailedItems, exportFailedItem{
-				Type:   "media",
-				ID:     m.ID,
-				Reason: fmt.Sprintf("failed to read file: %v", err),
-			})
-			continue
+		if _, err := io.WriteString(f, generateDayMarkdown(day)); err != nil {
+			return err
 		}
+	}
 
-		content, err := io.ReadAll(reader)
-		reader.Close()
+	// 写入 media/ 目录，逐个从存储复制（本地/S3 透明）
+	if len(e.data.Media) > 0 {
+		fsys, err := e.app.NewFilesystem()
 		if err != nil {
-			logger.Warn("[Export] failed to read media content %s: %v", fileKey, err)
-			stats.FailedItems = append(stats.FailedItems, exportFailedItem{
-				Type:   "media",
-				ID:     m.ID,
-				Reason: fmt.Sprintf("failed to read content: %v", err),
-			})
-			continue
+			return fmt.Errorf("failed to initialize filesystem: %w", err)
 		}
+		defer fsys.Close()
 
-		if w, err := zipWriter.Create("media/" + m.File); err == nil {
-			w.Write(content)
-			mediaExportedCount++
+		for i, m := range e.data.Media {
+			if err := e.step(i + 1); err != nil {
+				return err
+			}
+			if err := writeExportMedia(zipWriter, fsys, e.media[m.ID]); err != nil {
+				return err
+			}
 		}
 	}
-	stats.Media.ActualExported = mediaExportedCount
 
 	if err := zipWriter.Close(); err != nil {
-		return apis.NewBadRequestError("Failed to create ZIP", err)
+		return fmt.Errorf("failed to create ZIP: %w", err)
 	}
 
-	// 序列化 stats 放入 header
-	statsJSON, _ := json.Marshal(stats)
+	logExport(e.userID, e.stats)
+	return nil
+}
 
-	// 返回 ZIP 响应
-	c.Response().Header().Set("Content-Type", "application/zip")
-	c.Response().Header().Set("Content-Disposition", "attachment; filename=diarum_export.zip")
-	c.Response().Header().Set("X-Export-Stats", string(statsJSON))
-	c.Response().Header().Set("Access-Control-Expose-Headers", "X-Export-Stats")
-	c.Response().WriteHeader(http.StatusOK)
-	c.Response().Write(buf.Bytes())
+// step reports that done files of the export were written, the JSON and Markdown count as one
+func (e *preparedExport) step(done int) error {
+	if e.progress == nil {
+		return nil
+	}
+	return e.progress.Step(done, len(e.data.Media)+1)
+}
 
-	logger.Info("[Export] completed for user %s: %d diaries, %d media, %d conversations",
-		userID, stats.Diaries.ActualExported, stats.Media.ActualExported, stats.Conversations.ActualExported)
+// writeExportMedia copies the file of a media record into the archive.
+// Media are already compressed, they are stored as they are.
+func writeExportMedia(zipWriter *zip.Writer, fsys *filesystem.System, record *models.Record) error {
+	fileKey := record.BaseFilesPath() + "/" + record.GetString("file")
+	reader, err := fsys.GetFile(fileKey)
+	if err != nil {
+		return fmt.Errorf("failed to read media file %s: %w", fileKey, err)
+	}
+	defer reader.Close()
 
+	header := &zip.FileHeader{Name: "media/" + record.GetString("file"), Method: zip.Store}
+	header.Modified = record.GetDateTime("created").Time()
+	f, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		return fmt.Errorf("failed to copy media file %s: %w", fileKey, err)
+	}
 	return nil
 }
 
+func logExport(userID string, stats *ExportStats) {
+	logger.Info("[Export] completed for user %s: %d diaries, %d media, %d conversations",
+		userID, stats.Diaries.ActualExported, stats.Media.ActualExported, stats.Conversations.ActualExported)
+}
+
 // ---------- Import Handler ----------
 
-func handleImport(c echo.Context, app *pocketbase.PocketBase, embeddingService *embedding.EmbeddingService) error {
+func handleImport(c echo.Context, app *pocketbase.PocketBase, embeddingService *embedding.EmbeddingService, jobService *jobs.JobService) error {
 	authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
 	if authRecord == nil {
 		return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
@@ -425,356 +583,698 @@ func handleImport(c echo.Context, app *pocketbase.PocketBase, embeddingService *
 	if err != nil {
 		return apis.NewBadRequestError("Missing upload file", err)
 	}
-	if fh.Size > maxImportSize {
-		return apis.NewBadRequestError("File too large (max 200MB). Please use segmented export with date range filters to create smaller export files, then import them separately.", nil)
+
+	opts := ImportOptions{Strategy: c.FormValue("strategy"), DryRun: c.FormValue("dry_run") == "true"}
+	if c.QueryParam("async") == "true" {
+		return startImportJob(c, app, embeddingService, jobService, userID, fh, opts)
 	}
 
+	// Uploads above the multipart memory limit are spooled to a temporary file, read in place
 	f, err := fh.Open()
 	if err != nil {
 		return apis.NewBadRequestError("Failed to open upload", err)
 	}
 	defer f.Close()
 
-	zipBytes, err := io.ReadAll(io.LimitReader(f, maxImportSize+1))
+	stats, err := ImportArchive(app, userID, f, fh.Size, opts)
 	if err != nil {
-		return apis.NewBadRequestError("Failed to read upload", err)
+		return err
+	}
+
+	if !opts.DryRun {
+		rebuildVectorsAfterImport(app, embeddingService, userID)
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// Import strategies for diaries that already exist: an entry of the diary on the same day and at
+// the same time as an entry of the archive. Entries identical to one in the diary are always skipped.
+const (
+	// ImportStrategySkip keeps the existing entry and skips the imported one
+	ImportStrategySkip = "skip"
+	// ImportStrategyOverwrite replaces the existing entry with the imported one
+	ImportStrategyOverwrite = "overwrite"
+	// ImportStrategyKeepNewer keeps whichever entry was updated last.
+	// Archives written before export carried update times keep the existing entry.
+	ImportStrategyKeepNewer = "keep-newer"
+	// ImportStrategyAppend adds the imported content to the end of the existing entry
+	ImportStrategyAppend = "append"
+	// ImportStrategyMerge is ImportStrategyAppend with a horizontal rule between the two
+	ImportStrategyMerge = "merge-with-separator"
+)
+
+// ImportStrategies lists the strategies for entries that already exist
+var ImportStrategies = []string{ImportStrategySkip, ImportStrategyOverwrite, ImportStrategyKeepNewer, ImportStrategyAppend, ImportStrategyMerge}
+
+// Actions of an import plan
+const (
+	importActionCreate    = "create"
+	importActionSkip      = "skip"
+	importActionOverwrite = "overwrite"
+	importActionAppend    = "append"
+	importActionRestore   = "restore"
+	importActionFail      = "fail"
+)
+
+// ImportOptions controls how an archive is imported
+type ImportOptions struct {
+	// Strategy for entries that already exist, ImportStrategySkip when empty
+	Strategy string
+	// DryRun plans the import without writing anything, the stats carry the plan
+	DryRun bool
+	// Progress follows the import item by item, nil for none.
+	// When it fails the import stops and is rolled back.
+	Progress Progress
+}
+
+// Progress follows a long export or import. Step is called with the items done so far,
+// an error stops the work, like when a background job is cancelled.
+type Progress interface {
+	Step(done, total int) error
+}
+
+// ImportPlanItem is what an import does, or would do on a dry run, with an item of the archive
+type ImportPlanItem struct {
+	// Kind is diary, media or conversation
+	Kind string `json:"kind"`
+	// ID is the id of the item in the archive
+	ID   string `json:"id"`
+	Date string `json:"date,omitempty"`
+	Time string `json:"time,omitempty"`
+	// Name is the file name of media and the title of conversations
+	Name string `json:"name,omitempty"`
+	// Action is create, skip, overwrite, append, restore or fail
+	Action string `json:"action"`
+	// ExistingID is the record the item was matched with
+	ExistingID string `json:"existing_id,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// checkImportStrategy validates the strategy of an import, defaulting to ImportStrategySkip
+func checkImportStrategy(opts *ImportOptions) error {
+	if opts.Strategy == "" {
+		opts.Strategy = ImportStrategySkip
+	}
+	if !list.ExistInSlice(opts.Strategy, ImportStrategies) {
+		return apis.NewBadRequestError("Invalid import strategy, expected one of "+strings.Join(ImportStrategies, ", "), nil)
 	}
-	if int64(len(zipBytes)) > maxImportSize {
-		return apis.NewBadRequestError("File too large (max 200MB). Please use segmented export with date range filters to create smaller export files, then import them separately.", nil)
+	return nil
+}
+
+// errImportDryRun rolls back the transaction of a dry run
+var errImportDryRun = errors.New("dry run")
+
+// ImportArchive imports an export ZIP of the given size read from r into a user's data.
+// It backs both the import route and command, errors of an invalid archive are *apis.ApiError.
+// The archive is read in place and media files are copied to storage one at a time, so its size
+// is not limited. The import runs in one transaction: when writing fails nothing is imported.
+func ImportArchive(app *pocketbase.PocketBase, userID string, r io.ReaderAt, size int64, opts ImportOptions) (*ImportStats, error) {
+	if err := checkImportStrategy(&opts); err != nil {
+		return nil, err
 	}
 
-	// 解压 ZIP
-	zipReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	// 读取 ZIP 目录
+	zipReader, err := zip.NewReader(r, size)
 	if err != nil {
-		return apis.NewBadRequestError("Failed to read ZIP file", err)
+		return nil, apis.NewBadRequestError("Failed to read ZIP file", err)
 	}
 
-	// 读取 ZIP 中的各文件到内存
+	// 读取 diarum_export.json，媒体文件只记录位置，导入时再读取
 	var exportJSON []byte
-	mediaFiles := make(map[string][]byte) // filename -> bytes
+	mediaFiles := make(map[string]*zip.File) // filename -> ZIP entry
 
 	for _, zf := range zipReader.File {
 		// Path traversal protection
-		if !isValidZipPath(zf.Name) {
+		if !importer.ValidPath(zf.Name) {
 			logger.Warn("[Import] skipping file with invalid path: %s", zf.Name)
 			continue
 		}
 
-		// ZIP bomb protection - check uncompressed size
+		// ZIP bomb protection - check uncompressed size, enforced again while reading
 		if zf.UncompressedSize64 > maxSingleFileSize {
 			logger.Warn("[Import] skipping file exceeding size limit: %s (%d bytes)", zf.Name, zf.UncompressedSize64)
 			continue
 		}
 
-		rc, err := zf.Open()
-		if err != nil {
-			continue
-		}
-
-		// Read with size limit (defense in depth)
-		limitedReader := io.LimitReader(rc, maxSingleFileSize+1)
-		data, err := io.ReadAll(limitedReader)
-		rc.Close()
-		if err != nil {
-			continue
-		}
-		if int64(len(data)) > maxSingleFileSize {
-			logger.Warn("[Import] file exceeded size limit during read: %s", zf.Name)
-			continue
-		}
-
 		switch {
 		case zf.Name == "diarum_export.json":
+			data, err := readZipEntry(zf, maxSingleFileSize)
+			if err != nil {
+				logger.Warn("[Import] failed to read %s: %v", zf.Name, err)
+				continue
+			}
 			exportJSON = data
 		case strings.HasPrefix(zf.Name, "media/"):
 			name := strings.TrimPrefix(zf.Name, "media/")
 			if name != "" {
-				mediaFiles[name] = data
+				mediaFiles[name] = zf
 			}
 		}
 	}
 
 	if exportJSON == nil {
-		return apis.NewBadRequestError("ZIP missing diarum_export.json", nil)
+		return nil, apis.NewBadRequestError("ZIP missing diarum_export.json", nil)
 	}
 
 	// 解析 JSON
 	var data exportData
 	if err := json.Unmarshal(exportJSON, &data); err != nil {
-		return apis.NewBadRequestError("Failed to parse diarum_export.json", err)
+		return nil, apis.NewBadRequestError("Failed to parse diarum_export.json", err)
 	}
 
 	if data.Version < 1 {
-		return apis.NewBadRequestError("Invalid export version", nil)
+		return nil, apis.NewBadRequestError("Invalid export version", nil)
 	}
 
-	stats := importStats{}
-
 	// 初始化 filesystem
 	fsys, err := app.NewFilesystem()
 	if err != nil {
-		return apis.NewBadRequestError("Failed to initialize filesystem", err)
+		return nil, apis.NewBadRequestError("Failed to initialize filesystem", err)
 	}
 	defer fsys.Close()
 
-	// ---------- 导入日记 ----------
-	// 维护旧 ID -> 新 ID 映射
-	diaryIDMap := make(map[string]string)
-	stats.Diaries.Total = len(data.Diaries)
+	imp := &archiveImport{
+		total:      len(data.Diaries) + len(data.Media) + len(data.Conversations),
+		userID:     userID,
+		opts:       opts,
+		data:       &data,
+		mediaFiles: mediaFiles,
+		fsys:       fsys,
+		diaryIDMap: make(map[string]string),
+	}
+	written := false
+	err = app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		imp.dao = txDao
+		if err := imp.importDiaries(); err != nil {
+			return err
+		}
+		if err := imp.importMedia(); err != nil {
+			return err
+		}
+		if err := imp.importConversations(); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errImportDryRun
+		}
+		written = true
+		return nil
+	})
+	switch {
+	case err == nil, errors.Is(err, errImportDryRun):
+	case written:
+		// The transaction was committed, the hooks that run after it failed
+		logger.Warn("[Import] hooks after the import of user %s failed: %v", userID, err)
+	default:
+		// Storage is not part of the transaction, remove the files it wrote
+		for _, key := range imp.uploaded {
+			if err := fsys.Delete(key); err != nil {
+				logger.Warn("[Import] failed to remove media file %s: %v", key, err)
+			}
+		}
+		if errors.Is(err, context.Canceled) {
+			logger.Info("[Import] cancelled for user %s, rolled back", userID)
+		} else {
+			logger.Error("[Import] failed for user %s, rolled back: %v", userID, err)
+		}
+		return nil, apis.NewApiError(http.StatusInternalServerError, "Import failed, nothing was imported", err)
+	}
+
+	stats := imp.stats
+	if opts.DryRun {
+		stats.DryRun = true
+		stats.Plan = imp.plan
+		if stats.Plan == nil {
+			stats.Plan = []ImportPlanItem{}
+		}
+		return &stats, nil
+	}
+
+	logger.Info("[Import] completed for user %s with strategy %s: diaries=%+v, media=%+v, conversations=%+v",
+		userID, opts.Strategy, stats.Diaries, stats.Media, stats.Conversations)
+
+	return &stats, nil
+}
+
+// archiveImport is an import of an export archive in progress, inside its transaction
+type archiveImport struct {
+	dao        *daos.Dao
+	userID     string
+	opts       ImportOptions
+	data       *exportData
+	mediaFiles map[string]*zip.File
+	fsys       *filesystem.System
+
+	// diaryIDMap maps the ids of the archive to the diaries they were imported into, "" when skipped
+	diaryIDMap map[string]string
+	// uploaded are the file keys written to storage, removed again when the import fails
+	uploaded []string
+	stats    ImportStats
+	plan     []ImportPlanItem
+
+	// done of total items of the archive were handled, reported to opts.Progress
+	done  int
+	total int
+}
+
+// step reports the progress of the import before the next item is handled
+func (imp *archiveImport) step() error {
+	if imp.opts.Progress == nil {
+		return nil
+	}
+	if err := imp.opts.Progress.Step(imp.done, imp.total); err != nil {
+		return err
+	}
+	imp.done++
+	return nil
+}
+
+// ---------- 导入日记 ----------
+
+func (imp *archiveImport) importDiaries() error {
+	imp.stats.Diaries.Total = len(imp.data.Diaries)
 
-	// 预先构建用户当前所有日记的 date set（用于快速去重查找）
-	existingDates, err := app.Dao().FindRecordsByFilter(
+	// 预先构建用户当前所有日记的去重 key set（日期 + 时间 + 内容哈希，同一天可以有多篇）
+	existingDiaries, err := imp.dao.FindRecordsByFilter(
 		"diaries",
-		"owner = {:owner}",
-		"date",
+		"owner = {:owner} && deleted_at = ''",
+		"created",
 		-1, 0,
-		map[string]any{"owner": userID},
+		map[string]any{"owner": imp.userID},
 	)
-	dateSet := make(map[string]bool)
-	if err == nil {
-		for _, r := range existingDates {
-			dateSet[extractExportDate(r.GetString("date"))] = true
+	if err != nil {
+		return fmt.Errorf("failed to query diaries: %w", err)
+	}
+	entrySet := make(map[string]bool, len(existingDiaries))
+	// The first entry of the diary at each day and time, the one a conflicting entry is resolved with.
+	// Entries created by this import are not in it, so the entries of an archive never conflict.
+	slots := make(map[string]*models.Record, len(existingDiaries))
+	for _, r := range existingDiaries {
+		date := extractExportDate(r.GetString("date"))
+		entrySet[diaryEntryKey(date, r.GetString("time"), r.GetString("content"))] = true
+		if slot := date + "|" + r.GetString("time"); slots[slot] == nil {
+			slots[slot] = r
 		}
 	}
 
-	diariesCollection, err := app.Dao().FindCollectionByNameOrId("diaries")
+	diariesCollection, err := imp.dao.FindCollectionByNameOrId("diaries")
 	if err != nil {
-		return apis.NewBadRequestError("Failed to find diaries collection", err)
+		return fmt.Errorf("failed to find diaries collection: %w", err)
 	}
 
-	for _, d := range data.Diaries {
-		if d.Date == "" {
-			stats.Diaries.Failed++
+	for _, d := range imp.data.Diaries {
+		if err := imp.step(); err != nil {
+			return err
+		}
+		item := ImportPlanItem{Kind: "diary", ID: d.ID, Date: d.Date, Time: d.Time}
+		imp.diaryIDMap[d.ID] = ""
+
+		if !dateutil.ValidDay(d.Date) || (d.Time != "" && !dateutil.ValidTime(d.Time)) {
+			imp.stats.Diaries.Failed++
+			imp.addPlan(item, importActionFail, "invalid date or time")
 			continue
 		}
 
-		// 基于日期去重
-		if dateSet[d.Date] {
-			stats.Diaries.Skipped++
-			diaryIDMap[d.ID] = "" // 标记为已跳过
+		// 基于 (日期, 时间, 内容哈希) 去重
+		key := diaryEntryKey(d.Date, d.Time, d.Content)
+		if entrySet[key] {
+			imp.stats.Diaries.Skipped++
+			imp.addPlan(item, importActionSkip, "identical entry exists")
 			continue
 		}
 
 		record := models.NewRecord(diariesCollection)
-		record.Set("date", d.Date+" 00:00:00.000Z")
-		record.Set("content", d.Content)
-		record.Set("owner", userID)
-		if d.Mood != "" {
-			record.Set("mood", d.Mood)
-		}
-		if d.Weather != "" {
-			record.Set("weather", d.Weather)
+		record.Set("owner", imp.userID)
+		input := diaryInput{Date: &d.Date, Time: &d.Time, Content: &d.Content, Mood: &d.Mood, Weather: &d.Weather, Tags: &d.Tags}
+		action := importActionCreate
+
+		if existing := slots[d.Date+"|"+d.Time]; existing != nil {
+			item.ExistingID = existing.Id
+			action, item.Reason = imp.resolveConflict(existing, d, &input)
+			if action == importActionSkip {
+				imp.stats.Diaries.Skipped++
+				imp.addPlan(item, action, item.Reason)
+				continue
+			}
+			record = existing
 		}
 
-		if err := app.Dao().SaveRecord(record); err != nil {
-			logger.Error("[Import] failed to save diary %s: %v", d.Date, err)
-			stats.Diaries.Failed++
+		if err := input.apply(imp.dao, record, time.UTC); err != nil {
+			imp.stats.Diaries.Failed++
+			imp.addPlan(item, importActionFail, err.Error())
 			continue
 		}
+		if err := imp.dao.SaveRecord(record); err != nil {
+			return fmt.Errorf("failed to save diary %s: %w", d.Date, err)
+		}
 
-		diaryIDMap[d.ID] = record.Id
-		dateSet[d.Date] = true // 更新 set 防止同一次导入中重复
-		stats.Diaries.Imported++
+		imp.diaryIDMap[d.ID] = record.Id
+		entrySet[diaryEntryKey(d.Date, d.Time, record.GetString("content"))] = true // 更新 set 防止同一次导入中重复
+		if action == importActionCreate {
+			imp.stats.Diaries.Imported++
+		} else {
+			imp.stats.Diaries.Updated++
+		}
+		imp.addPlan(item, action, item.Reason)
 	}
+	return nil
+}
 
-	// ---------- 导入媒体 ----------
-	mediaCollection, err := app.Dao().FindCollectionByNameOrId("media")
-	if err != nil {
-		logger.Error("[Import] failed to find media collection: %v", err)
+// resolveConflict decides what happens to an entry of the archive at the day and time of an
+// existing entry, adjusting the input that updates the existing entry
+func (imp *archiveImport) resolveConflict(existing *models.Record, d exportDiary, input *diaryInput) (action, reason string) {
+	switch imp.opts.Strategy {
+	case ImportStrategyOverwrite:
+		return importActionOverwrite, ""
+
+	case ImportStrategyKeepNewer:
+		updated, err := types.ParseDateTime(d.Updated)
+		if d.Updated == "" || err != nil {
+			return importActionSkip, "the archive has no update time"
+		}
+		if !updated.Time().After(existing.GetDateTime("updated").Time()) {
+			return importActionSkip, "the existing entry is newer"
+		}
+		return importActionOverwrite, "the imported entry is newer"
+
+	case ImportStrategyAppend, ImportStrategyMerge:
+		current := existing.GetString("content")
+		if strings.Contains(current, d.Content) {
+			return importActionSkip, "content already in the entry"
+		}
+		separator := ""
+		if imp.opts.Strategy == ImportStrategyMerge {
+			separator = "<hr>"
+		}
+		content := current + separator + d.Content
+		input.Content = &content
+
+		// Keep the fields of the existing entry, filling the empty ones
+		if existing.GetString("mood") != "" {
+			input.Mood = nil
+		}
+		if existing.GetString("weather") != "" {
+			input.Weather = nil
+		}
+		if len(d.Tags) > 0 {
+			tags := append(getTagNames(imp.dao, existing), d.Tags...)
+			input.Tags = &tags
+		} else {
+			input.Tags = nil
+		}
+		return importActionAppend, ""
 	}
+	return importActionSkip, "an entry exists at the same time"
+}
 
-	stats.Media.Total = len(data.Media)
+// ---------- 导入媒体 ----------
 
-	if mediaCollection != nil {
-		for _, m := range data.Media {
-			if m.File == "" {
-				stats.Media.Failed++
-				continue
-			}
+func (imp *archiveImport) importMedia() error {
+	mediaCollection, err := imp.dao.FindCollectionByNameOrId("media")
+	if err != nil {
+		return fmt.Errorf("failed to find media collection: %w", err)
+	}
 
-			// Check if file exists in ZIP
-			fileBytes, ok := mediaFiles[m.File]
-			if !ok {
-				logger.Warn("[Import] media file %s not found in ZIP", m.File)
-				stats.Media.Failed++
-				continue
-			}
+	imp.stats.Media.Total = len(imp.data.Media)
 
-			// Validate MIME type
-			detectedMime, allowed := config.IsAllowedMediaType(fileBytes)
-			if !allowed {
-				logger.Warn("[Import] media file %s has disallowed MIME type: %s", m.File, detectedMime)
-				stats.Media.Failed++
-				continue
-			}
+	for _, m := range imp.data.Media {
+		if err := imp.step(); err != nil {
+			return err
+		}
+		item := ImportPlanItem{Kind: "media", ID: m.ID, Name: m.File}
+		if m.File == "" {
+			imp.stats.Media.Failed++
+			imp.addPlan(item, importActionFail, "no file")
+			continue
+		}
 
-			// Check if media with same ID already exists - skip if so
-			if m.ID != "" {
-				existing, _ := app.Dao().FindRecordById("media", m.ID)
-				if existing != nil {
-					logger.Info("[Import] media %s already exists, skipping", m.ID)
-					stats.Media.Skipped++
-					continue
-				}
-			}
+		// Check if file exists in ZIP
+		zf, ok := imp.mediaFiles[m.File]
+		if !ok {
+			logger.Warn("[Import] media file %s not found in ZIP", m.File)
+			imp.stats.Media.Failed++
+			imp.addPlan(item, importActionFail, "file not found in the archive")
+			continue
+		}
 
-			// Fix diary relations (old ID -> new ID)
-			var newDiaryIDs []string
-			for _, oldID := range m.Diary {
-				if newID, exists := diaryIDMap[oldID]; exists && newID != "" {
-					newDiaryIDs = append(newDiaryIDs, newID)
-				}
-			}
+		// Validate MIME type from the start of the file
+		head, err := readZipEntry(zf, mediaSniffSize)
+		if err != nil && !errors.Is(err, errZipEntryTooLarge) {
+			logger.Warn("[Import] failed to read media file %s: %v", m.File, err)
+			imp.stats.Media.Failed++
+			imp.addPlan(item, importActionFail, "unreadable file")
+			continue
+		}
+		detectedMime, allowed := config.IsAllowedMediaType(head)
+		if !allowed {
+			logger.Warn("[Import] media file %s has disallowed MIME type: %s", m.File, detectedMime)
+			imp.stats.Media.Failed++
+			imp.addPlan(item, importActionFail, "disallowed MIME type "+detectedMime)
+			continue
+		}
 
-			// 创建 media 记录（先不设 file 字段）
-			record := models.NewRecord(mediaCollection)
-			record.Set("owner", userID)
-			if m.Name != "" {
-				record.Set("name", m.Name)
-			}
-			if m.Alt != "" {
-				record.Set("alt", m.Alt)
-			}
-			if len(newDiaryIDs) > 0 {
-				record.Set("diary", newDiaryIDs)
+		// Fix diary relations (old ID -> new ID)
+		var newDiaryIDs []string
+		for _, oldID := range m.Diary {
+			if newID, exists := imp.diaryIDMap[oldID]; exists && newID != "" {
+				newDiaryIDs = append(newDiaryIDs, newID)
 			}
+		}
 
-			if err := app.Dao().SaveRecord(record); err != nil {
-				logger.Error("[Import] failed to create media record: %v", err)
-				stats.Media.Failed++
+		// Check if media with same ID already exists - skip if so,
+		// but bring it back if the user moved it to the trash
+		if m.ID != "" {
+			existing, _ := imp.dao.FindRecordById("media", m.ID)
+			if existing != nil && trash.IsTrashed(existing) && existing.GetString("owner") == imp.userID {
+				existing.Set("deleted_at", "")
+				if len(newDiaryIDs) > 0 {
+					existing.Set("diary", newDiaryIDs)
+				}
+				if err := imp.dao.SaveRecord(existing); err != nil {
+					return fmt.Errorf("failed to restore trashed media %s: %w", m.ID, err)
+				}
+				imp.stats.Media.Imported++
+				item.ExistingID = existing.Id
+				imp.addPlan(item, importActionRestore, "in the trash")
 				continue
 			}
-
-			// 写入文件到存储
-			fileKey := record.BaseFilesPath() + "/" + m.File
-			if err := fsys.Upload(fileBytes, fileKey); err != nil {
-				logger.Error("[Import] failed to upload media file %s: %v", m.File, err)
-				stats.Media.Failed++
-				// 清理已创建的空记录
-				app.Dao().DeleteRecord(record)
+			if existing != nil {
+				imp.stats.Media.Skipped++
+				item.ExistingID = existing.Id
+				imp.addPlan(item, importActionSkip, "media exists")
 				continue
 			}
+		}
 
-			// 更新 file 字段并保存
-			record.Set("file", m.File)
-			if err := app.Dao().SaveRecord(record); err != nil {
-				logger.Error("[Import] failed to update media file field: %v", err)
-				stats.Media.Failed++
-				continue
+		// 创建 media 记录（先不设 file 字段）
+		record := models.NewRecord(mediaCollection)
+		record.Set("owner", imp.userID)
+		if m.Name != "" {
+			record.Set("name", m.Name)
+		}
+		if m.Alt != "" {
+			record.Set("alt", m.Alt)
+		}
+		if len(newDiaryIDs) > 0 {
+			record.Set("diary", newDiaryIDs)
+		}
+
+		if err := imp.dao.SaveRecord(record); err != nil {
+			return fmt.Errorf("failed to create media record: %w", err)
+		}
+
+		// 写入文件到存储，演练时不写入
+		if !imp.opts.DryRun {
+			fileKey := record.BaseFilesPath() + "/" + m.File
+			file := &filesystem.File{Name: m.File, OriginalName: m.File, Size: int64(zf.UncompressedSize64), Reader: zipEntryFile{zf}}
+			if err := imp.fsys.UploadFile(file, fileKey); err != nil {
+				return fmt.Errorf("failed to upload media file %s: %w", m.File, err)
 			}
+			imp.uploaded = append(imp.uploaded, fileKey)
+		}
 
-			stats.Media.Imported++
+		// 更新 file 字段并保存
+		record.Set("file", m.File)
+		if err := imp.dao.SaveRecord(record); err != nil {
+			return fmt.Errorf("failed to update media file field: %w", err)
 		}
-	}
 
-	// ---------- 导入 AI 对话 ----------
-	convCollection, err := app.Dao().FindCollectionByNameOrId("ai_conversations")
-	msgCollection, err2 := app.Dao().FindCollectionByNameOrId("ai_messages")
+		imp.stats.Media.Imported++
+		imp.addPlan(item, importActionCreate, "")
+	}
+	return nil
+}
 
-	stats.Conversations.Total = len(data.Conversations)
+// ---------- 导入 AI 对话 ----------
 
-	if convCollection != nil && err == nil && msgCollection != nil && err2 == nil {
-		for _, conv := range data.Conversations {
-			// Check if conversation with same ID already exists - skip if so
-			if conv.ID != "" {
-				existing, _ := app.Dao().FindRecordById("ai_conversations", conv.ID)
-				if existing != nil {
-					logger.Info("[Import] conversation %s already exists, skipping", conv.ID)
-					stats.Conversations.Skipped++
-					continue
-				}
-			}
+func (imp *archiveImport) importConversations() error {
+	imp.stats.Conversations.Total = len(imp.data.Conversations)
 
-			// Create conversation record
-			convRecord := models.NewRecord(convCollection)
-			convRecord.Set("title", conv.Title)
-			convRecord.Set("owner", userID)
+	convCollection, err := imp.dao.FindCollectionByNameOrId("ai_conversations")
+	if err != nil {
+		return fmt.Errorf("failed to find conversations collection: %w", err)
+	}
+	msgCollection, err := imp.dao.FindCollectionByNameOrId("ai_messages")
+	if err != nil {
+		return fmt.Errorf("failed to find messages collection: %w", err)
+	}
 
-			if err := app.Dao().SaveRecord(convRecord); err != nil {
-				logger.Error("[Import] failed to create conversation: %v", err)
-				stats.Conversations.Failed++
+	for _, conv := range imp.data.Conversations {
+		if err := imp.step(); err != nil {
+			return err
+		}
+		item := ImportPlanItem{Kind: "conversation", ID: conv.ID, Name: conv.Title}
+
+		// Check if conversation with same ID already exists - skip if so
+		if conv.ID != "" {
+			existing, _ := imp.dao.FindRecordById("ai_conversations", conv.ID)
+			if existing != nil {
+				imp.stats.Conversations.Skipped++
+				item.ExistingID = existing.Id
+				imp.addPlan(item, importActionSkip, "conversation exists")
 				continue
 			}
+		}
 
-			// Import messages
-			for _, msg := range conv.Messages {
-				// Check if message with same ID already exists - skip if so
-				if msg.ID != "" {
-					existing, _ := app.Dao().FindRecordById("ai_messages", msg.ID)
-					if existing != nil {
-						logger.Info("[Import] message %s already exists, skipping", msg.ID)
-						continue
-					}
+		// Create conversation record
+		convRecord := models.NewRecord(convCollection)
+		convRecord.Set("title", conv.Title)
+		convRecord.Set("owner", imp.userID)
+
+		if err := imp.dao.SaveRecord(convRecord); err != nil {
+			return fmt.Errorf("failed to create conversation: %w", err)
+		}
+
+		// Import messages
+		for _, msg := range conv.Messages {
+			// Check if message with same ID already exists - skip if so
+			if msg.ID != "" {
+				existing, _ := imp.dao.FindRecordById("ai_messages", msg.ID)
+				if existing != nil {
+					continue
 				}
+			}
 
-				msgRecord := models.NewRecord(msgCollection)
-				msgRecord.Set("conversation", convRecord.Id)
-				msgRecord.Set("role", msg.Role)
-				msgRecord.Set("content", msg.Content)
-				msgRecord.Set("owner", userID)
-
-				// 修复 referenced_diaries 关联
-				if len(msg.ReferencedDiaries) > 0 {
-					var newRefs []string
-					for _, oldID := range msg.ReferencedDiaries {
-						if newID, exists := diaryIDMap[oldID]; exists && newID != "" {
-							newRefs = append(newRefs, newID)
-						}
-					}
-					if len(newRefs) > 0 {
-						msgRecord.Set("referenced_diaries", newRefs)
+			msgRecord := models.NewRecord(msgCollection)
+			msgRecord.Set("conversation", convRecord.Id)
+			msgRecord.Set("role", msg.Role)
+			msgRecord.Set("content", msg.Content)
+			msgRecord.Set("owner", imp.userID)
+
+			// 修复 referenced_diaries 关联
+			if len(msg.ReferencedDiaries) > 0 {
+				var newRefs []string
+				for _, oldID := range msg.ReferencedDiaries {
+					if newID, exists := imp.diaryIDMap[oldID]; exists && newID != "" {
+						newRefs = append(newRefs, newID)
 					}
 				}
-
-				if err := app.Dao().SaveRecord(msgRecord); err != nil {
-					logger.Error("[Import] failed to create message: %v", err)
-					continue
+				if len(newRefs) > 0 {
+					msgRecord.Set("referenced_diaries", newRefs)
 				}
 			}
 
-			stats.Conversations.Imported++
+			if err := imp.dao.SaveRecord(msgRecord); err != nil {
+				return fmt.Errorf("failed to create message: %w", err)
+			}
 		}
+
+		imp.stats.Conversations.Imported++
+		imp.addPlan(item, importActionCreate, "")
 	}
+	return nil
+}
 
-	// ---------- 导入后异步触发向量重建 ----------
-	if embeddingService != nil {
-		configService := config.NewConfigService(app)
-		enabled, _ := configService.GetBool(userID, "ai.enabled")
-		if enabled {
-			go func() {
-				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-				defer cancel()
-				logger.Info("[Import] triggering incremental vector rebuild for user: %s", userID)
-				result, err := embeddingService.BuildIncrementalVectors(ctx, userID)
-				if err != nil {
-					logger.Error("[Import] vector rebuild failed for user %s: %v", userID, err)
-					return
-				}
-				logger.Info("[Import] vector rebuild completed for user %s: %d built, %d failed",
-					userID, result.Success, result.Failed)
-			}()
-		}
+// mediaSniffSize is the start of a media file read to check its type
+const mediaSniffSize = 1024
+
+// errZipEntryTooLarge is returned when a ZIP entry is larger than the limit it is read with
+var errZipEntryTooLarge = errors.New("file exceeds the size limit")
+
+// readZipEntry reads up to limit bytes of a ZIP entry, returning them with errZipEntryTooLarge
+// when the entry is longer
+func readZipEntry(zf *zip.File, limit int64) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
 	}
+	defer rc.Close()
 
-	logger.Info("[Import] completed for user %s: diaries=%+v, media=%+v, conversations=%+v",
-		userID, stats.Diaries, stats.Media, stats.Conversations)
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return data[:limit], errZipEntryTooLarge
+	}
+	return data, nil
+}
 
-	return c.JSON(http.StatusOK, stats)
+// zipEntryFile streams a ZIP entry to storage with filesystem.UploadFile,
+// enforcing the size limit on the uncompressed data as it is read
+type zipEntryFile struct {
+	zf *zip.File
 }
 
-// ---------- Helpers ----------
+func (f zipEntryFile) Open() (io.ReadSeekCloser, error) {
+	r := &zipEntryReader{zf: f.zf}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
 
-// isValidZipPath checks for path traversal attacks
-func isValidZipPath(name string) bool {
-	if strings.Contains(name, "..") {
-		return false
+// zipEntryReader reads a ZIP entry. UploadFile rewinds after detecting the content type,
+// which reopens the entry, other seeks are not supported.
+type zipEntryReader struct {
+	zf   *zip.File
+	rc   io.ReadCloser
+	read int64
+}
+
+func (r *zipEntryReader) open() error {
+	rc, err := r.zf.Open()
+	if err != nil {
+		return err
 	}
-	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, "\\") {
-		return false
+	r.rc, r.read = rc, 0
+	return nil
+}
+
+func (r *zipEntryReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.read += int64(n)
+	if r.read > maxSingleFileSize {
+		return n, errZipEntryTooLarge
 	}
-	return true
+	return n, err
 }
 
+func (r *zipEntryReader) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, errors.New("zip entry can only be rewound")
+	}
+	r.rc.Close()
+	return 0, r.open()
+}
+
+func (r *zipEntryReader) Close() error {
+	return r.rc.Close()
+}
+
+// addPlan records the action taken for an item, kept for dry runs only
+func (imp *archiveImport) addPlan(item ImportPlanItem, action, reason string) {
+	if !imp.opts.DryRun {
+		return
+	}
+	item.Action = action
+	item.Reason = reason
+	imp.plan = append(imp.plan, item)
+}
+
+// ---------- Helpers ----------
+
 // extractExportDate extracts YYYY-MM-DD from a PocketBase timestamp string
 func extractExportDate(dateTime string) string {
 	if len(dateTime) >= 10 {
@@ -783,26 +1283,74 @@ func extractExportDate(dateTime string) string {
 	return dateTime
 }
 
+// diaryEntryKey identifies a diary entry for import dedupe by its day, time and content hash
+func diaryEntryKey(date, clock, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return date + "|" + clock + "|" + hex.EncodeToString(sum[:])
+}
+
+// groupDiariesByDay splits diaries sorted by date into one slice per day
+func groupDiariesByDay(diaries []exportDiary) [][]exportDiary {
+	days := make([][]exportDiary, 0)
+	for _, d := range diaries {
+		if n := len(days); n > 0 && days[n-1][0].Date == d.Date {
+			days[n-1] = append(days[n-1], d)
+			continue
+		}
+		days = append(days, []exportDiary{d})
+	}
+	return days
+}
+
+// generateDayMarkdown renders the entries of a day, each under its own heading when there are several
+func generateDayMarkdown(entries []exportDiary) string {
+	if len(entries) == 1 && entries[0].Time == "" {
+		return generateMarkdown(entries[0])
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# " + entries[0].Date + "\n")
+	for i, d := range entries {
+		heading := d.Time
+		if heading == "" {
+			heading = fmt.Sprintf("Entry %d", i+1)
+		}
+		sb.WriteString("\n## " + heading + "\n\n")
+		writeMarkdownBody(&sb, d)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
 func generateMarkdown(d exportDiary) string {
 	var sb strings.Builder
 	sb.WriteString("# " + d.Date + "\n\n")
+	writeMarkdownBody(&sb, d)
+	return sb.String()
+}
+
+// writeMarkdownBody writes the metadata lines and content of a diary
+func writeMarkdownBody(sb *strings.Builder, d exportDiary) {
 	if d.Mood != "" {
 		sb.WriteString("**Mood:** " + d.Mood + "\n")
 	}
 	if d.Weather != "" {
 		sb.WriteString("**Weather:** " + d.Weather + "\n")
 	}
-	if d.Mood != "" || d.Weather != "" {
+	if len(d.Tags) > 0 {
+		sb.WriteString("**Tags:** " + strings.Join(d.Tags, ", ") + "\n")
+	}
+	if d.Mood != "" || d.Weather != "" || len(d.Tags) > 0 {
 		sb.WriteString("\n")
 	}
 	sb.WriteString(d.Content)
-	return sb.String()
 }
 
-// calculateDateRange calculates the start and end dates based on the export request
-func calculateDateRange(req ExportRequest) (time.Time, time.Time, error) {
-	now := time.Now().UTC()
-	endDate := now
+// calculateDateRange calculates the start and end dates based on the export request.
+// Relative ranges end today in loc, the result is compared with calendar days at midnight UTC.
+func calculateDateRange(req ExportRequest, loc *time.Location) (time.Time, time.Time, error) {
+	now := dateutil.TodayDate(loc)
+	endDate := now.Add(24*time.Hour - time.Second)
 
 	switch req.DateRange {
 	case "1m":
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func TestGroupDiariesByDay(t *testing.T) {
+	diaries := []exportDiary{
+		{ID: "a", Date: "2026-01-28", Time: "08:00"},
+		{ID: "b", Date: "2026-01-28", Time: "20:00"},
+		{ID: "c", Date: "2026-01-27"},
+	}
+
+	days := groupDiariesByDay(diaries)
+	if len(days) != 2 || len(days[0]) != 2 || len(days[1]) != 1 {
+		t.Fatalf("groupDiariesByDay() = %+v, want 2 entries then 1", days)
+	}
+	if days[0][1].ID != "b" || days[1][0].ID != "c" {
+		t.Errorf("groupDiariesByDay() changed the order: %+v", days)
+	}
+}
+
+func TestGenerateDayMarkdown(t *testing.T) {
+	single := []exportDiary{{Date: "2026-01-28", Mood: "happy", Content: "hello"}}
+	if got, want := generateDayMarkdown(single), "# 2026-01-28\n\n**Mood:** happy\n\nhello"; got != want {
+		t.Errorf("single entry = %q, want %q", got, want)
+	}
+
+	entries := []exportDiary{
+		{Date: "2026-01-28", Content: "untimed"},
+		{Date: "2026-01-28", Time: "12:30", Content: "lunch"},
+	}
+	want := "# 2026-01-28\n\n## Entry 1\n\nuntimed\n\n## 12:30\n\nlunch\n"
+	if got := generateDayMarkdown(entries); got != want {
+		t.Errorf("several entries = %q, want %q", got, want)
+	}
+}
+
+func TestDiaryEntryKey(t *testing.T) {
+	key := diaryEntryKey("2026-01-28", "08:00", "hello")
+	if key != diaryEntryKey("2026-01-28", "08:00", "hello") {
+		t.Error("diaryEntryKey() is not stable")
+	}
+	for _, other := range []string{
+		diaryEntryKey("2026-01-29", "08:00", "hello"),
+		diaryEntryKey("2026-01-28", "09:00", "hello"),
+		diaryEntryKey("2026-01-28", "08:00", "hello!"),
+	} {
+		if other == key {
+			t.Errorf("diaryEntryKey() collides: %s", key)
+		}
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	collection := &models.Collection{Name: "diaries", Schema: schema.NewSchema(
+		&schema.SchemaField{Name: "content", Type: schema.FieldTypeEditor},
+		&schema.SchemaField{Name: "mood", Type: schema.FieldTypeText},
+		&schema.SchemaField{Name: "weather", Type: schema.FieldTypeText},
+	)}
+	existing := models.NewRecord(collection)
+	existing.Set("content", "<p>morning</p>")
+	existing.Set("mood", "calm")
+	existing.Set("updated", "2026-01-28 12:00:00.000Z")
+
+	tests := []struct {
+		strategy string
+		diary    exportDiary
+		action   string
+		content  string
+	}{
+		{ImportStrategySkip, exportDiary{Content: "<p>evening</p>"}, importActionSkip, ""},
+		{ImportStrategyOverwrite, exportDiary{Content: "<p>evening</p>"}, importActionOverwrite, "<p>evening</p>"},
+		{ImportStrategyKeepNewer, exportDiary{Content: "<p>evening</p>", Updated: "2026-01-29 08:00:00.000Z"}, importActionOverwrite, "<p>evening</p>"},
+		{ImportStrategyKeepNewer, exportDiary{Content: "<p>evening</p>", Updated: "2026-01-27 08:00:00.000Z"}, importActionSkip, ""},
+		{ImportStrategyKeepNewer, exportDiary{Content: "<p>evening</p>"}, importActionSkip, ""},
+		{ImportStrategyAppend, exportDiary{Content: "<p>evening</p>", Mood: "tired"}, importActionAppend, "<p>morning</p><p>evening</p>"},
+		{ImportStrategyMerge, exportDiary{Content: "<p>evening</p>"}, importActionAppend, "<p>morning</p><hr><p>evening</p>"},
+		{ImportStrategyMerge, exportDiary{Content: "<p>morning</p>"}, importActionSkip, ""},
+	}
+	for _, tt := range tests {
+		imp := &archiveImport{opts: ImportOptions{Strategy: tt.strategy}}
+		d := tt.diary
+		input := diaryInput{Content: &d.Content, Mood: &d.Mood}
+		action, _ := imp.resolveConflict(existing, d, &input)
+		if action != tt.action {
+			t.Errorf("%s %+v: action = %s, want %s", tt.strategy, d, action, tt.action)
+			continue
+		}
+		if action != importActionSkip && *input.Content != tt.content {
+			t.Errorf("%s %+v: content = %s, want %s", tt.strategy, d, *input.Content, tt.content)
+		}
+		if action == importActionAppend && input.Mood != nil {
+			t.Errorf("%s: append replaced the mood of the existing entry", tt.strategy)
+		}
+	}
+}
+
+func TestZipEntryReaders(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, _ := w.Create("media/a.txt")
+	f.Write([]byte("0123456789"))
+	w.Close()
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zf := r.File[0]
+
+	if data, err := readZipEntry(zf, 4); !errors.Is(err, errZipEntryTooLarge) || string(data) != "0123" {
+		t.Errorf("readZipEntry(4) = %q, %v", data, err)
+	}
+	if data, err := readZipEntry(zf, 10); err != nil || string(data) != "0123456789" {
+		t.Errorf("readZipEntry(10) = %q, %v", data, err)
+	}
+
+	// UploadFile sniffs the start of the file, then rewinds
+	rs, err := zipEntryFile{zf}.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	head := make([]byte, 3)
+	io.ReadFull(rs, head)
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(rs); string(data) != "0123456789" {
+		t.Errorf("read after rewind = %q", data)
+	}
+	if _, err := rs.Seek(2, io.SeekStart); err == nil {
+		t.Error("Seek(2) succeeded, want an error")
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/apitoken"
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/feed"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+	// feedSummaryLength is the length in runes of an entry summary
+	feedSummaryLength = 200
+)
+
+// registerFeedRoutes registers the Atom and JSON feeds of a user's recent entries.
+// Feed readers rarely send headers, so the token query parameter is the usual way to authenticate.
+func registerFeedRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, configService *config.ConfigService, tokenService *apitoken.TokenService, rateLimits *ratelimit.Limits) {
+	e.Router.GET("/api/v1/feed.atom", func(c echo.Context) error {
+		f, err := buildFeed(app, c, configService, tokenService)
+		if err != nil {
+			return err
+		}
+		data, err := f.Atom()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to render feed"})
+		}
+		return c.Blob(http.StatusOK, feed.AtomContentType, data)
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+
+	e.Router.GET("/api/v1/feed.json", func(c echo.Context) error {
+		f, err := buildFeed(app, c, configService, tokenService)
+		if err != nil {
+			return err
+		}
+		data, err := f.JSON()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to render feed"})
+		}
+		return c.Blob(http.StatusOK, feed.JSONContentType, data)
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+}
+
+// buildFeed authenticates a feed request and collects the recent entries matching its filters.
+// Private and trashed entries are never included.
+func buildFeed(app *pocketbase.PocketBase, c echo.Context, configService *config.ConfigService, tokenService *apitoken.TokenService) (*feed.Feed, error) {
+	userId, err := publicUser(c, tokenService, apitoken.ScopeDiariesRead)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := defaultFeedLimit
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, apis.NewBadRequestError("Invalid limit", nil)
+		}
+		limit = min(limit, maxFeedLimit)
+	}
+
+	filter, filterParams := feedFilter(c, userId)
+	records, err := app.Dao().FindRecordsByFilter("diaries", filter, "-date,-time,-created", limit, 0, filterParams)
+	if err != nil {
+		return nil, apis.NewApiError(http.StatusInternalServerError, "Failed to query diaries", nil)
+	}
+
+	user, err := app.Dao().FindRecordById("users", userId)
+	if err != nil {
+		return nil, apis.NewNotFoundError("User not found", nil)
+	}
+	author := displayName(user)
+
+	base := c.Scheme() + "://" + c.Request().Host
+	loc := configService.GetLocation(userId)
+
+	f := &feed.Feed{
+		ID:       "urn:diarum:user:" + userId,
+		Title:    author + "'s diary",
+		Link:     base + "/",
+		FeedLink: base + c.Request().URL.Path,
+		Author:   author,
+		Updated:  user.GetDateTime("updated").Time(),
+		Entries:  make([]feed.Entry, 0, len(records)),
+	}
+
+	tagNames := getTagNamesBatch(app.Dao(), records)
+	for _, record := range records {
+		entry := feedEntry(app, record, tagNames[record.Id], base, loc)
+		if entry.Updated.After(f.Updated) {
+			f.Updated = entry.Updated
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	return f, nil
+}
+
+// feedFilter selects the entries shared by feeds and calendars: neither private nor trashed,
+// with the tag and mood given by the ?tag= and ?mood= query parameters
+func feedFilter(c echo.Context, userId string) (string, map[string]any) {
+	params := map[string]any{"owner": userId}
+	filter := appendTagFilter("owner = {:owner} && deleted_at = '' && private = false", params, c.QueryParam("tag"))
+	if mood := strings.TrimSpace(c.QueryParam("mood")); mood != "" {
+		params["mood"] = mood
+		filter += " && mood = {:mood}"
+	}
+	return filter, params
+}
+
+// displayName returns the name of a user, or the username when no name is set
+func displayName(user *models.Record) string {
+	if name := user.GetString("name"); name != "" {
+		return name
+	}
+	return user.Username()
+}
+
+// feedEntry converts a diary record into a feed entry with absolute links
+func feedEntry(app *pocketbase.PocketBase, record *models.Record, tags []string, base string, loc *time.Location) feed.Entry {
+	diary := diaryEntry(record, tags)
+
+	title := diary.Date
+	if diary.Time != "" {
+		title += " " + diary.Time
+	}
+	if diary.Mood != "" {
+		title += " · " + diary.Mood
+	}
+
+	// The entry is published at its day and time in the owner's timezone
+	published, err := time.ParseInLocation(dateutil.DayLayout, diary.Date, loc)
+	if err != nil {
+		published = record.GetDateTime("created").Time()
+	} else if clock, err := time.Parse(dateutil.TimeLayout, diary.Time); err == nil {
+		published = published.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute)
+	}
+
+	entry := feed.Entry{
+		ID:        "urn:diarum:diary:" + record.Id,
+		Title:     title,
+		Link:      base + "/diary/" + diary.Date,
+		Published: published,
+		Updated:   record.GetDateTime("updated").Time(),
+		Content:   feed.AbsoluteURLs(diary.Content, base),
+		Summary:   truncateRunes(textutil.StripHTML(diary.Content), feedSummaryLength),
+		Tags:      diary.Tags,
+	}
+
+	media, err := app.Dao().FindRecordsByFilter(
+		"media", "diary ?= {:diary} && deleted_at = ''", "created", -1, 0,
+		map[string]any{"diary": record.Id},
+	)
+	if err == nil {
+		for _, m := range media {
+			file := m.GetString("file")
+			name := m.GetString("name")
+			if name == "" {
+				name = file
+			}
+			entry.Attachments = append(entry.Attachments, feed.Attachment{
+				URL:      base + mediaRecordJSON(m).URL,
+				MimeType: mime.TypeByExtension(strings.ToLower(filepath.Ext(file))),
+				Title:    name,
+			})
+		}
+	}
+	return entry
+}
+
+// truncateRunes shortens text to at most n runes, marking a cut with an ellipsis
+func truncateRunes(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
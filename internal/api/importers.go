@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/forms"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/importer"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/openapi"
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// imageTag matches an <img> tag and captures its src
+var imageTag = regexp.MustCompile(`(?:<p>)?<img\b[^>]*\bsrc="([^"]*)"[^>]*>(?:</p>)?`)
+
+// SourceImportUpload is the multipart form of an import from another app
+type SourceImportUpload struct {
+	File openapi.Binary `json:"file"`
+}
+
+// RegisterImporterRoutes registers the imports from other journaling apps, see the importer package
+func RegisterImporterRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService) {
+	configService := config.NewConfigService(app)
+
+	// List the apps archives can be imported from
+	e.Router.GET("/api/import/sources", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, importer.All())
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Summarize what an import would add, without writing anything
+	e.Router.POST("/api/import/:source/preview", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		upload, err := readSourceUpload(c, userLocation(c, configService, authRecord.Id))
+		if err != nil {
+			return err
+		}
+		defer upload.Close()
+		return c.JSON(http.StatusOK, importer.NewPreview(upload.source.Name, upload.entries))
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Import the entries and photos of another app's archive.
+	// Entries already in the diary, with the same day, time and text, are skipped.
+	e.Router.POST("/api/import/:source", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+		userID := authRecord.Id
+
+		loc := userLocation(c, configService, userID)
+		upload, err := readSourceUpload(c, loc)
+		if err != nil {
+			return err
+		}
+		defer upload.Close()
+
+		stats, err := importEntries(app, userID, upload.entries, loc)
+		if err != nil {
+			return err
+		}
+		rebuildVectorsAfterImport(app, embeddingService, userID)
+
+		logger.Info("[Import] %s import completed for user %s: diaries=%+v, media=%+v",
+			upload.source.Name, userID, stats.Diaries, stats.Media)
+		return c.JSON(http.StatusOK, stats)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
+
+// sourceUpload is an upload parsed by an importer.
+// Photos are read from the upload while they are imported, so it stays open until Close.
+type sourceUpload struct {
+	source  importer.Importer
+	entries []importer.Entry
+	file    multipart.File
+}
+
+// Close closes the upload
+func (u *sourceUpload) Close() error {
+	return u.file.Close()
+}
+
+// readSourceUpload parses the uploaded archive with the importer named in the path.
+// Uploads above the multipart memory limit are spooled to a temporary file and read in place,
+// so their size is not limited, only what their files unpack to.
+func readSourceUpload(c echo.Context, loc *time.Location) (*sourceUpload, error) {
+	source, ok := importer.Lookup(c.PathParam("source"))
+	if !ok {
+		return nil, apis.NewNotFoundError("Unknown import source", nil)
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return nil, apis.NewBadRequestError("Missing upload file", err)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, apis.NewBadRequestError("Failed to open upload", err)
+	}
+
+	archive, err := importer.OpenArchive(fh.Filename, f, fh.Size)
+	if err != nil {
+		f.Close()
+		return nil, apis.NewBadRequestError(err.Error(), nil)
+	}
+	entries, err := source.Parse(archive, loc)
+	if errors.Is(err, importer.ErrNoEntries) {
+		f.Close()
+		return nil, apis.NewBadRequestError(fmt.Sprintf("No %s entries found in the upload", source.Title), nil)
+	}
+	if err != nil {
+		f.Close()
+		return nil, apis.NewBadRequestError(err.Error(), nil)
+	}
+	return &sourceUpload{source: source, entries: entries, file: f}, nil
+}
+
+// importEntries stores entries read by an importer, with their photos as media of the entry.
+// Entries are matched against the diary by day, time and text, so an archive can be imported again.
+// The location has no field of its own and ends the content.
+func importEntries(app *pocketbase.PocketBase, userID string, entries []importer.Entry, loc *time.Location) (*ImportStats, error) {
+	diariesCollection, err := app.Dao().FindCollectionByNameOrId("diaries")
+	if err != nil {
+		return nil, apis.NewBadRequestError("Failed to find diaries collection", err)
+	}
+	mediaCollection, err := app.Dao().FindCollectionByNameOrId("media")
+	if err != nil {
+		return nil, apis.NewBadRequestError("Failed to find media collection", err)
+	}
+
+	existing, err := app.Dao().FindRecordsByFilter(
+		"diaries", "owner = {:owner} && deleted_at = ''", "date", -1, 0,
+		map[string]any{"owner": userID},
+	)
+	if err != nil {
+		return nil, apis.NewBadRequestError("Failed to query diaries", err)
+	}
+	entrySet := make(map[string]bool, len(existing))
+	for _, r := range existing {
+		entrySet[importedEntryKey(extractExportDate(r.GetString("date")), r.GetString("time"), r.GetString("content"))] = true
+	}
+
+	stats := ImportStats{}
+	stats.Diaries.Total = len(entries)
+	for _, entry := range entries {
+		stats.Media.Total += len(entry.Photos)
+
+		content := entry.Content
+		if entry.Location != "" {
+			content += "<p>Location: " + html.EscapeString(entry.Location) + "</p>"
+		}
+		key := importedEntryKey(entry.Date, entry.Time, content)
+		if entrySet[key] {
+			stats.Diaries.Skipped++
+			stats.Media.Skipped += len(entry.Photos)
+			continue
+		}
+
+		// Upload the photos first, their URLs replace the refs in the content
+		var photos []*models.Record
+		urls := make(map[string]string, len(entry.Photos))
+		for _, photo := range entry.Photos {
+			record, err := importPhoto(app, mediaCollection, userID, photo)
+			if err != nil {
+				logger.Warn("[Import] failed to import photo %s of %s: %v", photo.Name, entry.Date, err)
+				stats.Media.Failed++
+				urls[photo.Ref] = ""
+				continue
+			}
+			photos = append(photos, record)
+			urls[photo.Ref] = mediaRecordJSON(record).URL
+		}
+		content = replaceImageSources(content, urls)
+
+		record := models.NewRecord(diariesCollection)
+		record.Set("owner", userID)
+		input := diaryInput{Date: &entry.Date, Time: &entry.Time, Content: &content, Mood: &entry.Mood, Weather: &entry.Weather}
+		if len(entry.Tags) > 0 {
+			input.Tags = &entry.Tags
+		}
+		err := input.apply(app.Dao(), record, loc)
+		if err == nil {
+			err = app.Dao().SaveRecord(record)
+		}
+		if err != nil {
+			logger.Error("[Import] failed to save diary %s: %v", entry.Date, err)
+			stats.Diaries.Failed++
+			for _, photo := range photos {
+				if err := app.Dao().DeleteRecord(photo); err != nil {
+					logger.Warn("[Import] failed to remove photo %s: %v", photo.Id, err)
+				}
+			}
+			stats.Media.Failed += len(photos)
+			continue
+		}
+		entrySet[key] = true
+		stats.Diaries.Imported++
+
+		for _, photo := range photos {
+			photo.Set("diary", []string{record.Id})
+			if err := app.Dao().SaveRecord(photo); err != nil {
+				logger.Warn("[Import] failed to attach photo %s to diary %s: %v", photo.Id, record.Id, err)
+			}
+			stats.Media.Imported++
+		}
+	}
+	return &stats, nil
+}
+
+// importPhoto reads a photo from the upload and stores it as a media record,
+// validated against the media schema like an upload
+func importPhoto(app *pocketbase.PocketBase, collection *models.Collection, userID string, photo importer.Photo) (*models.Record, error) {
+	data, err := photo.File.Read()
+	if err != nil {
+		return nil, err
+	}
+	if mimeType, allowed := config.IsAllowedMediaType(data); !allowed {
+		return nil, fmt.Errorf("disallowed MIME type %s", mimeType)
+	}
+	name := path.Base(photo.Name)
+	file, err := filesystem.NewFileFromBytes(data, name)
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.NewRecord(collection)
+	form := forms.NewRecordUpsert(app, record)
+	if err := form.LoadData(map[string]any{"owner": userID, "name": name}); err != nil {
+		return nil, err
+	}
+	if err := form.AddFiles("file", file); err != nil {
+		return nil, err
+	}
+	if err := form.Submit(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// replaceImageSources points the images of imported content at their media URLs.
+// Images whose URL is empty, photos that failed to import, are removed.
+func replaceImageSources(content string, urls map[string]string) string {
+	return imageTag.ReplaceAllStringFunc(content, func(tag string) string {
+		src := imageTag.FindStringSubmatch(tag)[1]
+		url, ok := urls[html.UnescapeString(src)]
+		switch {
+		case !ok:
+			return tag
+		case url == "":
+			// Keep the paragraph tags the match shares with surrounding text
+			opens, closes := strings.HasPrefix(tag, "<p>"), strings.HasSuffix(tag, "</p>")
+			switch {
+			case opens && !closes:
+				return "<p>"
+			case closes && !opens:
+				return "</p>"
+			}
+			return ""
+		}
+		return strings.Replace(tag, `src="`+src+`"`, `src="`+html.EscapeString(url)+`"`, 1)
+	})
+}
+
+// importedEntryKey identifies an entry by its day, time and text, ignoring images whose URLs
+// change with every import
+func importedEntryKey(date, clock, content string) string {
+	return diaryEntryKey(date, clock, textutil.StripHTML(content))
+}
+
+// rebuildVectorsAfterImport updates the vectors of a user in the background after an import
+func rebuildVectorsAfterImport(app *pocketbase.PocketBase, embeddingService *embedding.EmbeddingService, userID string) {
+	if embeddingService == nil {
+		return
+	}
+	enabled, _ := config.NewConfigService(app).GetBool(userID, "ai.enabled")
+	if !enabled {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		logger.Info("[Import] triggering incremental vector rebuild for user: %s", userID)
+		result, err := embeddingService.BuildIncrementalVectors(ctx, userID)
+		if err != nil {
+			logger.Error("[Import] vector rebuild failed for user %s: %v", userID, err)
+			return
+		}
+		logger.Info("[Import] vector rebuild completed for user %s: %d built, %d failed",
+			userID, result.Success, result.Failed)
+	}()
+}
@@ -0,0 +1,21 @@
+package api
+
+import "testing"
+
+func TestReplaceImageSources(t *testing.T) {
+	urls := map[string]string{"a.jpg": "/api/files/media/1/a.jpg", "b.jpg": ""}
+	tests := []struct {
+		content, want string
+	}{
+		{`<p><img src="a.jpg" alt=""></p>`, `<p><img src="/api/files/media/1/a.jpg" alt=""></p>`},
+		{`<p><img src="b.jpg" alt=""></p><p>text</p>`, `<p>text</p>`},
+		{`<p><img src="b.jpg" alt="">text</p>`, `<p>text</p>`},
+		{`<p>text<img src="b.jpg" alt=""></p>`, `<p>text</p>`},
+		{`<p><img src="https://example.com/c.jpg" alt=""></p>`, `<p><img src="https://example.com/c.jpg" alt=""></p>`},
+	}
+	for _, tt := range tests {
+		if got := replaceImageSources(tt.content, urls); got != tt.want {
+			t.Errorf("replaceImageSources(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
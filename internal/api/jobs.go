@@ -0,0 +1,325 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/jobs"
+	"github.com/songtianlun/diarum/internal/logger"
+)
+
+// defaultJobLimit and maxJobLimit bound the jobs returned per request
+const (
+	defaultJobLimit = 20
+	maxJobLimit     = 100
+)
+
+// Job event stream timing
+const (
+	// jobEventInterval is how often the event stream checks a job for changes
+	jobEventInterval = 500 * time.Millisecond
+	// jobEventKeepAlive resends an unchanged job, so proxies don't close an idle stream
+	jobEventKeepAlive = 15 * time.Second
+)
+
+// JobList lists the export and import jobs of a user, newest first
+type JobList struct {
+	Jobs []jobs.Job `json:"jobs"`
+}
+
+// ImportJobParams are the options an import job was started with
+type ImportJobParams struct {
+	File     string `json:"file"`
+	Size     int64  `json:"size"`
+	Strategy string `json:"strategy"`
+	DryRun   bool   `json:"dry_run,omitempty"`
+}
+
+// RegisterJobRoutes registers the endpoints of background export and import jobs.
+// Jobs are started by POST /api/export?async=true and POST /api/import?async=true.
+func RegisterJobRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, jobService *jobs.JobService) {
+	// List the user's jobs with their status and stats
+	e.Router.GET("/api/jobs", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		limit := defaultJobLimit
+		if value := c.QueryParam("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				return apis.NewBadRequestError("Invalid limit", nil)
+			}
+			limit = min(parsed, maxJobLimit)
+		}
+
+		list, err := jobService.List(authRecord.Id, limit)
+		if err != nil {
+			logger.Error("[GET /api/jobs] error: %v", err)
+			return apis.NewBadRequestError("Failed to list jobs", err)
+		}
+
+		return c.JSON(http.StatusOK, JobList{Jobs: list})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Get a job with its current progress
+	e.Router.GET("/api/jobs/:id", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		job, err := jobService.Get(authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return jobError(err)
+		}
+
+		return c.JSON(http.StatusOK, job)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Stream the progress of a job as server-sent events. Every event carries the job,
+	// the stream ends after the event with its final status.
+	e.Router.GET("/api/jobs/:id/events", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+		userID, id := authRecord.Id, c.PathParam("id")
+
+		job, err := jobService.Get(userID, id)
+		if err != nil {
+			return jobError(err)
+		}
+
+		// Set SSE headers
+		c.Response().Header().Set("Content-Type", "text/event-stream")
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		c.Response().Header().Set("Connection", "keep-alive")
+		c.Response().WriteHeader(http.StatusOK)
+
+		writer := &sseWriter{w: c.Response()}
+		ticker := time.NewTicker(jobEventInterval)
+		defer ticker.Stop()
+
+		var last []byte
+		var lastSent time.Time
+		for {
+			data, _ := json.Marshal(job)
+			if string(data) != string(last) || time.Since(lastSent) >= jobEventKeepAlive {
+				if _, err := fmt.Fprintf(writer, "data: %s\n\n", data); err != nil {
+					return nil
+				}
+				writer.Flush()
+				last, lastSent = data, time.Now()
+			}
+			if jobs.Finished(job.Status) {
+				return nil
+			}
+
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-ticker.C:
+			}
+			if job, err = jobService.Get(userID, id); err != nil {
+				// The job was deleted
+				return nil
+			}
+		}
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Cancel a queued or running job. A cancelled import is rolled back.
+	e.Router.POST("/api/jobs/:id/cancel", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		job, err := jobService.Cancel(authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return jobError(err)
+		}
+
+		return c.JSON(http.StatusOK, job)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Create a download link for the artifact of a completed export, replacing the previous link
+	e.Router.POST("/api/jobs/:id/link", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		link, err := jobService.Link(authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return jobError(err)
+		}
+
+		return c.JSON(http.StatusOK, link)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Download the artifact of a job. The token of the link authorizes the download,
+	// so it works from download managers, and Range requests resume interrupted downloads.
+	// The activity log would store the token with the URL, so the route isn't logged.
+	e.Router.GET("/api/jobs/:id/download", func(c echo.Context) error {
+		if err := jobService.Serve(c.Response(), c.Request(), c.PathParam("id"), c.QueryParam("token")); err != nil {
+			return jobError(err)
+		}
+		return nil
+	})
+
+	// Delete a finished job with its artifact
+	e.Router.DELETE("/api/jobs/:id", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		if err := jobService.Delete(authRecord.Id, c.PathParam("id")); err != nil {
+			return jobError(err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
+
+// jobError converts an error of the job service to an API error
+func jobError(err error) error {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		return apis.NewNotFoundError("Job not found", nil)
+	case errors.Is(err, jobs.ErrNoArtifact):
+		return apis.NewNotFoundError("The job has no file to download, it may have expired", nil)
+	case errors.Is(err, jobs.ErrInvalidLink):
+		return apis.NewForbiddenError("The download link is invalid or expired", nil)
+	case errors.Is(err, jobs.ErrBusy):
+		return apis.NewApiError(http.StatusConflict, "Another export or import job is in progress", nil)
+	case errors.Is(err, jobs.ErrRunning):
+		return apis.NewApiError(http.StatusConflict, "The job is still in progress, cancel it first", nil)
+	case errors.Is(err, jobs.ErrFinished):
+		return apis.NewApiError(http.StatusConflict, "The job has already finished", nil)
+	}
+	logger.Error("[Jobs] error: %v", err)
+	return apis.NewBadRequestError("Job request failed", err)
+}
+
+// startExportJob collects the data of an export and writes it to a temporary file in the background,
+// the job stores it as its artifact
+func startExportJob(c echo.Context, app *pocketbase.PocketBase, jobService *jobs.JobService, userID string, req ExportRequest, loc *time.Location) error {
+	name := "diarum_export_" + time.Now().UTC().Format("20060102_150405") + ".zip"
+	job, err := jobService.Run(userID, jobs.KindExport, req, func(run *jobs.Run) (*jobs.Result, error) {
+		export, err := prepareExport(app, userID, req, ExportFormatZip, loc)
+		if err != nil {
+			return nil, withCause(err)
+		}
+
+		f, err := os.CreateTemp("", "diarum-export-*.zip")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		export.progress = run
+		err = export.write(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return nil, err
+		}
+		return &jobs.Result{Stats: export.stats, Artifact: f.Name(), ArtifactName: name}, nil
+	})
+	if err != nil {
+		return jobError(err)
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// startImportJob imports an uploaded archive in the background.
+// The upload only lives as long as the request, so it is copied to a temporary file first.
+func startImportJob(c echo.Context, app *pocketbase.PocketBase, embeddingService *embedding.EmbeddingService, jobService *jobs.JobService, userID string, fh *multipart.FileHeader, opts ImportOptions) error {
+	if err := checkImportStrategy(&opts); err != nil {
+		return err
+	}
+
+	path, err := spoolUpload(fh)
+	if err != nil {
+		return apis.NewBadRequestError("Failed to read upload", err)
+	}
+
+	params := ImportJobParams{File: fh.Filename, Size: fh.Size, Strategy: opts.Strategy, DryRun: opts.DryRun}
+	job, err := jobService.Run(userID, jobs.KindImport, params, func(run *jobs.Run) (*jobs.Result, error) {
+		defer os.Remove(path)
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open upload: %w", err)
+		}
+		defer f.Close()
+
+		opts.Progress = run
+		stats, err := ImportArchive(app, userID, f, fh.Size, opts)
+		if err != nil {
+			return nil, withCause(err)
+		}
+		if !opts.DryRun {
+			rebuildVectorsAfterImport(app, embeddingService, userID)
+		}
+		return &jobs.Result{Stats: stats}, nil
+	})
+	if err != nil {
+		os.Remove(path)
+		return jobError(err)
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// spoolUpload copies an upload to a temporary file and returns its path
+func spoolUpload(fh *multipart.FileHeader) (string, error) {
+	src, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp("", "diarum-import-*.zip")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// withCause adds the underlying error of an API error to its message,
+// a failed job only keeps the message
+func withCause(err error) error {
+	var apiErr *apis.ApiError
+	if errors.As(err, &apiErr) {
+		if cause, ok := apiErr.RawData().(error); ok && cause != nil {
+			return fmt.Errorf("%s: %w", apiErr.Message, cause)
+		}
+	}
+	return err
+}
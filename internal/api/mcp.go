@@ -0,0 +1,356 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/songtianlun/diarum/internal/apitoken"
+	"github.com/songtianlun/diarum/internal/chat"
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/mcp"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+	"github.com/songtianlun/diarum/internal/stats"
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+const (
+	// mcpDiaryURIPrefix starts the URI of a diary day resource, e.g. diarum://diary/2026-01-28
+	mcpDiaryURIPrefix = "diarum://diary/"
+	// mcpResourcePageSize is the number of days listed per resources/list page
+	mcpResourcePageSize = 100
+	// maxMCPRequestSize is the largest MCP message accepted over HTTP
+	maxMCPRequestSize = 1024 * 1024
+)
+
+// RegisterMCPRoutes serves the MCP server over HTTP. Every request carries an API token,
+// which picks the user and the tools: writing needs diaries:write and semantic search the chat scope.
+func RegisterMCPRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService, rateLimits *ratelimit.Limits, version string) {
+	tokenService := apitoken.NewTokenService(app)
+
+	e.Router.POST("/api/v1/mcp", func(c echo.Context) error {
+		token, err := publicToken(c, tokenService)
+		if err != nil {
+			return err
+		}
+		if err := requireScope(token, apitoken.ScopeDiariesRead); err != nil {
+			return err
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxMCPRequestSize+1))
+		if err != nil {
+			return apis.NewBadRequestError("Failed to read request", err)
+		}
+		if len(body) > maxMCPRequestSize {
+			return apis.NewBadRequestError("Request too large", nil)
+		}
+
+		server := newMCPServer(app, c, embeddingService, rateLimits, version, token)
+		out := server.Handle(c.Request().Context(), body)
+		if out == nil {
+			return c.NoContent(http.StatusAccepted)
+		}
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, out)
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+}
+
+// NewMCPServer builds the MCP server of the journal of a token's owner, for the stdio transport.
+// embeddingService may be nil, semantic search is then left out.
+func NewMCPServer(app *pocketbase.PocketBase, embeddingService *embedding.EmbeddingService, version string, token *apitoken.Token) *mcp.Server {
+	return newMCPServer(app, nil, embeddingService, nil, version, token)
+}
+
+// newMCPServer builds the MCP server of a token's owner with the tools its scopes allow.
+// c is the HTTP request the server answers, nil on stdio; writes made for a request run the record API hooks
+// and semantic searches count against the AI chat limit of rateLimits.
+func newMCPServer(app *pocketbase.PocketBase, c echo.Context, embeddingService *embedding.EmbeddingService, rateLimits *ratelimit.Limits, version string, token *apitoken.Token) *mcp.Server {
+	userId := token.UserID
+	configService := config.NewConfigService(app)
+	chatService := chat.NewChatService(app, embeddingService)
+	statsService := stats.NewStatsService(app)
+
+	tools := []mcp.Tool{
+		{
+			Name: "search_diaries",
+			Description: "Search the diary. query takes keywords and filters like tag:work mood:happy weather:rain " +
+				`after:2026-01-01 before:2026-06-30, "an exact phrase" and -excluded words. Results are newest first.`,
+			InputSchema: mcpSchema(map[string]any{
+				"query":      mcpString("Keywords and filters, empty to list entries by date"),
+				"start_date": mcpString("First day, YYYY-MM-DD"),
+				"end_date":   mcpString("Last day, YYYY-MM-DD"),
+				"limit":      map[string]any{"type": "integer", "description": "Maximum number of entries, default 10, at most 100"},
+			}),
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				var in struct {
+					Query     string `json:"query"`
+					StartDate string `json:"start_date"`
+					EndDate   string `json:"end_date"`
+					Limit     int    `json:"limit"`
+				}
+				if err := mcp.DecodeArgs(args, &in); err != nil {
+					return nil, err
+				}
+				results, err := chatService.SearchDiariesByDateRange(ctx, userId, chat.SearchDiariesArgs{
+					StartDate: in.StartDate,
+					EndDate:   in.EndDate,
+					Filter:    in.Query,
+					Limit:     in.Limit,
+				})
+				if err != nil {
+					return nil, err
+				}
+				return mcpSearchResults(results), nil
+			},
+		},
+		{
+			Name:        "get_diary_by_date",
+			Description: "Get the diary entries of a day, with their time, mood, weather, tags and text.",
+			InputSchema: mcpSchema(map[string]any{
+				"date": mcpString(`Day, YYYY-MM-DD or "today"`),
+			}, "date"),
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				var in struct {
+					Date string `json:"date"`
+				}
+				if err := mcp.DecodeArgs(args, &in); err != nil {
+					return nil, err
+				}
+				day := in.Date
+				if day == "" || day == "today" {
+					day = dateutil.Today(configService.GetLocation(userId))
+				}
+				if !dateutil.ValidDay(day) {
+					return nil, errors.New("invalid date, expected YYYY-MM-DD")
+				}
+
+				records, err := findDayEntries(app, userId, day, "")
+				if err != nil {
+					return nil, errors.New("failed to query diaries")
+				}
+				response := dayResponse(app, day, records)
+				for i := range response.Entries {
+					response.Entries[i].Content = textutil.StripHTML(response.Entries[i].Content)
+				}
+				return struct {
+					Date    string       `json:"date"`
+					Entries []DiaryEntry `json:"entries"`
+				}{day, response.Entries}, nil
+			},
+		},
+		{
+			Name:        "get_stats",
+			Description: "Get writing statistics: entry and word counts, streaks, moods, weather and totals per week, month or year.",
+			InputSchema: mcpSchema(map[string]any{
+				"period": map[string]any{"type": "string", "enum": []string{stats.PeriodWeek, stats.PeriodMonth, stats.PeriodYear}, "description": "Grouping of the totals, default month"},
+			}),
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				var in struct {
+					Period string `json:"period"`
+				}
+				if err := mcp.DecodeArgs(args, &in); err != nil {
+					return nil, err
+				}
+				if in.Period == "" {
+					in.Period = stats.PeriodMonth
+				}
+				if !stats.ValidPeriod(in.Period) {
+					return nil, errors.New("period must be week, month or year")
+				}
+
+				report, err := statsService.Get(userId, configService.GetLocation(userId), in.Period)
+				if err != nil {
+					return nil, errors.New("failed to compute statistics")
+				}
+				// The daily heatmap is meant for charts and would crowd the model's context
+				summary := *report
+				summary.Heatmap = nil
+				return summary, nil
+			},
+		},
+	}
+
+	if embeddingService != nil && token.HasScope(apitoken.ScopeChat) {
+		tools = append(tools, mcp.Tool{
+			Name:        "semantic_search",
+			Description: "Find diary entries about a topic by meaning rather than exact words. Needs AI features and the vector index set up in Diarum.",
+			InputSchema: mcpSchema(map[string]any{
+				"query": mcpString("What to look for, in natural language"),
+				"limit": map[string]any{"type": "integer", "description": "Maximum number of entries, default 10"},
+			}, "query"),
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				var in struct {
+					Query string `json:"query"`
+					Limit int    `json:"limit"`
+				}
+				if err := mcp.DecodeArgs(args, &in); err != nil {
+					return nil, err
+				}
+				if strings.TrimSpace(in.Query) == "" {
+					return nil, errors.New("query is required")
+				}
+				if in.Limit <= 0 {
+					in.Limit = 10
+				}
+				// Every search embeds the query with the user's model
+				if c != nil {
+					if decision := rateLimits.Allow(ratelimit.GroupAIChat, rateLimitKey(c)); !decision.Allowed {
+						return nil, fmt.Errorf("too many AI requests, retry in %d seconds", max(ceilSeconds(decision.RetryAfter), 1))
+					}
+				}
+				results, err := embeddingService.QuerySimilar(ctx, userId, in.Query, min(in.Limit, 100))
+				if err != nil {
+					return nil, err
+				}
+				return mcpSearchResults(results), nil
+			},
+		})
+	}
+
+	if token.HasScope(apitoken.ScopeDiariesWrite) {
+		tools = append(tools, mcp.Tool{
+			Name:        "append_to_today",
+			Description: "Append text to today's diary, starting today's entry when there is none. Blank lines separate paragraphs.",
+			InputSchema: mcpSchema(map[string]any{
+				"text": mcpString("Plain text to add"),
+			}, "text"),
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				var in struct {
+					Text string `json:"text"`
+				}
+				if err := mcp.DecodeArgs(args, &in); err != nil {
+					return nil, err
+				}
+				paragraph := textutil.TextToHTML(in.Text)
+				if paragraph == "" {
+					return nil, errors.New("text is required")
+				}
+
+				loc := configService.GetLocation(userId)
+				record, _, err := appendToDay(app, c, userId, dateutil.Today(loc), paragraph, loc)
+				if err != nil {
+					return nil, err
+				}
+				entry := diaryEntryJSON(app.Dao(), record)
+				entry.Content = textutil.StripHTML(entry.Content)
+				return entry, nil
+			},
+		})
+	}
+
+	return &mcp.Server{
+		Name:    "diarum",
+		Version: version,
+		Instructions: "Tools and resources of the user's personal diary in Diarum. " +
+			"Diary days are resources at " + mcpDiaryURIPrefix + "{date}. Treat the entries as private.",
+		Tools: tools,
+		Templates: []mcp.ResourceTemplate{{
+			URITemplate: mcpDiaryURIPrefix + "{date}",
+			Name:        "Diary day",
+			Description: "The diary entries of a day, date is YYYY-MM-DD",
+			MimeType:    "text/markdown",
+		}},
+		ListResources: func(ctx context.Context, cursor string) ([]mcp.Resource, string, error) {
+			return listMCPDiaryDays(app, userId, cursor)
+		},
+		ReadResource: func(ctx context.Context, uri string) ([]mcp.ResourceContents, error) {
+			day := strings.TrimPrefix(uri, mcpDiaryURIPrefix)
+			if day == uri || !dateutil.ValidDay(day) {
+				return nil, mcp.ErrResourceNotFound
+			}
+			records, err := findDayEntries(app, userId, day, "")
+			if err != nil {
+				return nil, errors.New("failed to query diaries")
+			}
+			if len(records) == 0 {
+				return nil, mcp.ErrResourceNotFound
+			}
+
+			entries := make([]exportDiary, 0, len(records))
+			for _, diary := range diaryEntriesJSON(app.Dao(), records) {
+				entries = append(entries, exportDiary{
+					ID:      diary.ID,
+					Date:    diary.Date,
+					Time:    diary.Time,
+					Content: textutil.StripHTML(diary.Content),
+					Mood:    diary.Mood,
+					Weather: diary.Weather,
+					Tags:    diary.Tags,
+				})
+			}
+			return []mcp.ResourceContents{{URI: uri, MimeType: "text/markdown", Text: generateDayMarkdown(entries)}}, nil
+		},
+	}
+}
+
+// listMCPDiaryDays lists a page of the days with entries as resources, newest first.
+// The cursor is the offset of the page.
+func listMCPDiaryDays(app *pocketbase.PocketBase, userId, cursor string) ([]mcp.Resource, string, error) {
+	offset := 0
+	if cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(cursor)
+		if err != nil || offset < 0 {
+			return nil, "", &mcp.Error{Code: mcp.CodeInvalidParams, Message: "Invalid cursor"}
+		}
+	}
+
+	days := []struct {
+		Day string `db:"day"`
+	}{}
+	err := app.Dao().DB().
+		NewQuery("SELECT DISTINCT substr(date, 1, 10) AS day FROM diaries WHERE owner = {:owner} AND deleted_at = '' ORDER BY day DESC LIMIT {:limit} OFFSET {:offset}").
+		Bind(dbx.Params{"owner": userId, "limit": mcpResourcePageSize + 1, "offset": offset}).
+		All(&days)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list diaries: %w", err)
+	}
+
+	next := ""
+	if len(days) > mcpResourcePageSize {
+		days = days[:mcpResourcePageSize]
+		next = strconv.Itoa(offset + mcpResourcePageSize)
+	}
+	resources := make([]mcp.Resource, 0, len(days))
+	for _, row := range days {
+		resources = append(resources, mcp.Resource{
+			URI:      mcpDiaryURIPrefix + row.Day,
+			Name:     "Diary " + row.Day,
+			MimeType: "text/markdown",
+		})
+	}
+	return resources, next, nil
+}
+
+// mcpSearchResults converts search results to plain text for the model
+func mcpSearchResults(results []embedding.DiarySearchResult) []embedding.DiarySearchResult {
+	for i := range results {
+		results[i].Content = textutil.StripHTML(results[i].Content)
+	}
+	return results
+}
+
+// mcpSchema is the JSON schema of a tool's arguments object
+func mcpSchema(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func mcpString(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/chat"
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/memories"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+)
+
+// Memory is a past day with its diary entries
+type Memory struct {
+	Date    string       `json:"date"`
+	Entries []DiaryEntry `json:"entries"`
+	// YearsAgo is set for the same day in previous years
+	YearsAgo int `json:"years_ago,omitempty"`
+}
+
+// Memories are the "on this day" memories of a user
+type Memories struct {
+	Date     string   `json:"date"`
+	Years    []Memory `json:"years"`
+	WeekAgo  Memory   `json:"week_ago"`
+	MonthAgo Memory   `json:"month_ago"`
+	Empty    bool     `json:"empty"`
+	// Reflection is the AI reflection on the memories, when requested and available
+	Reflection string `json:"reflection,omitempty"`
+}
+
+// memoriesHandler serves "on this day" memories for authenticated users and the public token API
+type memoriesHandler struct {
+	app             *pocketbase.PocketBase
+	configService   *config.ConfigService
+	memoriesService *memories.MemoriesService
+	chatService     *chat.ChatService
+}
+
+func newMemoriesHandler(app *pocketbase.PocketBase, embeddingService *embedding.EmbeddingService) *memoriesHandler {
+	return &memoriesHandler{
+		app:             app,
+		configService:   config.NewConfigService(app),
+		memoriesService: memories.NewMemoriesService(app),
+		chatService:     chat.NewChatService(app, embeddingService),
+	}
+}
+
+// RegisterMemoryRoutes registers the "on this day" endpoint
+func RegisterMemoryRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService, rateLimits *ratelimit.Limits) {
+	handler := newMemoriesHandler(app, embeddingService)
+
+	// Entries from today's month and day in previous years, one week ago and one month ago.
+	// Private entries are included with ?include_private=true, ?reflect=true adds an AI reflection,
+	// which counts against the AI chat limit.
+	e.Router.GET("/api/diaries/on-this-day", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		return handler.respond(c, authRecord.Id, c.QueryParam("include_private") == "true")
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth(), RateLimitWhen(rateLimits, ratelimit.GroupAIChat, wantsReflection))
+}
+
+// respond writes the memories of the user, with a reflection when ?reflect=true and AI is enabled
+func (h *memoriesHandler) respond(c echo.Context, userID string, includePrivate bool) error {
+	onThisDay, err := h.memoriesService.OnThisDay(userID, includePrivate)
+	if err != nil {
+		logger.Error("[Memories] failed to load memories for user %s: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load memories"})
+	}
+
+	years := make([]Memory, 0, len(onThisDay.Years))
+	for _, memory := range onThisDay.Years {
+		years = append(years, h.memoryJSON(memory))
+	}
+
+	response := Memories{
+		Date:     onThisDay.Date,
+		Years:    years,
+		WeekAgo:  h.memoryJSON(onThisDay.WeekAgo),
+		MonthAgo: h.memoryJSON(onThisDay.MonthAgo),
+		Empty:    onThisDay.IsEmpty(),
+	}
+
+	if c.QueryParam("reflect") == "true" && !onThisDay.IsEmpty() {
+		if reflection, ok := h.reflect(c.Request().Context(), userID, onThisDay, includePrivate); ok {
+			response.Reflection = reflection
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// memoryJSON is the API representation of a memory
+func (h *memoriesHandler) memoryJSON(memory memories.Memory) Memory {
+	return Memory{
+		Date:     memory.Date,
+		Entries:  diaryEntriesJSON(h.app.Dao(), memory.Entries),
+		YearsAgo: memory.YearsAgo,
+	}
+}
+
+// reflect asks the chat model to compare today with the memories.
+// Failures are logged and leave the reflection out, the memories are still returned.
+func (h *memoriesHandler) reflect(ctx context.Context, userID string, onThisDay *memories.OnThisDay, includePrivate bool) (string, bool) {
+	enabled, _ := h.configService.GetBool(userID, "ai.enabled")
+	if !enabled {
+		return "", false
+	}
+
+	todayRecords, err := findDayEntries(h.app, userID, onThisDay.Date, "")
+	if err != nil {
+		logger.Warn("[Memories] failed to load today's entries for user %s: %v", userID, err)
+	}
+
+	todayEntries := make([]chat.ReflectionEntry, 0, len(todayRecords))
+	for _, record := range todayRecords {
+		if includePrivate || !record.GetBool("private") {
+			todayEntries = append(todayEntries, reflectionEntry(record))
+		}
+	}
+
+	pastMemories := make([]memories.Memory, 0, len(onThisDay.Years)+2)
+	pastMemories = append(pastMemories, onThisDay.Years...)
+	pastMemories = append(pastMemories, onThisDay.MonthAgo, onThisDay.WeekAgo)
+
+	pastEntries := make([]chat.ReflectionEntry, 0)
+	for _, memory := range pastMemories {
+		for _, record := range memory.Entries {
+			pastEntries = append(pastEntries, reflectionEntry(record))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	reflection, err := h.chatService.GenerateReflection(ctx, userID, onThisDay.Date, todayEntries, pastEntries)
+	if err != nil {
+		logger.Warn("[Memories] failed to generate reflection for user %s: %v", userID, err)
+		return "", false
+	}
+	return reflection, true
+}
+
+func reflectionEntry(record *models.Record) chat.ReflectionEntry {
+	return chat.ReflectionEntry{
+		Date:    strings.TrimSpace(dateutil.DayOf(record.GetString("date")) + " " + record.GetString("time")),
+		Mood:    record.GetString("mood"),
+		Content: record.GetString("content"),
+	}
+}
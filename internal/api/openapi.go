@@ -0,0 +1,346 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/songtianlun/diarum/internal/apitoken"
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/feed"
+	"github.com/songtianlun/diarum/internal/importer"
+	"github.com/songtianlun/diarum/internal/jobs"
+	"github.com/songtianlun/diarum/internal/openapi"
+	"github.com/songtianlun/diarum/internal/revision"
+	"github.com/songtianlun/diarum/internal/stats"
+	"github.com/songtianlun/diarum/internal/webhook"
+)
+
+// ImportUpload is the multipart form of an import
+type ImportUpload struct {
+	File openapi.Binary `json:"file"`
+	// Strategy for entries at the day and time of an existing entry:
+	// skip (default), overwrite, keep-newer, append or merge-with-separator
+	Strategy string `json:"strategy,omitempty"`
+	// DryRun returns the plan of the import without writing anything
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Query parameters shared by several routes
+var (
+	tzParam   = openapi.Param{Name: "tz", Description: "IANA timezone of the client, used when the user has no timezone setting"}
+	tagParam  = openapi.Param{Name: "tag", Description: "Only include diaries carrying this tag"}
+	moodParam = openapi.Param{Name: "mood", Description: "Only include diaries with this mood"}
+
+	feedParams = []openapi.Param{
+		tagParam,
+		moodParam,
+		{Name: "limit", Type: "integer", Description: "Number of entries, 20 by default and at most 100"},
+	}
+
+	asyncParam = openapi.Param{Name: "async", Type: "boolean", Description: "Run as a background job, answered with 202 and the job, see /api/jobs"}
+)
+
+// OpenAPIDocument describes the custom API routes.
+// Every route registered by RegisterRoutes must be listed here, a test checks it.
+func OpenAPIDocument(version string) *openapi.Document {
+	const (
+		user  = openapi.AuthUser
+		token = openapi.AuthToken
+	)
+
+	// Writes based on an outdated version of a diary are answered with its current copy
+	conflictResponse := map[int]any{http.StatusConflict: DiaryConflict{}}
+	// Exports and imports started with async=true are answered with their job
+	jobResponse := map[int]any{http.StatusAccepted: jobs.Job{}}
+
+	return openapi.Build(openapi.Spec{
+		Title:       "Diarum API",
+		Version:     version,
+		Description: "Custom endpoints of Diarum. Diaries, media and tags can also be managed through the PocketBase record API.",
+		Error:       apis.ApiError{},
+		Routes: []openapi.Route{
+			// Diaries
+			{Method: http.MethodGet, Path: "/api/diaries/by-date/:date", Tag: "diaries", Auth: user,
+				Summary:  `Entries of a day, "today" is resolved in the user's timezone`,
+				Query:    []openapi.Param{tzParam},
+				Response: DiaryDay{}},
+			{Method: http.MethodGet, Path: "/api/diaries/exists", Tag: "diaries", Auth: user,
+				Summary: "Days with diary entries, the current month by default",
+				Query: []openapi.Param{
+					{Name: "start", Description: "First day, YYYY-MM-DD"},
+					{Name: "end", Description: "Last day, YYYY-MM-DD"},
+					tagParam, tzParam,
+				},
+				Response: DiaryDates{}},
+			{Method: http.MethodGet, Path: "/api/diaries/stats", Tag: "diaries", Auth: user,
+				Summary:  "Diary count and writing streaks",
+				Query:    []openapi.Param{tzParam},
+				Response: DiaryStreak{}},
+			{Method: http.MethodGet, Path: "/api/diaries/search", Tag: "diaries", Auth: user,
+				Summary: "Full-text search with ranking and highlighted snippets",
+				Query: []openapi.Param{
+					{Name: "q", Description: "Search query, supports phrases, -exclusions and filters like tag:, mood: and before:", Required: true},
+					{Name: "page", Type: "integer"},
+					{Name: "perPage", Type: "integer", Description: "Results per page, at most 100"},
+					{Name: "sort", Description: `"date" sorts by date instead of relevance`},
+					tagParam,
+				},
+				Response: SearchResults{}},
+			{Method: http.MethodGet, Path: "/api/diaries/on-this-day", Tag: "diaries", Auth: user,
+				Summary: "Entries of the same day in previous years, a week and a month ago",
+				Query: []openapi.Param{
+					{Name: "include_private", Type: "boolean"},
+					{Name: "reflect", Type: "boolean", Description: "Add an AI reflection on the memories, limited like AI chat"},
+				},
+				Response: Memories{}},
+			{Method: http.MethodPut, Path: "/api/diaries/:id/tags", Tag: "diaries", Auth: user,
+				Summary: "Replace the tags of a diary by name, pass If-Match to only change the version the client saw",
+				Request: DiaryTags{}, Response: DiaryTags{},
+				Responses: conflictResponse},
+
+			// Revisions
+			{Method: http.MethodGet, Path: "/api/diaries/:id/revisions", Tag: "revisions", Auth: user,
+				Summary: "Revisions of a diary", Response: RevisionList{}},
+			{Method: http.MethodGet, Path: "/api/diaries/:id/revisions/diff", Tag: "revisions", Auth: user,
+				Summary: "Word-level diff between two revisions or a revision and the current diary",
+				Query: []openapi.Param{
+					{Name: "from", Description: `Revision ID or "current"`, Required: true},
+					{Name: "to", Description: `Revision ID or "current", the default`},
+				},
+				Response: RevisionDiff{}},
+			{Method: http.MethodGet, Path: "/api/diaries/:id/revisions/:rid", Tag: "revisions", Auth: user,
+				Summary: "A revision with its content", Response: revision.Revision{}},
+			{Method: http.MethodPost, Path: "/api/diaries/:id/revisions/:rid/restore", Tag: "revisions", Auth: user,
+				Summary:   "Restore a diary to a revision, pass If-Match to only restore the version the client saw",
+				Response:  RestoredDiary{},
+				Responses: conflictResponse},
+
+			// Tags
+			{Method: http.MethodGet, Path: "/api/tags", Tag: "tags", Auth: user,
+				Summary: "Tags with usage counts", Response: TagList{}},
+			{Method: http.MethodPost, Path: "/api/tags", Tag: "tags", Auth: user,
+				Summary: "Create a tag", Request: TagName{}, Response: Tag{}},
+			{Method: http.MethodPut, Path: "/api/tags/:id", Tag: "tags", Auth: user,
+				Summary: "Rename a tag", Request: TagName{}, Response: Tag{}},
+			{Method: http.MethodDelete, Path: "/api/tags/:id", Tag: "tags", Auth: user,
+				Summary: "Delete a tag", Response: SuccessResponse{}},
+			{Method: http.MethodPost, Path: "/api/tags/merge", Tag: "tags", Auth: user,
+				Summary: "Merge tags into a target tag", Request: TagMergeRequest{}, Response: TagMergeResult{}},
+			{Method: http.MethodGet, Path: "/api/tags/usage", Tag: "tags", Auth: user,
+				Summary: "Tag usage over time",
+				Query: []openapi.Param{
+					{Name: "period", Description: "day, month or year, default month"},
+					{Name: "start", Description: "First day, YYYY-MM-DD"},
+					{Name: "end", Description: "Last day, YYYY-MM-DD"},
+					{Name: "tag", Description: "Only count this tag"},
+				},
+				Response: TagUsage{}},
+
+			// Trash
+			{Method: http.MethodGet, Path: "/api/trash", Tag: "trash", Auth: user,
+				Summary: "Trashed diaries and media", Response: TrashList{}},
+			{Method: http.MethodDelete, Path: "/api/trash", Tag: "trash", Auth: user,
+				Summary: "Empty the trash", Response: TrashEmptied{}},
+			{Method: http.MethodPost, Path: "/api/trash/:collection/:id/restore", Tag: "trash", Auth: user,
+				Summary: "Restore a trashed record", Response: RestoredRecord{}},
+			{Method: http.MethodDelete, Path: "/api/trash/:collection/:id", Tag: "trash", Auth: user,
+				Summary: "Delete a trashed record permanently", Response: SuccessResponse{}},
+
+			// Statistics
+			{Method: http.MethodGet, Path: "/api/stats", Tag: "stats", Auth: user,
+				Summary: "Writing statistics",
+				Query: []openapi.Param{
+					{Name: "period", Description: "week, month or year, default month"},
+					tzParam,
+				},
+				Response: stats.Stats{}},
+
+			// Sync
+			{Method: http.MethodGet, Path: "/api/sync/changes", Tag: "sync", Auth: user,
+				Summary: "Changed diaries and media since a cursor, oldest first",
+				Query: []openapi.Param{
+					{Name: "since", Description: "Cursor returned by the previous call"},
+					{Name: "limit", Type: "integer", Description: "At most 1000 changes"},
+				},
+				Response: SyncChanges{}},
+			{Method: http.MethodPost, Path: "/api/sync/push", Tag: "sync", Auth: user,
+				Summary: "Apply a batch of client-side diary edits", Request: SyncPushRequest{}, Response: SyncPushResponse{}},
+
+			// Settings
+			{Method: http.MethodGet, Path: "/api/settings/api-token", Tag: "settings", Auth: user,
+				Summary: "API access status", Response: APIAccess{}},
+			{Method: http.MethodPost, Path: "/api/settings/api-token/toggle", Tag: "settings", Auth: user,
+				Summary: "Toggle API access for all tokens", Response: APIAccessToggle{}},
+			{Method: http.MethodGet, Path: "/api/settings/api-tokens", Tag: "settings", Auth: user,
+				Summary: "API tokens, including expired and revoked ones", Response: APITokenList{}},
+			{Method: http.MethodPost, Path: "/api/settings/api-tokens", Tag: "settings", Auth: user,
+				Summary: "Create an API token", Request: CreateAPITokenRequest{}, Response: CreatedAPIToken{}},
+			{Method: http.MethodPost, Path: "/api/settings/api-tokens/:id/revoke", Tag: "settings", Auth: user,
+				Summary: "Revoke an API token", Response: apitoken.Token{}},
+			{Method: http.MethodGet, Path: "/api/v1/settings", Tag: "settings", Auth: user,
+				Summary: "All settings", Response: SettingsBatch{}},
+			{Method: http.MethodPut, Path: "/api/v1/settings/batch", Tag: "settings", Auth: user,
+				Summary: "Update several settings", Request: SettingsBatch{}, Response: SuccessResponse{}},
+			{Method: http.MethodGet, Path: "/api/v1/settings/:key", Tag: "settings", Auth: user,
+				Summary: "A single setting", Response: Setting{}},
+			{Method: http.MethodPut, Path: "/api/v1/settings/:key", Tag: "settings", Auth: user,
+				Summary: "Update a single setting", Request: SettingValue{}, Response: SuccessResponse{}},
+			{Method: http.MethodDelete, Path: "/api/v1/settings/:key", Tag: "settings", Auth: user,
+				Summary: "Delete a single setting", Response: SuccessResponse{}},
+
+			// AI
+			{Method: http.MethodGet, Path: "/api/ai/settings", Tag: "ai", Auth: user,
+				Summary: "AI provider settings", Response: AISettings{}},
+			{Method: http.MethodPut, Path: "/api/ai/settings", Tag: "ai", Auth: user,
+				Summary: "Save the AI provider settings", Request: AISettings{}, Response: SuccessResponse{}},
+			{Method: http.MethodPost, Path: "/api/ai/models", Tag: "ai", Auth: user,
+				Summary: "Models of an OpenAI-compatible API", Request: ModelsRequest{}, Response: ModelList{}},
+			{Method: http.MethodPost, Path: "/api/ai/vectors/build", Tag: "ai", Auth: user,
+				Summary: "Rebuild the vectors of all diaries", Response: embedding.BuildResult{}},
+			{Method: http.MethodPost, Path: "/api/ai/vectors/build-incremental", Tag: "ai", Auth: user,
+				Summary: "Build the vectors of new and changed diaries", Response: embedding.BuildResult{}},
+			{Method: http.MethodGet, Path: "/api/ai/vectors/stats", Tag: "ai", Auth: user,
+				Summary: "Vector index statistics", Response: embedding.VectorStats{}},
+			{Method: http.MethodGet, Path: "/api/ai/conversations", Tag: "ai", Auth: user,
+				Summary: "Latest conversations", Response: []ConversationSummary{}},
+			{Method: http.MethodPost, Path: "/api/ai/conversations", Tag: "ai", Auth: user,
+				Summary: "Create a conversation", Request: ConversationTitle{}, Response: Conversation{}},
+			{Method: http.MethodGet, Path: "/api/ai/conversations/:id", Tag: "ai", Auth: user,
+				Summary: "A conversation with its messages", Response: ConversationDetail{}},
+			{Method: http.MethodPut, Path: "/api/ai/conversations/:id", Tag: "ai", Auth: user,
+				Summary: "Rename a conversation", Request: ConversationTitle{}, Response: Conversation{}},
+			{Method: http.MethodDelete, Path: "/api/ai/conversations/:id", Tag: "ai", Auth: user,
+				Summary: "Delete a conversation", Response: SuccessResponse{}},
+			{Method: http.MethodPost, Path: "/api/ai/chat", Tag: "ai", Auth: user,
+				Summary: "Send a message, the reply is streamed as server-sent events",
+				Request: ChatRequest{}, ResponseType: "text/event-stream"},
+
+			// Export and import
+			{Method: http.MethodPost, Path: "/api/export", Tag: "export", Auth: user,
+				Summary: "Export diaries, media and conversations as a ZIP, statistics are in the X-Export-Stats header",
+				Query:   []openapi.Param{tzParam, asyncParam},
+				Request: ExportRequest{}, ResponseType: "application/zip",
+				Responses: jobResponse},
+			{Method: http.MethodPost, Path: "/api/import", Tag: "export", Auth: user,
+				Summary: "Import a ZIP created by the export, or plan the import with dry_run",
+				Query:   []openapi.Param{asyncParam},
+				Request: ImportUpload{}, RequestType: openapi.ContentMultipart, Response: ImportStats{},
+				Responses: jobResponse},
+			{Method: http.MethodPost, Path: "/api/import/ics", Tag: "export", Auth: user,
+				Summary: `Add the events of an .ics file to the diary as "events of the day" sections`,
+				Query:   []openapi.Param{tzParam},
+				Request: CalendarImportUpload{}, RequestType: openapi.ContentMultipart, Response: CalendarImportResult{}},
+			{Method: http.MethodGet, Path: "/api/import/sources", Tag: "export", Auth: user,
+				Summary: "Apps whose archives can be imported", Response: []importer.Importer{}},
+			{Method: http.MethodPost, Path: "/api/import/:source/preview", Tag: "export", Auth: user,
+				Summary: "Summarize the entries of another app's archive without importing them",
+				Query:   []openapi.Param{tzParam},
+				Request: SourceImportUpload{}, RequestType: openapi.ContentMultipart, Response: importer.Preview{}},
+			{Method: http.MethodPost, Path: "/api/import/:source", Tag: "export", Auth: user,
+				Summary: "Import the entries and photos of another app's archive, like a Day One, Journey, Diaro or jrnl export",
+				Query:   []openapi.Param{tzParam},
+				Request: SourceImportUpload{}, RequestType: openapi.ContentMultipart, Response: ImportStats{}},
+
+			// Webhooks
+			{Method: http.MethodGet, Path: "/api/webhooks", Tag: "webhooks", Auth: user,
+				Summary: "Webhooks and the events they can subscribe to", Response: WebhookList{}},
+			{Method: http.MethodPost, Path: "/api/webhooks", Tag: "webhooks", Auth: user,
+				Summary: "Create a webhook", Request: CreateWebhookRequest{}, Response: CreatedWebhook{}},
+			{Method: http.MethodPut, Path: "/api/webhooks/:id", Tag: "webhooks", Auth: user,
+				Summary: "Update a webhook", Request: UpdateWebhookRequest{}, Response: webhook.Webhook{}},
+			{Method: http.MethodDelete, Path: "/api/webhooks/:id", Tag: "webhooks", Auth: user,
+				Summary: "Delete a webhook and its delivery log", Status: http.StatusNoContent},
+			{Method: http.MethodPost, Path: "/api/webhooks/:id/test", Tag: "webhooks", Auth: user,
+				Summary: "Send a ping to a webhook", Response: webhook.Delivery{}},
+			{Method: http.MethodGet, Path: "/api/webhooks/:id/deliveries", Tag: "webhooks", Auth: user,
+				Summary:  "Latest deliveries of a webhook",
+				Query:    []openapi.Param{{Name: "limit", Type: "integer", Description: "At most 200 deliveries, default 50"}},
+				Response: DeliveryList{}},
+			{Method: http.MethodPost, Path: "/api/webhooks/:id/deliveries/:deliveryId/redeliver", Tag: "webhooks", Auth: user,
+				Summary: "Queue the payload of a delivery again", Response: webhook.Delivery{}},
+
+			// Jobs
+			{Method: http.MethodGet, Path: "/api/jobs", Tag: "jobs", Auth: user,
+				Summary:  "Background export and import jobs with their status and stats, newest first",
+				Query:    []openapi.Param{{Name: "limit", Type: "integer", Description: "At most 100 jobs, default 20"}},
+				Response: JobList{}},
+			{Method: http.MethodGet, Path: "/api/jobs/:id", Tag: "jobs", Auth: user,
+				Summary: "A job with its current progress", Response: jobs.Job{}},
+			{Method: http.MethodGet, Path: "/api/jobs/:id/events", Tag: "jobs", Auth: user,
+				Summary:      "Server-sent events with the job whenever it changes, until it finishes",
+				ResponseType: "text/event-stream"},
+			{Method: http.MethodPost, Path: "/api/jobs/:id/cancel", Tag: "jobs", Auth: user,
+				Summary: "Cancel a queued or running job, a cancelled import is rolled back", Response: jobs.Job{}},
+			{Method: http.MethodPost, Path: "/api/jobs/:id/link", Tag: "jobs", Auth: user,
+				Summary: "Create an expiring download link for the file of a completed export", Response: jobs.DownloadLink{}},
+			{Method: http.MethodGet, Path: "/api/jobs/:id/download", Tag: "jobs",
+				Summary:      "Download the file of a job with the token of its link, Range requests resume downloads",
+				Query:        []openapi.Param{{Name: "token", Description: "Token of the download link", Required: true}},
+				ResponseType: "application/zip"},
+			{Method: http.MethodDelete, Path: "/api/jobs/:id", Tag: "jobs", Auth: user,
+				Summary: "Delete a finished job and its file", Status: http.StatusNoContent},
+
+			// Public API
+			{Method: http.MethodGet, Path: "/api/v1/diaries", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesRead,
+				Summary: "Entries of a day, or of a date range with start and end",
+				Query: []openapi.Param{
+					{Name: "date", Description: `Day, YYYY-MM-DD or "today"`},
+					{Name: "start", Description: "First day of a range, YYYY-MM-DD"},
+					{Name: "end", Description: "Last day of a range, YYYY-MM-DD"},
+					tagParam,
+				},
+				Response: openapi.OneOf{DiaryDay{}, DiaryRange{}}},
+			{Method: http.MethodPost, Path: "/api/v1/diaries", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesWrite,
+				Summary: "Create a diary entry, the date defaults to today",
+				Request: diaryInput{}, Response: DiaryEntry{}, Status: http.StatusCreated},
+			{Method: http.MethodPut, Path: "/api/v1/diaries/:id", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesWrite,
+				Summary: "Replace the content of a diary entry, pass If-Match or updated to only replace the version the client saw",
+				Request: diaryInput{}, Response: DiaryEntry{},
+				Responses: conflictResponse},
+			{Method: http.MethodPatch, Path: "/api/v1/diaries/:id", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesWrite,
+				Summary: "Update some fields of a diary entry",
+				Request: diaryInput{}, Response: DiaryEntry{},
+				Responses: conflictResponse},
+			{Method: http.MethodPost, Path: "/api/v1/diaries/append", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesWrite,
+				Summary: "Append a paragraph to the last entry of a day, or start one",
+				Request: AppendRequest{}, Response: DiaryEntry{}},
+			{Method: http.MethodPost, Path: "/api/v1/media", Tag: "public", Auth: token, Scope: apitoken.ScopeMedia,
+				Summary: "Upload a media file",
+				Request: MediaUpload{}, RequestType: openapi.ContentMultipart, Response: MediaRecord{}, Status: http.StatusCreated},
+			{Method: http.MethodGet, Path: "/api/v1/memories", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesRead,
+				Summary:  `"On this day" memories without private entries, ?reflect=true also needs the chat scope`,
+				Query:    []openapi.Param{{Name: "reflect", Type: "boolean", Description: "Add an AI reflection on the memories, limited like AI chat"}},
+				Response: Memories{}},
+			{Method: http.MethodGet, Path: "/api/v1/feed.atom", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesRead,
+				Summary: "Atom feed of the recent entries without private ones",
+				Query:   feedParams, ResponseType: "application/atom+xml"},
+			{Method: http.MethodGet, Path: "/api/v1/feed.json", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesRead,
+				Summary: "JSON Feed of the recent entries without private ones",
+				Query:   feedParams, Response: feed.JSONFeed{}, ResponseType: "application/feed+json"},
+			{Method: http.MethodGet, Path: "/api/v1/calendar.ics", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesRead,
+				Summary: "Calendar with an all-day event per entry, without private ones",
+				Query:   []openapi.Param{tagParam, moodParam}, ResponseType: "text/calendar"},
+			{Method: http.MethodPost, Path: "/api/v1/mcp", Tag: "public", Auth: token, Scope: apitoken.ScopeDiariesRead,
+				Summary: "Model Context Protocol endpoint, takes JSON-RPC messages and answers with JSON, 202 for notifications",
+				Request: map[string]any{}, Response: map[string]any{}},
+
+			// Server
+			{Method: http.MethodGet, Path: "/api/version", Tag: "server",
+				Summary: "Server name and version", Response: VersionInfo{}},
+			{Method: http.MethodGet, Path: "/api/openapi.json", Tag: "server",
+				Summary: "This document", Response: map[string]any{}},
+		},
+	})
+}
+
+// RegisterOpenAPIRoutes serves the OpenAPI document of the custom routes
+func RegisterOpenAPIRoutes(e *core.ServeEvent, version string) {
+	doc := OpenAPIDocument(version)
+
+	e.Router.GET("/api/openapi.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, doc)
+	})
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/songtianlun/diarum/internal/ratelimit"
+	"github.com/songtianlun/diarum/internal/webhook"
+)
+
+// TestOpenAPICoversRoutes fails when a registered route is missing from the OpenAPI document,
+// or the document describes a route that doesn't exist
+func TestOpenAPICoversRoutes(t *testing.T) {
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	e := &core.ServeEvent{App: app, Router: echo.New()}
+	rateLimits, _ := ratelimit.NewLimits(func(string) string { return "" })
+
+	RegisterRoutes(app, e, Options{
+		WebhookService: webhook.NewWebhookService(app),
+		RateLimits:     rateLimits,
+		Version:        "test",
+		Name:           "diarum",
+	})
+
+	doc := OpenAPIDocument("test")
+
+	registered := map[string]bool{}
+	for _, route := range e.Router.Router().Routes() {
+		if !strings.HasPrefix(route.Path(), "/api/") {
+			continue
+		}
+		operation := route.Method() + " " + route.Path()
+		registered[operation] = true
+		if !doc.Has(route.Method(), route.Path()) {
+			t.Errorf("%s is not described in the OpenAPI document", operation)
+		}
+	}
+	if len(registered) == 0 {
+		t.Fatal("no routes registered")
+	}
+
+	for _, operation := range doc.Operations() {
+		if !registered[operation] {
+			t.Errorf("%s is described but not registered", operation)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := OpenAPIDocument("1.2.3")
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Info.Version != "1.2.3" {
+		t.Errorf("version = %q", parsed.Info.Version)
+	}
+	for _, name := range []string{"DiaryDay", "DiaryEntry", "DiaryConflict", "ApiError", "Webhook"} {
+		if _, ok := parsed.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s missing", name)
+		}
+	}
+
+	// Every $ref must point at a described schema
+	for _, ref := range strings.Split(string(data), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		if _, ok := parsed.Components.Schemas[name]; !ok {
+			t.Errorf("dangling reference to %s", name)
+		}
+	}
+}
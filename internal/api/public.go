@@ -1,122 +1,209 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 
+	"github.com/songtianlun/diarum/internal/apitoken"
 	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/ratelimit"
 )
 
+// DiaryRange lists the diary entries of a date range, newest day first
+type DiaryRange struct {
+	Diaries []DiaryEntry `json:"diaries"`
+	Total   int          `json:"total"`
+}
+
 // RegisterPublicRoutes registers public API endpoints that use API token authentication
-func RegisterPublicRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
+func RegisterPublicRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService, rateLimits *ratelimit.Limits) {
 	configService := config.NewConfigService(app)
+	tokenService := apitoken.NewTokenService(app)
+	onThisDay := newMemoriesHandler(app, embeddingService)
 
 	// Get diaries by date or date range using API token
 	e.Router.GET("/api/v1/diaries", func(c echo.Context) error {
-		token := c.QueryParam("token")
-		if token == "" {
-			return apis.NewUnauthorizedError("API token is required", nil)
-		}
-
-		// Validate token and get owner using ConfigService
-		userId, err := configService.ValidateTokenAndGetUser(token)
-		if err == config.ErrAPIDisabled {
-			return apis.NewUnauthorizedError("API is disabled for this user", nil)
-		}
-		if err != nil || userId == "" {
-			return apis.NewUnauthorizedError("Invalid API token", nil)
+		userId, err := publicUser(c, tokenService, apitoken.ScopeDiariesRead)
+		if err != nil {
+			return err
 		}
 
 		// Check query parameters
 		date := c.QueryParam("date")
 		start := c.QueryParam("start")
 		end := c.QueryParam("end")
+		tag := c.QueryParam("tag")
 
-		// Single date query
+		// Single date query, "today" is resolved in the user's timezone
 		if date != "" {
-			startTime := date + " 00:00:00.000Z"
-			endTime := date + " 23:59:59.999Z"
-
-			record, err := app.Dao().FindFirstRecordByFilter(
-				"diaries",
-				"date >= {:start} && date <= {:end} && owner = {:owner}",
-				map[string]any{
-					"start": startTime,
-					"end":   endTime,
-					"owner": userId,
-				},
-			)
+			if date == "today" {
+				date = dateutil.Today(configService.GetLocation(userId))
+			}
+			if !dateutil.ValidDay(date) {
+				return apis.NewBadRequestError("Invalid date, expected YYYY-MM-DD", nil)
+			}
 
+			// A day may hold several entries, listed in order
+			records, err := findDayEntries(app, userId, date, tag)
 			if err != nil {
-				return c.JSON(http.StatusOK, map[string]any{
-					"date":    date,
-					"content": "",
-					"exists":  false,
-				})
+				return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query diaries"})
 			}
 
-			return c.JSON(http.StatusOK, map[string]any{
-				"id":      record.GetId(),
-				"date":    date,
-				"content": record.GetString("content"),
-				"mood":    record.GetString("mood"),
-				"weather": record.GetString("weather"),
-				"exists":  true,
-			})
+			return c.JSON(http.StatusOK, dayResponse(app, date, records))
 		}
 
 		// Date range query
 		if start != "" && end != "" {
-			startTime := start + " 00:00:00.000Z"
-			endTime := end + " 23:59:59.999Z"
+			startTime := dateutil.DayStart(start)
+			endTime := dateutil.DayEnd(end)
+
+			filterParams := map[string]any{
+				"start": startTime,
+				"end":   endTime,
+				"owner": userId,
+			}
+			filter := appendTagFilter("date >= {:start} && date <= {:end} && owner = {:owner} && deleted_at = ''", filterParams, tag)
 
 			records, err := app.Dao().FindRecordsByFilter(
 				"diaries",
-				"date >= {:start} && date <= {:end} && owner = {:owner}",
-				"-date",
+				filter,
+				"-date,time,created",
 				-1,
 				0,
-				map[string]any{
-					"start": startTime,
-					"end":   endTime,
-					"owner": userId,
-				},
+				filterParams,
 			)
 
 			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{
-					"error": "Failed to query diaries",
-				})
+				return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query diaries"})
 			}
 
 			// Format results
-			results := make([]map[string]any, 0, len(records))
-			for _, record := range records {
-				dateTime := record.GetString("date")
-				dateStr := dateTime
-				if len(dateTime) >= 10 {
-					dateStr = dateTime[:10]
-				}
-
-				results = append(results, map[string]any{
-					"id":      record.GetId(),
-					"date":    dateStr,
-					"content": record.GetString("content"),
-					"mood":    record.GetString("mood"),
-					"weather": record.GetString("weather"),
-				})
-			}
+			results := diaryEntriesJSON(app.Dao(), records)
 
-			return c.JSON(http.StatusOK, map[string]any{
-				"diaries": results,
-				"total":   len(results),
+			return c.JSON(http.StatusOK, DiaryRange{
+				Diaries: results,
+				Total:   len(results),
 			})
 		}
 
 		return apis.NewBadRequestError("Either 'date' or both 'start' and 'end' query parameters are required", nil)
-	}, apis.ActivityLogger(app))
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+	// "On this day" memories using API token, for widgets and shortcuts.
+	// Private entries are never included, ?reflect=true adds an AI reflection, which needs the chat scope
+	// and counts against the AI chat limit.
+	e.Router.GET("/api/v1/memories", func(c echo.Context) error {
+		token, err := publicToken(c, tokenService)
+		if err != nil {
+			return err
+		}
+		if err := requireScope(token, apitoken.ScopeDiariesRead); err != nil {
+			return err
+		}
+		if c.QueryParam("reflect") == "true" {
+			if err := requireScope(token, apitoken.ScopeChat); err != nil {
+				return err
+			}
+		}
+
+		return onThisDay.respond(c, token.UserID, false)
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic), RateLimitWhen(rateLimits, ratelimit.GroupAIChat, wantsReflection))
+
+	registerPublicWriteRoutes(app, e, configService, tokenService, rateLimits)
+	registerFeedRoutes(app, e, configService, tokenService, rateLimits)
+}
+
+// contextAPITokenKey holds the tokenAuth of a public request set by loadAPIToken
+const contextAPITokenKey = "apiToken"
+
+// tokenAuth is the outcome of authenticating the API token of a request
+type tokenAuth struct {
+	token *apitoken.Token
+	err   error
+}
+
+// loadAPIToken authenticates the API token of a public request before the route runs,
+// so rate limits count the requests of a valid token by the token and all others by IP.
+// The route still checks the outcome with publicToken.
+func loadAPIToken(tokenService *apitoken.TokenService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if secret := publicSecret(c); secret != "" {
+				token, err := tokenService.Authenticate(secret, c.RealIP())
+				c.Set(contextAPITokenKey, tokenAuth{token: token, err: err})
+			}
+			return next(c)
+		}
+	}
+}
+
+// loadedAPIToken returns the token of a request authenticated by loadAPIToken, nil for none
+func loadedAPIToken(c echo.Context) *apitoken.Token {
+	auth, _ := c.Get(contextAPITokenKey).(tokenAuth)
+	if auth.err != nil {
+		return nil
+	}
+	return auth.token
+}
+
+// publicToken authenticates a public request by its API token.
+// The token is sent as "Authorization: Bearer <token>", the ?token= query parameter is still
+// accepted for older integrations but ends up in logs and browser history.
+func publicToken(c echo.Context, tokenService *apitoken.TokenService) (*apitoken.Token, error) {
+	secret := publicSecret(c)
+	if secret == "" {
+		return nil, apis.NewUnauthorizedError("API token is required", nil)
+	}
+
+	auth, loaded := c.Get(contextAPITokenKey).(tokenAuth)
+	if !loaded {
+		auth.token, auth.err = tokenService.Authenticate(secret, c.RealIP())
+	}
+	token, err := auth.token, auth.err
+	switch {
+	case errors.Is(err, apitoken.ErrDisabled), errors.Is(err, apitoken.ErrExpired), errors.Is(err, apitoken.ErrRevoked):
+		return nil, apis.NewUnauthorizedError(err.Error(), nil)
+	case err != nil:
+		return nil, apis.NewUnauthorizedError("Invalid API token", nil)
+	}
+	return token, nil
+}
+
+// publicSecret returns the API token sent with a request, from the Bearer header or the token query parameter
+func publicSecret(c echo.Context) string {
+	secret := ""
+	if header := c.Request().Header.Get("Authorization"); len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		secret = strings.TrimSpace(header[len("Bearer "):])
+	}
+	if secret == "" {
+		secret = c.QueryParam("token")
+	}
+	return secret
+}
+
+// publicUser authenticates a public request, checks its token was granted scope and returns the owner
+func publicUser(c echo.Context, tokenService *apitoken.TokenService, scope string) (string, error) {
+	token, err := publicToken(c, tokenService)
+	if err != nil {
+		return "", err
+	}
+	if err := requireScope(token, scope); err != nil {
+		return "", err
+	}
+	return token.UserID, nil
+}
+
+// requireScope rejects a request whose token lacks scope
+func requireScope(token *apitoken.Token, scope string) error {
+	if !token.HasScope(scope) {
+		return apis.NewForbiddenError("The API token is missing the "+scope+" scope", nil)
+	}
+	return nil
 }
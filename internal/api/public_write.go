@@ -0,0 +1,296 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/forms"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+
+	"github.com/songtianlun/diarum/internal/apitoken"
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/openapi"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+	"github.com/songtianlun/diarum/internal/revision"
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// AppendRequest adds a paragraph of plain text to a day, blank lines separate paragraphs
+type AppendRequest struct {
+	Date string `json:"date,omitempty" form:"date"`
+	Text string `json:"text" form:"text"`
+}
+
+// MediaUpload is the multipart form of a media upload
+type MediaUpload struct {
+	File openapi.Binary `json:"file"`
+	// Diary is the ID of an entry to attach the file to
+	Diary string `json:"diary,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Alt   string `json:"alt,omitempty"`
+}
+
+// registerPublicWriteRoutes registers the token-authenticated write endpoints.
+// Writes run the after-request hooks of the PocketBase record API, so vector builds,
+// revisions and every other hook treat them like edits made in the app.
+func registerPublicWriteRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, configService *config.ConfigService, tokenService *apitoken.TokenService, rateLimits *ratelimit.Limits) {
+	revisionService := revision.NewRevisionService(app)
+
+	// Create a diary entry. The date defaults to today in the user's timezone.
+	e.Router.POST("/api/v1/diaries", func(c echo.Context) error {
+		userId, err := publicUser(c, tokenService, apitoken.ScopeDiariesWrite)
+		if err != nil {
+			return err
+		}
+
+		var input diaryInput
+		if err := c.Bind(&input); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+		loc := configService.GetLocation(userId)
+		if input.Date == nil || *input.Date == "" || *input.Date == "today" {
+			today := dateutil.Today(loc)
+			input.Date = &today
+		}
+
+		collection, err := app.Dao().FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return apis.NewBadRequestError("Failed to find diaries collection", err)
+		}
+		record := models.NewRecord(collection)
+		record.Set("owner", userId)
+		if err := input.apply(app.Dao(), record, loc); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		if err := app.Dao().SaveRecord(record); err != nil {
+			logger.Error("[POST /api/v1/diaries] failed to create diary for user %s: %v", userId, err)
+			return apis.NewBadRequestError("Failed to save diary", err)
+		}
+
+		if err := triggerRecordCreated(app, c, record); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, diaryEntryJSON(app.Dao(), record))
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+
+	// Replace the content of a diary entry, other fields in the body are updated too.
+	// Pass If-Match or updated to only replace the version the client saw.
+	e.Router.PUT("/api/v1/diaries/:id", func(c echo.Context) error {
+		return updatePublicDiary(app, c, configService, tokenService, revisionService, true)
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+
+	// Update some fields of a diary entry, e.g. set mood and weather
+	e.Router.PATCH("/api/v1/diaries/:id", func(c echo.Context) error {
+		return updatePublicDiary(app, c, configService, tokenService, revisionService, false)
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+
+	// Quick capture: append a paragraph to a day, for iOS Shortcuts and scripts.
+	// The text is added to the day's last entry, or starts a new entry when the day has none.
+	// text is plain text, blank lines separate paragraphs. date defaults to today.
+	e.Router.POST("/api/v1/diaries/append", func(c echo.Context) error {
+		userId, err := publicUser(c, tokenService, apitoken.ScopeDiariesWrite)
+		if err != nil {
+			return err
+		}
+
+		var body AppendRequest
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+		paragraph := textutil.TextToHTML(body.Text)
+		if paragraph == "" {
+			return apis.NewBadRequestError("text is required", nil)
+		}
+
+		loc := configService.GetLocation(userId)
+		day := body.Date
+		if day == "" || day == "today" {
+			day = dateutil.Today(loc)
+		}
+		if !dateutil.ValidDay(day) {
+			return apis.NewBadRequestError("Invalid date, expected YYYY-MM-DD", nil)
+		}
+
+		record, created, err := appendToDay(app, c, userId, day, paragraph, loc)
+		switch {
+		case errors.Is(err, errQueryDiaries):
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query diaries"})
+		case err != nil:
+			return err
+		}
+		if created {
+			return c.JSON(http.StatusCreated, diaryEntryJSON(app.Dao(), record))
+		}
+		return c.JSON(http.StatusOK, diaryEntryJSON(app.Dao(), record))
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+
+	// Upload a media file as multipart form data with the field "file".
+	// Optional fields: diary (ID of an entry to attach it to), name and alt.
+	e.Router.POST("/api/v1/media", func(c echo.Context) error {
+		userId, err := publicUser(c, tokenService, apitoken.ScopeMedia)
+		if err != nil {
+			return err
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			return apis.NewBadRequestError("file is required", err)
+		}
+		file, err := filesystem.NewFileFromMultipart(header)
+		if err != nil {
+			return apis.NewBadRequestError("Failed to read file", err)
+		}
+
+		name := c.FormValue("name")
+		if name == "" {
+			name = header.Filename
+		}
+		data := map[string]any{
+			"owner": userId,
+			"name":  name,
+			"alt":   c.FormValue("alt"),
+		}
+		if diaryID := strings.TrimSpace(c.FormValue("diary")); diaryID != "" {
+			if _, err := findOwnedDiary(app, userId, diaryID); err != nil {
+				return err
+			}
+			data["diary"] = []string{diaryID}
+		}
+
+		collection, err := app.Dao().FindCollectionByNameOrId("media")
+		if err != nil {
+			return apis.NewBadRequestError("Failed to find media collection", err)
+		}
+		record := models.NewRecord(collection)
+
+		// The form validates the file size and type against the media schema
+		form := forms.NewRecordUpsert(app, record)
+		if err := form.LoadData(data); err != nil {
+			return apis.NewBadRequestError("Invalid media data", err)
+		}
+		if err := form.AddFiles("file", file); err != nil {
+			return apis.NewBadRequestError("Invalid media file", err)
+		}
+		if err := form.Submit(); err != nil {
+			return apis.NewBadRequestError("Failed to upload media", err)
+		}
+
+		if err := triggerRecordCreated(app, c, record); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, mediaRecordJSON(record))
+	}, apis.ActivityLogger(app), loadAPIToken(tokenService), RateLimit(rateLimits, ratelimit.GroupPublic))
+}
+
+// updatePublicDiary applies a PUT or PATCH of a diary entry through the public API.
+// A replace must carry the new content.
+func updatePublicDiary(app *pocketbase.PocketBase, c echo.Context, configService *config.ConfigService, tokenService *apitoken.TokenService, revisionService *revision.RevisionService, replace bool) error {
+	userId, err := publicUser(c, tokenService, apitoken.ScopeDiariesWrite)
+	if err != nil {
+		return err
+	}
+
+	record, err := findOwnedDiary(app, userId, c.PathParam("id"))
+	if err != nil {
+		return err
+	}
+
+	var input diaryInput
+	if err := c.Bind(&input); err != nil {
+		return apis.NewBadRequestError("Invalid request body", err)
+	}
+	if replace && input.Content == nil {
+		return apis.NewBadRequestError("content is required", nil)
+	}
+
+	if conflict, err := DiaryWriteConflict(c, app.Dao(), revisionService, record, input.Content); conflict || err != nil {
+		return err
+	}
+
+	if err := input.apply(app.Dao(), record, configService.GetLocation(userId)); err != nil {
+		return apis.NewBadRequestError(err.Error(), nil)
+	}
+	if err := app.Dao().SaveRecord(record); err != nil {
+		logger.Error("[%s /api/v1/diaries/:id] failed to update diary %s: %v", c.Request().Method, record.Id, err)
+		return apis.NewBadRequestError("Failed to save diary", err)
+	}
+
+	if err := triggerRecordUpdated(app, c, record); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, diaryEntryJSON(app.Dao(), record))
+}
+
+// errQueryDiaries reports that the diaries of a day could not be loaded
+var errQueryDiaries = errors.New("failed to query diaries")
+
+// appendToDay adds a paragraph of HTML to the last entry of a day, or starts an entry when the day has none.
+// c is the request making the change and runs the record API hooks, nil skips them.
+func appendToDay(app *pocketbase.PocketBase, c echo.Context, userId, day, paragraph string, loc *time.Location) (*models.Record, bool, error) {
+	records, err := findDayEntries(app, userId, day, "")
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", errQueryDiaries, err)
+	}
+
+	if len(records) == 0 {
+		collection, err := app.Dao().FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return nil, false, apis.NewBadRequestError("Failed to find diaries collection", err)
+		}
+		record := models.NewRecord(collection)
+		record.Set("owner", userId)
+		input := diaryInput{Date: &day, Content: &paragraph}
+		if err := input.apply(app.Dao(), record, loc); err != nil {
+			return nil, false, apis.NewBadRequestError(err.Error(), nil)
+		}
+		if err := app.Dao().SaveRecord(record); err != nil {
+			logger.Error("[Append] failed to create diary for user %s: %v", userId, err)
+			return nil, false, apis.NewBadRequestError("Failed to save diary", err)
+		}
+		if c != nil {
+			if err := triggerRecordCreated(app, c, record); err != nil {
+				return nil, false, err
+			}
+		}
+		return record, true, nil
+	}
+
+	record := records[len(records)-1]
+	record.Set("content", record.GetString("content")+paragraph)
+	if err := app.Dao().SaveRecord(record); err != nil {
+		logger.Error("[Append] failed to update diary %s: %v", record.Id, err)
+		return nil, false, apis.NewBadRequestError("Failed to save diary", err)
+	}
+	if c != nil {
+		if err := triggerRecordUpdated(app, c, record); err != nil {
+			return nil, false, err
+		}
+	}
+	return record, false, nil
+}
+
+// triggerRecordCreated runs the after-create hooks of the record API for a record
+// created through a custom endpoint
+func triggerRecordCreated(app *pocketbase.PocketBase, c echo.Context, record *models.Record) error {
+	event := &core.RecordCreateEvent{HttpContext: c, Record: record}
+	event.Collection = record.Collection()
+	return app.OnRecordAfterCreateRequest().Trigger(event)
+}
+
+// triggerRecordUpdated runs the after-update hooks of the record API for a record
+// updated through a custom endpoint. record.OriginalCopy must still hold the previous state.
+func triggerRecordUpdated(app *pocketbase.PocketBase, c echo.Context, record *models.Record) error {
+	event := &core.RecordUpdateEvent{HttpContext: c, Record: record}
+	event.Collection = record.Collection()
+	return app.OnRecordAfterUpdateRequest().Trigger(event)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+)
+
+// RateLimit returns a middleware limiting the requests of a route group.
+// Requests are keyed by the signed in user, or by the API token for public endpoints,
+// and fall back to the client IP. Every response carries the RateLimit-* headers,
+// a rejected request gets a 429 with Retry-After.
+// Place it after RequireRecordAuth, or loadAPIToken for public endpoints, so unauthenticated
+// requests don't use up the user's budget.
+func RateLimit(limits *ratelimit.Limits, group string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			limit := limits.Limit(group)
+			if !limit.Enabled() {
+				return next(c)
+			}
+
+			decision := limits.Allow(group, rateLimitKey(c))
+
+			header := c.Response().Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Window)))
+
+			if !decision.Allowed {
+				retryAfter := max(ceilSeconds(decision.RetryAfter), 1)
+				header.Set("Retry-After", strconv.Itoa(retryAfter))
+				logger.Debug("[RateLimit] %s limit reached for %s", group, c.Request().URL.Path)
+				return apis.NewApiError(
+					http.StatusTooManyRequests,
+					fmt.Sprintf("Too many requests, retry in %d seconds.", retryAfter),
+					nil,
+				)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RateLimitWhen is RateLimit for the requests of a route that match,
+// such as those asking for an AI reflection, other requests pass through
+func RateLimitWhen(limits *ratelimit.Limits, group string, match func(c echo.Context) bool) echo.MiddlewareFunc {
+	limit := RateLimit(limits, group)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		limited := limit(next)
+		return func(c echo.Context) error {
+			if match(c) {
+				return limited(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+// wantsReflection matches requests asking for an AI reflection
+func wantsReflection(c echo.Context) bool {
+	return c.QueryParam("reflect") == "true"
+}
+
+// rateLimitKey identifies the caller of a request.
+// Only tokens that authenticated get a bucket of their own, requests with invalid tokens
+// are keyed by IP, so made up tokens can't create unbounded buckets.
+func rateLimitKey(c echo.Context) string {
+	if authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record); authRecord != nil {
+		return "user:" + authRecord.Id
+	}
+	if token := loadedAPIToken(c); token != nil {
+		return "token:" + token.ID
+	}
+	return "ip:" + c.RealIP()
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+
+	"github.com/songtianlun/diarum/internal/apitoken"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	limits, _ := ratelimit.NewLimits(func(key string) string {
+		if key == ratelimit.EnvPrefix+"PUBLIC" {
+			return "2/1m"
+		}
+		return ""
+	})
+	handler := RateLimit(limits, ratelimit.GroupPublic)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	e := echo.New()
+	// request sends a token as loadAPIToken would have authenticated it, an empty id for an invalid one
+	request := func(tokenID string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/diaries", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if tokenID != "" {
+			c.Set(contextAPITokenKey, tokenAuth{token: &apitoken.Token{ID: tokenID}})
+		} else {
+			c.Set(contextAPITokenKey, tokenAuth{err: apitoken.ErrInvalid})
+		}
+		return rec, handler(c)
+	}
+
+	for i := 0; i < 2; i++ {
+		rec, err := request("token_a")
+		if err != nil {
+			t.Fatalf("request %d rejected: %v", i+1, err)
+		}
+		if got := rec.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("RateLimit-Limit = %q", got)
+		}
+		if got := rec.Header().Get("RateLimit-Policy"); got != "2;w=60" {
+			t.Errorf("RateLimit-Policy = %q", got)
+		}
+	}
+
+	rec, err := request("token_a")
+	var apiErr *apis.ApiError
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: %v, want a 429", err)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+
+	if _, err := request("token_b"); err != nil {
+		t.Errorf("another token was limited: %v", err)
+	}
+
+	// Invalid tokens share the bucket of their IP
+	for i := 0; i < 2; i++ {
+		if _, err := request(""); err != nil {
+			t.Fatalf("invalid token request %d rejected: %v", i+1, err)
+		}
+	}
+	if _, err := request(""); !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		t.Errorf("third invalid token request: %v, want a 429", err)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	limits, _ := ratelimit.NewLimits(func(string) string { return "off" })
+	handler := RateLimit(limits, ratelimit.GroupAIChat)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/ai/chat", nil)
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("disabled limit rejected the request: %v", err)
+	}
+	if rec.Header().Get("RateLimit-Limit") != "" {
+		t.Error("disabled limit sent RateLimit headers")
+	}
+}
+
+func TestRateLimitWhen(t *testing.T) {
+	limits, _ := ratelimit.NewLimits(func(key string) string {
+		if key == ratelimit.EnvPrefix+"AI_CHAT" {
+			return "1/1m"
+		}
+		return ""
+	})
+	handler := RateLimitWhen(limits, ratelimit.GroupAIChat, wantsReflection)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	e := echo.New()
+	request := func(target string) error {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return handler(e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	if err := request("/api/diaries/on-this-day?reflect=true"); err != nil {
+		t.Fatalf("first reflection rejected: %v", err)
+	}
+	var apiErr *apis.ApiError
+	if err := request("/api/diaries/on-this-day?reflect=true"); !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		t.Errorf("second reflection: %v, want a 429", err)
+	}
+	if err := request("/api/diaries/on-this-day"); err != nil {
+		t.Errorf("request without a reflection was limited: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+package api
+
+// SuccessResponse confirms a change that has nothing else to return
+type SuccessResponse struct {
+	Success bool `json:"success"`
+}
+
+// ErrorResponse is returned by a few endpoints when the server fails to read data
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
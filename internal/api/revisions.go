@@ -0,0 +1,181 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/revision"
+	"github.com/songtianlun/diarum/internal/textutil"
+	"github.com/songtianlun/diarum/internal/trash"
+)
+
+// RevisionList lists the revisions of a diary, newest first
+type RevisionList struct {
+	Revisions []revision.Revision `json:"revisions"`
+	Total     int                 `json:"total"`
+}
+
+// RevisionDiff is a word-level diff between two versions of a diary
+type RevisionDiff struct {
+	From  string             `json:"from"`
+	To    string             `json:"to"`
+	Diff  []revision.DiffOp  `json:"diff"`
+	Stats revision.DiffStats `json:"stats"`
+}
+
+// RestoredDiary is a diary after restoring a revision
+type RestoredDiary struct {
+	ID      string `json:"id"`
+	Date    string `json:"date"`
+	Content string `json:"content"`
+	Mood    string `json:"mood"`
+	Weather string `json:"weather"`
+}
+
+// RegisterRevisionRoutes registers diary revision history API endpoints
+func RegisterRevisionRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService) {
+	revisionService := revision.NewRevisionService(app)
+
+	// List revisions of a diary
+	e.Router.GET("/api/diaries/:id/revisions", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		diary, err := findOwnedDiary(app, authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return err
+		}
+
+		revisions, err := revisionService.List(diary.Id)
+		if err != nil {
+			return apis.NewBadRequestError("Failed to fetch revisions", err)
+		}
+
+		return c.JSON(http.StatusOK, RevisionList{
+			Revisions: revisions,
+			Total:     len(revisions),
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Word-level diff between two revisions, or a revision and the current diary
+	e.Router.GET("/api/diaries/:id/revisions/diff", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		diary, err := findOwnedDiary(app, authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return err
+		}
+
+		from := c.QueryParam("from")
+		to := c.QueryParam("to")
+		if from == "" {
+			return apis.NewBadRequestError("Query parameter 'from' is required", nil)
+		}
+
+		// "current" (or empty) refers to the diary as it is now
+		contentOf := func(id string) (string, error) {
+			if id == "" || id == "current" {
+				return diary.GetString("content"), nil
+			}
+			rev, err := revisionService.Get(diary.Id, id)
+			if err != nil {
+				return "", err
+			}
+			return rev.Content, nil
+		}
+
+		oldContent, err := contentOf(from)
+		if err != nil {
+			return apis.NewNotFoundError("Revision not found", err)
+		}
+		newContent, err := contentOf(to)
+		if err != nil {
+			return apis.NewNotFoundError("Revision not found", err)
+		}
+
+		ops, stats := revision.DiffWords(textutil.StripHTML(oldContent), textutil.StripHTML(newContent))
+
+		return c.JSON(http.StatusOK, RevisionDiff{
+			From:  from,
+			To:    to,
+			Diff:  ops,
+			Stats: stats,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Get a single revision with content
+	e.Router.GET("/api/diaries/:id/revisions/:rid", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		diary, err := findOwnedDiary(app, authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return err
+		}
+
+		rev, err := revisionService.Get(diary.Id, c.PathParam("rid"))
+		if err != nil {
+			return apis.NewNotFoundError("Revision not found", err)
+		}
+
+		return c.JSON(http.StatusOK, rev)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Restore a diary to a revision. Pass If-Match to only restore the version the client saw.
+	e.Router.POST("/api/diaries/:id/revisions/:rid/restore", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		diary, err := findOwnedDiary(app, authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return err
+		}
+
+		if conflict, err := DiaryWriteConflict(c, app.Dao(), revisionService, diary, nil); conflict || err != nil {
+			return err
+		}
+
+		if err := revisionService.Restore(diary, c.PathParam("rid")); err != nil {
+			logger.Error("[POST /api/diaries/:id/revisions/:rid/restore] error: %v", err)
+			return apis.NewBadRequestError("Failed to restore revision", err)
+		}
+
+		embeddingService.ScheduleIncrementalBuild(authRecord.Id, "revision restore")
+
+		return c.JSON(http.StatusOK, RestoredDiary{
+			ID:      diary.Id,
+			Date:    extractExportDate(diary.GetString("date")),
+			Content: diary.GetString("content"),
+			Mood:    diary.GetString("mood"),
+			Weather: diary.GetString("weather"),
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
+
+// findOwnedDiary loads a diary by ID and verifies it belongs to the user
+func findOwnedDiary(app *pocketbase.PocketBase, userID, id string) (*models.Record, error) {
+	diary, err := app.Dao().FindRecordById("diaries", id)
+	if err != nil || trash.IsTrashed(diary) {
+		return nil, apis.NewNotFoundError("Diary not found", err)
+	}
+	if diary.GetString("owner") != userID {
+		return nil, apis.NewForbiddenError("Access denied", nil)
+	}
+	return diary, nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/jobs"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+	"github.com/songtianlun/diarum/internal/webhook"
+)
+
+// Options holds what the custom routes depend on
+type Options struct {
+	// EmbeddingService is nil when the vector database failed to open
+	EmbeddingService *embedding.EmbeddingService
+	WebhookService   *webhook.WebhookService
+	JobService       *jobs.JobService
+	RateLimits       *ratelimit.Limits
+	Version          string
+	Name             string
+}
+
+// RegisterRoutes registers all custom API endpoints
+func RegisterRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, opts Options) {
+	RegisterDiaryRoutes(app, e)
+	RegisterTagRoutes(app, e)
+	RegisterRevisionRoutes(app, e, opts.EmbeddingService)
+	RegisterTrashRoutes(app, e, opts.EmbeddingService)
+	RegisterSettingsRoutes(app, e)
+	RegisterAIRoutes(app, e, opts.EmbeddingService, opts.RateLimits)
+	RegisterExportImportRoutes(app, e, opts.EmbeddingService, opts.JobService, opts.RateLimits)
+	RegisterMemoryRoutes(app, e, opts.EmbeddingService, opts.RateLimits)
+	RegisterStatsRoutes(app, e)
+	RegisterSyncRoutes(app, e, opts.EmbeddingService)
+	RegisterPublicRoutes(app, e, opts.EmbeddingService, opts.RateLimits)
+	RegisterCalendarRoutes(app, e, opts.RateLimits)
+	RegisterImporterRoutes(app, e, opts.EmbeddingService)
+	RegisterMCPRoutes(app, e, opts.EmbeddingService, opts.RateLimits, opts.Version)
+	RegisterWebhookRoutes(app, e, opts.WebhookService)
+	RegisterJobRoutes(app, e, opts.JobService)
+	RegisterVersionRoutes(e, opts.Version, opts.Name)
+	RegisterOpenAPIRoutes(e, opts.Version)
+}
@@ -1,9 +1,9 @@
 package api
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase"
@@ -11,24 +11,63 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
 
+	"github.com/songtianlun/diarum/internal/apitoken"
 	"github.com/songtianlun/diarum/internal/config"
 	"github.com/songtianlun/diarum/internal/logger"
 )
 
-// generateToken generates a random 32-character hex token
-func generateToken() (string, error) {
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(bytes), nil
+// APIAccess reports whether the user has API tokens and API access is enabled
+type APIAccess struct {
+	Exists  bool `json:"exists"`
+	Enabled bool `json:"enabled"`
+}
+
+// APIAccessToggle is the API access state after toggling it
+type APIAccessToggle struct {
+	Enabled bool `json:"enabled"`
+}
+
+// APITokenList lists the API tokens of a user and the scopes a token can be granted
+type APITokenList struct {
+	Tokens []apitoken.Token `json:"tokens"`
+	Scopes []string         `json:"scopes"`
+}
+
+// CreateAPITokenRequest creates an API token, expires_in_days of 0 never expires
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// CreatedAPIToken holds the secret of a new API token, it is only returned once
+type CreatedAPIToken struct {
+	Token   string          `json:"token"`
+	Details *apitoken.Token `json:"details"`
+}
+
+// SettingsBatch holds several settings by key
+type SettingsBatch struct {
+	Settings map[string]any `json:"settings"`
+}
+
+// Setting is a single setting
+type Setting struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// SettingValue sets a single setting
+type SettingValue struct {
+	Value any `json:"value"`
 }
 
 // RegisterSettingsRoutes registers settings-related API endpoints
 func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 	configService := config.NewConfigService(app)
+	tokenService := apitoken.NewTokenService(app)
 
-	// Get API token status and value
+	// Get API access status. The tokens themselves are listed by /api/settings/api-tokens.
 	e.Router.GET("/api/settings/api-token", func(c echo.Context) error {
 		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
 		if authRecord == nil {
@@ -37,31 +76,22 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 
 		userId := authRecord.Id
 
-		token, err := configService.GetString(userId, "api.token")
-		if err != nil {
-			logger.Debug("[GET /api/settings/api-token] error getting token: %v", err)
-		}
 		enabled, err := configService.GetBool(userId, "api.enabled")
 		if err != nil {
 			logger.Debug("[GET /api/settings/api-token] error getting enabled: %v", err)
 		}
-
-		if token == "" {
-			return c.JSON(http.StatusOK, map[string]any{
-				"exists":  false,
-				"enabled": false,
-				"token":   "",
-			})
+		tokens, err := tokenService.List(userId)
+		if err != nil {
+			logger.Debug("[GET /api/settings/api-token] error listing tokens: %v", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"exists":  true,
-			"enabled": enabled,
-			"token":   token,
+		return c.JSON(http.StatusOK, APIAccess{
+			Exists:  len(tokens) > 0,
+			Enabled: enabled,
 		})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
-	// Toggle API token enabled/disabled
+	// Toggle API access on or off for all tokens of the user
 	e.Router.POST("/api/settings/api-token/toggle", func(c echo.Context) error {
 		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
 		if authRecord == nil {
@@ -70,83 +100,83 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 
 		userId := authRecord.Id
 
-		token, err := configService.GetString(userId, "api.token")
-		if err != nil {
-			logger.Debug("[POST /api/settings/api-token/toggle] error getting token: %v", err)
-		}
 		enabled, err := configService.GetBool(userId, "api.enabled")
 		if err != nil {
 			logger.Debug("[POST /api/settings/api-token/toggle] error getting enabled: %v", err)
 		}
 
-		if token == "" {
-			// No token exists, create one and enable it
-			newToken, err := generateToken()
-			if err != nil {
-				return apis.NewBadRequestError("Failed to generate token", err)
-			}
+		newEnabled := !enabled
+		if err := configService.Set(userId, "api.enabled", newEnabled); err != nil {
+			return apis.NewBadRequestError("Failed to update API access", err)
+		}
 
-			if err := configService.Set(userId, "api.token", newToken); err != nil {
-				return apis.NewBadRequestError("Failed to save token", err)
-			}
-			if err := configService.Set(userId, "api.enabled", true); err != nil {
-				return apis.NewBadRequestError("Failed to save enabled status", err)
-			}
+		return c.JSON(http.StatusOK, APIAccessToggle{Enabled: newEnabled})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
-			return c.JSON(http.StatusOK, map[string]any{
-				"enabled": true,
-				"token":   newToken,
-			})
+	// List the user's API tokens, including expired and revoked ones
+	e.Router.GET("/api/settings/api-tokens", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
 		}
 
-		// Toggle existing token
-		newEnabled := !enabled
-		if err := configService.Set(userId, "api.enabled", newEnabled); err != nil {
-			return apis.NewBadRequestError("Failed to update token", err)
+		tokens, err := tokenService.List(authRecord.Id)
+		if err != nil {
+			logger.Error("[GET /api/settings/api-tokens] error: %v", err)
+			return apis.NewBadRequestError("Failed to list API tokens", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"enabled": newEnabled,
-			"token":   token,
+		return c.JSON(http.StatusOK, APITokenList{
+			Tokens: tokens,
+			Scopes: apitoken.Scopes,
 		})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
-	// Reset API token (generate new one)
-	e.Router.POST("/api/settings/api-token/reset", func(c echo.Context) error {
+	// Create an API token. The secret is only returned by this response.
+	// expires_in_days of 0 creates a token that never expires.
+	e.Router.POST("/api/settings/api-tokens", func(c echo.Context) error {
 		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
 		if authRecord == nil {
 			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
 		}
 
-		userId := authRecord.Id
+		var body CreateAPITokenRequest
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+		if body.ExpiresInDays < 0 {
+			return apis.NewBadRequestError("expires_in_days must not be negative", nil)
+		}
 
-		// Generate new token
-		newToken, err := generateToken()
+		var expires time.Time
+		if body.ExpiresInDays > 0 {
+			expires = time.Now().AddDate(0, 0, body.ExpiresInDays)
+		}
+
+		secret, token, err := tokenService.Create(authRecord.Id, strings.TrimSpace(body.Name), body.Scopes, expires)
 		if err != nil {
-			return apis.NewBadRequestError("Failed to generate token", err)
+			return apis.NewBadRequestError(err.Error(), nil)
 		}
 
-		// Save new token
-		if err := configService.Set(userId, "api.token", newToken); err != nil {
-			return apis.NewBadRequestError("Failed to save token", err)
+		return c.JSON(http.StatusOK, CreatedAPIToken{
+			Token:   secret,
+			Details: token,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Revoke an API token, requests made with it are rejected from now on
+	e.Router.POST("/api/settings/api-tokens/:id/revoke", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
 		}
 
-		// Ensure enabled is set (default to true for reset)
-		enabled, err := configService.GetBool(userId, "api.enabled")
+		token, err := tokenService.Revoke(authRecord.Id, c.PathParam("id"))
 		if err != nil {
-			logger.Debug("[POST /api/settings/api-token/reset] error getting enabled: %v", err)
-		}
-		if !enabled {
-			if err := configService.Set(userId, "api.enabled", true); err != nil {
-				logger.Debug("[POST /api/settings/api-token/reset] error setting enabled: %v", err)
-			}
-			enabled = true
+			return apis.NewNotFoundError("API token not found", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"enabled": enabled,
-			"token":   newToken,
-		})
+		return c.JSON(http.StatusOK, token)
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Get all settings (new v1 API)
@@ -163,9 +193,7 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 			return apis.NewBadRequestError("Failed to get settings", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"settings": settings,
-		})
+		return c.JSON(http.StatusOK, SettingsBatch{Settings: settings})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Batch update settings (new v1 API)
@@ -177,9 +205,7 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 
 		userId := authRecord.Id
 
-		var body struct {
-			Settings map[string]any `json:"settings"`
-		}
+		var body SettingsBatch
 		if err := c.Bind(&body); err != nil {
 			return apis.NewBadRequestError("Invalid request body", err)
 		}
@@ -195,9 +221,7 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 			return apis.NewBadRequestError("Failed to save settings", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"success": true,
-		})
+		return c.JSON(http.StatusOK, SuccessResponse{Success: true})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Get single setting by key
@@ -220,9 +244,9 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 			return apis.NewBadRequestError("Failed to get setting", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"key":   key,
-			"value": value,
+		return c.JSON(http.StatusOK, Setting{
+			Key:   key,
+			Value: value,
 		})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
@@ -241,9 +265,7 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 			return apis.NewBadRequestError("Unknown setting key: "+key, nil)
 		}
 
-		var body struct {
-			Value any `json:"value"`
-		}
+		var body SettingValue
 		if err := c.Bind(&body); err != nil {
 			return apis.NewBadRequestError("Invalid request body", err)
 		}
@@ -252,9 +274,7 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 			return apis.NewBadRequestError("Failed to save setting", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"success": true,
-		})
+		return c.JSON(http.StatusOK, SuccessResponse{Success: true})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 
 	// Delete single setting by key
@@ -276,8 +296,6 @@ func RegisterSettingsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
 			return apis.NewBadRequestError("Failed to delete setting", err)
 		}
 
-		return c.JSON(http.StatusOK, map[string]any{
-			"success": true,
-		})
+		return c.JSON(http.StatusOK, SuccessResponse{Success: true})
 	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
 }
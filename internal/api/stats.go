@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/stats"
+)
+
+// RegisterStatsRoutes registers the writing statistics endpoint
+func RegisterStatsRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
+	configService := config.NewConfigService(app)
+	statsService := stats.NewStatsService(app)
+
+	// Full writing statistics: streaks, word and character counts, heatmap,
+	// weekday frequency, mood and weather distributions and media counts.
+	// ?period=week|month|year groups the statistics over time, default month.
+	e.Router.GET("/api/stats", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		period := c.QueryParam("period")
+		if period == "" {
+			period = stats.PeriodMonth
+		}
+		if !stats.ValidPeriod(period) {
+			return apis.NewBadRequestError("period must be week, month or year", nil)
+		}
+
+		report, err := statsService.Get(authRecord.Id, userLocation(c, configService, authRecord.Id), period)
+		if err != nil {
+			logger.Error("[Stats] failed to compute statistics for user %s: %v", authRecord.Id, err)
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute statistics"})
+		}
+
+		return c.JSON(http.StatusOK, report)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
@@ -0,0 +1,383 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/changes"
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/revision"
+	"github.com/songtianlun/diarum/internal/trash"
+)
+
+// Sync limits
+const (
+	defaultSyncLimit = 200
+	maxSyncLimit     = 1000
+	maxPushChanges   = 100
+)
+
+// Push operations and result statuses
+const (
+	syncOpCreate = "create"
+	syncOpUpdate = "update"
+	syncOpDelete = "delete"
+
+	syncApplied  = "applied"
+	syncConflict = "conflict"
+	syncRejected = "rejected"
+)
+
+// syncPushChange is a client-side edit sent to /api/sync/push
+type syncPushChange struct {
+	// ClientID is echoed back so clients can match results, e.g. to learn the ID of a created diary
+	ClientID   string `json:"client_id"`
+	Op         string `json:"op"`
+	Collection string `json:"collection"`
+	ID         string `json:"id"`
+	// BaseUpdated is the updated timestamp of the server copy the edit was based on
+	BaseUpdated string     `json:"base_updated"`
+	Data        diaryInput `json:"data"`
+}
+
+// syncPushResult reports the outcome of a single pushed change
+type syncPushResult struct {
+	ClientID string       `json:"client_id,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Status   string       `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Record   *DiaryRecord `json:"record,omitempty"`
+	// Server is the current server copy when the change conflicts, nil if it was deleted
+	Server *DiaryRecord `json:"server,omitempty"`
+	// Merge suggests a merge of the pushed and the server content of a conflicting update
+	Merge *revision.MergeResult `json:"merge,omitempty"`
+}
+
+// DiaryRecord is a diary entry with its timestamps, as seen by sync clients
+type DiaryRecord struct {
+	DiaryEntry
+	Created string `json:"created"`
+	Updated string `json:"updated"`
+}
+
+// MediaRecord is a media file with its timestamps, as seen by sync clients
+type MediaRecord struct {
+	ID      string   `json:"id"`
+	File    string   `json:"file"`
+	Name    string   `json:"name"`
+	Alt     string   `json:"alt"`
+	Diary   []string `json:"diary"`
+	URL     string   `json:"url"`
+	Created string   `json:"created"`
+	Updated string   `json:"updated"`
+}
+
+// SyncChange is a changed record, op is "upsert" with the current record or "delete"
+type SyncChange struct {
+	Seq        int64  `json:"seq"`
+	Collection string `json:"collection"`
+	ID         string `json:"id"`
+	Op         string `json:"op"`
+	// Record is a DiaryRecord or a MediaRecord
+	Record any `json:"record,omitempty"`
+}
+
+// SyncChanges is a page of changes, pass the cursor as ?since= to get the next one
+type SyncChanges struct {
+	Cursor  string       `json:"cursor"`
+	HasMore bool         `json:"has_more"`
+	Changes []SyncChange `json:"changes"`
+}
+
+// SyncPushRequest is a batch of client-side diary edits
+type SyncPushRequest struct {
+	Changes []syncPushChange `json:"changes"`
+}
+
+// SyncPushResponse reports the outcome of each pushed change and the latest cursor
+type SyncPushResponse struct {
+	Results []syncPushResult `json:"results"`
+	Cursor  string           `json:"cursor"`
+}
+
+// RegisterSyncRoutes registers the delta sync endpoints for offline clients
+func RegisterSyncRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService) {
+	configService := config.NewConfigService(app)
+	revisionService := revision.NewRevisionService(app)
+	trashService := trash.NewTrashService(app)
+
+	// Changes since a cursor, oldest first. Each diary or media record appears once with its
+	// current state, trashed and deleted records are reported with op "delete".
+	// Pass the returned cursor as ?since= on the next call, repeat while has_more is true.
+	e.Router.GET("/api/sync/changes", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		var since int64
+		if raw := c.QueryParam("since"); raw != "" {
+			parsed, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || parsed < 0 {
+				return apis.NewBadRequestError("Invalid cursor", nil)
+			}
+			since = parsed
+		}
+
+		limit := defaultSyncLimit
+		if raw := c.QueryParam("limit"); raw != "" {
+			if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+				limit = parsed
+			}
+		}
+		if limit > maxSyncLimit {
+			limit = maxSyncLimit
+		}
+
+		log, err := changes.Since(app.Dao(), authRecord.Id, since, limit)
+		if err != nil {
+			logger.Error("[Sync] %v", err)
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read changes"})
+		}
+
+		records, err := loadChangedRecords(app.Dao(), log)
+		if err != nil {
+			logger.Error("[Sync] failed to load changed records: %v", err)
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read changes"})
+		}
+
+		cursor := since
+		items := make([]SyncChange, 0, len(log))
+		for _, change := range log {
+			cursor = change.Seq
+			item := SyncChange{
+				Seq:        change.Seq,
+				Collection: change.Collection,
+				ID:         change.RecordID,
+				Op:         "delete",
+			}
+			if record := records[change.RecordID]; record != nil && !change.Deleted && !trash.IsTrashed(record) {
+				item.Op = "upsert"
+				item.Record = syncRecordJSON(app.Dao(), record)
+			}
+			items = append(items, item)
+		}
+
+		return c.JSON(http.StatusOK, SyncChanges{
+			Cursor:  strconv.FormatInt(cursor, 10),
+			HasMore: len(log) == limit,
+			Changes: items,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Apply a batch of client-side diary edits. Updates and deletes carry the updated timestamp
+	// they were based on, a change whose base is outdated is not applied and reported as a
+	// conflict together with the server copy. Each change is applied on its own.
+	e.Router.POST("/api/sync/push", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+		userID := authRecord.Id
+
+		var body SyncPushRequest
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+		if len(body.Changes) == 0 {
+			return apis.NewBadRequestError("changes is required", nil)
+		}
+		if len(body.Changes) > maxPushChanges {
+			return apis.NewBadRequestError("Too many changes, push at most "+strconv.Itoa(maxPushChanges)+" at once", nil)
+		}
+
+		loc := configService.GetLocation(userID)
+		diariesChanged := false
+
+		results := make([]syncPushResult, 0, len(body.Changes))
+		for _, change := range body.Changes {
+			result := syncPushResult{ClientID: change.ClientID, ID: change.ID}
+
+			if change.Collection != "" && change.Collection != "diaries" {
+				result.Status = syncRejected
+				result.Error = "only diaries can be pushed, upload media through the media collection"
+				results = append(results, result)
+				continue
+			}
+
+			switch change.Op {
+			case syncOpCreate:
+				collection, err := app.Dao().FindCollectionByNameOrId("diaries")
+				if err != nil {
+					result.Status = syncRejected
+					result.Error = "diaries collection not found"
+					break
+				}
+				record := models.NewRecord(collection)
+				record.Set("owner", userID)
+				if err := change.Data.apply(app.Dao(), record, loc); err != nil {
+					result.Status = syncRejected
+					result.Error = err.Error()
+					break
+				}
+				if err := app.Dao().SaveRecord(record); err != nil {
+					result.Status = syncRejected
+					result.Error = "failed to save diary"
+					logger.Error("[Sync] failed to create diary for user %s: %v", userID, err)
+					break
+				}
+				result.ID = record.Id
+				result.Status = syncApplied
+				result.Record = diaryRecordJSON(app.Dao(), record)
+				diariesChanged = true
+
+			case syncOpUpdate, syncOpDelete:
+				record, _ := app.Dao().FindRecordById("diaries", change.ID)
+				if record == nil || record.GetString("owner") != userID || trash.IsTrashed(record) {
+					// Deleted on the server, the client decides whether to re-create it
+					result.Status = syncConflict
+					result.Error = "diary was deleted"
+					break
+				}
+				if !sameUpdated(record, change.BaseUpdated) {
+					result.Status = syncConflict
+					result.Error = "diary was changed on the server"
+					result.Server = diaryRecordJSON(app.Dao(), record)
+					if change.Op == syncOpUpdate && change.Data.Content != nil {
+						merge := diaryMerge(revisionService, record, change.BaseUpdated, *change.Data.Content)
+						result.Merge = &merge
+					}
+					break
+				}
+
+				if change.Op == syncOpDelete {
+					if err := trashService.MoveToTrash(record); err != nil {
+						result.Status = syncRejected
+						result.Error = "failed to delete diary"
+						break
+					}
+					if err := embeddingService.DeleteDiaryVector(context.Background(), userID, record.Id); err != nil {
+						logger.Warn("[Sync] failed to remove vector for diary %s: %v", record.Id, err)
+					}
+					result.Status = syncApplied
+					break
+				}
+
+				original := record.OriginalCopy()
+				if err := change.Data.apply(app.Dao(), record, loc); err != nil {
+					result.Status = syncRejected
+					result.Error = err.Error()
+					break
+				}
+				if err := app.Dao().SaveRecord(record); err != nil {
+					result.Status = syncRejected
+					result.Error = "failed to save diary"
+					logger.Error("[Sync] failed to update diary %s: %v", record.Id, err)
+					break
+				}
+				if err := revisionService.SnapshotOnUpdate(original, record, change.BaseUpdated != ""); err != nil {
+					logger.Error("[Revision] failed to snapshot diary %s: %v", record.Id, err)
+				}
+				result.Status = syncApplied
+				result.Record = diaryRecordJSON(app.Dao(), record)
+				diariesChanged = true
+
+			default:
+				result.Status = syncRejected
+				result.Error = "op must be create, update or delete"
+			}
+
+			results = append(results, result)
+		}
+
+		if diariesChanged {
+			embeddingService.ScheduleIncrementalBuild(userID, "sync push")
+		}
+
+		cursor, err := changes.Latest(app.Dao(), userID)
+		if err != nil {
+			logger.Warn("[Sync] %v", err)
+		}
+
+		return c.JSON(http.StatusOK, SyncPushResponse{
+			Results: results,
+			Cursor:  strconv.FormatInt(cursor, 10),
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
+
+// loadChangedRecords loads the records referenced by change log entries, keyed by ID
+func loadChangedRecords(dao *daos.Dao, log []changes.Change) (map[string]*models.Record, error) {
+	ids := make(map[string][]string)
+	for _, change := range log {
+		if !change.Deleted {
+			ids[change.Collection] = append(ids[change.Collection], change.RecordID)
+		}
+	}
+
+	result := make(map[string]*models.Record)
+	for collection, collectionIDs := range ids {
+		records, err := dao.FindRecordsByIds(collection, collectionIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			result[record.Id] = record
+		}
+	}
+	return result, nil
+}
+
+// syncRecordJSON is the sync representation of a diary or media record
+func syncRecordJSON(dao *daos.Dao, record *models.Record) any {
+	if record.Collection().Name == "diaries" {
+		return diaryRecordJSON(dao, record)
+	}
+	return mediaRecordJSON(record)
+}
+
+// diaryRecordJSON is the sync representation of a diary record
+func diaryRecordJSON(dao *daos.Dao, record *models.Record) *DiaryRecord {
+	return &DiaryRecord{
+		DiaryEntry: diaryEntryJSON(dao, record),
+		Created:    record.GetString("created"),
+		Updated:    record.GetString("updated"),
+	}
+}
+
+// mediaRecordJSON is the sync representation of a media record
+func mediaRecordJSON(record *models.Record) *MediaRecord {
+	return &MediaRecord{
+		ID:      record.Id,
+		File:    record.GetString("file"),
+		Name:    record.GetString("name"),
+		Alt:     record.GetString("alt"),
+		Diary:   record.GetStringSlice("diary"),
+		URL:     "/api/files/" + record.Collection().Id + "/" + record.Id + "/" + record.GetString("file"),
+		Created: record.GetString("created"),
+		Updated: record.GetString("updated"),
+	}
+}
+
+// sameUpdated reports whether the record is still at the version a client based its edit on
+func sameUpdated(record *models.Record, base string) bool {
+	if base == "" {
+		return false
+	}
+	parsed, err := types.ParseDateTime(base)
+	if err != nil {
+		return false
+	}
+	return parsed.String() == record.GetDateTime("updated").String()
+}
@@ -0,0 +1,520 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/revision"
+)
+
+// tagDiariesJoin expands the multi-relation tags column of diaries into rows.
+// Diaries without tags may store an empty string, so fall back to an empty array.
+const tagDiariesJoin = "diaries d, json_each(CASE WHEN json_valid(d.tags) THEN d.tags ELSE '[]' END) je"
+
+// maxTagNameLength mirrors the max length of the tags.name field.
+// Records are saved through the Dao, which skips schema validation, so it is checked here.
+const maxTagNameLength = 50
+
+// tagWithCount represents a tag together with the number of diaries using it
+type tagWithCount struct {
+	ID      string `db:"id" json:"id"`
+	Name    string `db:"name" json:"name"`
+	Count   int    `db:"count" json:"count"`
+	Created string `db:"created" json:"created"`
+}
+
+// tagUsagePoint represents how often a tag was used within a period
+type tagUsagePoint struct {
+	Period string `db:"period" json:"period"`
+	TagID  string `db:"tag_id" json:"tag_id"`
+	Name   string `db:"name" json:"name"`
+	Count  int    `db:"count" json:"count"`
+}
+
+// TagList lists the tags of a user by name
+type TagList struct {
+	Tags  []tagWithCount `json:"tags"`
+	Total int            `json:"total"`
+}
+
+// TagName creates or renames a tag
+type TagName struct {
+	Name string `json:"name"`
+}
+
+// Tag is a tag without its usage
+type Tag struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// TagMergeRequest merges the source tags into the target tag
+type TagMergeRequest struct {
+	SourceIDs []string `json:"source_ids"`
+	TargetID  string   `json:"target_id"`
+}
+
+// TagMergeResult is the target tag of a merge with the number of removed tags and updated diaries
+type TagMergeResult struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Merged         int    `json:"merged"`
+	DiariesUpdated int    `json:"diaries_updated"`
+}
+
+// TagUsage lists how often tags were used per period
+type TagUsage struct {
+	Usage []tagUsagePoint `json:"usage"`
+}
+
+// DiaryTags are the tags of a diary by name
+type DiaryTags struct {
+	ID   string   `json:"id,omitempty"`
+	Tags []string `json:"tags"`
+}
+
+// RegisterTagRoutes registers tag management API endpoints
+func RegisterTagRoutes(app *pocketbase.PocketBase, e *core.ServeEvent) {
+	revisionService := revision.NewRevisionService(app)
+
+	// List tags with usage counts
+	e.Router.GET("/api/tags", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		tags := []tagWithCount{}
+		err := app.Dao().DB().
+			NewQuery(`SELECT t.id, t.name, t.created,
+				(SELECT COUNT(*) FROM ` + tagDiariesJoin + ` WHERE je.value = t.id AND d.owner = t.owner AND d.deleted_at = '') AS count
+				FROM tags t WHERE t.owner = {:owner} ORDER BY t.name`).
+			Bind(map[string]any{"owner": authRecord.Id}).
+			All(&tags)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query tags"})
+		}
+
+		return c.JSON(http.StatusOK, TagList{
+			Tags:  tags,
+			Total: len(tags),
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Create a tag
+	e.Router.POST("/api/tags", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		var body TagName
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+
+		name := normalizeTagName(body.Name)
+		if err := validateTagName(name); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+
+		if existing, _ := findTagByName(app.Dao(), authRecord.Id, name); existing != nil {
+			return apis.NewBadRequestError("Tag already exists: "+name, nil)
+		}
+
+		ids, err := findOrCreateTags(app.Dao(), authRecord.Id, []string{name})
+		if err != nil || len(ids) == 0 {
+			return apis.NewBadRequestError("Failed to create tag", err)
+		}
+
+		return c.JSON(http.StatusOK, Tag{
+			ID:   ids[0],
+			Name: name,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Rename a tag
+	e.Router.PUT("/api/tags/:id", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		tag, err := findOwnedTag(app.Dao(), authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return err
+		}
+
+		var body TagName
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+
+		name := normalizeTagName(body.Name)
+		if err := validateTagName(name); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+
+		if existing, _ := findTagByName(app.Dao(), authRecord.Id, name); existing != nil && existing.Id != tag.Id {
+			return apis.NewBadRequestError("Tag already exists: "+name+", use merge instead", nil)
+		}
+
+		tag.Set("name", name)
+		if err := app.Dao().SaveRecord(tag); err != nil {
+			return apis.NewBadRequestError("Failed to rename tag", err)
+		}
+
+		return c.JSON(http.StatusOK, Tag{
+			ID:   tag.Id,
+			Name: name,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Delete a tag (references on diaries are removed by PocketBase)
+	e.Router.DELETE("/api/tags/:id", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		tag, err := findOwnedTag(app.Dao(), authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return err
+		}
+
+		if err := app.Dao().DeleteRecord(tag); err != nil {
+			return apis.NewBadRequestError("Failed to delete tag", err)
+		}
+
+		return c.JSON(http.StatusOK, SuccessResponse{Success: true})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Merge one or more tags into a target tag
+	e.Router.POST("/api/tags/merge", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		var body TagMergeRequest
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+
+		if len(body.SourceIDs) == 0 || body.TargetID == "" {
+			return apis.NewBadRequestError("source_ids and target_id are required", nil)
+		}
+
+		target, err := findOwnedTag(app.Dao(), authRecord.Id, body.TargetID)
+		if err != nil {
+			return err
+		}
+
+		sources := make(map[string]bool, len(body.SourceIDs))
+		for _, id := range body.SourceIDs {
+			if id == target.Id {
+				continue
+			}
+			if _, err := findOwnedTag(app.Dao(), authRecord.Id, id); err != nil {
+				return err
+			}
+			sources[id] = true
+		}
+
+		updated := 0
+		removed := 0
+		err = app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+			diaries, err := txDao.FindRecordsByFilter(
+				"diaries",
+				"owner = {:owner}",
+				"",
+				-1,
+				0,
+				map[string]any{"owner": authRecord.Id},
+			)
+			if err != nil {
+				return err
+			}
+
+			for _, diary := range diaries {
+				current := diary.GetStringSlice("tags")
+				merged := make([]string, 0, len(current))
+				changed := false
+				seen := make(map[string]bool, len(current))
+				for _, id := range current {
+					if sources[id] {
+						id = target.Id
+						changed = true
+					}
+					if seen[id] {
+						continue
+					}
+					seen[id] = true
+					merged = append(merged, id)
+				}
+				if !changed {
+					continue
+				}
+				diary.Set("tags", merged)
+				if err := txDao.SaveRecord(diary); err != nil {
+					return err
+				}
+				updated++
+			}
+
+			for id := range sources {
+				// The source may have been deleted since it was checked
+				source, err := txDao.FindRecordById("tags", id)
+				if err != nil || source.GetString("owner") != authRecord.Id {
+					continue
+				}
+				if err := txDao.DeleteRecord(source); err != nil {
+					return err
+				}
+				removed++
+			}
+			return nil
+		})
+		if err != nil {
+			return apis.NewBadRequestError("Failed to merge tags", err)
+		}
+
+		return c.JSON(http.StatusOK, TagMergeResult{
+			ID:             target.Id,
+			Name:           target.GetString("name"),
+			Merged:         removed,
+			DiariesUpdated: updated,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Tag usage over time, grouped by day, month or year
+	e.Router.GET("/api/tags/usage", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		format := "%Y-%m"
+		switch c.QueryParam("period") {
+		case "day":
+			format = "%Y-%m-%d"
+		case "year":
+			format = "%Y"
+		case "", "month":
+		default:
+			return apis.NewBadRequestError("period must be one of day, month, year", nil)
+		}
+
+		query := `SELECT strftime('` + format + `', d.date) AS period, t.id AS tag_id, t.name, COUNT(*) AS count
+			FROM ` + tagDiariesJoin + ` JOIN tags t ON t.id = je.value
+			WHERE d.owner = {:owner} AND d.deleted_at = ''`
+		params := map[string]any{"owner": authRecord.Id}
+
+		if start := c.QueryParam("start"); start != "" {
+			query += " AND d.date >= {:start}"
+			params["start"] = dateutil.DayStart(start)
+		}
+		if end := c.QueryParam("end"); end != "" {
+			query += " AND d.date <= {:end}"
+			params["end"] = dateutil.DayEnd(end)
+		}
+		if tag := c.QueryParam("tag"); tag != "" {
+			query += " AND t.name = {:tag}"
+			params["tag"] = tag
+		}
+		query += " GROUP BY period, t.id ORDER BY period, t.name"
+
+		usage := []tagUsagePoint{}
+		if err := app.Dao().DB().NewQuery(query).Bind(params).All(&usage); err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query tag usage"})
+		}
+
+		return c.JSON(http.StatusOK, TagUsage{Usage: usage})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Replace the tags of a diary by name, creating missing tags.
+	// Pass If-Match or updated to only change the version the client saw.
+	e.Router.PUT("/api/diaries/:id/tags", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		diary, err := findOwnedDiary(app, authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return err
+		}
+
+		if conflict, err := DiaryWriteConflict(c, app.Dao(), revisionService, diary, nil); conflict || err != nil {
+			return err
+		}
+
+		var body DiaryTags
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+
+		for _, raw := range body.Tags {
+			if name := normalizeTagName(raw); name != "" {
+				if err := validateTagName(name); err != nil {
+					return apis.NewBadRequestError(err.Error(), nil)
+				}
+			}
+		}
+
+		ids, err := findOrCreateTags(app.Dao(), authRecord.Id, body.Tags)
+		if err != nil {
+			return apis.NewBadRequestError("Failed to save tags", err)
+		}
+
+		diary.Set("tags", ids)
+		if err := app.Dao().SaveRecord(diary); err != nil {
+			return apis.NewBadRequestError("Failed to update diary tags", err)
+		}
+
+		return c.JSON(http.StatusOK, DiaryTags{
+			ID:   diary.Id,
+			Tags: getTagNames(app.Dao(), diary),
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
+
+// normalizeTagName trims whitespace and a leading '#' from a tag name
+func normalizeTagName(name string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+}
+
+// validateTagName checks that a normalized tag name fits the tags schema
+func validateTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("Tag name is required")
+	}
+	if utf8.RuneCountInString(name) > maxTagNameLength {
+		return fmt.Errorf("Tag name must be at most %d characters", maxTagNameLength)
+	}
+	return nil
+}
+
+// findTagByName finds a user's tag by its exact name
+func findTagByName(dao *daos.Dao, userID, name string) (*models.Record, error) {
+	return dao.FindFirstRecordByFilter(
+		"tags",
+		"owner = {:owner} && name = {:name}",
+		map[string]any{"owner": userID, "name": name},
+	)
+}
+
+// findOwnedTag loads a tag by ID and verifies it belongs to the user
+func findOwnedTag(dao *daos.Dao, userID, id string) (*models.Record, error) {
+	tag, err := dao.FindRecordById("tags", id)
+	if err != nil {
+		return nil, apis.NewNotFoundError("Tag not found", err)
+	}
+	if tag.GetString("owner") != userID {
+		return nil, apis.NewForbiddenError("Access denied", nil)
+	}
+	return tag, nil
+}
+
+// findOrCreateTags resolves tag names to IDs, creating tags that don't exist yet.
+// The returned IDs keep the input order with duplicates and blanks removed.
+func findOrCreateTags(dao *daos.Dao, userID string, names []string) ([]string, error) {
+	ids := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+
+	var collection *models.Collection
+	for _, raw := range names {
+		name := normalizeTagName(raw)
+		if name == "" || seen[name] {
+			continue
+		}
+		if err := validateTagName(name); err != nil {
+			return nil, err
+		}
+		seen[name] = true
+
+		if existing, _ := findTagByName(dao, userID, name); existing != nil {
+			ids = append(ids, existing.Id)
+			continue
+		}
+
+		if collection == nil {
+			var err error
+			collection, err = dao.FindCollectionByNameOrId("tags")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		record := models.NewRecord(collection)
+		record.Set("name", name)
+		record.Set("owner", userID)
+		if err := dao.SaveRecord(record); err != nil {
+			return nil, err
+		}
+		ids = append(ids, record.Id)
+	}
+
+	return ids, nil
+}
+
+// getTagNames returns the tag names attached to a diary record
+func getTagNames(dao *daos.Dao, diary *models.Record) []string {
+	return getTagNamesBatch(dao, []*models.Record{diary})[diary.Id]
+}
+
+// getTagNamesBatch returns the tag names of each diary record by diary id, loading the tags in one query
+func getTagNamesBatch(dao *daos.Dao, diaries []*models.Record) map[string][]string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, diary := range diaries {
+		for _, id := range diary.GetStringSlice("tags") {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	byID := make(map[string]string, len(ids))
+	if len(ids) > 0 {
+		tags, err := dao.FindRecordsByIds("tags", ids)
+		if err == nil {
+			for _, tag := range tags {
+				byID[tag.Id] = tag.GetString("name")
+			}
+		}
+	}
+
+	names := make(map[string][]string, len(diaries))
+	for _, diary := range diaries {
+		diaryNames := make([]string, 0, len(diary.GetStringSlice("tags")))
+		for _, id := range diary.GetStringSlice("tags") {
+			if name, ok := byID[id]; ok {
+				diaryNames = append(diaryNames, name)
+			}
+		}
+		names[diary.Id] = diaryNames
+	}
+	return names
+}
+
+// appendTagFilter narrows a diaries filter to entries carrying the named tag
+func appendTagFilter(filter string, params map[string]any, tag string) string {
+	tag = normalizeTagName(tag)
+	if tag == "" {
+		return filter
+	}
+	params["tag"] = tag
+	return filter + " && tags.name ?= {:tag}"
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/testapp"
+)
+
+// serveTags sends a request to the tag routes as the given user and decodes the JSON response into out
+func serveTags(t *testing.T, app *pocketbase.PocketBase, user *models.Record, method, path string, body, out any) int {
+	t.Helper()
+	router := echo.New()
+	router.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(apis.ContextAuthRecordKey, user)
+			return next(c)
+		}
+	})
+	RegisterTagRoutes(app, &core.ServeEvent{App: app, Router: router})
+
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code == http.StatusOK && out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("failed to decode %s %s: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+// newTag creates a tag of a user
+func newTag(t *testing.T, app *pocketbase.PocketBase, owner *models.Record, name string) *models.Record {
+	t.Helper()
+	return testapp.Record(t, app, "tags", map[string]any{"owner": owner.Id, "name": name})
+}
+
+// newTaggedDiary creates a diary of a user on a day with the given tags
+func newTaggedDiary(t *testing.T, app *pocketbase.PocketBase, owner *models.Record, day string, tags ...*models.Record) *models.Record {
+	t.Helper()
+	ids := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		ids = append(ids, tag.Id)
+	}
+	return testapp.Record(t, app, "diaries", map[string]any{
+		"owner": owner.Id, "date": day + " 00:00:00.000Z", "content": "<p>" + day + "</p>", "tags": ids,
+	})
+}
+
+func TestTagUsageCounts(t *testing.T) {
+	app := testapp.New(t)
+	alice := testapp.User(t, app, "alice")
+	bob := testapp.User(t, app, "bob")
+
+	walk := newTag(t, app, alice, "walk")
+	park := newTag(t, app, alice, "park")
+	newTag(t, app, alice, "unused")
+	newTaggedDiary(t, app, alice, "2024-01-05", walk, park)
+	newTaggedDiary(t, app, alice, "2024-02-10", walk)
+	trashed := newTaggedDiary(t, app, alice, "2024-02-11", walk)
+	trashed.Set("deleted_at", "2024-02-12 00:00:00.000Z")
+	if err := app.Dao().SaveRecord(trashed); err != nil {
+		t.Fatalf("failed to trash diary: %v", err)
+	}
+	// Tags of other users are neither listed nor counted
+	newTaggedDiary(t, app, bob, "2024-01-05", newTag(t, app, bob, "walk"))
+
+	var list TagList
+	if code := serveTags(t, app, alice, http.MethodGet, "/api/tags", nil, &list); code != http.StatusOK {
+		t.Fatalf("GET /api/tags = %d", code)
+	}
+	counts := make(map[string]int, len(list.Tags))
+	for _, tag := range list.Tags {
+		counts[tag.Name] = tag.Count
+	}
+	if want := map[string]int{"park": 1, "unused": 0, "walk": 2}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("tag counts = %v, want %v", counts, want)
+	}
+
+	var usage TagUsage
+	if code := serveTags(t, app, alice, http.MethodGet, "/api/tags/usage?period=month", nil, &usage); code != http.StatusOK {
+		t.Fatalf("GET /api/tags/usage = %d", code)
+	}
+	want := []tagUsagePoint{
+		{Period: "2024-01", TagID: park.Id, Name: "park", Count: 1},
+		{Period: "2024-01", TagID: walk.Id, Name: "walk", Count: 1},
+		{Period: "2024-02", TagID: walk.Id, Name: "walk", Count: 1},
+	}
+	if !reflect.DeepEqual(usage.Usage, want) {
+		t.Errorf("usage = %+v, want %+v", usage.Usage, want)
+	}
+
+	if code := serveTags(t, app, alice, http.MethodGet, "/api/tags/usage?period=week", nil, nil); code == http.StatusOK {
+		t.Errorf("GET /api/tags/usage?period=week succeeded, want an error")
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	app := testapp.New(t)
+	alice := testapp.User(t, app, "alice")
+	bob := testapp.User(t, app, "bob")
+
+	travel := newTag(t, app, alice, "travel")
+	trip := newTag(t, app, alice, "trip")
+	journey := newTag(t, app, alice, "journey")
+	park := newTag(t, app, alice, "park")
+	both := newTaggedDiary(t, app, alice, "2024-01-01", trip, travel, park)
+	source := newTaggedDiary(t, app, alice, "2024-01-02", journey)
+	untouched := newTaggedDiary(t, app, alice, "2024-01-03", park)
+	bobTag := newTag(t, app, bob, "trip")
+	bobDiary := newTaggedDiary(t, app, bob, "2024-01-01", bobTag)
+
+	// Tags of other users can't be merged
+	request := TagMergeRequest{SourceIDs: []string{trip.Id, bobTag.Id}, TargetID: travel.Id}
+	if code := serveTags(t, app, alice, http.MethodPost, "/api/tags/merge", request, nil); code == http.StatusOK {
+		t.Fatalf("merging another user's tag succeeded")
+	}
+	if _, err := app.Dao().FindRecordById("tags", trip.Id); err != nil {
+		t.Fatalf("rejected merge removed a source tag: %v", err)
+	}
+
+	var result TagMergeResult
+	request = TagMergeRequest{SourceIDs: []string{trip.Id, journey.Id, travel.Id}, TargetID: travel.Id}
+	if code := serveTags(t, app, alice, http.MethodPost, "/api/tags/merge", request, &result); code != http.StatusOK {
+		t.Fatalf("POST /api/tags/merge = %d", code)
+	}
+	if want := (TagMergeResult{ID: travel.Id, Name: "travel", Merged: 2, DiariesUpdated: 2}); result != want {
+		t.Errorf("merge result = %+v, want %+v", result, want)
+	}
+
+	// Relations move to the target, a diary carrying both keeps the target once
+	for _, tt := range []struct {
+		diary *models.Record
+		want  []string
+	}{
+		{both, []string{travel.Id, park.Id}},
+		{source, []string{travel.Id}},
+		{untouched, []string{park.Id}},
+		{bobDiary, []string{bobTag.Id}},
+	} {
+		diary, err := app.Dao().FindRecordById("diaries", tt.diary.Id)
+		if err != nil {
+			t.Fatalf("failed to load diary: %v", err)
+		}
+		if got := diary.GetStringSlice("tags"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tags of %s = %v, want %v", diary.GetString("date"), got, tt.want)
+		}
+	}
+
+	// The sources are deleted, the target and other users' tags remain
+	for _, id := range []string{trip.Id, journey.Id} {
+		if _, err := app.Dao().FindRecordById("tags", id); err == nil {
+			t.Errorf("source tag %s still exists", id)
+		}
+	}
+	for _, id := range []string{travel.Id, bobTag.Id} {
+		if _, err := app.Dao().FindRecordById("tags", id); err != nil {
+			t.Errorf("tag %s was removed: %v", id, err)
+		}
+	}
+}
+
+func TestGetTagNamesBatch(t *testing.T) {
+	app := testapp.New(t)
+	alice := testapp.User(t, app, "alice")
+
+	walk := newTag(t, app, alice, "walk")
+	park := newTag(t, app, alice, "park")
+	first := newTaggedDiary(t, app, alice, "2024-01-01", park, walk)
+	second := newTaggedDiary(t, app, alice, "2024-01-02", walk)
+	untagged := newTaggedDiary(t, app, alice, "2024-01-03")
+
+	got := getTagNamesBatch(app.Dao(), []*models.Record{first, second, untagged})
+	want := map[string][]string{
+		first.Id:    {"park", "walk"},
+		second.Id:   {"walk"},
+		untagged.Id: {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getTagNamesBatch() = %v, want %v", got, want)
+	}
+	if names := getTagNames(app.Dao(), first); !reflect.DeepEqual(names, []string{"park", "walk"}) {
+		t.Errorf("getTagNames() = %v", names)
+	}
+}
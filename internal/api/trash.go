@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/trash"
+)
+
+// TrashList lists the trashed records of a user
+type TrashList struct {
+	Items []trash.Item `json:"items"`
+	Total int          `json:"total"`
+}
+
+// RestoredRecord is a record restored from the trash
+type RestoredRecord struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	Success    bool   `json:"success"`
+}
+
+// TrashEmptied reports how many records were deleted permanently
+type TrashEmptied struct {
+	Deleted int `json:"deleted"`
+}
+
+// RegisterTrashRoutes registers trash bin API endpoints
+func RegisterTrashRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, embeddingService *embedding.EmbeddingService) {
+	trashService := trash.NewTrashService(app)
+
+	// List trashed diaries and media
+	e.Router.GET("/api/trash", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		items, err := trashService.List(authRecord.Id)
+		if err != nil {
+			logger.Error("[GET /api/trash] error: %v", err)
+			return apis.NewBadRequestError("Failed to fetch trash", err)
+		}
+
+		return c.JSON(http.StatusOK, TrashList{
+			Items: items,
+			Total: len(items),
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Restore a trashed record
+	e.Router.POST("/api/trash/:collection/:id/restore", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		record, err := trashService.FindTrashed(authRecord.Id, c.PathParam("collection"), c.PathParam("id"))
+		if err != nil {
+			return apis.NewNotFoundError("Record not found in trash", err)
+		}
+
+		if err := trashService.Restore(record); err != nil {
+			return apis.NewBadRequestError("Failed to restore record", err)
+		}
+
+		if record.Collection().Name == "diaries" {
+			embeddingService.ScheduleIncrementalBuild(authRecord.Id, "trash restore")
+		}
+
+		return c.JSON(http.StatusOK, RestoredRecord{
+			ID:         record.Id,
+			Collection: record.Collection().Name,
+			Success:    true,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Permanently delete a trashed record
+	e.Router.DELETE("/api/trash/:collection/:id", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		record, err := trashService.FindTrashed(authRecord.Id, c.PathParam("collection"), c.PathParam("id"))
+		if err != nil {
+			return apis.NewNotFoundError("Record not found in trash", err)
+		}
+
+		if err := trashService.Purge(record); err != nil {
+			return apis.NewBadRequestError("Failed to delete record", err)
+		}
+
+		return c.JSON(http.StatusOK, SuccessResponse{Success: true})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Empty the trash
+	e.Router.DELETE("/api/trash", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		items, err := trashService.List(authRecord.Id)
+		if err != nil {
+			return apis.NewBadRequestError("Failed to fetch trash", err)
+		}
+
+		deleted := 0
+		for _, item := range items {
+			record, err := trashService.FindTrashed(authRecord.Id, item.Collection, item.ID)
+			if err != nil {
+				continue
+			}
+			if err := trashService.Purge(record); err != nil {
+				logger.Error("[DELETE /api/trash] failed to delete %s %s: %v", item.Collection, item.ID, err)
+				continue
+			}
+			deleted++
+		}
+
+		return c.JSON(http.StatusOK, TrashEmptied{Deleted: deleted})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
@@ -7,12 +7,18 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// VersionInfo is the name and version of the server
+type VersionInfo struct {
+	Version string `json:"version"`
+	Name    string `json:"name"`
+}
+
 // RegisterVersionRoutes registers the version API endpoint
 func RegisterVersionRoutes(e *core.ServeEvent, version, name string) {
 	e.Router.GET("/api/version", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]string{
-			"version": version,
-			"name":    name,
+		return c.JSON(http.StatusOK, VersionInfo{
+			Version: version,
+			Name:    name,
 		})
 	})
 }
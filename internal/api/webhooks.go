@@ -0,0 +1,221 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/webhook"
+)
+
+// defaultDeliveryLimit and maxDeliveryLimit bound the delivery log returned per request
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+// WebhookList lists the webhooks of a user and the events they can subscribe to
+type WebhookList struct {
+	Webhooks []webhook.Webhook `json:"webhooks"`
+	Events   []string          `json:"events"`
+}
+
+// CreateWebhookRequest creates a webhook
+type CreateWebhookRequest struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// UpdateWebhookRequest updates a webhook, fields left out keep their current value
+type UpdateWebhookRequest struct {
+	Name    string   `json:"name,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Events  []string `json:"events,omitempty"`
+	Enabled bool     `json:"enabled,omitempty"`
+}
+
+// CreatedWebhook holds the signing secret of a new webhook, it is only returned once
+type CreatedWebhook struct {
+	Secret  string           `json:"secret"`
+	Webhook *webhook.Webhook `json:"webhook"`
+}
+
+// DeliveryList lists the deliveries of a webhook, newest first
+type DeliveryList struct {
+	Deliveries []webhook.Delivery `json:"deliveries"`
+}
+
+// RegisterWebhookRoutes registers webhook management and delivery log endpoints
+func RegisterWebhookRoutes(app *pocketbase.PocketBase, e *core.ServeEvent, webhookService *webhook.WebhookService) {
+	// List the user's webhooks and the events they can subscribe to
+	e.Router.GET("/api/webhooks", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		hooks, err := webhookService.List(authRecord.Id)
+		if err != nil {
+			logger.Error("[GET /api/webhooks] error: %v", err)
+			return apis.NewBadRequestError("Failed to list webhooks", err)
+		}
+
+		return c.JSON(http.StatusOK, WebhookList{
+			Webhooks: hooks,
+			Events:   webhook.Events,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Create a webhook. The signing secret is only returned by this response.
+	e.Router.POST("/api/webhooks", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		var body CreateWebhookRequest
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+
+		secret, hook, err := webhookService.Create(authRecord.Id, body.Name, body.URL, body.Events)
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+
+		return c.JSON(http.StatusOK, CreatedWebhook{
+			Secret:  secret,
+			Webhook: hook,
+		})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Update a webhook. Fields left out of the body keep their current value.
+	e.Router.PUT("/api/webhooks/:id", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		record, err := webhookService.Find(authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return apis.NewNotFoundError("Webhook not found", err)
+		}
+
+		body := UpdateWebhookRequest{
+			Name:    record.GetString("name"),
+			URL:     record.GetString("url"),
+			Events:  record.GetStringSlice("events"),
+			Enabled: record.GetBool("enabled"),
+		}
+		if err := c.Bind(&body); err != nil {
+			return apis.NewBadRequestError("Invalid request body", err)
+		}
+
+		hook, err := webhookService.Update(authRecord.Id, record.Id, body.Name, body.URL, body.Events, body.Enabled)
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+
+		return c.JSON(http.StatusOK, hook)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Delete a webhook and its delivery log
+	e.Router.DELETE("/api/webhooks/:id", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		if err := webhookService.Delete(authRecord.Id, c.PathParam("id")); err != nil {
+			if err == webhook.ErrNotFound {
+				return apis.NewNotFoundError("Webhook not found", err)
+			}
+			return apis.NewBadRequestError("Failed to delete webhook", err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Send a ping to a webhook and return the logged delivery
+	e.Router.POST("/api/webhooks/:id/test", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		record, err := webhookService.Find(authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return apis.NewNotFoundError("Webhook not found", err)
+		}
+
+		delivery, err := webhookService.Test(record)
+		if err != nil {
+			logger.Error("[POST /api/webhooks/:id/test] error: %v", err)
+			return apis.NewBadRequestError("Failed to test webhook", err)
+		}
+
+		return c.JSON(http.StatusOK, delivery)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// List the latest deliveries of a webhook, newest first
+	e.Router.GET("/api/webhooks/:id/deliveries", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		record, err := webhookService.Find(authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return apis.NewNotFoundError("Webhook not found", err)
+		}
+
+		limit := defaultDeliveryLimit
+		if value := c.QueryParam("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				return apis.NewBadRequestError("Invalid limit", nil)
+			}
+			limit = min(parsed, maxDeliveryLimit)
+		}
+
+		deliveries, err := webhookService.Deliveries(record.Id, limit)
+		if err != nil {
+			logger.Error("[GET /api/webhooks/:id/deliveries] error: %v", err)
+			return apis.NewBadRequestError("Failed to list deliveries", err)
+		}
+
+		return c.JSON(http.StatusOK, DeliveryList{Deliveries: deliveries})
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+
+	// Queue the payload of a delivery again, the new delivery is returned
+	e.Router.POST("/api/webhooks/:id/deliveries/:deliveryId/redeliver", func(c echo.Context) error {
+		authRecord, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record)
+		if authRecord == nil {
+			return apis.NewUnauthorizedError("The request requires valid authorization token.", nil)
+		}
+
+		record, err := webhookService.Find(authRecord.Id, c.PathParam("id"))
+		if err != nil {
+			return apis.NewNotFoundError("Webhook not found", err)
+		}
+		delivery, err := webhookService.FindDelivery(record, c.PathParam("deliveryId"))
+		if err != nil {
+			return apis.NewNotFoundError("Delivery not found", err)
+		}
+
+		redelivery, err := webhookService.Redeliver(record, delivery)
+		if err != nil {
+			logger.Error("[POST /api/webhooks/:id/deliveries/:deliveryId/redeliver] error: %v", err)
+			return apis.NewBadRequestError("Failed to redeliver", err)
+		}
+
+		return c.JSON(http.StatusOK, redelivery)
+	}, apis.ActivityLogger(app), apis.RequireRecordAuth())
+}
@@ -0,0 +1,190 @@
+package apitoken
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/logger"
+)
+
+// Authentication errors
+var (
+	ErrInvalid  = errors.New("invalid API token")
+	ErrExpired  = errors.New("API token has expired")
+	ErrRevoked  = errors.New("API token has been revoked")
+	ErrDisabled = errors.New("API is disabled for this user")
+)
+
+// lastUsedInterval limits how often the last use of a token is written
+const lastUsedInterval = time.Minute
+
+// maxNameLength mirrors the max length of the api_tokens.name field
+const maxNameLength = 100
+
+// TokenService manages the API tokens of users
+type TokenService struct {
+	app           *pocketbase.PocketBase
+	configService *config.ConfigService
+}
+
+// NewTokenService creates a new TokenService
+func NewTokenService(app *pocketbase.PocketBase) *TokenService {
+	return &TokenService{
+		app:           app,
+		configService: config.NewConfigService(app),
+	}
+}
+
+// Create stores a new token and returns it with its secret, which is shown to the user once.
+// A zero expires creates a token that never expires.
+func (s *TokenService) Create(userID, name string, scopes []string, expires time.Time) (string, *Token, error) {
+	if name == "" {
+		return "", nil, fmt.Errorf("name is required")
+	}
+	if len([]rune(name)) > maxNameLength {
+		return "", nil, fmt.Errorf("name must be at most %d characters", maxNameLength)
+	}
+	scopes, err := NormalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if !expires.IsZero() && !expires.After(time.Now()) {
+		return "", nil, fmt.Errorf("expiry must be in the future")
+	}
+
+	secret, err := Generate()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	collection, err := s.app.Dao().FindCollectionByNameOrId("api_tokens")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find api_tokens collection: %w", err)
+	}
+
+	record := models.NewRecord(collection)
+	record.Set("owner", userID)
+	record.Set("name", name)
+	record.Set("token_hash", Hash(secret))
+	record.Set("prefix", DisplayPrefix(secret))
+	record.Set("scopes", scopes)
+	if !expires.IsZero() {
+		record.Set("expires", expires.UTC())
+	}
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return "", nil, fmt.Errorf("failed to save token: %w", err)
+	}
+
+	logger.Info("[TokenService] created token %s for user %s", record.Id, userID)
+	token := toToken(record)
+	return secret, &token, nil
+}
+
+// List returns the tokens of a user, newest first, including expired and revoked ones
+func (s *TokenService) List(userID string) ([]Token, error) {
+	records, err := s.app.Dao().FindRecordsByFilter(
+		"api_tokens",
+		"owner = {:owner}",
+		"-created",
+		-1,
+		0,
+		map[string]any{"owner": userID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tokens: %w", err)
+	}
+
+	tokens := make([]Token, 0, len(records))
+	for _, record := range records {
+		tokens = append(tokens, toToken(record))
+	}
+	return tokens, nil
+}
+
+// Revoke disables a token of a user, it stays listed with its revocation time
+func (s *TokenService) Revoke(userID, id string) (*Token, error) {
+	record, err := s.app.Dao().FindRecordById("api_tokens", id)
+	if err != nil || record.GetString("owner") != userID {
+		return nil, fmt.Errorf("token not found")
+	}
+
+	if record.GetDateTime("revoked").IsZero() {
+		record.Set("revoked", types.NowDateTime())
+		if err := s.app.Dao().SaveRecord(record); err != nil {
+			return nil, fmt.Errorf("failed to revoke token: %w", err)
+		}
+		logger.Info("[TokenService] revoked token %s of user %s", record.Id, userID)
+	}
+
+	token := toToken(record)
+	return &token, nil
+}
+
+// Authenticate resolves a token presented by a request and records its use.
+// ip is the client address of the request.
+func (s *TokenService) Authenticate(secret, ip string) (*Token, error) {
+	if secret == "" {
+		return nil, ErrInvalid
+	}
+
+	// The hash is indexed and unique, so the lookup doesn't leak timing about the secret
+	record, err := s.app.Dao().FindFirstRecordByFilter(
+		"api_tokens",
+		"token_hash = {:hash}",
+		map[string]any{"hash": Hash(secret)},
+	)
+	if err != nil {
+		logger.Debug("[TokenService] no matching token found")
+		return nil, ErrInvalid
+	}
+
+	if !record.GetDateTime("revoked").IsZero() {
+		return nil, ErrRevoked
+	}
+	if expires := record.GetDateTime("expires"); !expires.IsZero() && time.Now().After(expires.Time()) {
+		return nil, ErrExpired
+	}
+
+	userID := record.GetString("owner")
+	enabled, err := s.configService.GetBool(userID, "api.enabled")
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrDisabled
+	}
+
+	lastUsed := record.GetDateTime("last_used")
+	if lastUsed.IsZero() || time.Since(lastUsed.Time()) > lastUsedInterval || record.GetString("last_ip") != ip {
+		record.Set("last_used", types.NowDateTime())
+		record.Set("last_ip", ip)
+		if err := s.app.Dao().SaveRecord(record); err != nil {
+			logger.Warn("[TokenService] failed to record use of token %s: %v", record.Id, err)
+		}
+	}
+
+	token := toToken(record)
+	return &token, nil
+}
+
+// toToken converts an api_tokens record
+func toToken(record *models.Record) Token {
+	return Token{
+		ID:       record.Id,
+		Name:     record.GetString("name"),
+		Prefix:   record.GetString("prefix"),
+		Scopes:   record.GetStringSlice("scopes"),
+		Expires:  record.GetDateTime("expires").String(),
+		LastUsed: record.GetDateTime("last_used").String(),
+		LastIP:   record.GetString("last_ip"),
+		Revoked:  record.GetDateTime("revoked").String(),
+		Created:  record.Created.String(),
+		UserID:   record.GetString("owner"),
+	}
+}
@@ -0,0 +1,76 @@
+package apitoken
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	a, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("Generate returned the same token twice")
+	}
+	if !strings.HasPrefix(a, tokenPrefix) || len(a) != len(tokenPrefix)+32 {
+		t.Errorf("unexpected token format %q", a)
+	}
+}
+
+func TestHash(t *testing.T) {
+	if Hash("a") == Hash("b") {
+		t.Error("different tokens hash the same")
+	}
+	if Hash("a") != Hash("a") {
+		t.Error("hash is not stable")
+	}
+	if len(Hash("a")) != 64 {
+		t.Errorf("hash length = %d, want 64", len(Hash("a")))
+	}
+}
+
+func TestDisplayPrefix(t *testing.T) {
+	tests := map[string]string{
+		"diarum_0123456789abcdef": "diarum_012345",
+		"0123456789abcdef0123":    "0123456789abc",
+		"abc":                     "abc",
+		"":                        "",
+	}
+	for token, want := range tests {
+		if got := DisplayPrefix(token); got != want {
+			t.Errorf("DisplayPrefix(%q) = %q, want %q", token, got, want)
+		}
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	got, err := NormalizeScopes([]string{" media", "diaries:read", "media", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "diaries:read,media" {
+		t.Errorf("NormalizeScopes = %v", got)
+	}
+
+	if _, err := NormalizeScopes([]string{"admin"}); err == nil {
+		t.Error("unknown scope accepted")
+	}
+	if _, err := NormalizeScopes(nil); err == nil {
+		t.Error("empty scopes accepted")
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	token := &Token{Scopes: []string{ScopeDiariesRead}}
+	if !token.HasScope(ScopeDiariesRead) {
+		t.Error("granted scope not found")
+	}
+	if token.HasScope(ScopeDiariesWrite) {
+		t.Error("missing scope reported as granted")
+	}
+}
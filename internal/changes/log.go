@@ -0,0 +1,128 @@
+package changes
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// logTable records the latest change of every diary and media record.
+// seq only grows, so it serves as the sync cursor. Each record keeps a single row,
+// older rows are replaced, which keeps the table as small as the synced data.
+const logTable = "sync_changes"
+
+// Collections lists the collections tracked for sync
+var Collections = []string{"diaries", "media"}
+
+// CreateLog creates the change log table
+func CreateLog(db dbx.Builder) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + logTable + ` (
+			seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+			collection TEXT NOT NULL,
+			record_id  TEXT NOT NULL,
+			owner      TEXT NOT NULL,
+			deleted    BOOLEAN NOT NULL DEFAULT FALSE,
+			changed    TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%fZ', 'now'))
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_changes_record ON ` + logTable + ` (collection, record_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_sync_changes_owner_seq ON ` + logTable + ` (owner, seq)`,
+	}
+	for _, statement := range statements {
+		if _, err := db.NewQuery(statement).Execute(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropLog removes the change log table
+func DropLog(db dbx.Builder) error {
+	_, err := db.NewQuery(`DROP TABLE IF EXISTS ` + logTable).Execute()
+	return err
+}
+
+// Change is an entry of the change log
+type Change struct {
+	Seq        int64  `db:"seq" json:"seq"`
+	Collection string `db:"collection" json:"collection"`
+	RecordID   string `db:"record_id" json:"id"`
+	Deleted    bool   `db:"deleted" json:"deleted"`
+	Changed    string `db:"changed" json:"changed"`
+}
+
+// Track logs a change of a diary or media record.
+// Trashed records are logged as deleted, clients drop them like permanently deleted ones.
+func Track(dao *daos.Dao, record *models.Record, deleted bool) error {
+	if !deleted && !record.GetDateTime("deleted_at").IsZero() {
+		deleted = true
+	}
+
+	// Replace the previous row so the record moves to the end of the log
+	_, err := dao.DB().
+		NewQuery("DELETE FROM " + logTable + " WHERE collection = {:collection} AND record_id = {:id}").
+		Bind(dbx.Params{"collection": record.Collection().Name, "id": record.Id}).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to update change log: %w", err)
+	}
+
+	_, err = dao.DB().
+		NewQuery("INSERT INTO " + logTable + " (collection, record_id, owner, deleted) VALUES ({:collection}, {:id}, {:owner}, {:deleted})").
+		Bind(dbx.Params{
+			"collection": record.Collection().Name,
+			"id":         record.Id,
+			"owner":      record.GetString("owner"),
+			"deleted":    deleted,
+		}).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to update change log: %w", err)
+	}
+	return nil
+}
+
+// Since returns up to limit changes of a user after the cursor, oldest first.
+// The cursor of the next call is the Seq of the last change returned.
+func Since(dao *daos.Dao, owner string, cursor int64, limit int) ([]Change, error) {
+	result := []Change{}
+	err := dao.DB().
+		NewQuery("SELECT seq, collection, record_id, deleted, changed FROM " + logTable +
+			" WHERE owner = {:owner} AND seq > {:cursor} ORDER BY seq LIMIT {:limit}").
+		Bind(dbx.Params{"owner": owner, "cursor": cursor, "limit": limit}).
+		All(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change log: %w", err)
+	}
+	return result, nil
+}
+
+// Latest returns the current end of a user's change log, 0 when it is empty
+func Latest(dao *daos.Dao, owner string) (int64, error) {
+	var seq int64
+	err := dao.DB().
+		NewQuery("SELECT COALESCE(MAX(seq), 0) FROM " + logTable + " WHERE owner = {:owner}").
+		Bind(dbx.Params{"owner": owner}).
+		Row(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read change log: %w", err)
+	}
+	return seq, nil
+}
+
+// Seed logs every existing diary and media record, used when the log is created
+func Seed(dao *daos.Dao) error {
+	for _, collection := range Collections {
+		_, err := dao.DB().
+			NewQuery("INSERT OR REPLACE INTO " + logTable + " (collection, record_id, owner, deleted) " +
+				"SELECT {:collection}, id, owner, deleted_at != '' FROM " + collection + " ORDER BY updated").
+			Bind(dbx.Params{"collection": collection}).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("failed to seed change log from %s: %w", collection, err)
+		}
+	}
+	return nil
+}
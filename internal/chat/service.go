@@ -14,8 +14,10 @@ import (
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/models"
 	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
 	"github.com/songtianlun/diarum/internal/embedding"
 	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/search"
 )
 
 // ChatService handles AI chat operations with RAG
@@ -23,6 +25,7 @@ type ChatService struct {
 	app              *pocketbase.PocketBase
 	embeddingService *embedding.EmbeddingService
 	configService    *config.ConfigService
+	searchService    *search.SearchService
 }
 
 // ChatMessage represents a message in the chat
@@ -63,6 +66,7 @@ type SearchDiariesArgs struct {
 	StartDate string `json:"start_date,omitempty"`
 	EndDate   string `json:"end_date,omitempty"`
 	Query     string `json:"query,omitempty"`
+	Filter    string `json:"filter,omitempty"` // structured query, see search.ParseQuery
 	Limit     int    `json:"limit,omitempty"`
 }
 
@@ -103,6 +107,7 @@ func NewChatService(app *pocketbase.PocketBase, embeddingService *embedding.Embe
 		app:              app,
 		embeddingService: embeddingService,
 		configService:    config.NewConfigService(app),
+		searchService:    search.NewSearchService(app),
 	}
 }
 
@@ -129,6 +134,10 @@ func (s *ChatService) getTools() []Tool {
 							"type":        "string",
 							"description": "语义搜索关键词。用于查找与该主题相关的日记。",
 						},
+						"filter": map[string]interface{}{
+							"type":        "string",
+							"description": "精确筛选条件，语法示例：mood:happy weather:rain tag:work after:2024-01-01 before:2024-06-30 \"完整短语\" -排除词。普通词按全文检索匹配，引号内为精确短语，前缀 - 表示排除。",
+						},
 						"limit": map[string]interface{}{
 							"type":        "integer",
 							"description": "返回的最大日记数量，默认10，最大100。",
@@ -151,8 +160,8 @@ func (s *ChatService) QueryRelevantDiaries(ctx context.Context, userID, query st
 
 // SearchDiariesByDateRange searches diaries within a date range
 func (s *ChatService) SearchDiariesByDateRange(ctx context.Context, userID string, args SearchDiariesArgs) ([]embedding.DiarySearchResult, error) {
-	logger.Info("[ChatService] searching diaries: startDate=%s, endDate=%s, query=%s, limit=%d",
-		args.StartDate, args.EndDate, args.Query, args.Limit)
+	logger.Info("[ChatService] searching diaries: startDate=%s, endDate=%s, query=%s, filter=%s, limit=%d",
+		args.StartDate, args.EndDate, args.Query, args.Filter, args.Limit)
 
 	// Set default limit
 	if args.Limit <= 0 {
@@ -162,31 +171,44 @@ func (s *ChatService) SearchDiariesByDateRange(ctx context.Context, userID strin
 		args.Limit = 100
 	}
 
-	// Build filter conditions
-	filter := "owner = {:owner}"
-	filterParams := map[string]any{"owner": userID}
-
-	if args.StartDate != "" {
-		filter += " && date >= {:start_date}"
-		filterParams["start_date"] = args.StartDate
+	// Build filter conditions from the structured filter and the date range
+	parsed, err := search.ParseQuery(args.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	if args.StartDate != "" && parsed.After == "" {
+		parsed.After = args.StartDate
 	}
-	if args.EndDate != "" {
-		filter += " && date <= {:end_date}"
-		filterParams["end_date"] = args.EndDate + " 23:59:59"
+	if args.EndDate != "" && parsed.Before == "" {
+		parsed.Before = args.EndDate
 	}
 
-	// Query from database
-	diaries, err := s.app.Dao().FindRecordsByFilter(
-		"diaries",
-		filter,
-		"-date",
-		args.Limit,
-		0,
-		filterParams,
-	)
+	opts := parsed.Options(userID)
+	opts.Limit = args.Limit
+	hits, _, err := s.searchService.Search(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch diaries: %w", err)
+	}
+
+	// Query from database, keeping the search order
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	records, err := s.app.Dao().FindRecordsByIds("diaries", ids)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch diaries: %w", err)
 	}
+	byID := make(map[string]*models.Record, len(records))
+	for _, record := range records {
+		byID[record.Id] = record
+	}
+	diaries := make([]*models.Record, 0, len(hits))
+	for _, hit := range hits {
+		if record, ok := byID[hit.ID]; ok {
+			diaries = append(diaries, record)
+		}
+	}
 
 	// Convert to DiarySearchResult
 	results := make([]embedding.DiarySearchResult, 0, len(diaries))
@@ -268,8 +290,9 @@ func (s *ChatService) buildSystemPrompt(diaries []embedding.DiarySearchResult) s
 }
 
 // buildAgentSystemPrompt creates the system prompt for the agent with tools
-func (s *ChatService) buildAgentSystemPrompt() string {
-	today := time.Now().Format("2006-01-02")
+// Today's date follows the user's timezone setting
+func (s *ChatService) buildAgentSystemPrompt(userID string) string {
+	today := dateutil.Today(s.configService.GetLocation(userID))
 	return fmt.Sprintf(`You are a helpful AI assistant for a personal diary application called Diarum.
 You help users reflect on their diary entries, summarize their experiences, and provide insights based on their personal journal.
 
@@ -283,6 +306,7 @@ You have access to the search_diaries tool to find relevant diary entries. Use i
 When using search_diaries:
 - For time-based queries (e.g., "this year", "last month"), set appropriate start_date and end_date
 - For topic-based queries (e.g., "about travel"), use the query parameter
+- For precise conditions, use the filter parameter, e.g. mood:happy weather:rain tag:work "exact phrase" -excluded
 - Adjust limit based on the scope: use higher limits (30-50) for summaries, lower (5-10) for specific questions
 
 Always reference specific dates when discussing diary entries. Respond in the same language as the user.`, today)
@@ -356,7 +380,7 @@ func (s *ChatService) StreamChat(ctx context.Context, userID, conversationID, me
 	}
 
 	// Build initial messages with system prompt
-	systemPrompt := s.buildAgentSystemPrompt()
+	systemPrompt := s.buildAgentSystemPrompt(userID)
 	messages := []ChatMessage{
 		{Role: "system", Content: systemPrompt},
 	}
@@ -737,6 +761,85 @@ func stripHTMLTags(s string) string {
 
 // GenerateTitle generates a title for a conversation based on the first message
 func (s *ChatService) GenerateTitle(ctx context.Context, userID, userMessage, assistantResponse string) (string, error) {
+	// Build messages for title generation
+	messages := []ChatMessage{
+		{
+			Role: "system",
+			Content: `Generate a short, concise title (max 50 characters) for this conversation based on the user's message and assistant's response.
+The title should capture the main topic or intent of the conversation.
+Respond with ONLY the title, no quotes, no explanation, no punctuation at the end.
+Use the same language as the user's message.`,
+		},
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("User message: %s\n\nAssistant response: %s", userMessage, truncateString(assistantResponse, 500)),
+		},
+	}
+
+	title, err := s.complete(ctx, userID, messages, 60, 30*time.Second)
+	if err != nil {
+		return "", err
+	}
+
+	// Ensure title is not too long
+	if len(title) > 100 {
+		title = title[:100]
+	}
+
+	return title, nil
+}
+
+// ReflectionEntry is a diary entry given to GenerateReflection
+type ReflectionEntry struct {
+	Date    string
+	Mood    string
+	Content string
+}
+
+// GenerateReflection writes a short "then vs. now" reflection comparing today's entries with past ones
+func (s *ChatService) GenerateReflection(ctx context.Context, userID, today string, todayEntries, pastEntries []ReflectionEntry) (string, error) {
+	if len(pastEntries) == 0 {
+		return "", fmt.Errorf("no past entries to reflect on")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Today is %s.\n\n", today))
+	writeReflectionEntries(&sb, "Today's entries", todayEntries)
+	writeReflectionEntries(&sb, "Past entries", pastEntries)
+
+	messages := []ChatMessage{
+		{
+			Role: "system",
+			Content: `You are a thoughtful companion for a personal diary application called Diarum.
+Compare what the user wrote in the past with today and write a short, warm reflection (at most 120 words) about what changed and what stayed the same.
+Speak to the user directly, mention the dates you refer to, and don't invent anything that isn't in the entries.
+Respond in the same language as the diary entries.`,
+		},
+		{Role: "user", Content: sb.String()},
+	}
+
+	return s.complete(ctx, userID, messages, 400, time.Minute)
+}
+
+// writeReflectionEntries formats entries for the reflection prompt
+func writeReflectionEntries(sb *strings.Builder, title string, entries []ReflectionEntry) {
+	sb.WriteString(title + ":\n")
+	if len(entries) == 0 {
+		sb.WriteString("(none)\n\n")
+		return
+	}
+	for _, entry := range entries {
+		sb.WriteString("--- " + entry.Date)
+		if entry.Mood != "" {
+			sb.WriteString(" (mood: " + entry.Mood + ")")
+		}
+		sb.WriteString(" ---\n")
+		sb.WriteString(truncateString(stripHTMLTags(entry.Content), 1500) + "\n\n")
+	}
+}
+
+// complete sends a non-streaming chat completion with the user's AI configuration
+func (s *ChatService) complete(ctx context.Context, userID string, messages []ChatMessage, maxTokens int, timeout time.Duration) (string, error) {
 	// Get AI configuration
 	apiKey, err := s.configService.GetString(userID, "ai.api_key")
 	if err != nil || apiKey == "" {
@@ -753,21 +856,6 @@ func (s *ChatService) GenerateTitle(ctx context.Context, userID, userMessage, as
 		return "", fmt.Errorf("chat model not configured")
 	}
 
-	// Build messages for title generation
-	messages := []ChatMessage{
-		{
-			Role: "system",
-			Content: `Generate a short, concise title (max 50 characters) for this conversation based on the user's message and assistant's response.
-The title should capture the main topic or intent of the conversation.
-Respond with ONLY the title, no quotes, no explanation, no punctuation at the end.
-Use the same language as the user's message.`,
-		},
-		{
-			Role:    "user",
-			Content: fmt.Sprintf("User message: %s\n\nAssistant response: %s", userMessage, truncateString(assistantResponse, 500)),
-		},
-	}
-
 	// Call API without streaming
 	baseURL = strings.TrimSuffix(baseURL, "/")
 	url := baseURL + "/v1/chat/completions"
@@ -775,7 +863,7 @@ Use the same language as the user's message.`,
 	reqBody := map[string]interface{}{
 		"model":      chatModel,
 		"messages":   messages,
-		"max_tokens": 60,
+		"max_tokens": maxTokens,
 		"stream":     false,
 	}
 
@@ -792,7 +880,7 @@ Use the same language as the user's message.`,
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := &http.Client{Timeout: timeout}
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
@@ -820,13 +908,7 @@ Use the same language as the user's message.`,
 		return "", fmt.Errorf("no response from API")
 	}
 
-	title := strings.TrimSpace(result.Choices[0].Message.Content)
-	// Ensure title is not too long
-	if len(title) > 100 {
-		title = title[:100]
-	}
-
-	return title, nil
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
 }
 
 // truncateString truncates a string to the specified length
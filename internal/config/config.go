@@ -1,9 +1,9 @@
 package config
 
 import (
-	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/daos"
@@ -16,9 +16,6 @@ import (
 // ErrUnknownKey is returned when trying to set an unregistered configuration key
 var ErrUnknownKey = errors.New("unknown configuration key")
 
-// ErrAPIDisabled is returned when the API is disabled for a user
-var ErrAPIDisabled = errors.New("API is disabled for this user")
-
 // ConfigService provides methods to manage user settings
 type ConfigService struct {
 	app *pocketbase.PocketBase
@@ -113,12 +110,66 @@ func (s *ConfigService) GetBool(userId, key string) (bool, error) {
 	return false, nil
 }
 
+// GetInt retrieves an integer configuration value
+func (s *ConfigService) GetInt(userId, key string) (int, error) {
+	value, err := s.Get(userId, key)
+	if err != nil {
+		return 0, err
+	}
+	if value == nil {
+		return 0, nil
+	}
+
+	// Handle types.JsonRaw
+	if raw, ok := value.(types.JsonRaw); ok {
+		var f float64
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return 0, nil
+		}
+		return int(f), nil
+	}
+
+	// Handle different types that JSON might return
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	}
+	return 0, nil
+}
+
+// GetLocation returns the user's configured timezone, UTC when unset or invalid
+func (s *ConfigService) GetLocation(userId string) *time.Location {
+	name, err := s.GetString(userId, "user.timezone")
+	if err != nil || name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		logger.Warn("[ConfigService.GetLocation] invalid timezone %q for user %s", name, userId)
+		return time.UTC
+	}
+	return loc
+}
+
+// HasTimezone reports whether the user configured a timezone
+func (s *ConfigService) HasTimezone(userId string) bool {
+	name, _ := s.GetString(userId, "user.timezone")
+	return name != ""
+}
+
 // Set stores a configuration value for a user
 func (s *ConfigService) Set(userId, key string, value any) error {
 	// Validate key against registry
 	if _, ok := GetConfigMeta(key); !ok {
 		return ErrUnknownKey
 	}
+	if err := ValidateValue(key, value); err != nil {
+		return err
+	}
 
 	// Find existing record
 	record, err := s.app.Dao().FindFirstRecordByFilter(
@@ -174,6 +225,12 @@ func (s *ConfigService) GetBatch(userId string) (map[string]any, error) {
 
 // SetBatch stores multiple configuration values for a user atomically
 func (s *ConfigService) SetBatch(userId string, settings map[string]any) error {
+	for key, value := range settings {
+		if err := ValidateValue(key, value); err != nil {
+			return err
+		}
+	}
+
 	return s.app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
 		for key, value := range settings {
 			// Skip unknown keys with warning log
@@ -242,47 +299,7 @@ func maskSensitiveValue(value string) string {
 
 // isSensitiveKey checks if a key contains sensitive data that should be masked in logs
 func isSensitiveKey(key string) bool {
-	return IsEncrypted(key) || key == "api.token"
-}
-
-// ValidateTokenAndGetUser validates an API token and returns the user ID
-func (s *ConfigService) ValidateTokenAndGetUser(token string) (string, error) {
-	logger.Debug("[ValidateTokenAndGetUser] validating token: %s", maskSensitiveValue(token))
-
-	// Direct query by token value using index on key field
-	record, err := s.app.Dao().FindFirstRecordByFilter(
-		"user_settings",
-		"key = 'api.token' && value = {:token}",
-		map[string]any{"token": token},
-	)
-
-	if err != nil {
-		logger.Debug("[ValidateTokenAndGetUser] no matching token found: %v", err)
-		return "", nil
-	}
-
-	userId := record.GetString("user")
-	storedToken := s.parseStringValue(record.Get("value"))
-
-	// Use constant-time comparison to prevent timing attacks
-	if subtle.ConstantTimeCompare([]byte(storedToken), []byte(token)) != 1 {
-		logger.Debug("[ValidateTokenAndGetUser] token mismatch")
-		return "", nil
-	}
-
-	// Check if API is enabled for this user
-	enabled, err := s.GetBool(userId, "api.enabled")
-	if err != nil {
-		logger.Debug("[ValidateTokenAndGetUser] error checking API enabled: %v", err)
-		return "", err
-	}
-	if !enabled {
-		logger.Debug("[ValidateTokenAndGetUser] API disabled for user: %s", userId)
-		return "", ErrAPIDisabled
-	}
-
-	logger.Debug("[ValidateTokenAndGetUser] token validated for user: %s", userId)
-	return userId, nil
+	return IsEncrypted(key)
 }
 
 // parseStringValue extracts a string from various value types
@@ -1,22 +1,36 @@
 package config
 
+import (
+	"fmt"
+	"time"
+)
+
 // ConfigMeta defines metadata for a configuration item
 type ConfigMeta struct {
 	Type      string // "string", "bool", "int", "float", "json"
 	Default   any
 	Encrypted bool
+	Validate  func(value any) error // optional, checked before a value is stored
 }
 
 // ConfigRegistry defines all available configuration items
 var ConfigRegistry = map[string]ConfigMeta{
-	// API settings
-	"api.token":   {Type: "string", Default: "", Encrypted: false},
+	// API settings, the tokens themselves live in the api_tokens collection
 	"api.enabled": {Type: "bool", Default: false, Encrypted: false},
 
+	// User settings
+	"user.timezone": {Type: "string", Default: "", Encrypted: false, Validate: validateTimezone}, // IANA name, empty means UTC
+
 	// Sync settings
 	"sync.autoSaveInterval": {Type: "int", Default: 3000, Encrypted: false},  // milliseconds
 	"sync.cacheDays":        {Type: "int", Default: 30, Encrypted: false},
 
+	// History settings
+	"history.revisionInterval": {Type: "int", Default: 10, Encrypted: false}, // minutes between revisions during continuous editing
+
+	// Trash settings
+	"trash.retentionDays": {Type: "int", Default: 30, Encrypted: false}, // 0 keeps trashed records forever
+
 	// AI settings (unified API key and base URL)
 	"ai.enabled":          {Type: "bool", Default: false, Encrypted: false},
 	"ai.api_key":          {Type: "string", Default: "", Encrypted: true},
@@ -26,6 +40,29 @@ var ConfigRegistry = map[string]ConfigMeta{
 	"ai.vectors_built_at": {Type: "string", Default: "", Encrypted: false},
 }
 
+// validateTimezone accepts an empty string or a valid IANA timezone name
+func validateTimezone(value any) error {
+	name, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("timezone must be a string")
+	}
+	if name == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("unknown timezone: %s", name)
+	}
+	return nil
+}
+
+// ValidateValue checks a value against the validator of its configuration key
+func ValidateValue(key string, value any) error {
+	if meta, ok := ConfigRegistry[key]; ok && meta.Validate != nil {
+		return meta.Validate(value)
+	}
+	return nil
+}
+
 // GetConfigMeta returns the metadata for a configuration key
 func GetConfigMeta(key string) (ConfigMeta, bool) {
 	meta, ok := ConfigRegistry[key]
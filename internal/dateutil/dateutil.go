@@ -0,0 +1,134 @@
+package dateutil
+
+import (
+	"strings"
+	"time"
+)
+
+// DayLayout is the calendar day format used by the API, e.g. "2026-01-28"
+const DayLayout = "2006-01-02"
+
+// TimeLayout is the time of day of a diary entry, e.g. "08:30"
+const TimeLayout = "15:04"
+
+// timestampLayouts are the accepted forms of an instant, the first is how PocketBase stores dates
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.000Z07:00",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	time.RFC3339Nano,
+}
+
+// Diary dates are calendar days in the owner's timezone, stored as midnight UTC
+// ("2026-01-28 00:00:00.000Z"), so a stored date reads as the same day everywhere.
+
+// LoadLocation resolves an IANA timezone name, falling back to UTC
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ValidDay reports whether s is a calendar day in DayLayout
+func ValidDay(s string) bool {
+	_, err := time.Parse(DayLayout, s)
+	return err == nil
+}
+
+// ValidTime reports whether s is a time of day in TimeLayout
+func ValidTime(s string) bool {
+	_, err := time.Parse(TimeLayout, s)
+	return err == nil && len(s) == len(TimeLayout)
+}
+
+// Today returns the current calendar day in loc
+func Today(loc *time.Location) string {
+	return time.Now().In(loc).Format(DayLayout)
+}
+
+// TodayDate returns the current calendar day in loc as midnight UTC
+func TodayDate(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// DayStart returns the stored value of a calendar day, the lower bound of its window
+func DayStart(day string) string {
+	return day + " 00:00:00.000Z"
+}
+
+// DayEnd returns the upper bound of a calendar day window in stored format
+func DayEnd(day string) string {
+	return day + " 23:59:59.999Z"
+}
+
+// DayOf extracts the calendar day from a stored diary date
+func DayOf(stored string) string {
+	if len(stored) >= 10 {
+		return stored[:10]
+	}
+	return stored
+}
+
+// LocalDay converts a stored timestamp, such as created or updated, to the calendar day in loc
+func LocalDay(stored string, loc *time.Location) string {
+	t, ok := parseTimestamp(stored)
+	if !ok {
+		return DayOf(stored)
+	}
+	return t.In(loc).Format(DayLayout)
+}
+
+// NormalizeDate turns a diary date into its stored form.
+// Plain days and values at midnight UTC are already calendar days and are kept.
+// Any other timestamp is an instant and is converted to the calendar day in loc.
+// Returns the normalized value and whether it could be parsed.
+func NormalizeDate(value string, loc *time.Location) (string, bool) {
+	value = strings.TrimSpace(value)
+	if ValidDay(value) {
+		return DayStart(value), true
+	}
+
+	t, ok := parseTimestamp(value)
+	if !ok {
+		return value, false
+	}
+
+	t = t.UTC()
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return DayStart(t.Format(DayLayout)), true
+	}
+	return DayStart(t.In(loc).Format(DayLayout)), true
+}
+
+// ClockOf returns the time of day in loc of a diary date sent as an instant.
+// Plain days and values at midnight UTC carry no time and return "".
+func ClockOf(value string, loc *time.Location) string {
+	value = strings.TrimSpace(value)
+	if ValidDay(value) {
+		return ""
+	}
+	t, ok := parseTimestamp(value)
+	if !ok {
+		return ""
+	}
+	if u := t.UTC(); u.Hour() == 0 && u.Minute() == 0 && u.Second() == 0 && u.Nanosecond() == 0 {
+		return ""
+	}
+	return t.In(loc).Format(TimeLayout)
+}
+
+// parseTimestamp parses an instant in one of timestampLayouts, values without an offset are UTC
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil && !t.IsZero() {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,101 @@
+package dateutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeDate(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+	newYork := time.FixedZone("UTC-5", -5*60*60)
+
+	tests := []struct {
+		name  string
+		value string
+		loc   *time.Location
+		want  string
+		ok    bool
+	}{
+		{"plain day", "2026-01-28", shanghai, "2026-01-28 00:00:00.000Z", true},
+		{"stored day", "2026-01-28 00:00:00.000Z", newYork, "2026-01-28 00:00:00.000Z", true},
+		{"instant east of UTC", "2026-01-27 18:30:00.000Z", shanghai, "2026-01-28 00:00:00.000Z", true},
+		{"instant west of UTC", "2026-01-28 03:00:00.000Z", newYork, "2026-01-27 00:00:00.000Z", true},
+		{"RFC3339 with offset", "2026-01-28T07:00:00+08:00", time.UTC, "2026-01-27 00:00:00.000Z", true},
+		{"surrounding space", " 2026-01-28 ", time.UTC, "2026-01-28 00:00:00.000Z", true},
+		{"empty", "", time.UTC, "", false},
+		{"garbage", "yesterday", time.UTC, "yesterday", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NormalizeDate(tt.value, tt.loc)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("NormalizeDate(%q) = %q, %v, want %q, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLocalDay(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+
+	tests := []struct {
+		stored string
+		loc    *time.Location
+		want   string
+	}{
+		{"2026-01-27 18:30:00.000Z", shanghai, "2026-01-28"},
+		{"2026-01-27 18:30:00.000Z", time.UTC, "2026-01-27"},
+		{"2026-01-27", shanghai, "2026-01-27"},
+		{"", shanghai, ""},
+	}
+
+	for _, tt := range tests {
+		if got := LocalDay(tt.stored, tt.loc); got != tt.want {
+			t.Errorf("LocalDay(%q, %s) = %q, want %q", tt.stored, tt.loc, got, tt.want)
+		}
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	if loc := LoadLocation(""); loc != time.UTC {
+		t.Errorf("LoadLocation(\"\") = %s, want UTC", loc)
+	}
+	if loc := LoadLocation("Not/AZone"); loc != time.UTC {
+		t.Errorf("LoadLocation(invalid) = %s, want UTC", loc)
+	}
+}
+
+func TestClockOf(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"2026-01-28", ""},
+		{"2026-01-28 00:00:00.000Z", ""},
+		{"2026-01-27 18:30:00.000Z", "02:30"},
+		{"2026-01-28T07:05:00+08:00", "07:05"},
+		{"not a date", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ClockOf(tt.value, shanghai); got != tt.want {
+			t.Errorf("ClockOf(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidTime(t *testing.T) {
+	for _, s := range []string{"00:00", "08:30", "23:59"} {
+		if !ValidTime(s) {
+			t.Errorf("ValidTime(%q) = false, want true", s)
+		}
+	}
+	for _, s := range []string{"", "8:30", "24:00", "12:60", "12:30:00"} {
+		if ValidTime(s) {
+			t.Errorf("ValidTime(%q) = true, want false", s)
+		}
+	}
+}
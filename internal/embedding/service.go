@@ -13,15 +13,30 @@ import (
 	chromem "github.com/philippgille/chromem-go"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/hook"
 	"github.com/songtianlun/diarum/internal/config"
 	"github.com/songtianlun/diarum/internal/logger"
 )
 
 // EmbeddingService handles diary embedding operations
 type EmbeddingService struct {
-	app           *pocketbase.PocketBase
-	vectorDB      *VectorDB
-	configService *config.ConfigService
+	app             *pocketbase.PocketBase
+	vectorDB        *VectorDB
+	configService   *config.ConfigService
+	onBuildComplete *hook.Hook[*BuildEvent]
+}
+
+// Build modes reported by BuildEvent
+const (
+	BuildModeFull        = "full"
+	BuildModeIncremental = "incremental"
+)
+
+// BuildEvent is passed to OnBuildComplete handlers when a vector build finishes
+type BuildEvent struct {
+	UserID string
+	Mode   string
+	Result *BuildResult
 }
 
 // BuildResult represents the result of a build operation
@@ -65,9 +80,23 @@ type EmbeddingResponse struct {
 // NewEmbeddingService creates a new EmbeddingService
 func NewEmbeddingService(app *pocketbase.PocketBase, vectorDB *VectorDB) *EmbeddingService {
 	return &EmbeddingService{
-		app:           app,
-		vectorDB:      vectorDB,
-		configService: config.NewConfigService(app),
+		app:             app,
+		vectorDB:        vectorDB,
+		configService:   config.NewConfigService(app),
+		onBuildComplete: &hook.Hook[*BuildEvent]{},
+	}
+}
+
+// OnBuildComplete hook is triggered after a full or incremental vector build finishes,
+// including builds that failed for some diaries
+func (s *EmbeddingService) OnBuildComplete() *hook.Hook[*BuildEvent] {
+	return s.onBuildComplete
+}
+
+// buildComplete triggers the OnBuildComplete hook, handler errors are only logged
+func (s *EmbeddingService) buildComplete(userID, mode string, result *BuildResult) {
+	if err := s.onBuildComplete.Trigger(&BuildEvent{UserID: userID, Mode: mode, Result: result}); err != nil {
+		logger.Warn("[EmbeddingService] build complete hook failed for user %s: %v", userID, err)
 	}
 }
 
@@ -179,7 +208,7 @@ func (s *EmbeddingService) BuildAllVectors(ctx context.Context, userID string) (
 	// Get all diaries for the user
 	diaries, err := s.app.Dao().FindRecordsByFilter(
 		"diaries",
-		"owner = {:owner}",
+		"owner = {:owner} && deleted_at = ''",
 		"-date",
 		-1, // No limit
 		0,
@@ -197,6 +226,7 @@ func (s *EmbeddingService) BuildAllVectors(ctx context.Context, userID string) (
 
 	if len(diaries) == 0 {
 		logger.Info("[EmbeddingService] no diaries found for user: %s", userID)
+		s.buildComplete(userID, BuildModeFull, result)
 		return result, nil
 	}
 
@@ -217,6 +247,7 @@ func (s *EmbeddingService) BuildAllVectors(ctx context.Context, userID string) (
 	logger.Info("[EmbeddingService] full rebuild completed for user %s: %d success, %d failed",
 		userID, result.Success, result.Failed)
 
+	s.buildComplete(userID, BuildModeFull, result)
 	return result, nil
 }
 
@@ -245,7 +276,7 @@ func (s *EmbeddingService) BuildIncrementalVectors(ctx context.Context, userID s
 	// Get all diaries for the user
 	diaries, err := s.app.Dao().FindRecordsByFilter(
 		"diaries",
-		"owner = {:owner}",
+		"owner = {:owner} && deleted_at = ''",
 		"-date",
 		-1,
 		0,
@@ -263,6 +294,7 @@ func (s *EmbeddingService) BuildIncrementalVectors(ctx context.Context, userID s
 
 	if len(diaries) == 0 {
 		logger.Info("[EmbeddingService] no diaries found for user: %s", userID)
+		s.buildComplete(userID, BuildModeIncremental, result)
 		return result, nil
 	}
 
@@ -289,9 +321,37 @@ func (s *EmbeddingService) BuildIncrementalVectors(ctx context.Context, userID s
 	logger.Info("[EmbeddingService] incremental build completed for user %s: %d built, %d skipped, %d failed",
 		userID, result.Success, skipped, result.Failed)
 
+	s.buildComplete(userID, BuildModeIncremental, result)
 	return result, nil
 }
 
+// ScheduleIncrementalBuild runs an incremental vector build in the background
+// if AI is enabled for the user. source is only used for logging.
+func (s *EmbeddingService) ScheduleIncrementalBuild(userID, source string) {
+	if s == nil || userID == "" {
+		return
+	}
+
+	// Check if AI is enabled for this user
+	enabled, _ := s.configService.GetBool(userID, "ai.enabled")
+	if !enabled {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		logger.Info("[AutoVectorBuild] triggered by %s for user: %s", source, userID)
+		result, err := s.BuildIncrementalVectors(ctx, userID)
+		if err != nil {
+			logger.Error("[AutoVectorBuild] failed for user %s: %v", userID, err)
+			return
+		}
+		logger.Info("[AutoVectorBuild] completed for user %s: %d built, %d failed", userID, result.Success, result.Failed)
+	}()
+}
+
 // processDiary processes a single diary entry
 func (s *EmbeddingService) processDiary(ctx context.Context, collection *chromem.Collection, diary *models.Record, embeddingFunc chromem.EmbeddingFunc) error {
 	content := diary.GetString("content")
@@ -371,6 +431,25 @@ func (s *EmbeddingService) needsBuildVector(ctx context.Context, collection *chr
 	return diaryUpdated.After(builtAt)
 }
 
+// DeleteDiaryVector removes a diary's document from the user's vector collection
+func (s *EmbeddingService) DeleteDiaryVector(ctx context.Context, userID, diaryID string) error {
+	if s == nil || userID == "" {
+		return nil
+	}
+
+	collection := s.vectorDB.GetCollection(userID)
+	if collection == nil {
+		return nil
+	}
+
+	if err := collection.Delete(ctx, nil, nil, diaryID); err != nil {
+		return fmt.Errorf("failed to delete vector document: %w", err)
+	}
+
+	logger.Debug("[EmbeddingService] deleted vector document %s for user: %s", diaryID, userID)
+	return nil
+}
+
 // DiarySearchResult represents a diary found by vector search
 type DiarySearchResult struct {
 	ID      string  `json:"id"`
@@ -445,7 +524,7 @@ func (s *EmbeddingService) GetVectorStats(ctx context.Context, userID string) (*
 	// Get all diaries for the user
 	diaries, err := s.app.Dao().FindRecordsByFilter(
 		"diaries",
-		"owner = {:owner}",
+		"owner = {:owner} && deleted_at = ''",
 		"-updated",
 		-1,
 		0,
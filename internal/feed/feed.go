@@ -0,0 +1,235 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"regexp"
+	"time"
+)
+
+// Content types of the feeds
+const (
+	AtomContentType = "application/atom+xml; charset=utf-8"
+	JSONContentType = "application/feed+json; charset=utf-8"
+)
+
+// JSONFeedVersion is the JSON Feed version URL written to every JSON feed
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// Feed is a list of diary entries, rendered as Atom or JSON Feed
+type Feed struct {
+	// ID is a permanent identifier of the feed, e.g. a tag or urn URI
+	ID    string
+	Title string
+	// Link is the web page of the feed, FeedLink the URL the feed is served at
+	Link     string
+	FeedLink string
+	Author   string
+	Updated  time.Time
+	Entries  []Entry
+}
+
+// Entry is a single diary entry of a feed
+type Entry struct {
+	ID        string
+	Title     string
+	Link      string
+	Published time.Time
+	Updated   time.Time
+	// Content is HTML, Summary plain text
+	Content     string
+	Summary     string
+	Tags        []string
+	Attachments []Attachment
+}
+
+// Attachment is a media file of an entry
+type Attachment struct {
+	URL      string
+	MimeType string
+	Title    string
+}
+
+// ---------- Atom ----------
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href  string `xml:"href,attr"`
+	Rel   string `xml:"rel,attr,omitempty"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    atomText       `xml:"content"`
+}
+
+// Atom renders the feed as an Atom 1.0 document
+func (f *Feed) Atom() ([]byte, error) {
+	doc := atomFeed{
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: atomTime(f.Updated),
+		Links: []atomLink{
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+			{Href: f.FeedLink, Rel: "self", Type: "application/atom+xml"},
+		},
+	}
+	if f.Author != "" {
+		doc.Author = &atomAuthor{Name: f.Author}
+	}
+
+	for _, entry := range f.Entries {
+		item := atomEntry{
+			ID:        entry.ID,
+			Title:     entry.Title,
+			Published: atomTime(entry.Published),
+			Updated:   atomTime(entry.Updated),
+			Links:     []atomLink{{Href: entry.Link, Rel: "alternate", Type: "text/html"}},
+			Content:   atomText{Type: "html", Body: entry.Content},
+		}
+		if entry.Summary != "" {
+			item.Summary = &atomText{Type: "text", Body: entry.Summary}
+		}
+		for _, tag := range entry.Tags {
+			item.Categories = append(item.Categories, atomCategory{Term: tag})
+		}
+		for _, attachment := range entry.Attachments {
+			item.Links = append(item.Links, atomLink{
+				Href:  attachment.URL,
+				Rel:   "enclosure",
+				Type:  attachment.MimeType,
+				Title: attachment.Title,
+			})
+		}
+		doc.Entries = append(doc.Entries, item)
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ---------- JSON Feed ----------
+
+// JSONFeed is a JSON Feed 1.1 document
+type JSONFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url,omitempty"`
+	FeedURL     string       `json:"feed_url,omitempty"`
+	Authors     []JSONAuthor `json:"authors,omitempty"`
+	Items       []JSONItem   `json:"items"`
+}
+
+// JSONAuthor is the author of a JSON feed
+type JSONAuthor struct {
+	Name string `json:"name"`
+}
+
+// JSONItem is an entry of a JSON feed
+type JSONItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Attachments   []JSONAttachment `json:"attachments,omitempty"`
+}
+
+// JSONAttachment is a media file of a JSON feed item
+type JSONAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Title    string `json:"title,omitempty"`
+}
+
+// JSONFeed converts the feed to a JSON Feed document
+func (f *Feed) JSONFeed() JSONFeed {
+	doc := JSONFeed{
+		Version:     JSONFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.FeedLink,
+		Items:       make([]JSONItem, 0, len(f.Entries)),
+	}
+	if f.Author != "" {
+		doc.Authors = []JSONAuthor{{Name: f.Author}}
+	}
+
+	for _, entry := range f.Entries {
+		item := JSONItem{
+			ID:            entry.ID,
+			URL:           entry.Link,
+			Title:         entry.Title,
+			ContentHTML:   entry.Content,
+			Summary:       entry.Summary,
+			DatePublished: atomTime(entry.Published),
+			DateModified:  atomTime(entry.Updated),
+			Tags:          entry.Tags,
+		}
+		for _, attachment := range entry.Attachments {
+			item.Attachments = append(item.Attachments, JSONAttachment{
+				URL:      attachment.URL,
+				MimeType: attachment.MimeType,
+				Title:    attachment.Title,
+			})
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	return doc
+}
+
+// JSON renders the feed as a JSON Feed 1.1 document
+func (f *Feed) JSON() ([]byte, error) {
+	return json.MarshalIndent(f.JSONFeed(), "", "  ")
+}
+
+// ---------- HTML ----------
+
+// rootRelativeURL matches src and href attributes holding a root-relative URL like /api/files/...
+var rootRelativeURL = regexp.MustCompile(`(\s(?:src|href)\s*=\s*["'])/([^/])`)
+
+// AbsoluteURLs rewrites root-relative links and image sources in HTML against base,
+// feed readers resolve them against their own origin otherwise
+func AbsoluteURLs(html, base string) string {
+	return rootRelativeURL.ReplaceAllString(html, "${1}"+base+"/${2}")
+}
@@ -0,0 +1,104 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() *Feed {
+	published := time.Date(2026, 1, 2, 8, 30, 0, 0, time.FixedZone("CET", 3600))
+	return &Feed{
+		ID:       "urn:diarum:feed:u1",
+		Title:    "Alice's diary",
+		Link:     "https://diary.example.com/",
+		FeedLink: "https://diary.example.com/api/v1/feed.atom",
+		Author:   "Alice",
+		Updated:  published,
+		Entries: []Entry{{
+			ID:        "urn:diarum:diary:d1",
+			Title:     "2026-01-02 08:30 · happy",
+			Link:      "https://diary.example.com/diary/2026-01-02",
+			Published: published,
+			Updated:   published.Add(time.Hour),
+			Content:   `<p>Snow & sun</p><img src="https://diary.example.com/api/files/m/1/a.jpg">`,
+			Summary:   "Snow & sun",
+			Tags:      []string{"winter", "travel"},
+			Attachments: []Attachment{
+				{URL: "https://diary.example.com/api/files/m/1/a.jpg", MimeType: "image/jpeg", Title: "a.jpg"},
+			},
+		}},
+	}
+}
+
+func TestAtom(t *testing.T) {
+	data, err := testFeed().Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "<?xml") {
+		t.Error("missing XML declaration")
+	}
+
+	var parsed atomFeed
+	if err := xml.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if parsed.Updated != "2026-01-02T07:30:00Z" {
+		t.Errorf("updated = %q", parsed.Updated)
+	}
+	if len(parsed.Entries) != 1 {
+		t.Fatalf("%d entries", len(parsed.Entries))
+	}
+
+	entry := parsed.Entries[0]
+	if entry.Content.Type != "html" || !strings.Contains(entry.Content.Body, "<p>Snow & sun</p>") {
+		t.Errorf("content = %+v", entry.Content)
+	}
+	if len(entry.Categories) != 2 || entry.Categories[1].Term != "travel" {
+		t.Errorf("categories = %+v", entry.Categories)
+	}
+	if len(entry.Links) != 2 || entry.Links[1].Rel != "enclosure" || entry.Links[1].Type != "image/jpeg" {
+		t.Errorf("links = %+v", entry.Links)
+	}
+	if !strings.Contains(string(data), "&lt;p&gt;Snow &amp; sun") {
+		t.Error("HTML content not escaped")
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	data, err := testFeed().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed JSONFeed
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Version != JSONFeedVersion || parsed.Authors[0].Name != "Alice" {
+		t.Errorf("feed = %+v", parsed)
+	}
+	item := parsed.Items[0]
+	if item.DatePublished != "2026-01-02T07:30:00Z" || item.DateModified != "2026-01-02T08:30:00Z" {
+		t.Errorf("dates = %s %s", item.DatePublished, item.DateModified)
+	}
+	if len(item.Attachments) != 1 || item.Attachments[0].MimeType != "image/jpeg" {
+		t.Errorf("attachments = %+v", item.Attachments)
+	}
+
+	empty, _ := (&Feed{Title: "empty"}).JSON()
+	if !strings.Contains(string(empty), `"items": []`) {
+		t.Errorf("empty feed has no items array: %s", empty)
+	}
+}
+
+func TestAbsoluteURLs(t *testing.T) {
+	html := `<p><a href="/diary/2026-01-02">day</a><img src="/api/files/m/1/a.jpg"><img src='//cdn.example.com/b.png'><img src="https://x.example.com/c.png"></p>`
+	want := `<p><a href="https://d.example.com/diary/2026-01-02">day</a><img src="https://d.example.com/api/files/m/1/a.jpg"><img src='//cdn.example.com/b.png'><img src="https://x.example.com/c.png"></p>`
+	if got := AbsoluteURLs(html, "https://d.example.com"); got != want {
+		t.Errorf("AbsoluteURLs() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,406 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the content type of calendar files
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineOctets is the longest content line before it is folded, see RFC 5545 section 3.1
+const maxLineOctets = 75
+
+// maxEventDays bounds the days a single event is spread over, a multi-year event is a data error
+const maxEventDays = 31
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+	utcLayout      = "20060102T150405Z"
+)
+
+// Calendar is a list of events
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Event is a VEVENT. All-day events start at midnight UTC of their first day
+// and end at midnight UTC of the day after their last one.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Status      string
+	Categories  []string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Stamp       time.Time
+}
+
+// Cancelled reports whether the event was cancelled
+func (e *Event) Cancelled() bool {
+	return strings.EqualFold(e.Status, "CANCELLED")
+}
+
+// Days lists the calendar days in loc the event takes place on, as YYYY-MM-DD
+func (e *Event) Days(loc *time.Location) []string {
+	var first, last time.Time
+	if e.AllDay {
+		first = e.Start
+		last = first
+		if e.End.After(first) {
+			last = e.End.AddDate(0, 0, -1)
+		}
+	} else {
+		start := e.Start.In(loc)
+		first = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		last = first
+		if e.End.After(e.Start) {
+			// An event ending at midnight does not take place on the next day
+			end := e.End.In(loc).Add(-time.Nanosecond)
+			last = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+		}
+	}
+
+	var days []string
+	for day := first; !day.After(last) && len(days) < maxEventDays; day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format("2006-01-02"))
+	}
+	return days
+}
+
+// ---------- Encoding ----------
+
+// Encode renders the calendar as an iCalendar file.
+// Only all-day events are written, they are the only kind a diary produces.
+func (c *Calendar) Encode() []byte {
+	var sb strings.Builder
+	line := func(name, value string) {
+		writeLine(&sb, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", c.ProdID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escapeText(c.Name))
+	}
+
+	for _, event := range c.Events {
+		end := event.End
+		if !end.After(event.Start) {
+			end = event.Start.AddDate(0, 0, 1)
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", event.UID)
+		line("DTSTAMP", event.Stamp.UTC().Format(utcLayout))
+		line("DTSTART;VALUE=DATE", event.Start.Format(dateLayout))
+		line("DTEND;VALUE=DATE", end.Format(dateLayout))
+		line("SUMMARY", escapeText(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION", escapeText(event.Location))
+		}
+		if event.URL != "" {
+			line("URL", event.URL)
+		}
+		if len(event.Categories) > 0 {
+			categories := make([]string, len(event.Categories))
+			for i, category := range event.Categories {
+				categories[i] = escapeText(category)
+			}
+			line("CATEGORIES", strings.Join(categories, ","))
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return []byte(sb.String())
+}
+
+// writeLine writes a content line, folded into lines of at most 75 octets without splitting a character
+func writeLine(sb *strings.Builder, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		sb.WriteString(s[:cut])
+		sb.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards their length
+		limit = maxLineOctets - 1
+	}
+	sb.WriteString(s)
+	sb.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// ---------- Parsing ----------
+
+// property is a content line split into its parts
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the events of an iCalendar file. Floating times, which carry no timezone,
+// are read in loc. Recurrence rules are not expanded, a recurring event is read as its first occurrence.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events []Event
+		event  *Event
+		// stack holds the open components, properties of components nested in an event like VALARM are ignored
+		stack []string
+	)
+	for n, raw := range lines {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		prop, ok := parseProperty(raw)
+		if !ok {
+			return nil, fmt.Errorf("line %d: invalid content line", n+1)
+		}
+
+		switch prop.name {
+		case "BEGIN":
+			component := strings.ToUpper(prop.value)
+			stack = append(stack, component)
+			if component == "VEVENT" {
+				event = &Event{}
+			}
+			continue
+		case "END":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", n+1, prop.value)
+			}
+			component := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if component == "VEVENT" && event != nil {
+				if event.Start.IsZero() {
+					return nil, fmt.Errorf("line %d: event without DTSTART", n+1)
+				}
+				events = append(events, *event)
+				event = nil
+			}
+			continue
+		}
+
+		if event == nil || stack[len(stack)-1] != "VEVENT" {
+			continue
+		}
+		if err := event.set(prop, loc); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unterminated %s", stack[len(stack)-1])
+	}
+	return events, nil
+}
+
+// set reads a property of the event
+func (e *Event) set(prop property, loc *time.Location) error {
+	switch prop.name {
+	case "UID":
+		e.UID = prop.value
+	case "SUMMARY":
+		e.Summary = unescapeText(prop.value)
+	case "DESCRIPTION":
+		e.Description = unescapeText(prop.value)
+	case "LOCATION":
+		e.Location = unescapeText(prop.value)
+	case "URL":
+		e.URL = prop.value
+	case "STATUS":
+		e.Status = prop.value
+	case "CATEGORIES":
+		for _, category := range splitList(prop.value) {
+			if category = strings.TrimSpace(unescapeText(category)); category != "" {
+				e.Categories = append(e.Categories, category)
+			}
+		}
+	case "DTSTAMP":
+		stamp, _, err := parseTime(prop, loc)
+		if err != nil {
+			return err
+		}
+		e.Stamp = stamp
+	case "DTSTART":
+		start, allDay, err := parseTime(prop, loc)
+		if err != nil {
+			return err
+		}
+		e.Start, e.AllDay = start, allDay
+	case "DTEND":
+		end, _, err := parseTime(prop, loc)
+		if err != nil {
+			return err
+		}
+		e.End = end
+	}
+	return nil
+}
+
+// parseTime reads a DATE or DATE-TIME value, dates are returned as midnight UTC
+func parseTime(prop property, loc *time.Location) (time.Time, bool, error) {
+	value := prop.value
+	if prop.params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s date %q", prop.name, value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(utcLayout, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s time %q", prop.name, value)
+		}
+		return t, false, nil
+	}
+
+	if tzid := prop.params["TZID"]; tzid != "" {
+		// Outlook writes Windows zone names, which fall back to loc
+		if zone, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = zone
+		}
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s time %q", prop.name, value)
+	}
+	return t, false, nil
+}
+
+// unfold reads the content lines of a file, joining folded lines
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// parseProperty splits a content line into name, parameters and value.
+// Quoted parameter values may contain colons and semicolons.
+func parseProperty(line string) (property, bool) {
+	prop := property{params: map[string]string{}}
+
+	colon := -1
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		if line[i] == '"' {
+			quoted = !quoted
+		} else if line[i] == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return prop, false
+	}
+	prop.value = line[colon+1:]
+
+	parts := splitOutsideQuotes(line[:colon], ';')
+	prop.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, prop.name != ""
+}
+
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitList splits a comma separated text list, keeping escaped commas
+func splitList(s string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			sb.WriteByte('\n')
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
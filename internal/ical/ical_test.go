@@ -0,0 +1,147 @@
+package ical
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	cal := &Calendar{
+		ProdID: "-//Diarum//Diary//EN",
+		Name:   "Alice's diary",
+		Events: []Event{{
+			UID:         "d1@diarum",
+			Summary:     "Diary · happy",
+			Description: "Snow, sun; and\n" + strings.Repeat("日记", 40),
+			URL:         "https://diary.example.com/diary/2026-01-02",
+			Categories:  []string{"winter", "a,b"},
+			Start:       day,
+			AllDay:      true,
+			Stamp:       time.Date(2026, 1, 2, 9, 0, 0, 0, time.FixedZone("CET", 3600)),
+		}},
+	}
+	data := cal.Encode()
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line longer than %d octets: %q", maxLineOctets, line)
+		}
+	}
+	for _, want := range []string{
+		"DTSTART;VALUE=DATE:20260102\r\n",
+		"DTEND;VALUE=DATE:20260103\r\n",
+		"DTSTAMP:20260102T080000Z\r\n",
+		`SUMMARY:Diary · happy`,
+		`DESCRIPTION:Snow\, sun\; and\n`,
+		`CATEGORIES:winter,a\,b`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("calendar is missing %q", want)
+		}
+	}
+
+	// The encoded calendar reads back unchanged
+	events, err := Parse(bytes.NewReader(data), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events", len(events))
+	}
+	got := events[0]
+	if got.Description != cal.Events[0].Description || !reflect.DeepEqual(got.Categories, cal.Events[0].Categories) {
+		t.Errorf("round trip = %+v", got)
+	}
+	if !got.AllDay || !got.Start.Equal(day) || !got.End.Equal(day.AddDate(0, 0, 1)) {
+		t.Errorf("dates = %v %v %v", got.AllDay, got.Start, got.End)
+	}
+}
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Europe/Berlin\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:19701025T030000\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:1\r\n" +
+	"SUMMARY:Standup\r\n" +
+	"LOCATION:Room \"A\"\\, 2nd floor\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20260105T090000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20260105T091500\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"SUMMARY:Alarm\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:2\r\n" +
+	"SUMMARY:Trip to the\r\n" +
+	"  mountains\r\n" +
+	"DTSTART;VALUE=DATE:20260106\r\n" +
+	"DTEND;VALUE=DATE:20260109\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:3\r\n" +
+	"SUMMARY:Late call\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"DTSTART:20260105T230000Z\r\n" +
+	"DTEND:20260106T000000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(testCalendar), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("%d events", len(events))
+	}
+
+	standup := events[0]
+	if standup.Summary != "Standup" || standup.Location != `Room "A", 2nd floor` {
+		t.Errorf("standup = %+v", standup)
+	}
+	if standup.Start.UTC().Format(time.RFC3339) != "2026-01-05T08:00:00Z" {
+		t.Errorf("TZID start = %v", standup.Start)
+	}
+
+	trip := events[1]
+	if trip.Summary != "Trip to the mountains" {
+		t.Errorf("folded summary = %q", trip.Summary)
+	}
+	if got := trip.Days(time.UTC); !reflect.DeepEqual(got, []string{"2026-01-06", "2026-01-07", "2026-01-08"}) {
+		t.Errorf("all-day days = %v", got)
+	}
+
+	call := events[2]
+	if !call.Cancelled() {
+		t.Error("cancelled event not reported")
+	}
+	if got := call.Days(time.UTC); !reflect.DeepEqual(got, []string{"2026-01-05"}) {
+		t.Errorf("event ending at midnight = %v", got)
+	}
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	if got := call.Days(tokyo); !reflect.DeepEqual(got, []string{"2026-01-06"}) {
+		t.Errorf("days in Tokyo = %v", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"unterminated": "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20260101\r\n",
+		"no start":     "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:x\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		"bad date":     "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:2026-01-01\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		"not ics":      "hello world\r\n",
+	} {
+		if _, err := Parse(strings.NewReader(input), time.UTC); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
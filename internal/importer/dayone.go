@@ -0,0 +1,106 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// dayOneMoment matches the Markdown image of a Day One attachment, ![](dayone-moment://ID)
+var dayOneMoment = regexp.MustCompile(`!\[[^\]]*\]\(dayone-moment:/*(?:[a-z]+/)?([0-9A-Fa-f]+)\)`)
+
+// dayOne reads the JSON export of Day One: a ZIP with one JSON file per journal and the photos
+// in photos/<md5>.<type>. Entry text is Markdown that embeds photos as dayone-moment:// links.
+var dayOne = Importer{
+	Name:   "dayone",
+	Title:  "Day One",
+	Accept: "Day One JSON export (.zip), or a journal's .json file",
+	Parse:  parseDayOne,
+}
+
+type dayOneJournal struct {
+	Entries []dayOneEntry `json:"entries"`
+}
+
+type dayOneEntry struct {
+	UUID         string   `json:"uuid"`
+	CreationDate string   `json:"creationDate"`
+	TimeZone     string   `json:"timeZone"`
+	Text         string   `json:"text"`
+	Tags         []string `json:"tags"`
+	Location     *struct {
+		PlaceName          string `json:"placeName"`
+		LocalityName       string `json:"localityName"`
+		AdministrativeArea string `json:"administrativeArea"`
+		Country            string `json:"country"`
+	} `json:"location"`
+	Weather *struct {
+		ConditionsDescription string   `json:"conditionsDescription"`
+		TemperatureCelsius    *float64 `json:"temperatureCelsius"`
+	} `json:"weather"`
+	Photos []struct {
+		Identifier string `json:"identifier"`
+		MD5        string `json:"md5"`
+		Type       string `json:"type"`
+	} `json:"photos"`
+}
+
+func parseDayOne(archive *Archive, loc *time.Location) ([]Entry, error) {
+	var entries []Entry
+	for _, file := range archive.WithExt(".json") {
+		var journal dayOneJournal
+		data, err := file.Read()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &journal); err != nil {
+			return nil, fmt.Errorf("invalid Day One journal %s: %w", file.Name, err)
+		}
+
+		for _, e := range journal.Entries {
+			created, err := time.Parse(time.RFC3339, e.CreationDate)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date %q of Day One entry %s", e.CreationDate, e.UUID)
+			}
+			entry := Entry{Tags: cleanTags(e.Tags)}
+			entry.Date, entry.Time = dayAndTime(created.In(zoneOr(e.TimeZone, loc)))
+
+			// Photos are referenced by identifier in the text and stored by checksum
+			photos := map[string]Photo{}
+			for _, p := range e.Photos {
+				file := archive.Find("photos", p.MD5+"."+p.Type)
+				if file == nil {
+					continue
+				}
+				photo := Photo{Ref: "dayone-moment://" + p.Identifier, Name: file.Name, File: file}
+				photos[p.Identifier] = photo
+				entry.Photos = append(entry.Photos, photo)
+			}
+			text := dayOneMoment.ReplaceAllStringFunc(e.Text, func(image string) string {
+				id := dayOneMoment.FindStringSubmatch(image)[1]
+				if photo, ok := photos[id]; ok {
+					return "![](" + photo.Ref + ")"
+				}
+				// Videos, audio and missing photos are left out
+				return ""
+			})
+			entry.Content = appendPhotos(textutil.MarkdownToHTML(text), entry.Photos)
+
+			if e.Location != nil {
+				entry.Location = joinParts(", ", e.Location.PlaceName, e.Location.LocalityName, e.Location.AdministrativeArea, e.Location.Country)
+			}
+			if e.Weather != nil {
+				entry.Weather = weather(e.Weather.ConditionsDescription, e.Weather.TemperatureCelsius)
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
+	}
+	return entries, nil
+}
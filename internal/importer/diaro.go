@@ -0,0 +1,159 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// diaro reads the backup of Diaro: DiaroBackup.xml, alone or in a ZIP with the photos
+// in media/photo. The XML holds one table per kind of record, entries point to their
+// tags and location by uid.
+var diaro = Importer{
+	Name:   "diaro",
+	Title:  "Diaro",
+	Accept: "Diaro backup (.zip or DiaroBackup.xml)",
+	Parse:  parseDiaro,
+}
+
+// diaroMoods names the moods of Diaro by number
+var diaroMoods = map[string]string{
+	"1": "awesome",
+	"2": "happy",
+	"3": "neutral",
+	"4": "sad",
+	"5": "awful",
+}
+
+type diaroBackup struct {
+	Tables []struct {
+		Name string `xml:"name,attr"`
+		Rows []struct {
+			Fields []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"r"`
+	} `xml:"table"`
+}
+
+// rows returns the rows of a table as field maps
+func (b *diaroBackup) rows(table string) []map[string]string {
+	var rows []map[string]string
+	for _, t := range b.Tables {
+		if t.Name != table {
+			continue
+		}
+		for _, r := range t.Rows {
+			row := make(map[string]string, len(r.Fields))
+			for _, f := range r.Fields {
+				row[f.XMLName.Local] = strings.TrimSpace(f.Value)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func parseDiaro(archive *Archive, loc *time.Location) ([]Entry, error) {
+	files := archive.WithExt(".xml")
+	if len(files) == 0 {
+		return nil, ErrNoEntries
+	}
+	var backup diaroBackup
+	data, err := files[0].Read()
+	if err != nil {
+		return nil, err
+	}
+	if err := xml.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("invalid Diaro backup %s: %w", files[0].Name, err)
+	}
+
+	tags := map[string]string{}
+	for _, row := range backup.rows("diaro_tags") {
+		tags[row["uid"]] = row["title"]
+	}
+	locations := map[string]string{}
+	for _, row := range backup.rows("diaro_locations") {
+		locations[row["uid"]] = joinParts(", ", row["title"], row["address"])
+	}
+	attachments := map[string][]map[string]string{}
+	for _, row := range backup.rows("diaro_attachments") {
+		if row["type"] == "photo" {
+			attachments[row["entry_uid"]] = append(attachments[row["entry_uid"]], row)
+		}
+	}
+
+	var entries []Entry
+	for _, row := range backup.rows("diaro_entries") {
+		millis, err := strconv.ParseInt(row["date"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q of Diaro entry %s", row["date"], row["uid"])
+		}
+		entryLoc := loc
+		if offset, ok := parseOffset(row["tz_offset"]); ok {
+			entryLoc = time.FixedZone(row["tz_offset"], offset)
+		}
+
+		entry := Entry{
+			Mood:     diaroMoods[row["mood"]],
+			Location: locations[row["location_uid"]],
+		}
+		entry.Date, entry.Time = dayAndTime(time.UnixMilli(millis).In(entryLoc))
+
+		// Tags are stored as ",uid1,uid2,"
+		var entryTags []string
+		for _, uid := range strings.Split(row["tags"], ",") {
+			if title, ok := tags[uid]; ok {
+				entryTags = append(entryTags, title)
+			}
+		}
+		entry.Tags = cleanTags(entryTags)
+
+		if celsius, err := strconv.ParseFloat(row["weather_temperature"], 64); err == nil && row["weather_description"] != "" {
+			entry.Weather = weather(row["weather_description"], &celsius)
+		} else {
+			entry.Weather = truncate(row["weather_description"])
+		}
+
+		photos := attachments[row["uid"]]
+		sort.SliceStable(photos, func(i, j int) bool {
+			a, _ := strconv.Atoi(photos[i]["position"])
+			b, _ := strconv.Atoi(photos[j]["position"])
+			return a < b
+		})
+		for _, photo := range photos {
+			if file := archive.Find("photo", photo["filename"]); file != nil {
+				entry.Photos = append(entry.Photos, Photo{Ref: photo["filename"], Name: photo["filename"], File: file})
+			}
+		}
+
+		content := textutil.TextToHTML(row["text"])
+		if title := row["title"]; title != "" {
+			content = "<h2>" + html.EscapeString(title) + "</h2>" + content
+		}
+		entry.Content = appendPhotos(content, entry.Photos)
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
+	}
+	return entries, nil
+}
+
+// parseOffset reads a UTC offset like +02:00 into seconds
+func parseOffset(s string) (int, bool) {
+	t, err := time.Parse("-07:00", s)
+	if err != nil {
+		return 0, false
+	}
+	_, offset := t.Zone()
+	return offset, true
+}
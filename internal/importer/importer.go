@@ -0,0 +1,387 @@
+// Package importer reads the archives of other journaling apps into diary entries.
+// Each source is an Importer, the api package stores the entries and their photos.
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// ZIP bomb protection: the largest file read from an archive, the most bytes read
+// from all of its files together and the most files it may have
+const (
+	maxFileSize     = 100 << 20
+	maxArchiveSize  = 1 << 30
+	maxArchiveFiles = 10000
+)
+
+// maxFieldLength is the longest mood or weather kept, the diary fields allow 50 characters
+const maxFieldLength = 50
+
+// previewSize is the number of entries shown in a preview
+const previewSize = 20
+
+// ErrNoEntries is returned when an archive holds no entries of the source
+var ErrNoEntries = errors.New("no entries found")
+
+// ErrArchiveTooLarge is returned for archives above the total size or file count limit
+var ErrArchiveTooLarge = errors.New("archive is too large to import")
+
+// Entry is a diary entry read from another app
+type Entry struct {
+	// Date is the day in YYYY-MM-DD, Time the HH:MM of the entry or empty
+	Date string
+	Time string
+	// Content is editor HTML, photos are <img> tags with the Ref of the photo as src
+	Content  string
+	Mood     string
+	Weather  string
+	Location string
+	Tags     []string
+	Photos   []Photo
+}
+
+// Photo is an image attached to an entry
+type Photo struct {
+	// Ref is the src of the photo's <img> in the entry content, replaced by the media URL on import
+	Ref  string
+	Name string
+	// File is read when the photo is imported
+	File *File
+}
+
+// Importer reads the archive of one app
+type Importer struct {
+	// Name identifies the source in the import routes, e.g. dayone
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	// Accept describes the expected upload
+	Accept string `json:"accept"`
+	// Parse reads the entries of an archive, times without a timezone are in loc
+	Parse func(archive *Archive, loc *time.Location) ([]Entry, error) `json:"-"`
+}
+
+// importers lists the registered sources in the order they are offered
+var importers []Importer
+
+// Register adds a source
+func Register(imp Importer) {
+	importers = append(importers, imp)
+}
+
+// All returns the registered sources
+func All() []Importer {
+	return append([]Importer(nil), importers...)
+}
+
+// Lookup finds a source by name
+func Lookup(name string) (Importer, bool) {
+	for _, imp := range importers {
+		if imp.Name == name {
+			return imp, true
+		}
+	}
+	return Importer{}, false
+}
+
+func init() {
+	Register(dayOne)
+	Register(journey)
+	Register(diaro)
+	Register(jrnl)
+	Register(markdown)
+}
+
+// ---------- Archives ----------
+
+// File is a file of an upload, its content is read on demand
+type File struct {
+	// Name is the slash separated path inside the archive
+	Name string
+	// Size is the uncompressed size, ZIP entries can't unpack to more
+	Size int64
+	open func() (io.ReadCloser, error)
+}
+
+// Read returns the content of the file, files above the size limit fail
+func (f *File) Read() ([]byte, error) {
+	if f.Size > maxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", f.Name, maxFileSize>>20)
+	}
+	rc, err := f.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	if len(data) > maxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", f.Name, maxFileSize>>20)
+	}
+	return data, nil
+}
+
+// Archive holds the files of an upload, the entries of a ZIP or the uploaded file itself
+type Archive struct {
+	Files []*File
+}
+
+// OpenArchive opens an upload of the given size read from r, which must stay open while
+// the archive is used. ZIP files are read in place, skipping entries with unsafe paths or
+// above the size limit, any other file becomes an archive of that one file.
+// Archives with too many files, or whose files unpack to too many bytes together, fail as a whole.
+func OpenArchive(name string, r io.ReaderAt, size int64) (*Archive, error) {
+	return openArchive(name, r, size, maxArchiveSize, maxArchiveFiles)
+}
+
+// openArchive is OpenArchive with the archive limits as arguments
+func openArchive(name string, r io.ReaderAt, size int64, maxSize int64, maxFiles int) (*Archive, error) {
+	magic := make([]byte, 4)
+	if n, _ := r.ReadAt(magic, 0); n < len(magic) || !bytes.Equal(magic, []byte("PK\x03\x04")) {
+		file := &File{Name: path.Base(name), Size: size, open: func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(r, 0, size)), nil
+		}}
+		return &Archive{Files: []*File{file}}, nil
+	}
+
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ZIP file: %w", err)
+	}
+	if len(reader.File) > maxFiles {
+		return nil, fmt.Errorf("%w: more than %d files", ErrArchiveTooLarge, maxFiles)
+	}
+
+	archive := &Archive{}
+	// The ZIP reader fails entries that unpack to more than their header claims,
+	// so the sizes of the headers bound what the archive unpacks to
+	var total int64
+	for _, zf := range reader.File {
+		if zf.FileInfo().IsDir() || !ValidPath(zf.Name) || strings.HasPrefix(zf.Name, "__MACOSX/") {
+			continue
+		}
+		if zf.UncompressedSize64 > maxFileSize {
+			continue
+		}
+		total += int64(zf.UncompressedSize64)
+		if total > maxSize {
+			return nil, fmt.Errorf("%w: more than %d MB unpacked", ErrArchiveTooLarge, maxSize>>20)
+		}
+		archive.Files = append(archive.Files, &File{Name: zf.Name, Size: int64(zf.UncompressedSize64), open: zf.Open})
+	}
+	return archive, nil
+}
+
+// ValidPath reports whether a path inside an archive is safe to use, rejecting path traversal
+func ValidPath(name string) bool {
+	if strings.Contains(name, "..") {
+		return false
+	}
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, "\\") {
+		return false
+	}
+	return true
+}
+
+// WithExt returns the files with one of the given extensions, sorted by path
+func (a *Archive) WithExt(exts ...string) []*File {
+	var files []*File
+	for _, f := range a.Files {
+		ext := strings.ToLower(path.Ext(f.Name))
+		for _, want := range exts {
+			if ext == want {
+				files = append(files, f)
+				break
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// Find returns the file with the given base name, preferring one inside dir
+func (a *Archive) Find(dir, base string) *File {
+	var found *File
+	for _, f := range a.Files {
+		if path.Base(f.Name) != base {
+			continue
+		}
+		if dir == "" || strings.HasPrefix(f.Name, dir+"/") || strings.Contains(f.Name, "/"+dir+"/") {
+			return f
+		}
+		if found == nil {
+			found = f
+		}
+	}
+	return found
+}
+
+// ---------- Preview ----------
+
+// Preview summarizes the entries of an archive before they are imported
+type Preview struct {
+	Source    string         `json:"source"`
+	Entries   int            `json:"entries"`
+	Photos    int            `json:"photos"`
+	StartDate string         `json:"start_date"`
+	EndDate   string         `json:"end_date"`
+	Tags      []string       `json:"tags"`
+	Sample    []PreviewEntry `json:"sample"`
+}
+
+// PreviewEntry is an entry of a preview
+type PreviewEntry struct {
+	Date     string   `json:"date"`
+	Time     string   `json:"time,omitempty"`
+	Excerpt  string   `json:"excerpt"`
+	Mood     string   `json:"mood,omitempty"`
+	Weather  string   `json:"weather,omitempty"`
+	Location string   `json:"location,omitempty"`
+	Tags     []string `json:"tags"`
+	Photos   int      `json:"photos"`
+}
+
+// NewPreview summarizes entries, the sample holds the first entries
+func NewPreview(source string, entries []Entry) *Preview {
+	preview := &Preview{Source: source, Entries: len(entries), Tags: []string{}, Sample: []PreviewEntry{}}
+
+	tags := map[string]bool{}
+	for i, e := range entries {
+		preview.Photos += len(e.Photos)
+		if preview.StartDate == "" || e.Date < preview.StartDate {
+			preview.StartDate = e.Date
+		}
+		if e.Date > preview.EndDate {
+			preview.EndDate = e.Date
+		}
+		for _, tag := range e.Tags {
+			if !tags[tag] {
+				tags[tag] = true
+				preview.Tags = append(preview.Tags, tag)
+			}
+		}
+
+		if i < previewSize {
+			entryTags := e.Tags
+			if entryTags == nil {
+				entryTags = []string{}
+			}
+			preview.Sample = append(preview.Sample, PreviewEntry{
+				Date:     e.Date,
+				Time:     e.Time,
+				Excerpt:  excerpt(textutil.StripHTML(e.Content), 120),
+				Mood:     e.Mood,
+				Weather:  e.Weather,
+				Location: e.Location,
+				Tags:     entryTags,
+				Photos:   len(e.Photos),
+			})
+		}
+	}
+	sort.Strings(preview.Tags)
+	return preview
+}
+
+// ---------- Helpers for sources ----------
+
+// dayAndTime splits a time into the day and clock of an entry
+func dayAndTime(t time.Time) (string, string) {
+	return t.Format("2006-01-02"), t.Format("15:04")
+}
+
+// zoneOr loads a named timezone, falling back to loc
+func zoneOr(name string, loc *time.Location) *time.Location {
+	if name != "" {
+		if zone, err := time.LoadLocation(name); err == nil {
+			return zone
+		}
+	}
+	return loc
+}
+
+// appendPhotos adds an image for each photo not yet referenced in the content
+func appendPhotos(content string, photos []Photo) string {
+	for _, photo := range photos {
+		src := `src="` + html.EscapeString(photo.Ref) + `"`
+		if !strings.Contains(content, src) {
+			content += `<p><img ` + src + ` alt=""></p>`
+		}
+	}
+	return content
+}
+
+// joinParts joins the non-empty parts, skipping repeats
+func joinParts(sep string, parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		repeated := false
+		for _, k := range kept {
+			if strings.EqualFold(k, part) {
+				repeated = true
+			}
+		}
+		if !repeated {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+// weather describes the weather with its temperature when known
+func weather(description string, celsius *float64) string {
+	if celsius != nil && *celsius > -100 && *celsius < 100 {
+		return truncate(joinParts(", ", description, fmt.Sprintf("%.0f°C", *celsius)))
+	}
+	return truncate(description)
+}
+
+// truncate shortens a field to maxFieldLength characters
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= maxFieldLength {
+		return s
+	}
+	return string([]rune(s)[:maxFieldLength-1]) + "…"
+}
+
+// excerpt shortens text to n characters on one line
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n-1]) + "…"
+}
+
+// cleanTags trims tags, drops empty ones and repeats
+func cleanTags(tags []string) []string {
+	cleaned := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		cleaned = append(cleaned, tag)
+	}
+	return cleaned
+}
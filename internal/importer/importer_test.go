@@ -0,0 +1,300 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipArchive builds an archive from file names and contents
+func zipArchive(t *testing.T, files map[string]string) *Archive {
+	t.Helper()
+	archive, err := openBytes("export.zip", zipBytes(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+// openBytes opens an upload held in memory
+func openBytes(name string, data []byte) (*Archive, error) {
+	return OpenArchive(name, bytes.NewReader(data), int64(len(data)))
+}
+
+// zipBytes builds a ZIP file from file names and contents
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenArchive(t *testing.T) {
+	archive := zipArchive(t, map[string]string{
+		"Journal.json":      "{}",
+		"photos/a.jpeg":     "jpeg",
+		"../evil.txt":       "x",
+		"__MACOSX/._a.jpeg": "x",
+	})
+	if len(archive.Files) != 2 {
+		t.Errorf("files = %d, want 2", len(archive.Files))
+	}
+	f := archive.Find("photos", "a.jpeg")
+	if f == nil {
+		t.Fatal("Find() = nil")
+	}
+	if data, err := f.Read(); err != nil || string(data) != "jpeg" {
+		t.Errorf("Read() = %q, %v", data, err)
+	}
+
+	single, err := openBytes("dir/journal.txt", []byte("text"))
+	if err != nil || len(single.Files) != 1 || single.Files[0].Name != "journal.txt" {
+		t.Errorf("single file = %+v, %v", single, err)
+	}
+}
+
+func TestOpenArchiveLimits(t *testing.T) {
+	data := zipBytes(t, map[string]string{
+		"a.md": strings.Repeat("a", 600),
+		"b.md": strings.Repeat("b", 600),
+		"c.md": "c",
+	})
+
+	if _, err := openArchive("export.zip", bytes.NewReader(data), int64(len(data)), 2000, 3); err != nil {
+		t.Errorf("archive within the limits rejected: %v", err)
+	}
+	if _, err := openArchive("export.zip", bytes.NewReader(data), int64(len(data)), 1000, 3); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("archive above the size limit = %v, want ErrArchiveTooLarge", err)
+	}
+	if _, err := openArchive("export.zip", bytes.NewReader(data), int64(len(data)), 2000, 2); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("archive above the file limit = %v, want ErrArchiveTooLarge", err)
+	}
+}
+
+func TestDayOne(t *testing.T) {
+	archive := zipArchive(t, map[string]string{
+		"Journal.json": `{"entries": [{
+			"uuid": "E1",
+			"creationDate": "2024-03-01T22:30:00Z",
+			"timeZone": "Europe/Berlin",
+			"text": "# Trip\n\nSnow\\! ![](dayone-moment://ABC123) ![](dayone-moment:/video/FFF)",
+			"tags": ["travel", " travel", "winter"],
+			"location": {"placeName": "Hut", "localityName": "Zermatt", "country": "Switzerland"},
+			"weather": {"conditionsDescription": "Snow", "temperatureCelsius": -3.4},
+			"photos": [{"identifier": "ABC123", "md5": "d41d8", "type": "jpeg"}, {"identifier": "DEF", "md5": "beef", "type": "png"}]
+		}]}`,
+		"photos/d41d8.jpeg": "jpeg",
+		"photos/beef.png":   "png",
+	})
+
+	entries, err := dayOne.Parse(archive, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := entries[0]
+	if e.Date != "2024-03-01" || e.Time != "23:30" {
+		t.Errorf("date = %s %s, want the time in Berlin", e.Date, e.Time)
+	}
+	wantContent := `<h1>Trip</h1><p>Snow! <img src="dayone-moment://ABC123" alt=""></p><p><img src="dayone-moment://DEF" alt=""></p>`
+	if e.Content != wantContent {
+		t.Errorf("content =\n%s\nwant\n%s", e.Content, wantContent)
+	}
+	if len(e.Photos) != 2 || e.Photos[0].File.Size != 4 {
+		t.Errorf("photos = %+v", e.Photos)
+	}
+	if !reflect.DeepEqual(e.Tags, []string{"travel", "winter"}) {
+		t.Errorf("tags = %v", e.Tags)
+	}
+	if e.Location != "Hut, Zermatt, Switzerland" || e.Weather != "Snow, -3°C" {
+		t.Errorf("location = %q, weather = %q", e.Location, e.Weather)
+	}
+}
+
+func TestJourney(t *testing.T) {
+	archive := zipArchive(t, map[string]string{
+		"1700000000000-abc.json": `{"id": "abc", "text": "**Good** day", "date_journal": 1700000000000, "timezone": "Asia/Tokyo",
+			"tags": ["life"], "photos": ["1700000000000-abc-1.jpg"], "address": "Shibuya, Tokyo", "sentiment": 0.5,
+			"weather": {"degree_c": 1.7976931348623157e308, "description": "Clear", "place": "Tokyo"}}`,
+		"1700000000000-abc-1.jpg": "jpg",
+		"settings.json":           `{"theme": "dark"}`,
+	})
+
+	entries, err := journey.Parse(archive, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Date != "2023-11-15" || e.Time != "07:13" {
+		t.Errorf("date = %s %s", e.Date, e.Time)
+	}
+	if e.Content != `<p><strong>Good</strong> day</p><p><img src="1700000000000-abc-1.jpg" alt=""></p>` {
+		t.Errorf("content = %s", e.Content)
+	}
+	if e.Mood != "good" || e.Weather != "Clear" || e.Location != "Shibuya, Tokyo, Tokyo" {
+		t.Errorf("mood = %q, weather = %q, location = %q", e.Mood, e.Weather, e.Location)
+	}
+}
+
+func TestDiaro(t *testing.T) {
+	archive := zipArchive(t, map[string]string{
+		"DiaroBackup.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<data version="2">
+<table name="diaro_tags"><r><uid>t1</uid><title>work</title></r><r><uid>t2</uid><title>idea</title></r></table>
+<table name="diaro_locations"><r><uid>l1</uid><title>Office</title><address>Main St 1</address></r></table>
+<table name="diaro_entries"><r>
+	<uid>e1</uid><date>1704099600000</date><tz_offset>+02:00</tz_offset>
+	<title>Kickoff &amp; plans</title><text>Line one
+Line two</text>
+	<location_uid>l1</location_uid><tags>,t1,t2,</tags><mood>2</mood>
+	<weather_temperature>21.4</weather_temperature><weather_description>sunny</weather_description>
+</r></table>
+<table name="diaro_attachments">
+	<r><uid>a2</uid><entry_uid>e1</entry_uid><type>photo</type><filename>photo_2.jpg</filename><position>2</position></r>
+	<r><uid>a1</uid><entry_uid>e1</entry_uid><type>photo</type><filename>photo_1.jpg</filename><position>1</position></r>
+</table>
+</data>`,
+		"media/photo/photo_1.jpg": "one",
+		"media/photo/photo_2.jpg": "two",
+	})
+
+	entries, err := diaro.Parse(archive, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := entries[0]
+	if e.Date != "2024-01-01" || e.Time != "11:00" {
+		t.Errorf("date = %s %s", e.Date, e.Time)
+	}
+	want := `<h2>Kickoff &amp; plans</h2><p>Line one<br>Line two</p><p><img src="photo_1.jpg" alt=""></p><p><img src="photo_2.jpg" alt=""></p>`
+	if e.Content != want {
+		t.Errorf("content =\n%s\nwant\n%s", e.Content, want)
+	}
+	if e.Mood != "happy" || e.Weather != "sunny, 21°C" || e.Location != "Office, Main St 1" || !reflect.DeepEqual(e.Tags, []string{"work", "idea"}) {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestJrnl(t *testing.T) {
+	text := "[2024-01-02 09:05:00 PM] Met @anna for dinner. *\nWe talked about @travel-plans.\n\n" +
+		"2023-12-31 23:59 Old style entry\n"
+	archive, _ := openBytes("journal.txt", []byte(text))
+
+	entries, err := jrnl.Parse(archive, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Date != "2024-01-02" || e.Time != "21:05" || !reflect.DeepEqual(e.Tags, []string{"anna", "travel-plans"}) {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.Content != "<p>Met @anna for dinner.<br>We talked about @travel-plans.</p>" {
+		t.Errorf("content = %s", e.Content)
+	}
+	if entries[1].Date != "2023-12-31" || entries[1].Time != "23:59" {
+		t.Errorf("old style entry = %+v", entries[1])
+	}
+
+	export := `{"tags": {"@work": 1}, "entries": [{"title": "Standup.", "body": "Notes", "date": "2024-02-03", "time": "09:15", "tags": ["@work"], "starred": false}]}`
+	archive, _ = openBytes("export.json", []byte(export))
+	entries, err = jrnl.Parse(archive, time.UTC)
+	if err != nil || len(entries) != 1 || entries[0].Time != "09:15" || !reflect.DeepEqual(entries[0].Tags, []string{"work"}) {
+		t.Errorf("JSON export = %+v, %v", entries, err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	archive := zipArchive(t, map[string]string{
+		"Vault/Daily/2024-05-06.md": "---\nmood: happy\nweather: \"Sunny, 20°C\"\ntags:\n  - \"#walk\"\n  - park\n---\n" +
+			"Walked to [[Central Park|the park]].\n\n![[duck.png|300]]\n![map](../assets/map%201.jpg) ![[Missing.png]] ![[Other note]]",
+		"Vault/Daily/notes.md":       "# Ideas\n\nNo date here",
+		"Vault/Later.md":             "---\ndate: 2024-05-07 08:30\n---\nMorning *coffee*",
+		"Vault/attachments/duck.png": "png",
+		"Vault/assets/map 1.jpg":     "jpg",
+	})
+
+	entries, err := markdown.Parse(archive, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Date != "2024-05-06" || e.Time != "" || e.Mood != "happy" || e.Weather != "Sunny, 20°C" || !reflect.DeepEqual(e.Tags, []string{"walk", "park"}) {
+		t.Errorf("entry = %+v", e)
+	}
+	want := `<p>Walked to the park.</p><p><img src="Vault/attachments/duck.png" alt=""><br>` +
+		`<img src="Vault/assets/map 1.jpg" alt="map"></p>`
+	if e.Content != want {
+		t.Errorf("content = %s, want %s", e.Content, want)
+	}
+	if len(e.Photos) != 2 || e.Photos[0].Ref != "Vault/attachments/duck.png" || e.Photos[1].Name != "map 1.jpg" {
+		t.Errorf("photos = %+v", e.Photos)
+	}
+	if e := entries[1]; e.Date != "2024-05-07" || e.Time != "08:30" || e.Content != "<p>Morning <em>coffee</em></p>" {
+		t.Errorf("front matter date entry = %+v", e)
+	}
+}
+
+func TestMarkdownDiarumExport(t *testing.T) {
+	day := "# 2026-01-28\n\n## 08:00\n\n**Mood:** calm\n**Tags:** work, home\n\n<p>breakfast</p>\n\n## Entry 2\n\n<p>later</p>\n"
+	archive := zipArchive(t, map[string]string{"markdown/2026-01-28.md": day})
+
+	entries, err := markdown.Parse(archive, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(entries))
+	}
+	if e := entries[0]; e.Time != "08:00" || e.Mood != "calm" || !reflect.DeepEqual(e.Tags, []string{"work", "home"}) || e.Content != "<p>breakfast</p>" {
+		t.Errorf("first entry = %+v", e)
+	}
+	if e := entries[1]; e.Date != "2026-01-28" || e.Time != "" || e.Mood != "" || e.Content != "<p>later</p>" {
+		t.Errorf("second entry = %+v", e)
+	}
+}
+
+func TestNoEntries(t *testing.T) {
+	archive, _ := openBytes("notes.txt", []byte("just some text"))
+	if _, err := jrnl.Parse(archive, time.UTC); err != ErrNoEntries {
+		t.Errorf("err = %v, want ErrNoEntries", err)
+	}
+}
+
+func TestNewPreview(t *testing.T) {
+	entries := []Entry{
+		{Date: "2024-02-01", Content: "<p>" + strings.Repeat("word ", 40) + "</p>", Tags: []string{"b"}},
+		{Date: "2024-01-01", Tags: []string{"a", "b"}, Photos: []Photo{{Ref: "x"}}},
+	}
+	preview := NewPreview("test", entries)
+	if preview.Entries != 2 || preview.Photos != 1 || preview.StartDate != "2024-01-01" || preview.EndDate != "2024-02-01" {
+		t.Errorf("preview = %+v", preview)
+	}
+	if !reflect.DeepEqual(preview.Tags, []string{"a", "b"}) {
+		t.Errorf("tags = %v", preview.Tags)
+	}
+	if n := len([]rune(preview.Sample[0].Excerpt)); n != 120 {
+		t.Errorf("excerpt has %d characters", n)
+	}
+}
@@ -0,0 +1,95 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// journey reads the JSON export of Journey: a ZIP with one JSON file per entry and its photos
+// next to them. Entry text is Markdown, or HTML when the entry type says so.
+var journey = Importer{
+	Name:   "journey",
+	Title:  "Journey",
+	Accept: "Journey JSON export (.zip)",
+	Parse:  parseJourney,
+}
+
+type journeyEntry struct {
+	ID          string   `json:"id"`
+	Text        string   `json:"text"`
+	Type        string   `json:"type"`
+	DateJournal int64    `json:"date_journal"`
+	Timezone    string   `json:"timezone"`
+	Tags        []string `json:"tags"`
+	Photos      []string `json:"photos"`
+	Address     string   `json:"address"`
+	Sentiment   float64  `json:"sentiment"`
+	Weather     struct {
+		DegreeC     *float64 `json:"degree_c"`
+		Description string   `json:"description"`
+		Place       string   `json:"place"`
+	} `json:"weather"`
+}
+
+func parseJourney(archive *Archive, loc *time.Location) ([]Entry, error) {
+	var entries []Entry
+	for _, file := range archive.WithExt(".json") {
+		var e journeyEntry
+		data, err := file.Read()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("invalid Journey entry %s: %w", file.Name, err)
+		}
+		if e.DateJournal == 0 {
+			// Not an entry, e.g. a settings file
+			continue
+		}
+
+		entry := Entry{Tags: cleanTags(e.Tags), Mood: journeyMood(e.Sentiment)}
+		entry.Date, entry.Time = dayAndTime(time.UnixMilli(e.DateJournal).In(zoneOr(e.Timezone, loc)))
+
+		for _, name := range e.Photos {
+			if file := archive.Find("", name); file != nil {
+				entry.Photos = append(entry.Photos, Photo{Ref: name, Name: name, File: file})
+			}
+		}
+		content := e.Text
+		if e.Type != "html" {
+			content = textutil.MarkdownToHTML(content)
+		}
+		entry.Content = appendPhotos(content, entry.Photos)
+
+		entry.Location = joinParts(", ", e.Address, e.Weather.Place)
+		if e.Weather.Description != "" {
+			// Journey writes the largest double as the temperature when it is unknown
+			entry.Weather = weather(e.Weather.Description, e.Weather.DegreeC)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
+	}
+	return entries, nil
+}
+
+// journeyMood names the sentiment Journey stores for the mood picker, from -1 (awful) to 1 (great).
+// Zero means no mood was picked.
+func journeyMood(sentiment float64) string {
+	switch {
+	case sentiment >= 0.75:
+		return "great"
+	case sentiment > 0:
+		return "good"
+	case sentiment <= -0.75:
+		return "awful"
+	case sentiment < 0:
+		return "bad"
+	}
+	return ""
+}
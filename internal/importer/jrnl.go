@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// jrnl reads journals of the jrnl command line app, the plain text journal file or
+// the output of jrnl --export json. Tags are words starting with @ in the text.
+var jrnl = Importer{
+	Name:   "jrnl",
+	Title:  "jrnl",
+	Accept: "jrnl journal file (.txt) or JSON export (.json)",
+	Parse:  parseJrnl,
+}
+
+var (
+	// jrnlHeading starts an entry of a plain text journal: [2024-01-02 09:30:00 AM] Title
+	// or, in older journals, 2024-01-02 09:30 Title
+	jrnlHeading = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2})[ T](\d{1,2}:\d{2})(?::\d{2})?(?: ?([AaPp][Mm]))?\]? ?(.*)$`)
+	jrnlTag     = regexp.MustCompile(`(?:^|[\s(])@([\p{L}\p{N}_-]+)`)
+)
+
+type jrnlExport struct {
+	Entries []struct {
+		Title   string   `json:"title"`
+		Body    string   `json:"body"`
+		Date    string   `json:"date"`
+		Time    string   `json:"time"`
+		Tags    []string `json:"tags"`
+		Starred bool     `json:"starred"`
+	} `json:"entries"`
+}
+
+func parseJrnl(archive *Archive, loc *time.Location) ([]Entry, error) {
+	var entries []Entry
+	for _, file := range archive.WithExt(".json") {
+		var export jrnlExport
+		data, err := file.Read()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, fmt.Errorf("invalid jrnl export %s: %w", file.Name, err)
+		}
+		for _, e := range export.Entries {
+			clock, ok := jrnlClock(e.Time, "")
+			if _, err := time.Parse("2006-01-02", e.Date); err != nil || !ok {
+				return nil, fmt.Errorf("invalid date %q %q of jrnl entry %q", e.Date, e.Time, e.Title)
+			}
+			tags := make([]string, 0, len(e.Tags))
+			for _, tag := range e.Tags {
+				tags = append(tags, strings.TrimPrefix(tag, "@"))
+			}
+			entries = append(entries, jrnlEntry(e.Date, clock, e.Title, e.Body, tags))
+		}
+	}
+
+	for _, file := range archive.WithExt(".txt", "") {
+		var current *Entry
+		var title string
+		var body []string
+		flush := func() {
+			if current != nil {
+				entries = append(entries, jrnlEntry(current.Date, current.Time, title, strings.Join(body, "\n"), nil))
+			}
+		}
+
+		data, err := file.Read()
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+			if m := jrnlHeading.FindStringSubmatch(line); m != nil {
+				if clock, ok := jrnlClock(m[2], m[3]); ok {
+					flush()
+					current = &Entry{Date: m[1], Time: clock}
+					title, body = m[4], nil
+					continue
+				}
+			}
+			if current != nil {
+				body = append(body, line)
+			}
+		}
+		flush()
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
+	}
+	return entries, nil
+}
+
+// jrnlEntry builds an entry from the title line and body of a jrnl entry.
+// A starred entry's title ends with " *", which is dropped.
+func jrnlEntry(date, clock, title, body string, tags []string) Entry {
+	title = strings.TrimSuffix(strings.TrimSpace(title), " *")
+	text := strings.TrimSpace(title + "\n" + strings.Trim(body, "\n"))
+
+	if tags == nil {
+		for _, m := range jrnlTag.FindAllStringSubmatch(text, -1) {
+			tags = append(tags, m[1])
+		}
+	}
+	return Entry{Date: date, Time: clock, Content: textutil.TextToHTML(text), Tags: cleanTags(tags)}
+}
+
+// jrnlClock normalizes a time with an optional AM/PM marker to HH:MM
+func jrnlClock(clock, meridiem string) (string, bool) {
+	layout := "15:04"
+	if meridiem != "" {
+		clock, layout = clock+" "+strings.ToUpper(meridiem), "3:04 PM"
+	}
+	t, err := time.Parse(layout, clock)
+	if err != nil {
+		return "", false
+	}
+	return t.Format("15:04"), true
+}
@@ -0,0 +1,319 @@
+package importer
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// markdown reads a folder of Markdown notes, one note per day like the daily notes of an
+// Obsidian vault or the markdown/ folder of a Diarum export. The day comes from the front
+// matter or the file name, notes without one are skipped.
+var markdown = Importer{
+	Name:   "markdown",
+	Title:  "Markdown",
+	Accept: "Folder of Markdown notes (.zip), such as Obsidian daily notes, or a single .md file",
+	Parse:  parseMarkdown,
+}
+
+var (
+	// markdownFileDate finds the day in a file name: 2024-01-02.md, Daily/2024_01_02.md or 20240102 notes.md
+	markdownFileDate = regexp.MustCompile(`(\d{4})[-_.]?(\d{2})[-_.]?(\d{2})`)
+	// markdownEmbed matches an Obsidian embed, ![[image.png]] or ![[image.png|300]]
+	markdownEmbed = regexp.MustCompile(`!\[\[([^\]|#]+)(?:#[^\]|]*)?(?:\|([^\]]*))?\]\]`)
+	// markdownWikiLink matches an Obsidian link, [[Note]] or [[Note|label]]
+	markdownWikiLink = regexp.MustCompile(`\[\[([^\]|]+)(?:\|([^\]]*))?\]\]`)
+	// markdownImage matches a Markdown image, ![alt](path) or ![alt](<path with spaces>)
+	markdownImage = regexp.MustCompile(`!\[([^\]]*)\]\((<[^>]+>|[^)\s]+)(?:\s+"[^"]*")?\)`)
+	// markdownField matches a metadata line of a Diarum export, **Mood:** happy
+	markdownField = regexp.MustCompile(`^\*\*(Mood|Weather|Tags):\*\*\s*(.*)$`)
+	// markdownSection matches the heading of an entry in a Diarum export with several entries a day
+	markdownSection = regexp.MustCompile(`^## (\d{1,2}:\d{2}|Entry \d+)\s*$`)
+	// markdownHTML tells content that is already editor HTML, like the notes of a Diarum export
+	markdownHTML = regexp.MustCompile(`^<(p|h[1-6]|ul|ol|blockquote|pre|div|figure|img|table)\b`)
+)
+
+// imageExts are the extensions of embeds imported as photos
+var imageExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true, ".svg": true, ".heic": true, ".avif": true,
+}
+
+func parseMarkdown(archive *Archive, loc *time.Location) ([]Entry, error) {
+	var entries []Entry
+	for _, file := range archive.WithExt(".md", ".markdown") {
+		data, err := file.Read()
+		if err != nil {
+			return nil, err
+		}
+		meta, body := frontMatter(strings.ReplaceAll(string(data), "\r\n", "\n"))
+
+		date, clock, ok := markdownDate(meta, loc)
+		if !ok {
+			if m := markdownFileDate.FindStringSubmatch(path.Base(file.Name)); m != nil {
+				date = m[1] + "-" + m[2] + "-" + m[3]
+				_, err := time.Parse("2006-01-02", date)
+				ok = err == nil
+			}
+		}
+		if !ok {
+			// Not a daily note
+			continue
+		}
+		if t := meta["time"]; t != "" {
+			if parsed, err := time.Parse("15:04", t); err == nil {
+				clock = parsed.Format("15:04")
+			}
+		}
+
+		base := Entry{
+			Date:     date,
+			Time:     clock,
+			Mood:     truncate(meta["mood"]),
+			Weather:  truncate(meta["weather"]),
+			Location: meta["location"],
+			Tags:     cleanTags(frontMatterList(meta["tags"])),
+		}
+		for _, section := range markdownSections(body) {
+			entry := base
+			if t, err := time.Parse("15:04", section.heading); err == nil {
+				entry.Time = t.Format("15:04")
+			}
+			text := markdownMetadata(&entry, section.body, date)
+			entry.Content, entry.Photos = markdownContent(archive, path.Dir(file.Name), text)
+			if strings.TrimSpace(textutil.StripHTML(entry.Content)) == "" && len(entry.Photos) == 0 {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
+	}
+	return entries, nil
+}
+
+// frontMatter splits the YAML front matter from a note. Only the flat keys and lists that
+// notes use are read: key: value, key: [a, b] and key: followed by "- item" lines.
+func frontMatter(note string) (map[string]string, string) {
+	meta := map[string]string{}
+	if !strings.HasPrefix(note, "---\n") {
+		return meta, note
+	}
+	end := strings.Index(note[4:], "\n---")
+	if end < 0 {
+		return meta, note
+	}
+	block, body := note[4:4+end], note[4+end+4:]
+	body = strings.TrimPrefix(body, "\n")
+
+	var key string
+	for _, line := range strings.Split(block, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && key != "" {
+			meta[key] = joinParts(", ", meta[key], unquote(item))
+			continue
+		}
+		name, value, ok := strings.Cut(trimmed, ":")
+		if !ok || line != strings.TrimLeft(line, " \t") {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			var items []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				items = append(items, unquote(strings.TrimSpace(item)))
+			}
+			value = strings.Join(items, ", ")
+		}
+		meta[key] = unquote(value)
+	}
+	if meta["tags"] == "" {
+		meta["tags"] = meta["tag"]
+	}
+	return meta, body
+}
+
+// frontMatterList splits a front matter list, Obsidian tags may start with #
+func frontMatterList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' }) {
+		items = append(items, strings.TrimPrefix(strings.TrimSpace(item), "#"))
+	}
+	return items
+}
+
+// unquote removes the quotes around a YAML scalar
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// markdownDate reads the day of a note from its front matter date, which may carry a time
+func markdownDate(meta map[string]string, loc *time.Location) (string, string, bool) {
+	value := meta["date"]
+	if value == "" {
+		value = meta["created"]
+	}
+	if value == "" {
+		return "", "", false
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		date, clock := dayAndTime(t.In(loc))
+		return date, clock, true
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			date, clock := dayAndTime(t)
+			return date, clock, true
+		}
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.Format("2006-01-02"), "", true
+	}
+	return "", "", false
+}
+
+type noteSection struct {
+	heading string
+	body    string
+}
+
+// markdownSections splits a note into its entries. A day of a Diarum export with several entries
+// has one "## HH:MM" or "## Entry N" section per entry, any other note is a single entry.
+func markdownSections(body string) []noteSection {
+	lines := strings.Split(body, "\n")
+	var sections []noteSection
+	var preamble []string
+	current := -1
+	for _, line := range lines {
+		if m := markdownSection.FindStringSubmatch(line); m != nil {
+			sections = append(sections, noteSection{heading: m[1]})
+			current = len(sections) - 1
+			continue
+		}
+		if current < 0 {
+			preamble = append(preamble, line)
+		} else {
+			sections[current].body += line + "\n"
+		}
+	}
+	if len(sections) < 2 {
+		return []noteSection{{body: body}}
+	}
+	// Only the day's title may come before the first entry
+	for _, line := range preamble {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "# ") {
+			return []noteSection{{body: body}}
+		}
+	}
+	return sections
+}
+
+// markdownMetadata drops the day heading of a note and reads the **Mood:**, **Weather:**
+// and **Tags:** lines a Diarum export starts entries with
+func markdownMetadata(entry *Entry, body, date string) string {
+	lines := strings.Split(strings.TrimLeft(body, "\n"), "\n")
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "# "+date {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 {
+		m := markdownField.FindStringSubmatch(strings.TrimSpace(lines[0]))
+		if m == nil {
+			break
+		}
+		switch m[1] {
+		case "Mood":
+			entry.Mood = truncate(m[2])
+		case "Weather":
+			entry.Weather = truncate(m[2])
+		case "Tags":
+			entry.Tags = cleanTags(append(append([]string(nil), entry.Tags...), strings.Split(m[2], ",")...))
+		}
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownContent converts a note to editor HTML. Embedded images found in the archive become
+// photos referenced by their path, other embeds are dropped and wiki links become their text.
+func markdownContent(archive *Archive, dir, text string) (string, []Photo) {
+	var photos []Photo
+	seen := map[string]bool{}
+	photoRef := func(target string) (string, bool) {
+		file := markdownFile(archive, dir, target)
+		if file == nil || !imageExts[strings.ToLower(path.Ext(file.Name))] {
+			return "", false
+		}
+		if !seen[file.Name] {
+			seen[file.Name] = true
+			photos = append(photos, Photo{Ref: file.Name, Name: path.Base(file.Name), File: file})
+		}
+		return file.Name, true
+	}
+
+	trimmed := strings.TrimSpace(text)
+	if markdownHTML.MatchString(trimmed) {
+		return trimmed, nil
+	}
+
+	text = markdownEmbed.ReplaceAllStringFunc(text, func(embed string) string {
+		m := markdownEmbed.FindStringSubmatch(embed)
+		if ref, ok := photoRef(strings.TrimSpace(m[1])); ok {
+			return "![](<" + ref + ">)"
+		}
+		return ""
+	})
+	text = markdownImage.ReplaceAllStringFunc(text, func(image string) string {
+		m := markdownImage.FindStringSubmatch(image)
+		target := strings.TrimSuffix(strings.TrimPrefix(m[2], "<"), ">")
+		if strings.Contains(target, "://") {
+			// Remote images stay as they are
+			return image
+		}
+		if ref, ok := photoRef(target); ok {
+			return "![" + m[1] + "](<" + ref + ">)"
+		}
+		return ""
+	})
+	text = markdownWikiLink.ReplaceAllStringFunc(text, func(link string) string {
+		m := markdownWikiLink.FindStringSubmatch(link)
+		if m[2] != "" {
+			return m[2]
+		}
+		return m[1]
+	})
+	return textutil.MarkdownToHTML(text), photos
+}
+
+// markdownFile resolves a link of a note: relative to the note, from the archive root,
+// or by file name anywhere in the archive as Obsidian does
+func markdownFile(archive *Archive, dir, target string) *File {
+	if decoded, err := url.PathUnescape(target); err == nil {
+		target = decoded
+	}
+	for _, name := range []string{path.Join(dir, target), path.Clean(target)} {
+		if !ValidPath(name) {
+			continue
+		}
+		for _, f := range archive.Files {
+			if f.Name == name {
+				return f
+			}
+		}
+	}
+	return archive.Find("", path.Base(target))
+}
@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// Kinds of jobs
+const (
+	KindExport = "export"
+	KindImport = "import"
+)
+
+// Kinds lists every kind of job
+var Kinds = []string{KindExport, KindImport}
+
+// Job statuses
+const (
+	// StatusQueued jobs wait for one of the running jobs to finish
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Statuses lists every job status
+var Statuses = []string{StatusQueued, StatusRunning, StatusCompleted, StatusFailed, StatusCancelled}
+
+// Errors of the job service
+var (
+	// ErrNotFound is returned for jobs that don't exist or belong to another user
+	ErrNotFound = errors.New("job not found")
+	// ErrBusy is returned when the user already has a job queued or running
+	ErrBusy = errors.New("another export or import job is in progress")
+	// ErrRunning is returned when deleting a job that is still in progress
+	ErrRunning = errors.New("job is still in progress, cancel it first")
+	// ErrFinished is returned when cancelling a job that already ended
+	ErrFinished = errors.New("job has already finished")
+	// ErrNoArtifact is returned for jobs without a file to download, or whose file expired
+	ErrNoArtifact = errors.New("job has no file to download")
+	// ErrInvalidLink is returned for download links with a wrong or expired token
+	ErrInvalidLink = errors.New("download link is invalid or expired")
+)
+
+// tokenLength is the length of download tokens, about 238 bits of randomness
+const tokenLength = 40
+
+// Job describes an export or import job. Stats holds the statistics of the export or
+// import once it finished, they stay after the artifact expires.
+type Job struct {
+	ID       string          `json:"id"`
+	Kind     string          `json:"kind"`
+	Status   string          `json:"status"`
+	Progress int             `json:"progress"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Stats    json.RawMessage `json:"stats,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	// Artifact is the file name of the export, empty for imports and once the file expired
+	Artifact string `json:"artifact,omitempty"`
+	// ArtifactSize is the size of the artifact in bytes
+	ArtifactSize    int64  `json:"artifact_size,omitempty"`
+	ArtifactExpires string `json:"artifact_expires,omitempty"`
+	Created         string `json:"created"`
+	Updated         string `json:"updated"`
+	Finished        string `json:"finished,omitempty"`
+}
+
+// Finished reports whether a status is final
+func Finished(status string) bool {
+	return status == StatusCompleted || status == StatusFailed || status == StatusCancelled
+}
+
+// DownloadLink is a link to the artifact of a job, valid until it expires.
+// The token is only returned when the link is created.
+type DownloadLink struct {
+	URL     string `json:"url"`
+	Token   string `json:"token"`
+	Expires string `json:"expires"`
+}
+
+// Result is what a job function produces
+type Result struct {
+	// Stats are kept with the job
+	Stats any
+	// Artifact is a local file the service moves to storage, empty for none.
+	// The service removes the local file.
+	Artifact string
+	// ArtifactName is the file name the artifact is downloaded as
+	ArtifactName string
+}
+
+// Func runs a job, reporting its progress to run. The job is cancelled when Step fails.
+type Func func(run *Run) (*Result, error)
+
+// percent converts the items done of a total into a progress percentage.
+// 100 is only reached when the job completes, after the artifact was stored.
+func percent(done, total int) int {
+	if total <= 0 || done <= 0 {
+		return 0
+	}
+	p := done * 100 / total
+	if p > 99 {
+		p = 99
+	}
+	return p
+}
+
+// newToken creates a download token and its stored hash
+func newToken() (string, string) {
+	token := security.RandomString(tokenLength)
+	return token, security.SHA256(token)
+}
+
+// checkToken validates a download token against the stored hash and expiry
+func checkToken(token, hash string, expires, now time.Time) error {
+	if token == "" || hash == "" || expires.IsZero() {
+		return ErrInvalidLink
+	}
+	if !security.Equal(security.SHA256(token), hash) || !now.Before(expires) {
+		return ErrInvalidLink
+	}
+	return nil
+}
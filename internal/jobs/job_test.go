@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		done, total int
+		want        int
+	}{
+		{0, 10, 0},
+		{5, 10, 50},
+		{1, 3, 33},
+		{10, 10, 99},
+		{12, 10, 99},
+		{3, 0, 0},
+		{-1, 10, 0},
+	}
+	for _, tt := range tests {
+		if got := percent(tt.done, tt.total); got != tt.want {
+			t.Errorf("percent(%d, %d) = %d, want %d", tt.done, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestCheckToken(t *testing.T) {
+	token, hash := newToken()
+	if len(token) != tokenLength || hash == token {
+		t.Fatalf("newToken() = %q, %q", token, hash)
+	}
+	now := time.Now()
+	expires := now.Add(time.Hour)
+
+	if err := checkToken(token, hash, expires, now); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+	if err := checkToken(token+"x", hash, expires, now); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("wrong token accepted: %v", err)
+	}
+	if err := checkToken(token, hash, expires, expires); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("expired token accepted: %v", err)
+	}
+	if err := checkToken("", "", time.Time{}, now); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("empty token accepted: %v", err)
+	}
+	if err := checkToken(token, hash, time.Time{}, now); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("token without expiry accepted: %v", err)
+	}
+}
+
+func TestRunStep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &Run{ctx: ctx, cancel: cancel}
+
+	if err := run.Step(1, 4); err != nil {
+		t.Fatalf("Step() = %v", err)
+	}
+	if got := run.progress.Load(); got != 25 {
+		t.Errorf("progress = %d, want 25", got)
+	}
+
+	cancel()
+	if err := run.Step(2, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("Step() after cancel = %v, want context.Canceled", err)
+	}
+	if got := run.progress.Load(); got != 25 {
+		t.Errorf("progress after cancel = %d, want 25", got)
+	}
+}
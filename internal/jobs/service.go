@@ -0,0 +1,511 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/logger"
+)
+
+// Service tuning
+const (
+	// maxRunning is how many jobs run at the same time, others wait queued
+	maxRunning = 2
+	// LinkTTL is how long a download link is valid
+	LinkTTL = 24 * time.Hour
+	// ArtifactRetention is how long artifacts are kept in storage, the job and its stats stay
+	ArtifactRetention = 7 * 24 * time.Hour
+	// jobRetention is how long finished jobs are kept
+	jobRetention  = 90 * 24 * time.Hour
+	pruneInterval = time.Hour
+	// cancelWait is how long Cancel waits for a job to stop
+	cancelWait = 10 * time.Second
+)
+
+// Run is a job in progress, handed to its Func
+type Run struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	userID   string
+	progress atomic.Int32
+	// done is closed once the job ended and its outcome was saved
+	done chan struct{}
+}
+
+// Context is cancelled when the job is cancelled
+func (r *Run) Context() context.Context {
+	return r.ctx
+}
+
+// Step records that done of total items were processed. It fails once the job is cancelled,
+// the job function then returns the error. Progress is kept in memory, so Step is safe
+// to call inside a transaction.
+func (r *Run) Step(done, total int) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	r.progress.Store(int32(percent(done, total)))
+	return nil
+}
+
+// JobService runs exports and imports in the background and keeps their outcome.
+// Jobs are stored in the jobs collection, the artifact of an export is a file of its record.
+type JobService struct {
+	app     *pocketbase.PocketBase
+	slots   chan struct{}
+	started atomic.Bool
+
+	mu   sync.Mutex
+	runs map[string]*Run // by job id
+}
+
+// NewJobService creates a new JobService, Start must be called to clean up after restarts
+func NewJobService(app *pocketbase.PocketBase) *JobService {
+	return &JobService{
+		app:   app,
+		slots: make(chan struct{}, maxRunning),
+		runs:  make(map[string]*Run),
+	}
+}
+
+// Start fails the jobs a previous process left unfinished and removes expired
+// artifacts and old jobs in the background
+func (s *JobService) Start() {
+	if s.started.Swap(true) {
+		return
+	}
+	s.failInterrupted()
+
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			s.prune()
+			<-ticker.C
+		}
+	}()
+}
+
+// Run creates a queued job of a user and runs fn in the background once a slot is free.
+// A user has one job in progress at a time, ErrBusy is returned otherwise.
+func (s *JobService) Run(userID, kind string, params any, fn Func) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, run := range s.runs {
+		if run.userID == userID {
+			return nil, ErrBusy
+		}
+	}
+
+	collection, err := s.app.Dao().FindCollectionByNameOrId("jobs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find jobs collection: %w", err)
+	}
+	record := models.NewRecord(collection)
+	record.Set("owner", userID)
+	record.Set("kind", kind)
+	record.Set("status", StatusQueued)
+	record.Set("progress", 0)
+	record.Set("params", params)
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &Run{ctx: ctx, cancel: cancel, userID: userID, done: make(chan struct{})}
+	s.runs[record.Id] = run
+	go s.execute(record, run, fn)
+
+	logger.Info("[JobService] queued %s job %s for user %s", kind, record.Id, userID)
+	job := toJob(record)
+	return &job, nil
+}
+
+// execute waits for a slot, runs the job and saves its outcome
+func (s *JobService) execute(record *models.Record, run *Run, fn Func) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.runs, record.Id)
+		s.mu.Unlock()
+		run.cancel()
+		close(run.done)
+	}()
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-run.ctx.Done():
+		s.finish(record, run, nil, run.ctx.Err())
+		return
+	}
+
+	record.Set("status", StatusRunning)
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		logger.Error("[JobService] failed to save job %s: %v", record.Id, err)
+	}
+
+	result, err := call(run, fn)
+	if result != nil && result.Artifact != "" {
+		if err == nil {
+			err = s.storeArtifact(record, result)
+		}
+		if removeErr := os.Remove(result.Artifact); removeErr != nil && !os.IsNotExist(removeErr) {
+			logger.Warn("[JobService] failed to remove %s: %v", result.Artifact, removeErr)
+		}
+	}
+	s.finish(record, run, result, err)
+}
+
+// call runs a job function, a panic fails the job instead of the server
+func call(run *Run, fn Func) (result *Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(run)
+}
+
+// storeArtifact uploads the local artifact of a job as the file of its record
+func (s *JobService) storeArtifact(record *models.Record, result *Result) error {
+	file, err := filesystem.NewFileFromPath(result.Artifact)
+	if err != nil {
+		return fmt.Errorf("failed to open artifact: %w", err)
+	}
+	if result.ArtifactName != "" {
+		file.Name = result.ArtifactName
+		file.OriginalName = result.ArtifactName
+	}
+
+	fsys, err := s.app.NewFilesystem()
+	if err != nil {
+		return fmt.Errorf("failed to initialize filesystem: %w", err)
+	}
+	defer fsys.Close()
+
+	if err := fsys.UploadFile(file, record.BaseFilesPath()+"/"+file.Name); err != nil {
+		return fmt.Errorf("failed to store artifact: %w", err)
+	}
+	record.Set("artifact", file.Name)
+	record.Set("artifact_size", file.Size)
+	record.Set("artifact_expires", time.Now().Add(ArtifactRetention).UTC())
+	return nil
+}
+
+// finish saves the final status of a job. A cancelled job counts as cancelled
+// whatever error its function returned.
+func (s *JobService) finish(record *models.Record, run *Run, result *Result, err error) {
+	switch {
+	case err == nil:
+		record.Set("status", StatusCompleted)
+		record.Set("progress", 100)
+		record.Set("error", "")
+	case run.ctx.Err() != nil:
+		record.Set("status", StatusCancelled)
+		record.Set("progress", run.progress.Load())
+		record.Set("error", "")
+	default:
+		record.Set("status", StatusFailed)
+		record.Set("progress", run.progress.Load())
+		record.Set("error", err.Error())
+	}
+	if result != nil && result.Stats != nil {
+		record.Set("stats", result.Stats)
+	}
+	record.Set("finished", types.NowDateTime())
+
+	if saveErr := s.app.Dao().SaveRecord(record); saveErr != nil {
+		logger.Error("[JobService] failed to save job %s: %v", record.Id, saveErr)
+	}
+	if err != nil && record.GetString("status") == StatusFailed {
+		logger.Error("[JobService] %s job %s of user %s failed: %v", record.GetString("kind"), record.Id, run.userID, err)
+		return
+	}
+	logger.Info("[JobService] %s job %s of user %s %s", record.GetString("kind"), record.Id, run.userID, record.GetString("status"))
+}
+
+// List returns the latest jobs of a user, newest first
+func (s *JobService) List(userID string, limit int) ([]Job, error) {
+	records, err := s.app.Dao().FindRecordsByFilter(
+		"jobs",
+		"owner = {:owner}",
+		"-created",
+		limit,
+		0,
+		map[string]any{"owner": userID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jobs: %w", err)
+	}
+
+	jobs := make([]Job, 0, len(records))
+	for _, record := range records {
+		jobs = append(jobs, s.toLiveJob(record))
+	}
+	return jobs, nil
+}
+
+// Get returns a job of a user with its current progress
+func (s *JobService) Get(userID, id string) (*Job, error) {
+	record, err := s.Find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	job := s.toLiveJob(record)
+	return &job, nil
+}
+
+// Find returns a job record of a user
+func (s *JobService) Find(userID, id string) (*models.Record, error) {
+	record, err := s.app.Dao().FindRecordById("jobs", id)
+	if err != nil || record.GetString("owner") != userID {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// Cancel stops a queued or running job and waits a moment for it to end.
+// An import that is cancelled is rolled back, an export leaves no artifact.
+func (s *JobService) Cancel(userID, id string) (*Job, error) {
+	if _, err := s.Find(userID, id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	run := s.runs[id]
+	s.mu.Unlock()
+	if run == nil {
+		return nil, ErrFinished
+	}
+
+	run.cancel()
+	select {
+	case <-run.done:
+	case <-time.After(cancelWait):
+	}
+	return s.Get(userID, id)
+}
+
+// Delete removes a finished job with its artifact
+func (s *JobService) Delete(userID, id string) error {
+	record, err := s.Find(userID, id)
+	if err != nil {
+		return err
+	}
+	if !Finished(record.GetString("status")) {
+		return ErrRunning
+	}
+	if err := s.app.Dao().DeleteRecord(record); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	logger.Info("[JobService] deleted job %s of user %s", id, userID)
+	return nil
+}
+
+// Link creates a download link for the artifact of a job, replacing the previous one.
+// The link is valid for LinkTTL, or until the artifact expires when that is sooner.
+func (s *JobService) Link(userID, id string) (*DownloadLink, error) {
+	record, err := s.Find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if record.GetString("status") != StatusCompleted || record.GetString("artifact") == "" {
+		return nil, ErrNoArtifact
+	}
+
+	expires := time.Now().Add(LinkTTL)
+	if artifactExpires := record.GetDateTime("artifact_expires").Time(); !artifactExpires.IsZero() && artifactExpires.Before(expires) {
+		expires = artifactExpires
+	}
+	token, hash := newToken()
+	record.Set("download_token", hash)
+	record.Set("download_expires", expires.UTC())
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+
+	return &DownloadLink{
+		URL:     "/api/jobs/" + record.Id + "/download?token=" + token,
+		Token:   token,
+		Expires: record.GetDateTime("download_expires").String(),
+	}, nil
+}
+
+// Serve writes the artifact of a job to the response when the download token is valid.
+// Range requests are supported, so interrupted downloads can resume.
+func (s *JobService) Serve(res http.ResponseWriter, req *http.Request, id, token string) error {
+	record, err := s.app.Dao().FindRecordById("jobs", id)
+	if err != nil {
+		return ErrInvalidLink
+	}
+	if err := checkToken(token, record.GetString("download_token"), record.GetDateTime("download_expires").Time(), time.Now()); err != nil {
+		return err
+	}
+	name := record.GetString("artifact")
+	if name == "" {
+		return ErrNoArtifact
+	}
+
+	fsys, err := s.app.NewFilesystem()
+	if err != nil {
+		return fmt.Errorf("failed to initialize filesystem: %w", err)
+	}
+	defer fsys.Close()
+
+	// The link carries a secret, it must not end up in shared caches
+	res.Header().Set("Cache-Control", "private, no-store")
+	res.Header().Set("Content-Disposition", "attachment; filename="+name)
+	return fsys.Serve(res, req, record.BaseFilesPath()+"/"+name, name)
+}
+
+// failInterrupted fails the jobs that were queued or running when the server stopped
+func (s *JobService) failInterrupted() {
+	records, err := s.app.Dao().FindRecordsByFilter(
+		"jobs",
+		"status = {:queued} || status = {:running}",
+		"",
+		-1,
+		0,
+		map[string]any{"queued": StatusQueued, "running": StatusRunning},
+	)
+	if err != nil {
+		logger.Error("[JobService] failed to fetch interrupted jobs: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		record.Set("status", StatusFailed)
+		record.Set("error", "interrupted by a server restart")
+		record.Set("finished", types.NowDateTime())
+		if err := s.app.Dao().SaveRecord(record); err != nil {
+			logger.Error("[JobService] failed to save job %s: %v", record.Id, err)
+		}
+	}
+	if len(records) > 0 {
+		logger.Warn("[JobService] marked %d interrupted jobs as failed", len(records))
+	}
+}
+
+// prune removes expired artifacts, keeping their jobs, and deletes jobs past the retention period
+func (s *JobService) prune() {
+	now := types.NowDateTime().String()
+	expired, err := s.app.Dao().FindRecordsByFilter(
+		"jobs",
+		"artifact != '' && artifact_expires != '' && artifact_expires < {:now}",
+		"",
+		-1,
+		0,
+		map[string]any{"now": now},
+	)
+	if err != nil {
+		logger.Error("[JobService] failed to fetch expired artifacts: %v", err)
+		return
+	}
+	if len(expired) > 0 {
+		fsys, err := s.app.NewFilesystem()
+		if err != nil {
+			logger.Error("[JobService] failed to initialize filesystem: %v", err)
+			return
+		}
+		defer fsys.Close()
+
+		for _, record := range expired {
+			key := record.BaseFilesPath() + "/" + record.GetString("artifact")
+			if err := fsys.Delete(key); err != nil {
+				logger.Warn("[JobService] failed to remove artifact %s: %v", key, err)
+			}
+			record.Set("artifact", "")
+			record.Set("download_token", "")
+			record.Set("download_expires", "")
+			if err := s.app.Dao().SaveRecord(record); err != nil {
+				logger.Error("[JobService] failed to save job %s: %v", record.Id, err)
+			}
+		}
+		logger.Info("[JobService] removed %d expired artifacts", len(expired))
+	}
+
+	cutoff, err := types.ParseDateTime(time.Now().Add(-jobRetention))
+	if err != nil {
+		return
+	}
+	old, err := s.app.Dao().FindRecordsByFilter(
+		"jobs",
+		"finished != '' && finished < {:cutoff}",
+		"",
+		-1,
+		0,
+		map[string]any{"cutoff": cutoff.String()},
+	)
+	if err != nil {
+		logger.Error("[JobService] failed to fetch old jobs: %v", err)
+		return
+	}
+	for _, record := range old {
+		if err := s.app.Dao().DeleteRecord(record); err != nil {
+			logger.Error("[JobService] failed to delete job %s: %v", record.Id, err)
+		}
+	}
+	if len(old) > 0 {
+		logger.Info("[JobService] pruned %d old jobs", len(old))
+	}
+}
+
+// toLiveJob converts a jobs record, with the progress of the run when the job is in progress
+func (s *JobService) toLiveJob(record *models.Record) Job {
+	job := toJob(record)
+	s.mu.Lock()
+	run := s.runs[record.Id]
+	s.mu.Unlock()
+	if run != nil && !Finished(job.Status) {
+		job.Progress = int(run.progress.Load())
+	}
+	return job
+}
+
+// toJob converts a jobs record, leaving out the download token
+func toJob(record *models.Record) Job {
+	return Job{
+		ID:              record.Id,
+		Kind:            record.GetString("kind"),
+		Status:          record.GetString("status"),
+		Progress:        record.GetInt("progress"),
+		Params:          rawJSON(record, "params"),
+		Stats:           rawJSON(record, "stats"),
+		Error:           record.GetString("error"),
+		Artifact:        record.GetString("artifact"),
+		ArtifactSize:    int64(record.GetInt("artifact_size")),
+		ArtifactExpires: artifactExpires(record),
+		Created:         record.Created.String(),
+		Updated:         record.Updated.String(),
+		Finished:        record.GetDateTime("finished").String(),
+	}
+}
+
+// artifactExpires is when the artifact of a record is removed, empty once it was
+func artifactExpires(record *models.Record) string {
+	if record.GetString("artifact") == "" {
+		return ""
+	}
+	return record.GetDateTime("artifact_expires").String()
+}
+
+// rawJSON returns a JSON field of a record, nil when it is empty
+func rawJSON(record *models.Record, field string) json.RawMessage {
+	raw, err := json.Marshal(record.Get(field))
+	if err != nil || string(raw) == "null" || string(raw) == `""` {
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,370 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LatestProtocolVersion is the newest Model Context Protocol version the server speaks
+const LatestProtocolVersion = "2025-06-18"
+
+// supportedVersions lists the protocol versions a client may ask for, newest first
+var supportedVersions = []string{LatestProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeResourceNotFound is the MCP error for an unknown resource URI
+	CodeResourceNotFound = -32002
+)
+
+// maxMessageSize is the longest message read from stdio
+const maxMessageSize = 10 * 1024 * 1024
+
+// ErrResourceNotFound is returned by ReadResource for an unknown URI
+var ErrResourceNotFound = errors.New("resource not found")
+
+// Tool is a function the client may call
+type Tool struct {
+	Name        string
+	Description string
+	// InputSchema is the JSON schema of the arguments object
+	InputSchema map[string]any
+	// Handler runs the tool. A string result is sent as is, other results as JSON.
+	// Errors are reported to the model as a failed tool call, not as a protocol error.
+	Handler func(ctx context.Context, args json.RawMessage) (any, error)
+}
+
+// Resource is a document the client may read
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceTemplate describes resources addressed by a URI template, e.g. diarum://diary/{date}
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents is the text of a resource
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+// Server answers MCP requests. It keeps no per-session state, so a single server can
+// answer every message of a stdio session or each HTTP request on its own.
+type Server struct {
+	Name         string
+	Version      string
+	Instructions string
+	Tools        []Tool
+	Templates    []ResourceTemplate
+	// ListResources returns a page of resources and the cursor of the next one, "" on the last page
+	ListResources func(ctx context.Context, cursor string) ([]Resource, string, error)
+	// ReadResource returns the contents of a resource, or ErrResourceNotFound
+	ReadResource func(ctx context.Context, uri string) ([]ResourceContents, error)
+}
+
+// Error is a JSON-RPC error
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// toolResult is the result of tools/call
+type toolResult struct {
+	Content []textContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+type textContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Handle answers a message, a single JSON-RPC message or a batch of them.
+// It returns nil when the message holds only notifications.
+func (s *Server) Handle(ctx context.Context, data []byte) []byte {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(data, &batch); err != nil {
+		resp := s.handleOne(ctx, data)
+		if resp == nil {
+			return nil
+		}
+		out, _ := json.Marshal(resp)
+		return out
+	}
+
+	if len(batch) == 0 {
+		out, _ := json.Marshal(errorResponse(nil, CodeInvalidRequest, "empty batch"))
+		return out
+	}
+	var responses []*response
+	for _, message := range batch {
+		if resp := s.handleOne(ctx, message); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	out, _ := json.Marshal(responses)
+	return out
+}
+
+// ServeStdio reads newline-delimited messages from r and writes the responses to w until r ends or ctx is done
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		out := s.Handle(ctx, line)
+		if out == nil {
+			continue
+		}
+		if _, err := w.Write(append(out, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *Server) handleOne(ctx context.Context, data []byte) *response {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errorResponse(nil, CodeParseError, "invalid JSON")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, CodeInvalidRequest, "invalid JSON-RPC request")
+	}
+
+	// Notifications like notifications/initialized need no answer
+	isNotification := len(req.ID) == 0 || string(req.ID) == "null"
+
+	result, err := s.dispatch(ctx, req)
+	if isNotification {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		return &response{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	}
+	return &response{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func (s *Server) dispatch(ctx context.Context, req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.initialize(params.ProtocolVersion), nil
+
+	case "ping":
+		return struct{}{}, nil
+
+	case "tools/list":
+		tools := make([]map[string]any, 0, len(s.Tools))
+		for _, tool := range s.Tools {
+			schema := tool.InputSchema
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			tools = append(tools, map[string]any{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"inputSchema": schema,
+			})
+		}
+		return map[string]any{"tools": tools}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.callTool(ctx, params.Name, params.Arguments)
+
+	case "resources/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		resources := []Resource{}
+		next := ""
+		if s.ListResources != nil {
+			page, cursor, err := s.ListResources(ctx, params.Cursor)
+			if err != nil {
+				return nil, err
+			}
+			resources, next = append(resources, page...), cursor
+		}
+		result := map[string]any{"resources": resources}
+		if next != "" {
+			result["nextCursor"] = next
+		}
+		return result, nil
+
+	case "resources/templates/list":
+		templates := s.Templates
+		if templates == nil {
+			templates = []ResourceTemplate{}
+		}
+		return map[string]any{"resourceTemplates": templates}, nil
+
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if s.ReadResource == nil {
+			return nil, &Error{Code: CodeResourceNotFound, Message: "Resource not found: " + params.URI}
+		}
+		contents, err := s.ReadResource(ctx, params.URI)
+		if errors.Is(err, ErrResourceNotFound) {
+			return nil, &Error{Code: CodeResourceNotFound, Message: "Resource not found: " + params.URI}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"contents": contents}, nil
+
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	}
+
+	return nil, &Error{Code: CodeMethodNotFound, Message: "Method not found: " + req.Method}
+}
+
+// initialize answers the handshake, agreeing on the client's protocol version when it is supported
+func (s *Server) initialize(requested string) map[string]any {
+	version := LatestProtocolVersion
+	for _, supported := range supportedVersions {
+		if requested == supported {
+			version = requested
+		}
+	}
+
+	capabilities := map[string]any{
+		"tools": map[string]any{"listChanged": false},
+	}
+	if s.ListResources != nil || s.ReadResource != nil {
+		capabilities["resources"] = map[string]any{"listChanged": false, "subscribe": false}
+	}
+
+	result := map[string]any{
+		"protocolVersion": version,
+		"capabilities":    capabilities,
+		"serverInfo":      map[string]any{"name": s.Name, "version": s.Version},
+	}
+	if s.Instructions != "" {
+		result["instructions"] = s.Instructions
+	}
+	return result
+}
+
+func (s *Server) callTool(ctx context.Context, name string, args json.RawMessage) (any, error) {
+	for _, tool := range s.Tools {
+		if tool.Name != name {
+			continue
+		}
+		if len(args) == 0 || string(args) == "null" {
+			args = json.RawMessage("{}")
+		}
+
+		value, err := tool.Handler(ctx, args)
+		if err != nil {
+			return toolResult{Content: []textContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+
+		text, ok := value.(string)
+		if !ok {
+			data, err := json.MarshalIndent(value, "", "  ")
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode result of %s: %w", name, err)
+			}
+			text = string(data)
+		}
+		return toolResult{Content: []textContent{{Type: "text", Text: text}}}, nil
+	}
+	return nil, &Error{Code: CodeInvalidParams, Message: "Unknown tool: " + name}
+}
+
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &response{JSONRPC: "2.0", ID: id, Error: &Error{Code: code, Message: message}}
+}
+
+// DecodeArgs decodes the arguments of a tool call, reporting a readable error to the model
+func DecodeArgs(args json.RawMessage, v any) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
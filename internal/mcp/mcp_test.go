@@ -0,0 +1,191 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testServer() *Server {
+	return &Server{
+		Name:    "test",
+		Version: "1.0.0",
+		Tools: []Tool{
+			{
+				Name:        "echo",
+				Description: "Echo the text",
+				InputSchema: map[string]any{"type": "object"},
+				Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+					var in struct {
+						Text string `json:"text"`
+					}
+					if err := DecodeArgs(args, &in); err != nil {
+						return nil, err
+					}
+					if in.Text == "" {
+						return nil, errors.New("text is required")
+					}
+					return map[string]string{"text": in.Text}, nil
+				},
+			},
+		},
+		Templates: []ResourceTemplate{{URITemplate: "test://doc/{id}", Name: "Document"}},
+		ListResources: func(ctx context.Context, cursor string) ([]Resource, string, error) {
+			if cursor == "" {
+				return []Resource{{URI: "test://doc/1", Name: "One"}}, "2", nil
+			}
+			return []Resource{{URI: "test://doc/2", Name: "Two"}}, "", nil
+		},
+		ReadResource: func(ctx context.Context, uri string) ([]ResourceContents, error) {
+			if uri != "test://doc/1" {
+				return nil, ErrResourceNotFound
+			}
+			return []ResourceContents{{URI: uri, MimeType: "text/plain", Text: "hello"}}, nil
+		},
+	}
+}
+
+// call sends a request and decodes the response
+func call(t *testing.T, s *Server, message string) map[string]any {
+	t.Helper()
+	out := s.Handle(context.Background(), []byte(message))
+	if out == nil {
+		t.Fatalf("no response to %s", message)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", out, err)
+	}
+	return resp
+}
+
+func TestInitialize(t *testing.T) {
+	s := testServer()
+
+	resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{}}}`)
+	result := resp["result"].(map[string]any)
+	if result["protocolVersion"] != "2024-11-05" {
+		t.Errorf("protocol version = %v", result["protocolVersion"])
+	}
+	capabilities := result["capabilities"].(map[string]any)
+	if capabilities["tools"] == nil || capabilities["resources"] == nil {
+		t.Errorf("capabilities = %v", capabilities)
+	}
+
+	resp = call(t, s, `{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`)
+	if got := resp["result"].(map[string]any)["protocolVersion"]; got != LatestProtocolVersion {
+		t.Errorf("unknown version answered with %v", got)
+	}
+
+	if out := s.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); out != nil {
+		t.Errorf("notification answered: %s", out)
+	}
+}
+
+func TestTools(t *testing.T) {
+	s := testServer()
+
+	resp := call(t, s, `{"jsonrpc":"2.0","id":"a","method":"tools/list"}`)
+	tools := resp["result"].(map[string]any)["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["name"] != "echo" {
+		t.Errorf("tools = %v", tools)
+	}
+
+	resp = call(t, s, `{"jsonrpc":"2.0","id":"b","method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	if resp["id"] != "b" {
+		t.Errorf("id = %v", resp["id"])
+	}
+	result := resp["result"].(map[string]any)
+	text := result["content"].([]any)[0].(map[string]any)["text"].(string)
+	if !strings.Contains(text, `"text": "hi"`) || result["isError"] != nil {
+		t.Errorf("result = %v", result)
+	}
+
+	// A failing tool is a tool error, not a protocol error
+	resp = call(t, s, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo"}}`)
+	if result := resp["result"].(map[string]any); result["isError"] != true {
+		t.Errorf("failed tool = %v", resp)
+	}
+
+	resp = call(t, s, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"nope"}}`)
+	if resp["error"].(map[string]any)["code"].(float64) != CodeInvalidParams {
+		t.Errorf("unknown tool = %v", resp)
+	}
+}
+
+func TestResources(t *testing.T) {
+	s := testServer()
+
+	resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`)
+	result := resp["result"].(map[string]any)
+	if result["nextCursor"] != "2" || len(result["resources"].([]any)) != 1 {
+		t.Errorf("first page = %v", result)
+	}
+	resp = call(t, s, `{"jsonrpc":"2.0","id":2,"method":"resources/list","params":{"cursor":"2"}}`)
+	if _, ok := resp["result"].(map[string]any)["nextCursor"]; ok {
+		t.Errorf("last page has a cursor: %v", resp)
+	}
+
+	resp = call(t, s, `{"jsonrpc":"2.0","id":3,"method":"resources/templates/list"}`)
+	if templates := resp["result"].(map[string]any)["resourceTemplates"].([]any); len(templates) != 1 {
+		t.Errorf("templates = %v", templates)
+	}
+
+	resp = call(t, s, `{"jsonrpc":"2.0","id":4,"method":"resources/read","params":{"uri":"test://doc/1"}}`)
+	contents := resp["result"].(map[string]any)["contents"].([]any)
+	if contents[0].(map[string]any)["text"] != "hello" {
+		t.Errorf("contents = %v", contents)
+	}
+
+	resp = call(t, s, `{"jsonrpc":"2.0","id":5,"method":"resources/read","params":{"uri":"test://doc/9"}}`)
+	if resp["error"].(map[string]any)["code"].(float64) != CodeResourceNotFound {
+		t.Errorf("missing resource = %v", resp)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	s := testServer()
+
+	if resp := call(t, s, `{not json`); resp["error"].(map[string]any)["code"].(float64) != CodeParseError || resp["id"] != nil {
+		t.Errorf("parse error = %v", resp)
+	}
+	if resp := call(t, s, `{"id":1,"method":"ping"}`); resp["error"].(map[string]any)["code"].(float64) != CodeInvalidRequest {
+		t.Errorf("missing jsonrpc = %v", resp)
+	}
+	if resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"prompts/list"}`); resp["error"].(map[string]any)["code"].(float64) != CodeMethodNotFound {
+		t.Errorf("unknown method = %v", resp)
+	}
+	if resp := call(t, s, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); resp["result"] == nil {
+		t.Errorf("ping = %v", resp)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s := testServer()
+	out := s.Handle(context.Background(), []byte(`[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","id":2,"method":"ping"}]`))
+	var responses []map[string]any
+	if err := json.Unmarshal(out, &responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 {
+		t.Errorf("%d responses, want 2", len(responses))
+	}
+}
+
+func TestServeStdio(t *testing.T) {
+	s := testServer()
+	in := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}` + "\n\n" +
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}` + "\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}` + "\n")
+	var out bytes.Buffer
+	if err := s.ServeStdio(context.Background(), in, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"id":1`) || !strings.Contains(lines[1], `"tools"`) {
+		t.Errorf("output = %q", out.String())
+	}
+}
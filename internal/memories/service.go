@@ -0,0 +1,173 @@
+package memories
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
+)
+
+// Memory is a past day with the entries written on it
+type Memory struct {
+	Date string
+	// YearsAgo is set for the same day in a previous year
+	YearsAgo int
+	Entries  []*models.Record
+}
+
+// OnThisDay holds the memories shown for today
+type OnThisDay struct {
+	Date string
+	// Years lists the same month and day of previous years, most recent first
+	Years    []Memory
+	WeekAgo  Memory
+	MonthAgo Memory
+}
+
+// IsEmpty reports whether no memory has any entries
+func (m *OnThisDay) IsEmpty() bool {
+	return len(m.Years) == 0 && len(m.WeekAgo.Entries) == 0 && len(m.MonthAgo.Entries) == 0
+}
+
+// MemoriesService finds past diary entries related to today
+type MemoriesService struct {
+	app           *pocketbase.PocketBase
+	configService *config.ConfigService
+}
+
+// NewMemoriesService creates a new MemoriesService
+func NewMemoriesService(app *pocketbase.PocketBase) *MemoriesService {
+	return &MemoriesService{
+		app:           app,
+		configService: config.NewConfigService(app),
+	}
+}
+
+// OnThisDay returns the user's entries written on today's month and day in previous years,
+// one week ago and one month ago. Today follows the user's timezone setting.
+// Private entries are only included when includePrivate is set.
+func (s *MemoriesService) OnThisDay(userID string, includePrivate bool) (*OnThisDay, error) {
+	return s.onDay(userID, dateutil.TodayDate(s.configService.GetLocation(userID)), includePrivate)
+}
+
+// onDay builds the memories for the calendar day today, given as midnight UTC
+func (s *MemoriesService) onDay(userID string, today time.Time, includePrivate bool) (*OnThisDay, error) {
+	result := &OnThisDay{
+		Date:  today.Format(dateutil.DayLayout),
+		Years: []Memory{},
+	}
+
+	entries, err := s.findEntries(userID, includePrivate,
+		monthDayExp(monthDays(today)),
+		dbx.NewExp("[[date]] < {:today}", dbx.Params{"today": dateutil.DayStart(result.Date)}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		day := dateutil.DayOf(entry.GetString("date"))
+		if n := len(result.Years); n > 0 && result.Years[n-1].Date == day {
+			result.Years[n-1].Entries = append(result.Years[n-1].Entries, entry)
+			continue
+		}
+		result.Years = append(result.Years, Memory{
+			Date:     day,
+			YearsAgo: today.Year() - dayYear(day),
+			Entries:  []*models.Record{entry},
+		})
+	}
+
+	if result.WeekAgo, err = s.memoryOn(userID, today.AddDate(0, 0, -7), includePrivate); err != nil {
+		return nil, err
+	}
+	if result.MonthAgo, err = s.memoryOn(userID, monthBefore(today), includePrivate); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// memoryOn loads the entries of a single day
+func (s *MemoriesService) memoryOn(userID string, day time.Time, includePrivate bool) (Memory, error) {
+	date := day.Format(dateutil.DayLayout)
+	entries, err := s.findEntries(userID, includePrivate,
+		dbx.NewExp("[[date]] >= {:start} AND [[date]] <= {:end}", dbx.Params{
+			"start": dateutil.DayStart(date),
+			"end":   dateutil.DayEnd(date),
+		}),
+	)
+	if err != nil {
+		return Memory{}, err
+	}
+	return Memory{Date: date, Entries: entries}, nil
+}
+
+// findEntries loads the user's live diaries matching the conditions, newest day first
+func (s *MemoriesService) findEntries(userID string, includePrivate bool, conditions ...dbx.Expression) ([]*models.Record, error) {
+	query := s.app.Dao().RecordQuery("diaries").
+		AndWhere(dbx.HashExp{"owner": userID, "deleted_at": ""})
+	if !includePrivate {
+		query.AndWhere(dbx.HashExp{"private": false})
+	}
+	for _, condition := range conditions {
+		query.AndWhere(condition)
+	}
+
+	records := []*models.Record{}
+	if err := query.OrderBy("date DESC", "time ASC", "created ASC").All(&records); err != nil {
+		return nil, fmt.Errorf("failed to load memories: %w", err)
+	}
+	return records, nil
+}
+
+// monthDays returns the "MM-DD" keys matching today in previous years.
+// On February 28 of a common year, entries from February 29 of leap years are included.
+func monthDays(today time.Time) []string {
+	days := []string{today.Format("01-02")}
+	if today.Month() == time.February && today.Day() == 28 && !isLeapYear(today.Year()) {
+		days = append(days, "02-29")
+	}
+	return days
+}
+
+// monthBefore returns the same day of the previous month, clamped to its last day
+func monthBefore(day time.Time) time.Time {
+	firstOfPrevious := time.Date(day.Year(), day.Month()-1, 1, 0, 0, 0, 0, day.Location())
+	lastOfPrevious := firstOfPrevious.AddDate(0, 1, -1).Day()
+	if day.Day() > lastOfPrevious {
+		return firstOfPrevious.AddDate(0, 0, lastOfPrevious-1)
+	}
+	return firstOfPrevious.AddDate(0, 0, day.Day()-1)
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// dayYear returns the year of a calendar day
+func dayYear(day string) int {
+	t, err := time.Parse(dateutil.DayLayout, day)
+	if err != nil {
+		return 0
+	}
+	return t.Year()
+}
+
+// monthDayExp matches diaries written on any of the "MM-DD" days
+func monthDayExp(days []string) dbx.Expression {
+	placeholders := make([]string, len(days))
+	params := dbx.Params{}
+	for i, day := range days {
+		key := fmt.Sprintf("monthDay%d", i)
+		placeholders[i] = "{:" + key + "}"
+		params[key] = day
+	}
+	// Stored dates start with "YYYY-MM-DD", so characters 6 to 10 are the month and day
+	return dbx.NewExp("substr([[date]], 6, 5) IN ("+strings.Join(placeholders, ", ")+")", params)
+}
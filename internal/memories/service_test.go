@@ -0,0 +1,48 @@
+package memories
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestMonthDays(t *testing.T) {
+	tests := []struct {
+		today string
+		want  []string
+	}{
+		{"2026-01-28", []string{"01-28"}},
+		{"2026-02-28", []string{"02-28", "02-29"}},
+		{"2028-02-28", []string{"02-28"}},
+		{"2028-02-29", []string{"02-29"}},
+	}
+
+	for _, tt := range tests {
+		if got := monthDays(day(tt.today)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("monthDays(%s) = %v, want %v", tt.today, got, tt.want)
+		}
+	}
+}
+
+func TestMonthBefore(t *testing.T) {
+	tests := []struct {
+		today string
+		want  string
+	}{
+		{"2026-06-15", "2026-05-15"},
+		{"2026-03-31", "2026-02-28"},
+		{"2028-03-31", "2028-02-29"},
+		{"2026-01-10", "2025-12-10"},
+	}
+
+	for _, tt := range tests {
+		if got := monthBefore(day(tt.today)).Format("2006-01-02"); got != tt.want {
+			t.Errorf("monthBefore(%s) = %s, want %s", tt.today, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		diariesCollection, err := dao.FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return err
+		}
+
+		// Create diary_revisions collection
+		// Revisions are written by server hooks only, so create/update/delete stay admin-only
+		revisionsCollection := &models.Collection{
+			Name:     "diary_revisions",
+			Type:     models.CollectionTypeBase,
+			ListRule: types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id"),
+			ViewRule: types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id"),
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "diary",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  diariesCollection.Id,
+						CascadeDelete: true,
+						MinSelect:     nil,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "content",
+					Type:     schema.FieldTypeEditor,
+					Required: false,
+					Options:  &schema.EditorOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "mood",
+					Type:     schema.FieldTypeText,
+					Required: false,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(50),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "weather",
+					Type:     schema.FieldTypeText,
+					Required: false,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(50),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "source",
+					Type:     schema.FieldTypeSelect,
+					Required: false,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    []string{"edit", "restore"},
+					},
+				},
+				&schema.SchemaField{
+					Name:     "owner",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  "_pb_users_auth_",
+						CascadeDelete: true,
+						MinSelect:     nil,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+			),
+		}
+
+		revisionsCollection.Indexes = types.JsonArray[string]{
+			"CREATE INDEX idx_diary_revisions_diary_created ON diary_revisions (diary, created)",
+			"CREATE INDEX idx_diary_revisions_owner ON diary_revisions (owner)",
+		}
+
+		return dao.SaveCollection(revisionsCollection)
+	}, func(db dbx.Builder) error {
+		// Rollback: drop diary_revisions collection
+		dao := daos.New(db)
+
+		revisionsCollection, err := dao.FindCollectionByNameOrId("diary_revisions")
+		if err == nil {
+			if err := dao.DeleteCollection(revisionsCollection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Diaries: add deleted_at and hide trashed records from the record API, including updates
+		diariesCollection, err := dao.FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return err
+		}
+
+		diariesCollection.Schema.AddField(&schema.SchemaField{
+			Name:     "deleted_at",
+			Type:     schema.FieldTypeDate,
+			Required: false,
+			Options:  &schema.DateOptions{},
+		})
+		diariesCollection.ListRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && deleted_at = \"\"")
+		diariesCollection.ViewRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && deleted_at = \"\"")
+		diariesCollection.UpdateRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && deleted_at = \"\"")
+
+		// A trashed diary must not block writing a new one for the same date
+		diariesCollection.Indexes = types.JsonArray[string]{
+			"CREATE UNIQUE INDEX idx_diaries_date_owner ON diaries (date, owner) WHERE deleted_at = ''",
+			"CREATE INDEX idx_diaries_deleted_at ON diaries (deleted_at)",
+		}
+
+		if err := dao.SaveCollection(diariesCollection); err != nil {
+			return err
+		}
+
+		// Media: add deleted_at and hide trashed records from the record API, including updates
+		mediaCollection, err := dao.FindCollectionByNameOrId("media")
+		if err != nil {
+			return err
+		}
+
+		mediaCollection.Schema.AddField(&schema.SchemaField{
+			Name:     "deleted_at",
+			Type:     schema.FieldTypeDate,
+			Required: false,
+			Options:  &schema.DateOptions{},
+		})
+		mediaCollection.ListRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && deleted_at = \"\"")
+		mediaCollection.ViewRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && deleted_at = \"\"")
+		mediaCollection.UpdateRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id && deleted_at = \"\"")
+		mediaCollection.Indexes = types.JsonArray[string]{
+			"CREATE INDEX idx_media_deleted_at ON media (deleted_at)",
+		}
+
+		return dao.SaveCollection(mediaCollection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Rollback: permanently remove trashed records, then drop the field
+		if _, err := db.NewQuery("DELETE FROM diaries WHERE deleted_at != ''").Execute(); err != nil {
+			return err
+		}
+		if _, err := db.NewQuery("DELETE FROM media WHERE deleted_at != ''").Execute(); err != nil {
+			return err
+		}
+
+		diariesCollection, err := dao.FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return err
+		}
+		if field := diariesCollection.Schema.GetFieldByName("deleted_at"); field != nil {
+			diariesCollection.Schema.RemoveField(field.Id)
+		}
+		diariesCollection.ListRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id")
+		diariesCollection.ViewRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id")
+		diariesCollection.UpdateRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id")
+		diariesCollection.Indexes = types.JsonArray[string]{
+			"CREATE UNIQUE INDEX idx_diaries_date_owner ON diaries (date, owner)",
+		}
+		if err := dao.SaveCollection(diariesCollection); err != nil {
+			return err
+		}
+
+		mediaCollection, err := dao.FindCollectionByNameOrId("media")
+		if err != nil {
+			return err
+		}
+		if field := mediaCollection.Schema.GetFieldByName("deleted_at"); field != nil {
+			mediaCollection.Schema.RemoveField(field.Id)
+		}
+		mediaCollection.ListRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id")
+		mediaCollection.ViewRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id")
+		mediaCollection.UpdateRule = types.Pointer("@request.auth.id != \"\" && owner = @request.auth.id")
+		mediaCollection.Indexes = types.JsonArray[string]{}
+
+		return dao.SaveCollection(mediaCollection)
+	})
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+
+	"github.com/songtianlun/diarum/internal/search"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		// Create the FTS5 full-text index and fill it with existing diaries
+		if _, err := db.NewQuery(search.CreateIndexSQL).Execute(); err != nil {
+			return err
+		}
+
+		_, err := search.Rebuild(daos.New(db))
+		return err
+	}, func(db dbx.Builder) error {
+		// Rollback: drop the full-text index
+		_, err := db.NewQuery(search.DropIndexSQL).Execute()
+		return err
+	})
+}
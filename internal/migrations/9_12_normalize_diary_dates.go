@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/pocketbase/dbx"
+	m "github.com/pocketbase/pocketbase/migrations"
+
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/logger"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		// Diary dates are calendar days stored as midnight UTC.
+		// Older writes through the collection API could store any instant, move those to their UTC day.
+		type diaryRow struct {
+			ID   string `db:"id"`
+			Date string `db:"date"`
+		}
+
+		rows := []diaryRow{}
+		err := db.NewQuery("SELECT id, date FROM diaries WHERE date != '' AND date NOT LIKE '% 00:00:00.000Z'").All(&rows)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			date, ok := dateutil.NormalizeDate(row.Date, time.UTC)
+			if !ok || date == row.Date {
+				continue
+			}
+
+			_, err := db.NewQuery("UPDATE diaries SET date = {:date} WHERE id = {:id}").
+				Bind(dbx.Params{"date": date, "id": row.ID}).
+				Execute()
+			if err != nil {
+				// Another diary already holds that day, leave this one for the user to resolve
+				logger.Warn("[Migration] failed to normalize date of diary %s (%s): %v", row.ID, row.Date, err)
+			}
+		}
+
+		return nil
+	}, func(db dbx.Builder) error {
+		// Rollback: the original instants are not kept, nothing to undo
+		return nil
+	})
+}
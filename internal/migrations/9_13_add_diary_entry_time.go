@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Diaries: allow several entries per day, each with an optional time of day (HH:MM)
+		diariesCollection, err := dao.FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return err
+		}
+
+		diariesCollection.Schema.AddField(&schema.SchemaField{
+			Name:     "time",
+			Type:     schema.FieldTypeText,
+			Required: false,
+			Options: &schema.TextOptions{
+				Min:     nil,
+				Max:     types.Pointer(5),
+				Pattern: `^([01]\d|2[0-3]):[0-5]\d$`,
+			},
+		})
+
+		// The day no longer identifies a diary, keep a plain index for day views
+		diariesCollection.Indexes = types.JsonArray[string]{
+			"CREATE INDEX idx_diaries_owner_date ON diaries (owner, date, time) WHERE deleted_at = ''",
+			"CREATE INDEX idx_diaries_deleted_at ON diaries (deleted_at)",
+		}
+
+		return dao.SaveCollection(diariesCollection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Rollback: drop the time field and restore one diary per day.
+		// Fails while a user still has several live entries on the same day.
+		diariesCollection, err := dao.FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return err
+		}
+		if field := diariesCollection.Schema.GetFieldByName("time"); field != nil {
+			diariesCollection.Schema.RemoveField(field.Id)
+		}
+		diariesCollection.Indexes = types.JsonArray[string]{
+			"CREATE UNIQUE INDEX idx_diaries_date_owner ON diaries (date, owner) WHERE deleted_at = ''",
+			"CREATE INDEX idx_diaries_deleted_at ON diaries (deleted_at)",
+		}
+
+		return dao.SaveCollection(diariesCollection)
+	})
+}
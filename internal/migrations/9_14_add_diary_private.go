@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Diaries: private entries are left out of "on this day" memories unless the owner asks for them
+		diariesCollection, err := dao.FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return err
+		}
+
+		diariesCollection.Schema.AddField(&schema.SchemaField{
+			Name:     "private",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		})
+
+		return dao.SaveCollection(diariesCollection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Rollback: drop the private field
+		diariesCollection, err := dao.FindCollectionByNameOrId("diaries")
+		if err != nil {
+			return err
+		}
+		if field := diariesCollection.Schema.GetFieldByName("private"); field != nil {
+			diariesCollection.Schema.RemoveField(field.Id)
+		}
+
+		return dao.SaveCollection(diariesCollection)
+	})
+}
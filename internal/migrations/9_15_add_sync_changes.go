@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+
+	"github.com/songtianlun/diarum/internal/changes"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		// Create the sync change log and record the current state of all diaries and media
+		if err := changes.CreateLog(db); err != nil {
+			return err
+		}
+
+		return changes.Seed(daos.New(db))
+	}, func(db dbx.Builder) error {
+		// Rollback: drop the change log
+		return changes.DropLog(db)
+	})
+}
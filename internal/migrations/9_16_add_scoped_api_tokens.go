@@ -0,0 +1,160 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/apitoken"
+)
+
+// legacyTokenScopes are granted to the token moved over from the api.token setting,
+// everything the single token could do before scopes existed
+var legacyTokenScopes = []string{apitoken.ScopeDiariesRead, apitoken.ScopeDiariesWrite, apitoken.ScopeMedia}
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Create api_tokens collection, reusing the name of the collection dropped by migration 6.
+		// Tokens are managed through the settings endpoints and only their hashes are stored,
+		// so no API rules are set and the collection stays admin-only.
+		tokensCollection := &models.Collection{
+			Name: "api_tokens",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "name",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(100),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "token_hash",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options: &schema.TextOptions{
+						Min: types.Pointer(64),
+						Max: types.Pointer(64),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "prefix",
+					Type:     schema.FieldTypeText,
+					Required: false,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(20),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "scopes",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: len(apitoken.Scopes),
+						Values:    apitoken.Scopes,
+					},
+				},
+				&schema.SchemaField{
+					Name:     "expires",
+					Type:     schema.FieldTypeDate,
+					Required: false,
+					Options:  &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "last_used",
+					Type:     schema.FieldTypeDate,
+					Required: false,
+					Options:  &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "last_ip",
+					Type:     schema.FieldTypeText,
+					Required: false,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(45),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "revoked",
+					Type:     schema.FieldTypeDate,
+					Required: false,
+					Options:  &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "owner",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  "_pb_users_auth_",
+						CascadeDelete: true,
+						MinSelect:     nil,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+			),
+		}
+
+		tokensCollection.Indexes = types.JsonArray[string]{
+			"CREATE UNIQUE INDEX idx_api_tokens_token_hash ON api_tokens (token_hash)",
+			"CREATE INDEX idx_api_tokens_owner ON api_tokens (owner)",
+		}
+
+		if err := dao.SaveCollection(tokensCollection); err != nil {
+			return err
+		}
+
+		// Move the single plaintext api.token setting of each user over as a hashed token
+		settings, err := dao.FindRecordsByFilter("user_settings", "key = 'api.token'", "", -1, 0)
+		if err != nil {
+			return err
+		}
+		for _, setting := range settings {
+			var token string
+			if err := json.Unmarshal([]byte(setting.GetString("value")), &token); err != nil {
+				token = setting.GetString("value")
+			}
+
+			if token != "" {
+				record := models.NewRecord(tokensCollection)
+				record.Set("owner", setting.GetString("user"))
+				record.Set("name", "Default token")
+				record.Set("token_hash", apitoken.Hash(token))
+				record.Set("prefix", apitoken.DisplayPrefix(token))
+				record.Set("scopes", legacyTokenScopes)
+				if err := dao.SaveRecord(record); err != nil {
+					return err
+				}
+			}
+
+			if err := dao.DeleteRecord(setting); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(db dbx.Builder) error {
+		// Rollback: drop the api_tokens collection.
+		// Only hashes were stored, so the legacy api.token setting can't be brought back.
+		dao := daos.New(db)
+
+		tokensCollection, err := dao.FindCollectionByNameOrId("api_tokens")
+		if err == nil {
+			if err := dao.DeleteCollection(tokensCollection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,192 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/webhook"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Create webhooks collection.
+		// Webhooks hold their signing secret and are managed through the webhook endpoints,
+		// so no API rules are set and the collection stays admin-only.
+		webhooksCollection := &models.Collection{
+			Name: "webhooks",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "name",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(100),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "url",
+					Type:     schema.FieldTypeUrl,
+					Required: true,
+					Options:  &schema.UrlOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "secret",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(100),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "events",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: len(webhook.Events),
+						Values:    webhook.Events,
+					},
+				},
+				&schema.SchemaField{
+					Name:     "enabled",
+					Type:     schema.FieldTypeBool,
+					Required: false,
+					Options:  &schema.BoolOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "owner",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  "_pb_users_auth_",
+						CascadeDelete: true,
+						MinSelect:     nil,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+			),
+		}
+
+		webhooksCollection.Indexes = types.JsonArray[string]{
+			"CREATE INDEX idx_webhooks_owner ON webhooks (owner)",
+		}
+
+		if err := dao.SaveCollection(webhooksCollection); err != nil {
+			return err
+		}
+
+		// Create webhook_deliveries collection, the delivery log and retry queue.
+		// Deliveries are written by the webhook service only and read through the webhook endpoints.
+		deliveriesCollection := &models.Collection{
+			Name: "webhook_deliveries",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "webhook",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  webhooksCollection.Id,
+						CascadeDelete: true,
+						MinSelect:     nil,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "event",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(50),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "payload",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "status",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    []string{webhook.StatusPending, webhook.StatusDelivered, webhook.StatusFailed},
+					},
+				},
+				&schema.SchemaField{
+					Name:     "attempts",
+					Type:     schema.FieldTypeNumber,
+					Required: false,
+					Options:  &schema.NumberOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "next_attempt",
+					Type:     schema.FieldTypeDate,
+					Required: false,
+					Options:  &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "response_status",
+					Type:     schema.FieldTypeNumber,
+					Required: false,
+					Options:  &schema.NumberOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "error",
+					Type:     schema.FieldTypeText,
+					Required: false,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "duration_ms",
+					Type:     schema.FieldTypeNumber,
+					Required: false,
+					Options:  &schema.NumberOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "owner",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  "_pb_users_auth_",
+						CascadeDelete: true,
+						MinSelect:     nil,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+			),
+		}
+
+		deliveriesCollection.Indexes = types.JsonArray[string]{
+			"CREATE INDEX idx_webhook_deliveries_webhook_created ON webhook_deliveries (webhook, created)",
+			"CREATE INDEX idx_webhook_deliveries_status_next ON webhook_deliveries (status, next_attempt)",
+		}
+
+		return dao.SaveCollection(deliveriesCollection)
+	}, func(db dbx.Builder) error {
+		// Rollback: drop webhook_deliveries and webhooks collections
+		dao := daos.New(db)
+
+		for _, name := range []string{"webhook_deliveries", "webhooks"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err == nil {
+				if err := dao.DeleteCollection(collection); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/jobs"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Create jobs collection for background exports and imports.
+		// Jobs hold the hash of their download token and are managed through the job endpoints,
+		// so no API rules are set and the collection stays admin-only.
+		jobsCollection := &models.Collection{
+			Name: "jobs",
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "kind",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    jobs.Kinds,
+					},
+				},
+				&schema.SchemaField{
+					Name:     "status",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    jobs.Statuses,
+					},
+				},
+				&schema.SchemaField{
+					Name:     "progress",
+					Type:     schema.FieldTypeNumber,
+					Required: false,
+					Options:  &schema.NumberOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "params",
+					Type:     schema.FieldTypeJson,
+					Required: false,
+					Options:  &schema.JsonOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "stats",
+					Type:     schema.FieldTypeJson,
+					Required: false,
+					Options:  &schema.JsonOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "error",
+					Type:     schema.FieldTypeText,
+					Required: false,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "artifact",
+					Type:     schema.FieldTypeFile,
+					Required: false,
+					Options: &schema.FileOptions{
+						MaxSelect: 1,
+						MaxSize:   10 << 30, // 10GB, exports are written by the job service, which doesn't check it
+						Protected: true,
+					},
+				},
+				&schema.SchemaField{
+					Name:     "artifact_size",
+					Type:     schema.FieldTypeNumber,
+					Required: false,
+					Options:  &schema.NumberOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "artifact_expires",
+					Type:     schema.FieldTypeDate,
+					Required: false,
+					Options:  &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "download_token",
+					Type:     schema.FieldTypeText,
+					Required: false,
+					Options: &schema.TextOptions{
+						Min: nil,
+						Max: types.Pointer(100),
+					},
+				},
+				&schema.SchemaField{
+					Name:     "download_expires",
+					Type:     schema.FieldTypeDate,
+					Required: false,
+					Options:  &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "finished",
+					Type:     schema.FieldTypeDate,
+					Required: false,
+					Options:  &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "owner",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						CollectionId:  "_pb_users_auth_",
+						CascadeDelete: true,
+						MinSelect:     nil,
+						MaxSelect:     types.Pointer(1),
+					},
+				},
+			),
+		}
+
+		jobsCollection.Indexes = types.JsonArray[string]{
+			"CREATE INDEX idx_jobs_owner_created ON jobs (owner, created)",
+			"CREATE INDEX idx_jobs_status ON jobs (status)",
+		}
+
+		return dao.SaveCollection(jobsCollection)
+	}, func(db dbx.Builder) error {
+		// Rollback: drop jobs collection
+		dao := daos.New(db)
+
+		collection, err := dao.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return nil
+		}
+		return dao.DeleteCollection(collection)
+	})
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Diary revisions: version is the updated timestamp of the diary state a revision holds,
+		// so a client's base version can be found exactly when merging a conflicting write
+		collection, err := dao.FindCollectionByNameOrId("diary_revisions")
+		if err != nil {
+			return err
+		}
+
+		collection.Schema.AddField(&schema.SchemaField{
+			Name:     "version",
+			Type:     schema.FieldTypeDate,
+			Required: false,
+			Options:  &schema.DateOptions{},
+		})
+
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Rollback: drop the version field
+		collection, err := dao.FindCollectionByNameOrId("diary_revisions")
+		if err != nil {
+			return err
+		}
+		if field := collection.Schema.GetFieldByName("version"); field != nil {
+			collection.Schema.RemoveField(field.Id)
+		}
+
+		return dao.SaveCollection(collection)
+	})
+}
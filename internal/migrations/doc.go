@@ -0,0 +1,6 @@
+// Package migrations holds the database migrations, registered on import.
+//
+// PocketBase applies migrations in file name order, compared as plain strings,
+// so "10_x.go" would run before "1_initial.go". Migrations after 8 are named
+// 9_NN_name.go with a two digit sequence number to keep them in order.
+package migrations
@@ -0,0 +1,328 @@
+package openapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version of the generated documents
+const Version = "3.1.0"
+
+// Authentication of a route
+const (
+	AuthNone = ""
+	// AuthUser requires the auth token of a signed in user
+	AuthUser = "user"
+	// AuthToken requires an API token, Route.Scope names the scope it must be granted
+	AuthToken = "token"
+)
+
+// Security scheme names
+const (
+	userAuthScheme = "userAuth"
+	apiTokenScheme = "apiToken"
+)
+
+// Content types
+const (
+	ContentJSON      = "application/json"
+	ContentMultipart = "multipart/form-data"
+)
+
+// Route describes an endpoint. Request and Response hold zero values of the body types,
+// their schemas are derived from the types.
+type Route struct {
+	Method string
+	// Path uses the router syntax, e.g. /api/diaries/:id
+	Path    string
+	Summary string
+	Tag     string
+	Auth    string
+	Scope   string
+	Query   []Param
+
+	// Request is the body, nil when the route takes none
+	Request any
+	// RequestType defaults to JSON
+	RequestType string
+
+	// Response is the body of a successful response, nil for none
+	Response any
+	// ResponseType defaults to JSON, a non-JSON body without a Response type is described as a string
+	ResponseType string
+	// Status defaults to 200
+	Status int
+
+	// Responses describes other JSON responses by status, e.g. a 409 with the conflicting data
+	Responses map[int]any
+}
+
+// Param is a query parameter
+type Param struct {
+	Name        string
+	Description string
+	// Type is the schema type, string by default
+	Type     string
+	Required bool
+}
+
+// Spec is the input of Build
+type Spec struct {
+	Title       string
+	Version     string
+	Description string
+	// Error is the body of error responses, described as the default response of every route
+	Error  any
+	Routes []Route
+}
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation is a method of a path
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of a request
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the shared schemas and security schemes
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme describes an authentication method
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Build generates the document of a spec
+func Build(spec Spec) *Document {
+	g := newGenerator()
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       spec.Title,
+			Version:     spec.Version,
+			Description: spec.Description,
+		},
+		Paths: map[string]map[string]*Operation{},
+		Components: Components{
+			SecuritySchemes: map[string]SecurityScheme{
+				userAuthScheme: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Auth token of a signed in user, as returned by the users auth endpoints",
+				},
+				apiTokenScheme: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "API token created in the settings, also accepted as the token query parameter",
+				},
+			},
+		},
+	}
+
+	errorSchema := g.schemaOf(spec.Error)
+
+	for _, route := range spec.Routes {
+		path, pathParams := convertPath(route.Path)
+
+		op := &Operation{
+			Summary:   route.Summary,
+			Responses: map[string]Response{},
+		}
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+		}
+
+		for _, name := range pathParams {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+		for _, param := range route.Query {
+			paramType := param.Type
+			if paramType == "" {
+				paramType = "string"
+			}
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:        param.Name,
+				In:          "query",
+				Description: param.Description,
+				Required:    param.Required,
+				Schema:      &Schema{Type: paramType},
+			})
+		}
+
+		if route.Request != nil {
+			requestType := route.RequestType
+			if requestType == "" {
+				requestType = ContentJSON
+			}
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{requestType: {Schema: g.schemaOf(route.Request)}},
+			}
+		}
+
+		op.Responses[statusKey(route.Status)] = g.response(route)
+		for status, body := range route.Responses {
+			op.Responses[statusKey(status)] = Response{
+				Description: http.StatusText(status),
+				Content:     map[string]MediaType{ContentJSON: {Schema: g.schemaOf(body)}},
+			}
+		}
+		if errorSchema != nil {
+			op.Responses["default"] = Response{
+				Description: "Error",
+				Content:     map[string]MediaType{ContentJSON: {Schema: errorSchema}},
+			}
+		}
+
+		switch route.Auth {
+		case AuthUser:
+			op.Security = []map[string][]string{{userAuthScheme: {}}}
+		case AuthToken:
+			scopes := []string{}
+			if route.Scope != "" {
+				scopes = append(scopes, route.Scope)
+			}
+			op.Security = []map[string][]string{{apiTokenScheme: scopes}}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*Operation{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	doc.Components.Schemas = g.schemas
+	return doc
+}
+
+// response describes the successful response of a route
+func (g *generator) response(route Route) Response {
+	response := Response{Description: http.StatusText(statusOf(route.Status))}
+
+	contentType := route.ResponseType
+	if contentType == "" {
+		contentType = ContentJSON
+	}
+
+	schema := g.schemaOf(route.Response)
+	if schema == nil && contentType != ContentJSON {
+		schema = &Schema{Type: "string", Format: "binary"}
+		if strings.HasPrefix(contentType, "text/") {
+			schema = &Schema{Type: "string"}
+		}
+	}
+	if schema != nil {
+		response.Content = map[string]MediaType{contentType: {Schema: schema}}
+	}
+	return response
+}
+
+// Has reports whether the document describes a method of a path in router syntax
+func (d *Document) Has(method, path string) bool {
+	converted, _ := convertPath(path)
+	_, ok := d.Paths[converted][strings.ToLower(method)]
+	return ok
+}
+
+// Operations lists the described routes as "METHOD path" in router syntax, sorted
+func (d *Document) Operations() []string {
+	var result []string
+	for path, ops := range d.Paths {
+		for method := range ops {
+			result = append(result, strings.ToUpper(method)+" "+routerPath(path))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// convertPath turns router path parameters like :id into OpenAPI's {id} and returns their names
+func convertPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// routerPath turns an OpenAPI path back into router syntax
+func routerPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = ":" + segment[1:len(segment)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func statusOf(status int) int {
+	if status == 0 {
+		return http.StatusOK
+	}
+	return status
+}
+
+func statusKey(status int) string {
+	return strconv.Itoa(statusOf(status))
+}
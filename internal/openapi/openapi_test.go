@@ -0,0 +1,151 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testEntry struct {
+	ID      string   `json:"id"`
+	Tags    []string `json:"tags"`
+	Private bool     `json:"private,omitempty"`
+	Secret  string   `json:"-"`
+	hidden  string
+}
+
+type testDay struct {
+	testEntry
+	Entries []testEntry        `json:"entries"`
+	Count   int64              `json:"count"`
+	Meta    map[string]any     `json:"meta"`
+	Created time.Time          `json:"created"`
+	Next    *testDay           `json:"next,omitempty"`
+	Raw     json.RawMessage    `json:"raw"`
+	Scores  map[string]float64 `json:"scores"`
+}
+
+func TestSchema(t *testing.T) {
+	g := newGenerator()
+	ref := g.schemaOf(testDay{})
+	if ref.Ref != "#/components/schemas/TestDay" {
+		t.Fatalf("ref = %q", ref.Ref)
+	}
+
+	day := g.schemas["TestDay"]
+	for _, name := range []string{"id", "tags", "private", "entries", "count", "meta", "created", "next", "raw", "scores"} {
+		if day.Properties[name] == nil {
+			t.Errorf("property %s missing", name)
+		}
+	}
+	if _, ok := day.Properties["Secret"]; ok {
+		t.Error("ignored field described")
+	}
+	if _, ok := day.Properties["hidden"]; ok {
+		t.Error("unexported field described")
+	}
+
+	wantRequired := []string{"id", "tags", "entries", "count", "meta", "created", "raw", "scores"}
+	if !reflect.DeepEqual(day.Required, wantRequired) {
+		t.Errorf("required = %v, want %v", day.Required, wantRequired)
+	}
+
+	if got := day.Properties["entries"]; got.Type != "array" || got.Items.Ref != "#/components/schemas/TestEntry" {
+		t.Errorf("entries = %+v", got)
+	}
+	if got := day.Properties["count"]; got.Type != "integer" || got.Format != "int64" {
+		t.Errorf("count = %+v", got)
+	}
+	if got := day.Properties["created"]; got.Type != "string" || got.Format != "date-time" {
+		t.Errorf("created = %+v", got)
+	}
+	if got := day.Properties["next"]; got.Ref != "#/components/schemas/TestDay" {
+		t.Errorf("recursive field = %+v", got)
+	}
+	if got := day.Properties["raw"]; got.Type != "" {
+		t.Errorf("raw JSON = %+v, want any", got)
+	}
+	if got := day.Properties["scores"]; got.Type != "object" || got.AdditionalProperties.Type != "number" {
+		t.Errorf("scores = %+v", got)
+	}
+	if got := g.schemas["TestEntry"].Properties["tags"]; got.Items.Type != "string" {
+		t.Errorf("tags = %+v", got)
+	}
+}
+
+func TestSchemaOneOfAndAnonymous(t *testing.T) {
+	g := newGenerator()
+
+	schema := g.schemaOf(OneOf{testEntry{}, []testEntry{}})
+	if len(schema.OneOf) != 2 || schema.OneOf[1].Type != "array" {
+		t.Errorf("oneOf = %+v", schema)
+	}
+
+	anonymous := g.schemaOf(struct {
+		File Binary `json:"file"`
+	}{})
+	if anonymous.Ref != "" || anonymous.Properties["file"].Format != "binary" {
+		t.Errorf("anonymous struct = %+v", anonymous)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	doc := Build(Spec{
+		Title:   "Test",
+		Version: "1.0.0",
+		Error:   struct{ Message string }{},
+		Routes: []Route{
+			{Method: "GET", Path: "/api/diaries/:id/revisions/:rid", Auth: AuthUser, Response: testEntry{}},
+			{Method: "POST", Path: "/api/v1/diaries", Auth: AuthToken, Scope: "diaries:write", Request: testEntry{}, Response: testEntry{}, Status: 201,
+				Responses: map[int]any{409: testDay{}}},
+			{Method: "POST", Path: "/api/export", ResponseType: "application/zip", Query: []Param{{Name: "limit", Type: "integer"}}},
+		},
+	})
+
+	if !doc.Has("GET", "/api/diaries/:id/revisions/:rid") || !doc.Has("post", "/api/v1/diaries") {
+		t.Fatal("routes missing from the document")
+	}
+	if doc.Has("DELETE", "/api/v1/diaries") {
+		t.Error("undescribed method reported")
+	}
+
+	want := []string{"GET /api/diaries/:id/revisions/:rid", "POST /api/export", "POST /api/v1/diaries"}
+	if got := doc.Operations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("operations = %v, want %v", got, want)
+	}
+
+	get := doc.Paths["/api/diaries/{id}/revisions/{rid}"]["get"]
+	if len(get.Parameters) != 2 || get.Parameters[0].Name != "id" || get.Parameters[0].In != "path" || !get.Parameters[0].Required {
+		t.Errorf("path parameters = %+v", get.Parameters)
+	}
+	if _, ok := get.Security[0][userAuthScheme]; !ok {
+		t.Errorf("security = %v", get.Security)
+	}
+	if get.Responses["default"].Content[ContentJSON].Schema == nil {
+		t.Error("error response missing")
+	}
+
+	create := doc.Paths["/api/v1/diaries"]["post"]
+	if create.RequestBody == nil || create.Responses["201"].Content[ContentJSON].Schema == nil {
+		t.Errorf("create = %+v", create)
+	}
+	if got := create.Responses["409"].Content[ContentJSON].Schema; got == nil || got.Ref != "#/components/schemas/TestDay" {
+		t.Errorf("conflict response = %+v", got)
+	}
+	if scopes := create.Security[0][apiTokenScheme]; !reflect.DeepEqual(scopes, []string{"diaries:write"}) {
+		t.Errorf("scopes = %v", scopes)
+	}
+
+	export := doc.Paths["/api/export"]["post"]
+	if got := export.Responses["200"].Content["application/zip"].Schema; got == nil || got.Format != "binary" {
+		t.Errorf("binary response = %+v", got)
+	}
+	if export.Parameters[0].In != "query" || export.Parameters[0].Schema.Type != "integer" {
+		t.Errorf("query parameter = %+v", export.Parameters[0])
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatalf("document does not marshal: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Schema is an OpenAPI schema object, limited to what Go types need
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// Binary marks a multipart form field holding a file
+type Binary string
+
+// OneOf describes a response that is one of several types
+type OneOf []any
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	binaryType        = reflect.TypeOf(Binary(""))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// generator derives schemas from Go types. Named structs become components,
+// referenced by $ref, so a type shared by several routes is described once.
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{
+		schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+	}
+}
+
+// schemaOf returns the schema of the type of value, nil for a nil value
+func (g *generator) schemaOf(value any) *Schema {
+	if value == nil {
+		return nil
+	}
+	if oneOf, ok := value.(OneOf); ok {
+		schema := &Schema{}
+		for _, option := range oneOf {
+			schema.OneOf = append(schema.OneOf, g.schemaOf(option))
+		}
+		return schema
+	}
+	return g.schema(reflect.TypeOf(value))
+}
+
+// schema returns the schema of t, following encoding/json
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	case binaryType:
+		return &Schema{Type: "string", Format: "binary"}
+	}
+
+	if t.Kind() == reflect.Pointer {
+		return g.schema(t.Elem())
+	}
+
+	// Types with their own encoding, like PocketBase's DateTime, are strings in practice
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.component(t)}
+	default:
+		// Interfaces hold any value
+		return &Schema{}
+	}
+}
+
+// component registers a named struct as a component and returns its name
+func (g *generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := exportedName(t.Name())
+	if _, taken := g.schemas[name]; taken {
+		// Same name in another package, qualify it with the package name
+		pkg := t.PkgPath()
+		name = exportedName(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+
+	// Register before generating the fields, so recursive types end in a $ref
+	g.names[t] = name
+	g.schemas[name] = &Schema{}
+	*g.schemas[name] = *g.structSchema(t)
+	return name
+}
+
+// structSchema describes the fields of a struct, embedded structs are inlined like encoding/json does
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.addFields(schema, t)
+	return schema
+}
+
+func (g *generator) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = g.schema(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// exportedName upper-cases the first letter of a Go type name
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
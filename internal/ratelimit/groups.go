@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Route groups sharing a limit
+const (
+	// GroupPublic covers the token-authenticated /api/v1 endpoints
+	GroupPublic = "public"
+	// GroupAIChat covers AI chat requests, which spend the user's model quota
+	GroupAIChat = "ai_chat"
+	// GroupVectors covers manual vector builds, which spend the user's embedding quota
+	GroupVectors = "vectors"
+	// GroupExport covers data exports
+	GroupExport = "export"
+)
+
+// DefaultLimits apply when no environment override is set
+var DefaultLimits = map[string]Limit{
+	GroupPublic:  {Requests: 120, Window: time.Minute},
+	GroupAIChat:  {Requests: 20, Window: time.Minute},
+	GroupVectors: {Requests: 10, Window: time.Hour},
+	GroupExport:  {Requests: 10, Window: time.Hour},
+}
+
+// EnvPrefix prefixes the environment variables overriding a group limit,
+// e.g. DIARUM_RATE_LIMIT_AI_CHAT=30/1m or DIARUM_RATE_LIMIT_PUBLIC=off
+const EnvPrefix = "DIARUM_RATE_LIMIT_"
+
+// Limits holds a limiter per route group
+type Limits struct {
+	limiters map[string]*Limiter
+}
+
+// NewLimits creates limiters for the default limits, overridden by the environment read with getenv.
+// Invalid overrides are returned as warnings and leave the default in place.
+func NewLimits(getenv func(string) string) (*Limits, []string) {
+	var warnings []string
+	limiters := make(map[string]*Limiter, len(DefaultLimits))
+	for group, limit := range DefaultLimits {
+		key := EnvPrefix + strings.ToUpper(group)
+		if value := getenv(key); value != "" {
+			parsed, err := ParseLimit(value)
+			if err != nil {
+				warnings = append(warnings, key+": "+err.Error())
+			} else {
+				limit = parsed
+			}
+		}
+		limiters[group] = NewLimiter(limit)
+	}
+	sort.Strings(warnings)
+	return &Limits{limiters: limiters}, warnings
+}
+
+// Allow takes a request of key from the limiter of a group, unknown groups are not limited
+func (l *Limits) Allow(group, key string) Decision {
+	if l == nil || l.limiters[group] == nil {
+		return Decision{Allowed: true}
+	}
+	return l.limiters[group].Allow(key)
+}
+
+// Limit returns the limit of a group
+func (l *Limits) Limit(group string) Limit {
+	if l == nil || l.limiters[group] == nil {
+		return Limit{}
+	}
+	return l.limiters[group].Limit()
+}
+
+// String describes the limit of every group, for the startup log
+func (l *Limits) String() string {
+	groups := make([]string, 0, len(l.limiters))
+	for group := range l.limiters {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	parts := make([]string, 0, len(groups))
+	for _, group := range groups {
+		parts = append(parts, group+"="+l.limiters[group].Limit().String())
+	}
+	return strings.Join(parts, " ")
+}
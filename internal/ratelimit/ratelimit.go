@@ -0,0 +1,177 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Window on average, with bursts of up to Requests.
+// A zero Limit disables limiting.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Window > 0
+}
+
+// String formats the limit the way ParseLimit reads it
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, formatWindow(l.Window))
+}
+
+// rate returns the refill rate in requests per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// ParseLimit reads a limit like "120/1m", "20/30s" or "5/h".
+// A bare count is per minute, "0" and "off" disable the limit.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "off" || value == "0" {
+		return Limit{}, nil
+	}
+
+	count, window, found := strings.Cut(value, "/")
+	requests, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("invalid request count %q", count)
+	}
+	if requests == 0 {
+		return Limit{}, nil
+	}
+
+	duration := time.Minute
+	if found {
+		window = strings.TrimSpace(window)
+		// Allow a bare unit like "/m" for one of it
+		if window != "" && (window[0] < '0' || window[0] > '9') {
+			window = "1" + window
+		}
+		if duration, err = time.ParseDuration(window); err != nil || duration <= 0 {
+			return Limit{}, fmt.Errorf("invalid window %q", window)
+		}
+	}
+
+	return Limit{Requests: requests, Window: duration}, nil
+}
+
+// formatWindow formats a window in its largest whole unit
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+// Decision is the outcome of a request against a limit
+type Decision struct {
+	Allowed bool
+	// Limit is the burst size, Remaining what is left of it after this request
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when allowed
+	RetryAfter time.Duration
+}
+
+// bucket is the token bucket of one key
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket limiter keyed by caller, safe for concurrent use
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter creates a limiter for a limit
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Limit returns the limit enforced by the limiter
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Allow takes a request from the bucket of key
+func (l *Limiter) Allow(key string) Decision {
+	if !l.limit.Enabled() {
+		return Decision{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	burst := float64(l.limit.Requests)
+	rate := l.limit.rate()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+	}
+	b.last = now
+
+	decision := Decision{Limit: l.limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	decision.Remaining = int(math.Floor(b.tokens))
+	decision.Reset = seconds((burst - b.tokens) / rate)
+	return decision
+}
+
+// sweep drops buckets that refilled completely, at most once per window
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.limit.Window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.limit.Window {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// seconds converts a duration in seconds to a time.Duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
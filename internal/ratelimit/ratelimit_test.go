@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Limit
+	}{
+		{"120/1m", Limit{120, time.Minute}},
+		{" 20 / 30s ", Limit{20, 30 * time.Second}},
+		{"5/h", Limit{5, time.Hour}},
+		{"60", Limit{60, time.Minute}},
+		{"off", Limit{}},
+		{"0", Limit{}},
+		{"0/1h", Limit{}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if err != nil {
+			t.Errorf("ParseLimit(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"many", "-1/1m", "10/soon", "10/-1m", "10/0s"} {
+		if _, err := ParseLimit(value); err == nil {
+			t.Errorf("ParseLimit(%q) accepted", value)
+		}
+	}
+}
+
+func TestLimitString(t *testing.T) {
+	for _, value := range []string{"120/1m", "10/1h", "20/30s", "off"} {
+		limit, err := ParseLimit(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := limit.String(); got != value {
+			t.Errorf("String() = %q, want %q", got, value)
+		}
+	}
+}
+
+// fakeClock returns a limiter with a controllable clock
+func fakeClock(limit Limit) (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(limit)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	limiter, now := fakeClock(Limit{Requests: 3, Window: time.Minute})
+
+	for i := 2; i >= 0; i-- {
+		d := limiter.Allow("a")
+		if !d.Allowed {
+			t.Fatalf("request within the burst rejected")
+		}
+		if d.Limit != 3 || d.Remaining != i {
+			t.Errorf("limit %d remaining %d, want 3 and %d", d.Limit, d.Remaining, i)
+		}
+	}
+
+	d := limiter.Allow("a")
+	if d.Allowed {
+		t.Fatal("request over the burst allowed")
+	}
+	// One request refills every 20 seconds
+	if d.RetryAfter != 20*time.Second {
+		t.Errorf("RetryAfter = %s, want 20s", d.RetryAfter)
+	}
+	if d.Reset != time.Minute {
+		t.Errorf("Reset = %s, want 1m", d.Reset)
+	}
+
+	if !limiter.Allow("b").Allowed {
+		t.Error("other key shares the bucket")
+	}
+
+	*now = now.Add(20 * time.Second)
+	if d := limiter.Allow("a"); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("refilled request: allowed %v remaining %d", d.Allowed, d.Remaining)
+	}
+
+	// A long pause refills the bucket to the burst, not beyond
+	*now = now.Add(time.Hour)
+	if d := limiter.Allow("a"); d.Remaining != 2 {
+		t.Errorf("remaining after a pause = %d, want 2", d.Remaining)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	limiter := NewLimiter(Limit{})
+	for i := 0; i < 1000; i++ {
+		if !limiter.Allow("a").Allowed {
+			t.Fatal("disabled limiter rejected a request")
+		}
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	limiter, now := fakeClock(Limit{Requests: 1, Window: time.Minute})
+	limiter.Allow("a")
+	limiter.Allow("b")
+
+	*now = now.Add(2 * time.Minute)
+	limiter.Allow("c")
+
+	if len(limiter.buckets) != 1 {
+		t.Errorf("%d buckets kept, want only the active one", len(limiter.buckets))
+	}
+}
+
+func TestNewLimits(t *testing.T) {
+	env := map[string]string{
+		"DIARUM_RATE_LIMIT_AI_CHAT": "2/1m",
+		"DIARUM_RATE_LIMIT_EXPORT":  "off",
+		"DIARUM_RATE_LIMIT_PUBLIC":  "lots",
+	}
+	limits, warnings := NewLimits(func(key string) string { return env[key] })
+
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %v, want one for the invalid public limit", warnings)
+	}
+	if got := limits.Limit(GroupPublic); got != DefaultLimits[GroupPublic] {
+		t.Errorf("invalid override changed the public limit to %s", got)
+	}
+	if got := limits.Limit(GroupAIChat); got != (Limit{2, time.Minute}) {
+		t.Errorf("ai chat limit = %s", got)
+	}
+	if limits.Limit(GroupExport).Enabled() {
+		t.Error("export limit not disabled")
+	}
+
+	limits.Allow(GroupAIChat, "u")
+	limits.Allow(GroupAIChat, "u")
+	if limits.Allow(GroupAIChat, "u").Allowed {
+		t.Error("third chat request allowed")
+	}
+	if !limits.Allow("unknown", "u").Allowed {
+		t.Error("unknown group limited")
+	}
+}
@@ -0,0 +1,224 @@
+package revision
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// maxDiffEdits caps the edit distance explored by the diff.
+// The trace grows quadratically with it, 1000 edits keep it around 8MB.
+const maxDiffEdits = 1000
+
+// maxDiffTokens caps the number of differing tokens the diff will look at.
+// Each round scans up to this many tokens, so it bounds CPU time per request.
+// Beyond either limit the texts are reported as fully replaced.
+const maxDiffTokens = 20000
+
+// DiffOp is one segment of a word-level diff
+type DiffOp struct {
+	Type string `json:"type"` // "equal", "insert", "delete"
+	Text string `json:"text"`
+}
+
+// DiffStats summarizes a diff in words
+type DiffStats struct {
+	Inserted int `json:"inserted"`
+	Deleted  int `json:"deleted"`
+}
+
+// DiffWords computes a word-level diff between two plain texts
+func DiffWords(oldText, newText string) ([]DiffOp, DiffStats) {
+	a := tokenize(oldText)
+	b := tokenize(newText)
+
+	// Trim common prefix and suffix before running the O(ND) algorithm
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]DiffOp, 0)
+	for _, t := range a[:prefix] {
+		ops = appendOp(ops, "equal", t)
+	}
+	ops = append(ops, diffTokens(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, t := range a[len(a)-suffix:] {
+		ops = appendOp(ops, "equal", t)
+	}
+
+	ops = mergeOps(ops)
+
+	var stats DiffStats
+	for _, op := range ops {
+		switch op.Type {
+		case "insert":
+			stats.Inserted += len(textutil.Words(op.Text))
+		case "delete":
+			stats.Deleted += len(textutil.Words(op.Text))
+		}
+	}
+	return ops, stats
+}
+
+// diffTokens runs the Myers diff over two token slices
+func diffTokens(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	if n+m > maxDiffTokens {
+		return replaceAll(a, b)
+	}
+
+	limit := n + m
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds the window v[-d-1..d+1] as it was before round d
+	trace := make([][]int, 0)
+
+	for d := 0; d <= limit; d++ {
+		window := make([]int, 2*d+3)
+		copy(window, v[offset-d-1:offset+d+2])
+		trace = append(trace, window)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+
+	// Too many edits, report a full replacement
+	return replaceAll(a, b)
+}
+
+// replaceAll reports a as deleted and b as inserted
+func replaceAll(a, b []string) []DiffOp {
+	ops := make([]DiffOp, 0, 2)
+	ops = append(ops, DiffOp{Type: "delete", Text: strings.Join(a, "")})
+	ops = append(ops, DiffOp{Type: "insert", Text: strings.Join(b, "")})
+	return ops
+}
+
+// backtrack walks the Myers trace from the end and emits ops in order
+func backtrack(trace [][]int, a, b []string) []DiffOp {
+	at := func(d, k int) int { return trace[d][k+d+1] }
+
+	reversed := make([]DiffOp, 0)
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(d, k-1) < at(d, k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(d, prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, DiffOp{Type: "equal", Text: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, DiffOp{Type: "insert", Text: b[y-1]})
+			} else {
+				reversed = append(reversed, DiffOp{Type: "delete", Text: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]DiffOp, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		ops = append(ops, reversed[i])
+	}
+	return ops
+}
+
+// appendOp appends a single token operation
+func appendOp(ops []DiffOp, opType, text string) []DiffOp {
+	return append(ops, DiffOp{Type: opType, Text: text})
+}
+
+// mergeOps joins consecutive operations of the same type
+func mergeOps(ops []DiffOp) []DiffOp {
+	merged := make([]DiffOp, 0, len(ops))
+	for _, op := range ops {
+		if op.Text == "" {
+			continue
+		}
+		if n := len(merged); n > 0 && merged[n-1].Type == op.Type {
+			merged[n-1].Text += op.Text
+			continue
+		}
+		merged = append(merged, op)
+	}
+	return merged
+}
+
+// tokenize splits text into words, whitespace runs, punctuation and single CJK characters
+// so that joining the tokens yields the original text
+func tokenize(text string) []string {
+	tokens := make([]string, 0)
+	start := 0
+	class := 0 // 0: none, 1: word, 2: space
+
+	flush := func(i int) {
+		if class != 0 && i > start {
+			tokens = append(tokens, text[start:i])
+		}
+		class = 0
+	}
+
+	for i, r := range text {
+		switch {
+		case textutil.IsCJK(r) || (!unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsDigit(r)):
+			flush(i)
+			_, size := utf8.DecodeRuneInString(text[i:])
+			tokens = append(tokens, text[i:i+size])
+			start = i + size
+		case unicode.IsSpace(r):
+			if class != 2 {
+				flush(i)
+				start = i
+				class = 2
+			}
+		default:
+			if class != 1 {
+				flush(i)
+				start = i
+				class = 1
+			}
+		}
+	}
+	flush(len(text))
+	return tokens
+}
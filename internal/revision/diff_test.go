@@ -0,0 +1,108 @@
+package revision
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"hello",
+		"hello world",
+		"  leading and trailing  ",
+		"punctuation, here! and... there?",
+		"今天天气很好",
+		"混合 mixed 文本, with 标点。",
+		"tabs\tand\nnewlines\r\n",
+		"emoji 😀 inside",
+		"invalid \xff byte",
+	}
+
+	for _, text := range tests {
+		if got := strings.Join(tokenize(text), ""); got != text {
+			t.Errorf("tokenize(%q) joined = %q", text, got)
+		}
+	}
+}
+
+func TestTokenizeSplitsCJK(t *testing.T) {
+	got := tokenize("今天good")
+	want := []string{"今", "天", "good"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestDiffWordsRebuildsBothSides(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		inserted int
+		deleted  int
+	}{
+		{"empty", "", "", 0, 0},
+		{"from empty", "", "new text", 2, 0},
+		{"to empty", "old text", "", 0, 2},
+		{"equal", "same words here", "same words here", 0, 0},
+		{"insert", "the quick fox", "the quick brown fox", 1, 0},
+		{"delete", "the quick brown fox", "the quick fox", 0, 1},
+		{"replace", "the quick brown fox", "the slow brown dog", 2, 2},
+		{"cjk", "今天天气很好", "今天天气不好", 1, 1},
+		{"cjk insert", "我去公园", "我昨天去公园", 2, 0},
+		{"mixed", "Went to 北京 today", "Went to 上海 yesterday", 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, stats := DiffWords(tt.old, tt.new)
+
+			var oldSB, newSB strings.Builder
+			for _, op := range ops {
+				switch op.Type {
+				case "equal":
+					oldSB.WriteString(op.Text)
+					newSB.WriteString(op.Text)
+				case "delete":
+					oldSB.WriteString(op.Text)
+				case "insert":
+					newSB.WriteString(op.Text)
+				default:
+					t.Fatalf("unexpected op type %q", op.Type)
+				}
+			}
+
+			if oldSB.String() != tt.old {
+				t.Errorf("old side = %q, want %q", oldSB.String(), tt.old)
+			}
+			if newSB.String() != tt.new {
+				t.Errorf("new side = %q, want %q", newSB.String(), tt.new)
+			}
+			if stats.Inserted != tt.inserted || stats.Deleted != tt.deleted {
+				t.Errorf("stats = %+v, want inserted=%d deleted=%d", stats, tt.inserted, tt.deleted)
+			}
+		})
+	}
+}
+
+func TestDiffWordsMergesOps(t *testing.T) {
+	ops, _ := DiffWords("a b c", "a x y c")
+	for i := 1; i < len(ops); i++ {
+		if ops[i].Type == ops[i-1].Type {
+			t.Errorf("consecutive %q ops were not merged: %+v", ops[i].Type, ops)
+		}
+	}
+}
+
+func TestDiffWordsFallsBackOnLargeInput(t *testing.T) {
+	oldText := strings.Repeat("a ", maxDiffTokens) + "x"
+	newText := strings.Repeat("b ", maxDiffTokens) + "y"
+
+	ops, _ := DiffWords(oldText, newText)
+	if len(ops) != 2 || ops[0].Type != "delete" || ops[1].Type != "insert" {
+		t.Fatalf("expected full replacement, got %d ops", len(ops))
+	}
+	if ops[0].Text != oldText || ops[1].Text != newText {
+		t.Errorf("full replacement does not carry the original texts")
+	}
+}
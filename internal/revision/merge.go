@@ -0,0 +1,237 @@
+package revision
+
+import "strings"
+
+// maxMergeCells caps the size of the block matching table of a merge.
+// Diaries are split into paragraphs, so real entries stay far below it.
+// Beyond the limit the differing region is reported as a single conflict.
+const maxMergeCells = 4_000_000
+
+// Conflict markers wrapped around the two versions of a block both sides changed
+const (
+	conflictStart  = "<<<<<<< yours\n"
+	conflictMiddle = "=======\n"
+	conflictEnd    = ">>>>>>> server\n"
+)
+
+// blockEndTags close a block of HTML content, diaries are split after them
+var blockEndTags = []string{
+	"</p>", "</h1>", "</h2>", "</h3>", "</h4>", "</h5>", "</h6>",
+	"</li>", "</blockquote>", "</pre>", "<br>", "<br/>", "<br />", "<hr>", "<hr/>", "<hr />",
+}
+
+// MergeResult is a suggested merge of two concurrent edits
+type MergeResult struct {
+	Content string `json:"content"`
+	// Conflicts is the number of blocks both sides changed differently, they are kept
+	// side by side between conflict markers. Zero means the merge applied cleanly.
+	Conflicts int `json:"conflicts"`
+}
+
+// Merge3 merges two edits of the same HTML or markdown content, block by block.
+// base is the version both edits started from, ours the client's edit and theirs the
+// server copy. Blocks changed on one side only are taken from that side.
+// Without a base every differing block is a conflict.
+func Merge3(base, ours, theirs string) MergeResult {
+	switch {
+	case ours == theirs, theirs == base && base != "":
+		return MergeResult{Content: ours}
+	case ours == base && base != "":
+		return MergeResult{Content: theirs}
+	}
+
+	o := splitBlocks(ours)
+	t := splitBlocks(theirs)
+
+	strict := base == ""
+	var b []string
+	if strict {
+		// Use the common blocks as the base, so only the differences conflict
+		for _, pair := range matchBlocks(o, t) {
+			b = append(b, o[pair[0]])
+		}
+	} else {
+		b = splitBlocks(base)
+	}
+
+	m := &merger{strict: strict}
+	toOurs := matchIndex(b, o)
+	toTheirs := matchIndex(b, t)
+
+	i, j, k := 0, 0, 0
+	for {
+		// The next base block kept unchanged on both sides
+		next := -1
+		for x := i; x < len(b); x++ {
+			if toOurs[x] >= j && toTheirs[x] >= k {
+				next = x
+				break
+			}
+		}
+		if next < 0 {
+			m.resolve(b[i:], o[j:], t[k:])
+			break
+		}
+
+		m.resolve(b[i:next], o[j:toOurs[next]], t[k:toTheirs[next]])
+		m.out.WriteString(b[next])
+		i, j, k = next+1, toOurs[next]+1, toTheirs[next]+1
+	}
+
+	return MergeResult{Content: m.out.String(), Conflicts: m.conflicts}
+}
+
+// merger collects the output of Merge3
+type merger struct {
+	out       strings.Builder
+	conflicts int
+	// strict reports every difference as a conflict, used when the base is unknown
+	strict bool
+}
+
+// resolve merges a region between two stable blocks
+func (m *merger) resolve(base, ours, theirs []string) {
+	switch {
+	case sameBlocks(ours, theirs):
+		m.write(ours)
+	case !m.strict && sameBlocks(ours, base):
+		m.write(theirs)
+	case !m.strict && sameBlocks(theirs, base):
+		m.write(ours)
+	default:
+		m.conflicts++
+		m.out.WriteString(conflictStart)
+		m.writeSection(ours)
+		m.out.WriteString(conflictMiddle)
+		m.writeSection(theirs)
+		m.out.WriteString(conflictEnd)
+	}
+}
+
+func (m *merger) write(blocks []string) {
+	for _, block := range blocks {
+		m.out.WriteString(block)
+	}
+}
+
+// writeSection writes one side of a conflict, ending it on its own line
+func (m *merger) writeSection(blocks []string) {
+	text := strings.Join(blocks, "")
+	m.out.WriteString(text)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		m.out.WriteString("\n")
+	}
+}
+
+// splitBlocks splits content into blocks that keep their delimiters,
+// after newlines and after closing HTML block tags
+func splitBlocks(text string) []string {
+	var blocks []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		end := -1
+		if text[i] == '\n' {
+			end = i + 1
+		} else if text[i] == '<' {
+			lower := strings.ToLower(text[i:min(len(text), i+len("<blockquote>")+1)])
+			for _, tag := range blockEndTags {
+				if strings.HasPrefix(lower, tag) {
+					end = i + len(tag)
+					break
+				}
+			}
+		}
+		if end < 0 {
+			continue
+		}
+		// Keep a newline directly after a closing tag with its block
+		if end < len(text) && text[end] == '\n' && text[end-1] != '\n' {
+			end++
+		}
+		blocks = append(blocks, text[start:end])
+		start = end
+		i = end - 1
+	}
+	if start < len(text) {
+		blocks = append(blocks, text[start:])
+	}
+	return blocks
+}
+
+// matchIndex maps every block of a to its matched block in b, -1 when it was changed
+func matchIndex(a, b []string) []int {
+	index := make([]int, len(a))
+	for i := range index {
+		index[i] = -1
+	}
+	for _, pair := range matchBlocks(a, b) {
+		index[pair[0]] = pair[1]
+	}
+	return index
+}
+
+// matchBlocks returns the index pairs of a longest common subsequence of two block lists
+func matchBlocks(a, b []string) [][2]int {
+	var pairs [][2]int
+
+	// Common prefix and suffix are matched directly
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		pairs = append(pairs, [2]int{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	x := a[prefix : len(a)-suffix]
+	y := b[prefix : len(b)-suffix]
+	if len(x) > 0 && len(y) > 0 && len(x)*len(y) <= maxMergeCells {
+		// lengths[i][j] is the LCS length of x[i:] and y[j:]
+		lengths := make([][]int, len(x)+1)
+		for i := range lengths {
+			lengths[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					lengths[i][j] = lengths[i+1][j+1] + 1
+				} else {
+					lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(x) && j < len(y) {
+			switch {
+			case x[i] == y[j]:
+				pairs = append(pairs, [2]int{prefix + i, prefix + j})
+				i++
+				j++
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				i++
+			default:
+				j++
+			}
+		}
+	}
+
+	for s := suffix; s > 0; s-- {
+		pairs = append(pairs, [2]int{len(a) - s, len(b) - s})
+	}
+	return pairs
+}
+
+func sameBlocks(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
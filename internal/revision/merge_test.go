@@ -0,0 +1,139 @@
+package revision
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitBlocksRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"plain text",
+		"<p>one</p><p>two</p>",
+		"<p>one</p>\n<p>two</p>\n",
+		"line one\nline two\n\nline four",
+		"<h1>Title</h1><ul><li>a</li><li>b</li></ul>",
+		"text<br>more<BR/>end",
+		"<p>未完",
+	}
+
+	for _, text := range tests {
+		if got := strings.Join(splitBlocks(text), ""); got != text {
+			t.Errorf("splitBlocks(%q) joined = %q", text, got)
+		}
+	}
+}
+
+func TestSplitBlocksHTML(t *testing.T) {
+	got := splitBlocks("<p>one</p>\n<p>two</p><ul><li>a</li></ul>")
+	want := []string{"<p>one</p>\n", "<p>two</p>", "<ul><li>a</li>", "</ul>"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("splitBlocks = %q, want %q", got, want)
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantConflicts      int
+	}{
+		{
+			name:   "identical edits",
+			base:   "<p>a</p>",
+			ours:   "<p>b</p>",
+			theirs: "<p>b</p>",
+			want:   "<p>b</p>",
+		},
+		{
+			name:   "only ours changed",
+			base:   "<p>a</p><p>b</p>",
+			ours:   "<p>a</p><p>B</p>",
+			theirs: "<p>a</p><p>b</p>",
+			want:   "<p>a</p><p>B</p>",
+		},
+		{
+			name:   "only theirs changed",
+			base:   "<p>a</p><p>b</p>",
+			ours:   "<p>a</p><p>b</p>",
+			theirs: "<p>A</p><p>b</p>",
+			want:   "<p>A</p><p>b</p>",
+		},
+		{
+			name:   "different paragraphs",
+			base:   "<p>a</p><p>b</p><p>c</p>",
+			ours:   "<p>A</p><p>b</p><p>c</p>",
+			theirs: "<p>a</p><p>b</p><p>C</p>",
+			want:   "<p>A</p><p>b</p><p>C</p>",
+		},
+		{
+			name:   "insertions at both ends",
+			base:   "line\n",
+			ours:   "first\nline\n",
+			theirs: "line\nlast\n",
+			want:   "first\nline\nlast\n",
+		},
+		{
+			name:   "deletion and edit elsewhere",
+			base:   "a\nb\nc\nd\n",
+			ours:   "a\nc\nd\n",
+			theirs: "a\nb\nc\nD\n",
+			want:   "a\nc\nD\n",
+		},
+		{
+			name:          "same paragraph changed",
+			base:          "<p>a</p><p>b</p>",
+			ours:          "<p>a</p><p>mine</p>",
+			theirs:        "<p>a</p><p>server</p>",
+			want:          "<p>a</p>" + conflictStart + "<p>mine</p>\n" + conflictMiddle + "<p>server</p>\n" + conflictEnd,
+			wantConflicts: 1,
+		},
+		{
+			name:          "unknown base",
+			base:          "",
+			ours:          "a\nmine\nc\n",
+			theirs:        "a\nserver\nc\n",
+			want:          "a\n" + conflictStart + "mine\n" + conflictMiddle + "server\n" + conflictEnd + "c\n",
+			wantConflicts: 1,
+		},
+		{
+			name:          "unknown base with one-sided addition",
+			base:          "",
+			ours:          "a\n",
+			theirs:        "a\nb\n",
+			want:          "a\n" + conflictStart + conflictMiddle + "b\n" + conflictEnd,
+			wantConflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Merge3(tt.base, tt.ours, tt.theirs)
+			if got.Content != tt.want {
+				t.Errorf("content = %q, want %q", got.Content, tt.want)
+			}
+			if got.Conflicts != tt.wantConflicts {
+				t.Errorf("conflicts = %d, want %d", got.Conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestMatchBlocksIsIncreasing(t *testing.T) {
+	a := []string{"x", "a", "b", "x", "c", "x"}
+	b := []string{"a", "x", "c", "x", "b", "x"}
+
+	pairs := matchBlocks(a, b)
+	for i, pair := range pairs {
+		if a[pair[0]] != b[pair[1]] {
+			t.Fatalf("pair %v matches %q with %q", pair, a[pair[0]], b[pair[1]])
+		}
+		if i > 0 && (pair[0] <= pairs[i-1][0] || pair[1] <= pairs[i-1][1]) {
+			t.Fatalf("pairs are not increasing: %v", pairs)
+		}
+	}
+	if len(pairs) != 4 {
+		t.Errorf("matched %d blocks, want 4: %v", len(pairs), pairs)
+	}
+}
@@ -0,0 +1,250 @@
+package revision
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/logger"
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// maxRevisionsPerDiary is the number of revisions kept for a single diary
+const maxRevisionsPerDiary = 100
+
+// Revision sources record why a snapshot was taken
+const (
+	SourceEdit    = "edit"
+	SourceRestore = "restore"
+)
+
+// RevisionService manages diary revision history
+type RevisionService struct {
+	app           *pocketbase.PocketBase
+	configService *config.ConfigService
+}
+
+// Revision represents a stored snapshot of a diary
+type Revision struct {
+	ID      string `json:"id"`
+	DiaryID string `json:"diary_id"`
+	Content string `json:"content,omitempty"`
+	Mood    string `json:"mood,omitempty"`
+	Weather string `json:"weather,omitempty"`
+	Source  string `json:"source"`
+	Words   int    `json:"words"`
+	Created string `json:"created"`
+}
+
+// NewRevisionService creates a new RevisionService
+func NewRevisionService(app *pocketbase.PocketBase) *RevisionService {
+	return &RevisionService{
+		app:           app,
+		configService: config.NewConfigService(app),
+	}
+}
+
+// SnapshotOnUpdate stores the previous state of an updated diary.
+// A save is coalesced when both the previous save and the latest revision fall within
+// the user's revision interval, so a burst of autosaves produces a single revision.
+// The first save after a restore is always snapshotted to keep the restored state, and so is
+// the state replaced by a write that carried its base version: another client may hold the same
+// version, and a conflicting write from it needs that version as the base of its merge.
+func (s *RevisionService) SnapshotOnUpdate(previous, current *models.Record, based bool) error {
+	if !contentChanged(previous, current) {
+		return nil
+	}
+	if based {
+		_, err := s.saveRevision(s.app.Dao(), previous, SourceEdit)
+		return err
+	}
+
+	userID := current.GetString("owner")
+	interval := s.revisionInterval(userID)
+
+	latest, err := s.app.Dao().FindRecordsByFilter(
+		"diary_revisions",
+		"diary = {:diary}",
+		"-created",
+		1,
+		0,
+		map[string]any{"diary": current.Id},
+	)
+	if err == nil && len(latest) > 0 &&
+		latest[0].GetString("source") != SourceRestore &&
+		time.Since(latest[0].Created.Time()) < interval &&
+		time.Since(previous.Updated.Time()) < interval {
+		logger.Debug("[RevisionService] coalescing save of diary %s into revision %s", current.Id, latest[0].Id)
+		return nil
+	}
+
+	_, err = s.saveRevision(s.app.Dao(), previous, SourceEdit)
+	return err
+}
+
+// Snapshot stores the current state of a diary unconditionally
+func (s *RevisionService) Snapshot(dao *daos.Dao, diary *models.Record) (*models.Record, error) {
+	return s.saveRevision(dao, diary, SourceEdit)
+}
+
+// List returns the revisions of a diary, newest first, without content
+func (s *RevisionService) List(diaryID string) ([]Revision, error) {
+	records, err := s.app.Dao().FindRecordsByFilter(
+		"diary_revisions",
+		"diary = {:diary}",
+		"-created",
+		-1,
+		0,
+		map[string]any{"diary": diaryID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch revisions: %w", err)
+	}
+
+	revisions := make([]Revision, 0, len(records))
+	for _, record := range records {
+		rev := toRevision(record)
+		rev.Content = ""
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+// Get returns a single revision of a diary including its content
+func (s *RevisionService) Get(diaryID, revisionID string) (*Revision, error) {
+	record, err := s.app.Dao().FindRecordById("diary_revisions", revisionID)
+	if err != nil {
+		return nil, fmt.Errorf("revision not found: %w", err)
+	}
+	if record.GetString("diary") != diaryID {
+		return nil, fmt.Errorf("revision %s does not belong to diary %s", revisionID, diaryID)
+	}
+	rev := toRevision(record)
+	return &rev, nil
+}
+
+// Restore replaces a diary's content, mood and weather with a revision.
+// The current state is snapshotted first so the restore itself can be undone.
+func (s *RevisionService) Restore(diary *models.Record, revisionID string) error {
+	rev, err := s.Get(diary.Id, revisionID)
+	if err != nil {
+		return err
+	}
+
+	return s.app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		if _, err := s.saveRevision(txDao, diary, SourceRestore); err != nil {
+			return err
+		}
+
+		diary.Set("content", rev.Content)
+		diary.Set("mood", rev.Mood)
+		diary.Set("weather", rev.Weather)
+		return txDao.SaveRecord(diary)
+	})
+}
+
+// BaseContent returns the content a diary had at an earlier version, identified by its
+// updated timestamp. It is taken from the revision of exactly that version, ok is false when
+// the history has none, e.g. when the save replacing it was coalesced.
+func (s *RevisionService) BaseContent(diaryID string, updated types.DateTime) (content string, ok bool) {
+	if updated.IsZero() {
+		return "", false
+	}
+	records, err := s.app.Dao().FindRecordsByFilter(
+		"diary_revisions",
+		"diary = {:diary} && version = {:version}",
+		"-created",
+		1,
+		0,
+		map[string]any{"diary": diaryID, "version": updated.String()},
+	)
+	if err != nil || len(records) == 0 {
+		return "", false
+	}
+	return records[0].GetString("content"), true
+}
+
+// MergeSuggestion merges a client's content, based on an outdated version of a diary,
+// with the diary's current content. See Merge3.
+func (s *RevisionService) MergeSuggestion(diary *models.Record, base types.DateTime, content string) MergeResult {
+	baseContent, _ := s.BaseContent(diary.Id, base)
+	return Merge3(baseContent, content, diary.GetString("content"))
+}
+
+// saveRevision writes a diary snapshot and prunes revisions beyond the limit
+func (s *RevisionService) saveRevision(dao *daos.Dao, diary *models.Record, source string) (*models.Record, error) {
+	collection, err := dao.FindCollectionByNameOrId("diary_revisions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find revisions collection: %w", err)
+	}
+
+	record := models.NewRecord(collection)
+	record.Set("diary", diary.Id)
+	record.Set("content", diary.GetString("content"))
+	record.Set("mood", diary.GetString("mood"))
+	record.Set("weather", diary.GetString("weather"))
+	record.Set("source", source)
+	record.Set("owner", diary.GetString("owner"))
+	record.Set("version", diary.GetDateTime("updated"))
+
+	if err := dao.SaveRecord(record); err != nil {
+		return nil, fmt.Errorf("failed to save revision: %w", err)
+	}
+
+	stale, err := dao.FindRecordsByFilter(
+		"diary_revisions",
+		"diary = {:diary}",
+		"-created",
+		-1,
+		maxRevisionsPerDiary,
+		map[string]any{"diary": diary.Id},
+	)
+	if err == nil {
+		for _, old := range stale {
+			if err := dao.DeleteRecord(old); err != nil {
+				logger.Warn("[RevisionService] failed to prune revision %s: %v", old.Id, err)
+			}
+		}
+	}
+
+	return record, nil
+}
+
+// revisionInterval returns the coalescing window configured for a user
+func (s *RevisionService) revisionInterval(userID string) time.Duration {
+	minutes, err := s.configService.GetInt(userID, "history.revisionInterval")
+	if err != nil || minutes < 0 {
+		minutes = 10
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// contentChanged reports whether a save touched the tracked fields
+func contentChanged(previous, current *models.Record) bool {
+	for _, field := range []string{"content", "mood", "weather"} {
+		if previous.GetString(field) != current.GetString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// toRevision converts a diary_revisions record
+func toRevision(record *models.Record) Revision {
+	content := record.GetString("content")
+	return Revision{
+		ID:      record.Id,
+		DiaryID: record.GetString("diary"),
+		Content: content,
+		Mood:    record.GetString("mood"),
+		Weather: record.GetString("weather"),
+		Source:  record.GetString("source"),
+		Words:   len(textutil.Words(textutil.StripHTML(content))),
+		Created: record.Created.String(),
+	}
+}
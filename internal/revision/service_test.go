@@ -0,0 +1,71 @@
+package revision
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/testapp"
+)
+
+// updateDiary changes the content of a diary like a save, returning the replaced and the new state
+func updateDiary(t *testing.T, app *pocketbase.PocketBase, id, content string) (previous, current *models.Record) {
+	t.Helper()
+	// updated has millisecond precision, keep versions apart
+	time.Sleep(5 * time.Millisecond)
+	current, err := app.Dao().FindRecordById("diaries", id)
+	if err != nil {
+		t.Fatalf("failed to load diary: %v", err)
+	}
+	previous = current.OriginalCopy()
+	current.Set("content", content)
+	if err := app.Dao().SaveRecord(current); err != nil {
+		t.Fatalf("failed to save diary: %v", err)
+	}
+	return previous, current
+}
+
+func TestBaseContentIsExact(t *testing.T) {
+	app := testapp.New(t)
+	user := testapp.User(t, app, "alice")
+	service := NewRevisionService(app)
+
+	diary := testapp.Record(t, app, "diaries", map[string]any{
+		"owner": user.Id, "date": "2024-03-01 00:00:00.000Z", "content": "<p>one</p>",
+	})
+	v1 := diary.GetDateTime("updated")
+
+	// A write carrying its base version always snapshots the replaced version
+	previous, current := updateDiary(t, app, diary.Id, "<p>two</p>")
+	if err := service.SnapshotOnUpdate(previous, current, true); err != nil {
+		t.Fatalf("SnapshotOnUpdate() = %v", err)
+	}
+	v2 := current.GetDateTime("updated")
+	previous, current = updateDiary(t, app, diary.Id, "<p>three</p>")
+	if err := service.SnapshotOnUpdate(previous, current, true); err != nil {
+		t.Fatalf("SnapshotOnUpdate() = %v", err)
+	}
+
+	if content, ok := service.BaseContent(diary.Id, v1); !ok || content != "<p>one</p>" {
+		t.Errorf("BaseContent(v1) = %q, %v", content, ok)
+	}
+	if content, ok := service.BaseContent(diary.Id, v2); !ok || content != "<p>two</p>" {
+		t.Errorf("BaseContent(v2) = %q, %v", content, ok)
+	}
+
+	// A write without a base version within the interval is coalesced, its version has no revision
+	v3 := current.GetDateTime("updated")
+	previous, current = updateDiary(t, app, diary.Id, "<p>four</p>")
+	if err := service.SnapshotOnUpdate(previous, current, false); err != nil {
+		t.Fatalf("SnapshotOnUpdate() = %v", err)
+	}
+	previous, current = updateDiary(t, app, diary.Id, "<p>five</p>")
+	if err := service.SnapshotOnUpdate(previous, current, true); err != nil {
+		t.Fatalf("SnapshotOnUpdate() = %v", err)
+	}
+	if content, ok := service.BaseContent(diary.Id, v3); ok {
+		t.Errorf("BaseContent(v3) = %q, want no base instead of a neighbouring version", content)
+	}
+}
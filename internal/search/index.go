@@ -0,0 +1,102 @@
+package search
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// ftsTable is the FTS5 virtual table holding the plain text of live diaries
+const ftsTable = "diaries_fts"
+
+// rebuildBatchSize is the number of diaries loaded at once when rebuilding the index
+const rebuildBatchSize = 500
+
+// CreateIndexSQL creates the full-text table.
+// Content is stored HTML-stripped with CJK characters pre-segmented, see textutil.SegmentCJK.
+const CreateIndexSQL = `CREATE VIRTUAL TABLE IF NOT EXISTS ` + ftsTable + ` USING fts5(
+	content,
+	diary_id UNINDEXED,
+	tokenize = 'unicode61 remove_diacritics 2'
+)`
+
+// DropIndexSQL removes the full-text table
+const DropIndexSQL = `DROP TABLE IF EXISTS ` + ftsTable
+
+// IndexDiary writes the current content of a diary into the full-text index.
+// Trashed diaries are removed from the index instead.
+func IndexDiary(dao *daos.Dao, diary *models.Record) error {
+	if err := RemoveDiary(dao, diary.Id); err != nil {
+		return err
+	}
+	if !diary.GetDateTime("deleted_at").IsZero() {
+		return nil
+	}
+	return insertDiary(dao, diary.Id, diary.GetString("content"))
+}
+
+// RemoveDiary deletes a diary from the full-text index
+func RemoveDiary(dao *daos.Dao, diaryID string) error {
+	_, err := dao.DB().
+		NewQuery("DELETE FROM " + ftsTable + " WHERE diary_id = {:id}").
+		Bind(dbx.Params{"id": diaryID}).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to remove diary %s from search index: %w", diaryID, err)
+	}
+	return nil
+}
+
+// Rebuild re-creates the full-text index from all live diaries and returns how many were indexed
+func Rebuild(dao *daos.Dao) (int, error) {
+	if _, err := dao.DB().NewQuery("DELETE FROM " + ftsTable).Execute(); err != nil {
+		return 0, fmt.Errorf("failed to clear search index: %w", err)
+	}
+
+	type diaryRow struct {
+		ID      string `db:"id"`
+		Content string `db:"content"`
+	}
+
+	indexed := 0
+	for offset := 0; ; offset += rebuildBatchSize {
+		rows := []diaryRow{}
+		err := dao.DB().
+			NewQuery("SELECT id, content FROM diaries WHERE deleted_at = '' ORDER BY rowid LIMIT {:limit} OFFSET {:offset}").
+			Bind(dbx.Params{"limit": rebuildBatchSize, "offset": offset}).
+			All(&rows)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to load diaries: %w", err)
+		}
+
+		for _, row := range rows {
+			if err := insertDiary(dao, row.ID, row.Content); err != nil {
+				return indexed, err
+			}
+			indexed++
+		}
+
+		if len(rows) < rebuildBatchSize {
+			return indexed, nil
+		}
+	}
+}
+
+// insertDiary adds the plain text of a diary to the full-text index
+func insertDiary(dao *daos.Dao, diaryID, content string) error {
+	_, err := dao.DB().
+		NewQuery("INSERT INTO " + ftsTable + " (content, diary_id) VALUES ({:content}, {:id})").
+		Bind(dbx.Params{
+			"content": textutil.SegmentCJK(textutil.StripHTML(content)),
+			"id":      diaryID,
+		}).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to index diary %s: %w", diaryID, err)
+	}
+	return nil
+}
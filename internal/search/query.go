@@ -0,0 +1,253 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+
+	"github.com/songtianlun/diarum/internal/dateutil"
+)
+
+// Query is a parsed structured search query, for example:
+//
+//	mood:happy weather:rain tag:work after:2024-01-01 before:2024-06-30 "exact phrase" -excluded
+//
+// Bare words match as prefixes, quoted text matches as an exact phrase and a leading '-'
+// excludes a word or phrase. after: and before: are inclusive dates.
+type Query struct {
+	Terms      []string `json:"terms,omitempty"`
+	Phrases    []string `json:"phrases,omitempty"`
+	Excluded   []string `json:"excluded,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Mood       string   `json:"mood,omitempty"`
+	NotMood    string   `json:"not_mood,omitempty"`
+	Weather    string   `json:"weather,omitempty"`
+	NotWeather string   `json:"not_weather,omitempty"`
+	After      string   `json:"after,omitempty"`
+	Before     string   `json:"before,omitempty"`
+}
+
+// ParseQuery parses the structured query language.
+// Unknown qualifiers are searched as plain text.
+func ParseQuery(input string) (*Query, error) {
+	q := &Query{}
+
+	for _, tok := range splitQuery(input) {
+		if tok.quoted {
+			if tok.negated {
+				q.Excluded = append(q.Excluded, tok.text)
+			} else {
+				q.Phrases = append(q.Phrases, tok.text)
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(tok.text, ":")
+		if found && value != "" {
+			handled, err := q.applyQualifier(strings.ToLower(key), value, tok.negated)
+			if err != nil {
+				return nil, err
+			}
+			if handled {
+				continue
+			}
+		}
+
+		if tok.negated {
+			q.Excluded = append(q.Excluded, tok.text)
+		} else {
+			q.Terms = append(q.Terms, tok.text)
+		}
+	}
+
+	if q.After != "" && q.Before != "" && q.After > q.Before {
+		return nil, fmt.Errorf("after:%s is later than before:%s", q.After, q.Before)
+	}
+	return q, nil
+}
+
+// applyQualifier stores a key:value pair, reporting false for unknown keys
+func (q *Query) applyQualifier(key, value string, negated bool) (bool, error) {
+	switch key {
+	case "mood":
+		if negated {
+			q.NotMood = value
+		} else {
+			q.Mood = value
+		}
+	case "weather":
+		if negated {
+			q.NotWeather = value
+		} else {
+			q.Weather = value
+		}
+	case "tag":
+		if negated {
+			return false, fmt.Errorf("excluding tags is not supported")
+		}
+		q.Tags = append(q.Tags, strings.TrimPrefix(value, "#"))
+	case "after", "before":
+		if negated {
+			return false, fmt.Errorf("%s: can't be negated", key)
+		}
+		if _, err := time.Parse(dateutil.DayLayout, value); err != nil {
+			return false, fmt.Errorf("%s: expects a date like 2024-01-31, got %q", key, value)
+		}
+		if key == "after" {
+			q.After = value
+		} else {
+			q.Before = value
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// IsEmpty reports whether the query has no conditions at all.
+// Words without letters or digits don't count as conditions.
+func (q *Query) IsEmpty() bool {
+	return q.Match() == "" && q.Exclude() == "" &&
+		len(q.Tags) == 0 && q.Mood == "" && q.NotMood == "" &&
+		q.Weather == "" && q.NotWeather == "" && q.After == "" && q.Before == ""
+}
+
+// Match returns the FTS5 query for the words and phrases that must appear
+func (q *Query) Match() string {
+	parts := make([]string, 0, len(q.Terms)+len(q.Phrases))
+	for _, term := range q.Terms {
+		if phrase := Phrase(term, true); phrase != "" {
+			parts = append(parts, phrase)
+		}
+	}
+	for _, text := range q.Phrases {
+		if phrase := Phrase(text, false); phrase != "" {
+			parts = append(parts, phrase)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Exclude returns the FTS5 query matching diaries that must be left out
+func (q *Query) Exclude() string {
+	parts := make([]string, 0, len(q.Excluded))
+	for _, text := range q.Excluded {
+		if phrase := Phrase(text, false); phrase != "" {
+			parts = append(parts, phrase)
+		}
+	}
+	return strings.Join(parts, " OR ")
+}
+
+// Filter compiles the non-text conditions into a PocketBase filter on the user's live diaries
+func (q *Query) Filter(userID string) (string, dbx.Params) {
+	filter := "owner = {:owner} && deleted_at = ''"
+	params := dbx.Params{"owner": userID}
+
+	if q.Mood != "" {
+		filter += " && mood = {:mood}"
+		params["mood"] = q.Mood
+	}
+	if q.NotMood != "" {
+		filter += " && mood != {:notMood}"
+		params["notMood"] = q.NotMood
+	}
+	if q.Weather != "" {
+		filter += " && weather = {:weather}"
+		params["weather"] = q.Weather
+	}
+	if q.NotWeather != "" {
+		filter += " && weather != {:notWeather}"
+		params["notWeather"] = q.NotWeather
+	}
+	for i, tag := range q.Tags {
+		key := fmt.Sprintf("tag%d", i)
+		filter += " && tags.name ?= {:" + key + "}"
+		params[key] = tag
+	}
+	if q.After != "" {
+		filter += " && date >= {:after}"
+		params["after"] = dateutil.DayStart(q.After)
+	}
+	if q.Before != "" {
+		filter += " && date <= {:before}"
+		params["before"] = dateutil.DayEnd(q.Before)
+	}
+
+	return filter, params
+}
+
+// Options builds search options for the user's diaries
+func (q *Query) Options(userID string) Options {
+	filter, params := q.Filter(userID)
+	return Options{
+		Match:   q.Match(),
+		Exclude: q.Exclude(),
+		Filter:  filter,
+		Params:  params,
+	}
+}
+
+// queryToken is a word or quoted phrase of the query input
+type queryToken struct {
+	text    string
+	quoted  bool
+	negated bool
+}
+
+// splitQuery splits the input on whitespace, keeping quoted phrases together.
+// Quotes may also follow a qualifier, as in tag:"side project".
+func splitQuery(input string) []queryToken {
+	tokens := make([]queryToken, 0)
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		if i >= len(runes) {
+			break
+		}
+
+		tok := queryToken{}
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			tok.negated = true
+			i++
+		}
+
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			tok.text = string(runes[i+1 : end])
+			tok.quoted = true
+			i = end + 1
+		} else {
+			var sb strings.Builder
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				if runes[i] == '"' {
+					// key:"quoted value"
+					end := i + 1
+					for end < len(runes) && runes[end] != '"' {
+						end++
+					}
+					sb.WriteString(string(runes[i+1 : end]))
+					i = end + 1
+					continue
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			tok.text = sb.String()
+		}
+
+		if strings.TrimSpace(tok.text) != "" {
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,143 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Query
+	}{
+		{"", Query{}},
+		{"walk park", Query{Terms: []string{"walk", "park"}}},
+		{`"exact phrase" -excluded`, Query{Phrases: []string{"exact phrase"}, Excluded: []string{"excluded"}}},
+		{`-"not this"`, Query{Excluded: []string{"not this"}}},
+		{
+			"mood:happy weather:rain tag:work tag:#home after:2024-01-01 before:2024-06-30",
+			Query{Mood: "happy", Weather: "rain", Tags: []string{"work", "home"}, After: "2024-01-01", Before: "2024-06-30"},
+		},
+		{"-mood:sad -weather:rain", Query{NotMood: "sad", NotWeather: "rain"}},
+		{`tag:"side project" 旅行`, Query{Tags: []string{"side project"}, Terms: []string{"旅行"}}},
+		{"Mood:calm", Query{Mood: "calm"}},
+		{"http://example.com well-known", Query{Terms: []string{"http://example.com", "well-known"}}},
+		{"mood: - ", Query{Terms: []string{"mood:", "-"}}},
+		{`"unclosed phrase`, Query{Phrases: []string{"unclosed phrase"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseQuery(tt.input)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.input, *got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []string{
+		"after:yesterday",
+		"before:2024-13-01",
+		"after:2024-06-01 before:2024-01-01",
+		"-tag:work",
+		"-after:2024-01-01",
+	}
+
+	for _, input := range tests {
+		if _, err := ParseQuery(input); err == nil {
+			t.Errorf("ParseQuery(%q) expected an error", input)
+		}
+	}
+}
+
+func TestQueryMatchAndExclude(t *testing.T) {
+	sep := textutil.SegmentSeparator
+	tests := []struct {
+		input   string
+		match   string
+		exclude string
+	}{
+		{"", "", ""},
+		{"!!! ...", "", ""},
+		{"walk park", `"walk"* "park"*`, ""},
+		{`"exact phrase"`, `"exact phrase"`, ""},
+		{`say "hi there"`, `"say"* "hi there"`, ""},
+		{`a"b`, `"ab"*`, ""},
+		{"天气 -rain -\"bad day\"", `"天` + sep + `气"*`, `"rain" OR "bad day"`},
+		{"mood:happy", "", ""},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.input)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error: %v", tt.input, err)
+		}
+		if got := q.Match(); got != tt.match {
+			t.Errorf("Match(%q) = %q, want %q", tt.input, got, tt.match)
+		}
+		if got := q.Exclude(); got != tt.exclude {
+			t.Errorf("Exclude(%q) = %q, want %q", tt.input, got, tt.exclude)
+		}
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	q, err := ParseQuery("mood:happy -weather:rain tag:work tag:home after:2024-01-01 before:2024-06-30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter, params := q.Filter("user1")
+	wantFilter := "owner = {:owner} && deleted_at = '' && mood = {:mood} && weather != {:notWeather}" +
+		" && tags.name ?= {:tag0} && tags.name ?= {:tag1} && date >= {:after} && date <= {:before}"
+	if filter != wantFilter {
+		t.Errorf("filter = %q, want %q", filter, wantFilter)
+	}
+
+	wantParams := map[string]any{
+		"owner":      "user1",
+		"mood":       "happy",
+		"notWeather": "rain",
+		"tag0":       "work",
+		"tag1":       "home",
+		"after":      "2024-01-01 00:00:00.000Z",
+		"before":     "2024-06-30 23:59:59.999Z",
+	}
+	for key, want := range wantParams {
+		if params[key] != want {
+			t.Errorf("params[%q] = %v, want %v", key, params[key], want)
+		}
+	}
+	if len(params) != len(wantParams) {
+		t.Errorf("params has %d entries, want %d", len(params), len(wantParams))
+	}
+}
+
+func TestQueryIsEmpty(t *testing.T) {
+	tests := map[string]bool{
+		"":                  true,
+		"   ":               true,
+		"...":               true,
+		"word":              false,
+		"-word":             false,
+		"tag:work":          false,
+		"mood:happy":        false,
+		"before:2024-01-01": false,
+	}
+
+	for input, want := range tests {
+		q, err := ParseQuery(input)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error: %v", input, err)
+		}
+		if got := q.IsEmpty(); got != want {
+			t.Errorf("IsEmpty(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
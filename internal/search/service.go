@@ -0,0 +1,175 @@
+package search
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/resolvers"
+	pbsearch "github.com/pocketbase/pocketbase/tools/search"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// Snippet highlight markers, private use characters that can't appear in diary text
+const (
+	markStart = "\ue000"
+	markEnd   = "\ue001"
+)
+
+// snippetTokens is the length of a snippet in tokens, a CJK character is one token
+const snippetTokens = 40
+
+// plainSnippetChars is the length in characters of a snippet without highlights
+const plainSnippetChars = 120
+
+// SearchService runs full-text queries against the diary index
+type SearchService struct {
+	app *pocketbase.PocketBase
+}
+
+// Options describes a diary search
+type Options struct {
+	// Match is an FTS5 query the diaries must match, see Query.Match.
+	// Without it diaries are listed by date and snippets show their beginning.
+	Match string
+	// Exclude is an FTS5 query the diaries must not match
+	Exclude string
+	// Filter is a PocketBase filter on the diaries collection, e.g. owner and tag conditions
+	Filter string
+	Params dbx.Params
+	// SortByDate orders by date instead of relevance
+	SortByDate bool
+	Limit      int
+	Offset     int
+}
+
+// Hit is a single matching diary
+type Hit struct {
+	ID   string `db:"id" json:"id"`
+	Date string `db:"date" json:"date"`
+	// Score is the BM25 score, lower is more relevant
+	Score   float64 `db:"score" json:"score"`
+	Snippet string  `db:"snippet" json:"snippet"`
+}
+
+// NewSearchService creates a new SearchService
+func NewSearchService(app *pocketbase.PocketBase) *SearchService {
+	return &SearchService{app: app}
+}
+
+// Search returns the diaries matching opts ranked by BM25, plus the total number of matches.
+// Snippets are HTML-escaped with matches wrapped in <mark>.
+func (s *SearchService) Search(opts Options) ([]Hit, int, error) {
+	dao := s.app.Dao()
+	collection, err := dao.FindCollectionByNameOrId("diaries")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Compile the PocketBase filter into a subquery of matching diary IDs
+	resolver := resolvers.NewRecordFieldResolver(dao, collection, nil, true)
+	expr, err := pbsearch.FilterData(opts.Filter).BuildExpr(resolver, opts.Params)
+	if err != nil || expr == nil {
+		return nil, 0, fmt.Errorf("invalid search filter: %w", err)
+	}
+	idQuery := dao.DB().Select("diaries.id").From("diaries").AndWhere(expr)
+	resolver.UpdateQuery(idQuery)
+	built := idQuery.Build()
+
+	params := dbx.Params{
+		"ftsMatch":     opts.Match,
+		"ftsExclude":   opts.Exclude,
+		"ftsMarkStart": markStart,
+		"ftsMarkEnd":   markEnd,
+	}
+	for key, value := range built.Params() {
+		params[key] = value
+	}
+
+	from := " FROM diaries JOIN " + ftsTable + " ON " + ftsTable + ".diary_id = diaries.id"
+	columns := fmt.Sprintf("0 AS score, substr(%s.content, 1, %d) AS snippet", ftsTable, plainSnippetChars*3)
+	where := " WHERE diaries.id IN (" + built.SQL() + ")"
+	order := " ORDER BY diaries.date DESC"
+
+	if opts.Match != "" {
+		where += " AND " + ftsTable + " MATCH {:ftsMatch}"
+		columns = fmt.Sprintf("bm25(%[1]s) AS score, snippet(%[1]s, 0, {:ftsMarkStart}, {:ftsMarkEnd}, '…', %[2]d) AS snippet",
+			ftsTable, snippetTokens)
+		if !opts.SortByDate {
+			order = " ORDER BY score, diaries.date DESC"
+		}
+	}
+
+	if opts.Exclude != "" {
+		where += " AND diaries.id NOT IN (SELECT diary_id FROM " + ftsTable + " WHERE " + ftsTable + " MATCH {:ftsExclude})"
+	}
+
+	var total int
+	if err := dao.DB().NewQuery("SELECT COUNT(*)" + from + where).Bind(params).Row(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	params["ftsLimit"] = limit
+	params["ftsOffset"] = opts.Offset
+
+	hits := []Hit{}
+	err = dao.DB().NewQuery("SELECT diaries.id AS id, diaries.date AS date, " + columns + from + where + order +
+		" LIMIT {:ftsLimit} OFFSET {:ftsOffset}").
+		Bind(params).
+		All(&hits)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search diaries: %w", err)
+	}
+
+	for i := range hits {
+		if opts.Match != "" {
+			hits[i].Snippet = formatSnippet(hits[i].Snippet)
+		} else {
+			hits[i].Snippet = plainSnippet(hits[i].Snippet)
+		}
+		if len(hits[i].Date) >= 10 {
+			hits[i].Date = hits[i].Date[:10]
+		}
+	}
+	return hits, total, nil
+}
+
+// Phrase quotes text as a single FTS5 phrase, optionally matching the last token as a prefix.
+// Returns "" when the text contains no letters or digits.
+func Phrase(text string, prefix bool) string {
+	if strings.IndexFunc(text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+		return ""
+	}
+	phrase := `"` + strings.ReplaceAll(textutil.SegmentCJK(text), `"`, `""`) + `"`
+	if prefix {
+		phrase += "*"
+	}
+	return phrase
+}
+
+// plainSnippet escapes the beginning of indexed text, cutting on a character boundary
+func plainSnippet(raw string) string {
+	text := strings.ReplaceAll(raw, textutil.SegmentSeparator, "")
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > plainSnippetChars {
+		text = strings.TrimSpace(string(runes[:plainSnippetChars])) + "…"
+	}
+	return html.EscapeString(text)
+}
+
+// formatSnippet escapes a raw FTS5 snippet and turns the highlight markers into <mark> tags
+func formatSnippet(raw string) string {
+	text := strings.ReplaceAll(raw, textutil.SegmentSeparator, "")
+	text = strings.Join(strings.Fields(text), " ")
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, markStart, "<mark>")
+	return strings.ReplaceAll(text, markEnd, "</mark>")
+}
@@ -0,0 +1,27 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+func TestFormatSnippet(t *testing.T) {
+	sep := textutil.SegmentSeparator
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"plain  text\nhere", "plain text here"},
+		{"a " + markStart + "match" + markEnd + " b", "a <mark>match</mark> b"},
+		{"今" + sep + markStart + "天" + sep + "气" + markEnd + sep + "好", "今<mark>天气</mark>好"},
+		{"<script> & " + markStart + "x" + markEnd, "&lt;script&gt; &amp; <mark>x</mark>"},
+	}
+
+	for _, tt := range tests {
+		if got := formatSnippet(tt.raw); got != tt.want {
+			t.Errorf("formatSnippet(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
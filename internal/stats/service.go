@@ -0,0 +1,155 @@
+package stats
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/logger"
+)
+
+// loadBatchSize is the number of diaries loaded at once when computing statistics
+const loadBatchSize = 500
+
+// cache holds computed reports per user until one of the user's diaries or media changes.
+// Reports are keyed by period and by today's date, so streaks roll over at midnight.
+var cache = struct {
+	sync.Mutex
+	reports map[string]map[string]*Stats
+}{reports: map[string]map[string]*Stats{}}
+
+// Invalidate drops the cached reports of a user
+func Invalidate(userID string) {
+	cache.Lock()
+	delete(cache.reports, userID)
+	cache.Unlock()
+}
+
+// InvalidateRecord drops the cached reports of the owner of a diary or media record
+func InvalidateRecord(model models.Model) {
+	if record, ok := model.(*models.Record); ok {
+		Invalidate(record.GetString("owner"))
+	}
+}
+
+// StatsService computes writing statistics
+type StatsService struct {
+	app *pocketbase.PocketBase
+}
+
+// NewStatsService creates a new StatsService
+func NewStatsService(app *pocketbase.PocketBase) *StatsService {
+	return &StatsService{app: app}
+}
+
+// Get returns the statistics of a user, computing them on a cache miss.
+// loc is the user's timezone, period the grouping of the per-period statistics.
+func (s *StatsService) Get(userID string, loc *time.Location, period string) (*Stats, error) {
+	if !ValidPeriod(period) {
+		return nil, fmt.Errorf("unsupported period %q", period)
+	}
+
+	today := dateutil.Today(loc)
+	key := period + "|" + today
+
+	cache.Lock()
+	if report, ok := cache.reports[userID][key]; ok {
+		cache.Unlock()
+		return report, nil
+	}
+	cache.Unlock()
+
+	start := time.Now()
+	entries, err := loadEntries(s.app.Dao(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := Compute(entries, today, period)
+	if report.Media, err = loadMedia(s.app.Dao(), userID); err != nil {
+		return nil, err
+	}
+	report.ComputedAt = time.Now().UTC().Format(time.RFC3339)
+	logger.Debug("[Stats] computed statistics of %d diaries for user %s in %s", len(entries), userID, time.Since(start))
+
+	cache.Lock()
+	if cache.reports[userID] == nil {
+		cache.reports[userID] = map[string]*Stats{}
+	}
+	cache.reports[userID][key] = report
+	cache.Unlock()
+
+	return report, nil
+}
+
+// loadEntries counts the words of all live diaries of a user, loading them in batches
+func loadEntries(dao *daos.Dao, userID string) ([]Entry, error) {
+	type diaryRow struct {
+		Date    string `db:"date"`
+		Mood    string `db:"mood"`
+		Weather string `db:"weather"`
+		Content string `db:"content"`
+	}
+
+	entries := make([]Entry, 0)
+	for offset := 0; ; offset += loadBatchSize {
+		rows := []diaryRow{}
+		err := dao.DB().
+			NewQuery("SELECT date, mood, weather, content FROM diaries WHERE owner = {:owner} AND deleted_at = '' ORDER BY date, id LIMIT {:limit} OFFSET {:offset}").
+			Bind(dbx.Params{"owner": userID, "limit": loadBatchSize, "offset": offset}).
+			All(&rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load diaries: %w", err)
+		}
+
+		for _, row := range rows {
+			entries = append(entries, NewEntry(dateutil.DayOf(row.Date), row.Mood, row.Weather, row.Content))
+		}
+
+		if len(rows) < loadBatchSize {
+			return entries, nil
+		}
+	}
+}
+
+// loadMedia counts the live media of a user by attachment and file type
+func loadMedia(dao *daos.Dao, userID string) (Media, error) {
+	type mediaRow struct {
+		File  string `db:"file"`
+		Diary string `db:"diary"`
+	}
+
+	rows := []mediaRow{}
+	err := dao.DB().
+		NewQuery("SELECT file, diary FROM media WHERE owner = {:owner} AND deleted_at = ''").
+		Bind(dbx.Params{"owner": userID}).
+		All(&rows)
+	if err != nil {
+		return Media{}, fmt.Errorf("failed to load media: %w", err)
+	}
+
+	media := Media{Total: len(rows), ByType: map[string]int{}}
+	for _, row := range rows {
+		// diary is a multi relation stored as a JSON array
+		if row.Diary != "" && row.Diary != "[]" {
+			media.Attached++
+		} else {
+			media.Unattached++
+		}
+
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(row.File)), ".")
+		if ext == "" {
+			ext = "other"
+		}
+		media.ByType[ext]++
+	}
+	return media, nil
+}
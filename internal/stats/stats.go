@@ -0,0 +1,279 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"unicode"
+
+	"github.com/songtianlun/diarum/internal/dateutil"
+	"github.com/songtianlun/diarum/internal/textutil"
+)
+
+// Periods supported for grouping statistics over time
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodYear  = "year"
+)
+
+// heatmapDays is the number of days covered by the calendar heatmap, ending today
+const heatmapDays = 365
+
+// Entry is the input of Compute, a single diary entry
+type Entry struct {
+	Day     string
+	Mood    string
+	Weather string
+	Words   int
+	Chars   int
+}
+
+// NewEntry counts the words and characters of a diary's HTML content.
+// CJK characters count as one word each, characters exclude whitespace.
+func NewEntry(day, mood, weather, content string) Entry {
+	text := textutil.StripHTML(content)
+	chars := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			chars++
+		}
+	}
+	return Entry{
+		Day:     day,
+		Mood:    mood,
+		Weather: weather,
+		Words:   len(textutil.Words(text)),
+		Chars:   chars,
+	}
+}
+
+// Streak is a run of consecutive days with at least one entry
+type Streak struct {
+	Days  int    `json:"days"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// Counts sums up words or characters
+type Counts struct {
+	Total    int     `json:"total"`
+	PerEntry float64 `json:"per_entry"`
+	Max      int     `json:"max"`
+}
+
+// Period holds the statistics of one week, month or year
+type Period struct {
+	Period  string         `json:"period"`
+	Entries int            `json:"entries"`
+	Days    int            `json:"days"`
+	Words   int            `json:"words"`
+	Chars   int            `json:"chars"`
+	Moods   map[string]int `json:"moods"`
+	Weather map[string]int `json:"weather"`
+}
+
+// HeatmapDay is a day with entries in the calendar heatmap
+type HeatmapDay struct {
+	Date    string `json:"date"`
+	Entries int    `json:"entries"`
+	Words   int    `json:"words"`
+}
+
+// Media counts the user's media files
+type Media struct {
+	Total      int            `json:"total"`
+	Attached   int            `json:"attached"`
+	Unattached int            `json:"unattached"`
+	ByType     map[string]int `json:"by_type"`
+}
+
+// Stats is the writing statistics report of a user
+type Stats struct {
+	Total         int    `json:"total"`
+	Days          int    `json:"days"`
+	CurrentStreak Streak `json:"current_streak"`
+	LongestStreak Streak `json:"longest_streak"`
+	Words         Counts `json:"words"`
+	Chars         Counts `json:"chars"`
+	// FirstDate and LastDate are the days of the oldest and newest entries
+	FirstDate string `json:"first_date,omitempty"`
+	LastDate  string `json:"last_date,omitempty"`
+	// PeriodType is the grouping of Periods: week, month or year
+	PeriodType string   `json:"period_type"`
+	Periods    []Period `json:"periods"`
+	// Heatmap lists the days with entries in the last year, oldest first
+	Heatmap []HeatmapDay `json:"heatmap"`
+	// Weekdays counts entries by weekday, index 0 is Sunday
+	Weekdays [7]int         `json:"weekdays"`
+	Moods    map[string]int `json:"moods"`
+	Weather  map[string]int `json:"weather"`
+	Media    Media          `json:"media"`
+	// ComputedAt is when the report was built, it is served from cache until a diary or media changes
+	ComputedAt string `json:"computed_at"`
+}
+
+// ValidPeriod reports whether period is a supported grouping
+func ValidPeriod(period string) bool {
+	return period == PeriodWeek || period == PeriodMonth || period == PeriodYear
+}
+
+// Compute builds the report from all entries of a user.
+// today is the current calendar day in the user's timezone.
+func Compute(entries []Entry, today, period string) *Stats {
+	s := &Stats{
+		Total:      len(entries),
+		PeriodType: period,
+		Periods:    []Period{},
+		Heatmap:    []HeatmapDay{},
+		Moods:      map[string]int{},
+		Weather:    map[string]int{},
+		Media:      Media{ByType: map[string]int{}},
+	}
+
+	days := map[string]*HeatmapDay{}
+	periods := map[string]*Period{}
+	periodDays := map[string]map[string]bool{}
+
+	for _, e := range entries {
+		day, ok := days[e.Day]
+		if !ok {
+			day = &HeatmapDay{Date: e.Day}
+			days[e.Day] = day
+		}
+		day.Entries++
+		day.Words += e.Words
+
+		s.Words.Total += e.Words
+		s.Chars.Total += e.Chars
+		if e.Words > s.Words.Max {
+			s.Words.Max = e.Words
+		}
+		if e.Chars > s.Chars.Max {
+			s.Chars.Max = e.Chars
+		}
+
+		if t, err := time.Parse(dateutil.DayLayout, e.Day); err == nil {
+			s.Weekdays[t.Weekday()]++
+		}
+		if e.Mood != "" {
+			s.Moods[e.Mood]++
+		}
+		if e.Weather != "" {
+			s.Weather[e.Weather]++
+		}
+
+		key := periodKey(e.Day, period)
+		p, ok := periods[key]
+		if !ok {
+			p = &Period{Period: key, Moods: map[string]int{}, Weather: map[string]int{}}
+			periods[key] = p
+			periodDays[key] = map[string]bool{}
+		}
+		p.Entries++
+		p.Words += e.Words
+		p.Chars += e.Chars
+		if e.Mood != "" {
+			p.Moods[e.Mood]++
+		}
+		if e.Weather != "" {
+			p.Weather[e.Weather]++
+		}
+		periodDays[key][e.Day] = true
+	}
+
+	if s.Total > 0 {
+		s.Words.PerEntry = round1(float64(s.Words.Total) / float64(s.Total))
+		s.Chars.PerEntry = round1(float64(s.Chars.Total) / float64(s.Total))
+	}
+
+	sortedDays := make([]string, 0, len(days))
+	for day := range days {
+		sortedDays = append(sortedDays, day)
+	}
+	sort.Strings(sortedDays)
+	s.Days = len(sortedDays)
+	if s.Days > 0 {
+		s.FirstDate = sortedDays[0]
+		s.LastDate = sortedDays[len(sortedDays)-1]
+	}
+
+	s.LongestStreak, s.CurrentStreak = streaks(sortedDays, today)
+
+	heatmapStart := ""
+	if t, err := time.Parse(dateutil.DayLayout, today); err == nil {
+		heatmapStart = t.AddDate(0, 0, -(heatmapDays - 1)).Format(dateutil.DayLayout)
+	}
+	for _, day := range sortedDays {
+		if day >= heatmapStart && day <= today {
+			s.Heatmap = append(s.Heatmap, *days[day])
+		}
+	}
+
+	for key, p := range periods {
+		p.Days = len(periodDays[key])
+		s.Periods = append(s.Periods, *p)
+	}
+	sort.Slice(s.Periods, func(i, j int) bool { return s.Periods[i].Period < s.Periods[j].Period })
+
+	return s
+}
+
+// streaks finds the longest run of consecutive days and the run ending today or yesterday.
+// days must be sorted and unique, days after today are ignored.
+func streaks(days []string, today string) (longest, current Streak) {
+	var run Streak
+	var prev time.Time
+
+	for _, day := range days {
+		t, err := time.Parse(dateutil.DayLayout, day)
+		if err != nil || day > today {
+			continue
+		}
+		if run.Days > 0 && t.Equal(prev.AddDate(0, 0, 1)) {
+			run.Days++
+			run.End = day
+		} else {
+			run = Streak{Days: 1, Start: day, End: day}
+		}
+		if run.Days > longest.Days {
+			longest = run
+		}
+		prev = t
+	}
+
+	// The current streak is still alive when the last entry is today or yesterday
+	if t, err := time.Parse(dateutil.DayLayout, today); err == nil && run.Days > 0 {
+		yesterday := t.AddDate(0, 0, -1).Format(dateutil.DayLayout)
+		if run.End == today || run.End == yesterday {
+			current = run
+		}
+	}
+	return longest, current
+}
+
+// periodKey returns the period a day belongs to: "2026-W05", "2026-01" or "2026"
+func periodKey(day, period string) string {
+	switch period {
+	case PeriodWeek:
+		t, err := time.Parse(dateutil.DayLayout, day)
+		if err != nil {
+			return day
+		}
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case PeriodYear:
+		if len(day) >= 4 {
+			return day[:4]
+		}
+	default:
+		if len(day) >= 7 {
+			return day[:7]
+		}
+	}
+	return day
+}
+
+func round1(v float64) float64 {
+	return float64(int(v*10+0.5)) / 10
+}
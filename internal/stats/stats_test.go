@@ -0,0 +1,97 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewEntryCountsCJK(t *testing.T) {
+	e := NewEntry("2026-01-28", "", "", "<p>今天天气 good, really good.</p>")
+	if e.Words != 7 {
+		t.Errorf("Words = %d, want 7", e.Words)
+	}
+	if e.Chars != 20 {
+		t.Errorf("Chars = %d, want 20", e.Chars)
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	days := []string{"2026-01-01", "2026-01-02", "2026-01-03", "2026-01-10", "2026-01-11", "2026-02-01"}
+
+	tests := []struct {
+		name    string
+		days    []string
+		today   string
+		longest Streak
+		current Streak
+	}{
+		{"alive today", append(days, "2026-02-02"), "2026-02-02",
+			Streak{3, "2026-01-01", "2026-01-03"}, Streak{2, "2026-02-01", "2026-02-02"}},
+		{"alive yesterday", days, "2026-02-02",
+			Streak{3, "2026-01-01", "2026-01-03"}, Streak{1, "2026-02-01", "2026-02-01"}},
+		{"broken", days, "2026-02-05",
+			Streak{3, "2026-01-01", "2026-01-03"}, Streak{}},
+		{"future days ignored", []string{"2026-01-01", "2026-01-02", "2026-03-01"}, "2026-01-02",
+			Streak{2, "2026-01-01", "2026-01-02"}, Streak{2, "2026-01-01", "2026-01-02"}},
+		{"empty", nil, "2026-01-01", Streak{}, Streak{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			longest, current := streaks(tt.days, tt.today)
+			if longest != tt.longest || current != tt.current {
+				t.Errorf("streaks() = %+v, %+v, want %+v, %+v", longest, current, tt.longest, tt.current)
+			}
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	entries := []Entry{
+		{Day: "2025-12-31", Mood: "sad", Words: 10, Chars: 40},
+		{Day: "2026-01-01", Mood: "happy", Weather: "sunny", Words: 20, Chars: 60},
+		{Day: "2026-01-01", Mood: "happy", Words: 30, Chars: 80},
+	}
+
+	s := Compute(entries, "2026-01-02", PeriodMonth)
+
+	if s.Total != 3 || s.Days != 2 {
+		t.Errorf("Total, Days = %d, %d, want 3, 2", s.Total, s.Days)
+	}
+	if s.Words.Total != 60 || s.Words.Max != 30 || s.Words.PerEntry != 20 {
+		t.Errorf("Words = %+v", s.Words)
+	}
+	if s.CurrentStreak.Days != 2 || s.LongestStreak.Days != 2 {
+		t.Errorf("streaks = %+v, %+v, want 2 days", s.CurrentStreak, s.LongestStreak)
+	}
+	if !reflect.DeepEqual(s.Moods, map[string]int{"sad": 1, "happy": 2}) {
+		t.Errorf("Moods = %v", s.Moods)
+	}
+	// 2025-12-31 is a Wednesday, 2026-01-01 a Thursday
+	if s.Weekdays[3] != 1 || s.Weekdays[4] != 2 {
+		t.Errorf("Weekdays = %v", s.Weekdays)
+	}
+	if len(s.Periods) != 2 || s.Periods[0].Period != "2025-12" || s.Periods[1].Entries != 2 || s.Periods[1].Days != 1 {
+		t.Errorf("Periods = %+v", s.Periods)
+	}
+	if len(s.Heatmap) != 2 || s.Heatmap[1] != (HeatmapDay{Date: "2026-01-01", Entries: 2, Words: 50}) {
+		t.Errorf("Heatmap = %+v", s.Heatmap)
+	}
+}
+
+func TestPeriodKey(t *testing.T) {
+	tests := []struct {
+		day, period, want string
+	}{
+		{"2026-01-28", PeriodMonth, "2026-01"},
+		{"2026-01-28", PeriodYear, "2026"},
+		{"2026-01-28", PeriodWeek, "2026-W05"},
+		{"2027-01-01", PeriodWeek, "2026-W53"},
+	}
+
+	for _, tt := range tests {
+		if got := periodKey(tt.day, tt.period); got != tt.want {
+			t.Errorf("periodKey(%s, %s) = %s, want %s", tt.day, tt.period, got, tt.want)
+		}
+	}
+}
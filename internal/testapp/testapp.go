@@ -0,0 +1,80 @@
+// Package testapp creates PocketBase apps with the diarum schema, for tests of the services and routes
+package testapp
+
+import (
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/migrations/logs"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/migrate"
+
+	_ "github.com/songtianlun/diarum/internal/migrations"
+)
+
+// New returns an app whose database, in a temporary directory, has every migration applied.
+// It is closed when the test ends.
+func New(t testing.TB) *pocketbase.PocketBase {
+	t.Helper()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("failed to bootstrap app: %v", err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+
+	// The search index needs FTS5, which cgo builds of SQLite only include with the sqlite_fts5 tag
+	if _, err := app.DB().NewQuery("CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x)").Execute(); err != nil {
+		t.Skipf("SQLite lacks FTS5, run the tests with -tags sqlite_fts5: %v", err)
+	}
+
+	for _, run := range []struct {
+		db   *dbx.DB
+		list migrate.MigrationsList
+	}{
+		{app.DB(), m.AppMigrations},
+		{app.LogsDB(), logs.LogsMigrations},
+	} {
+		runner, err := migrate.NewRunner(run.db, run.list)
+		if err != nil {
+			t.Fatalf("failed to create migration runner: %v", err)
+		}
+		if _, err := runner.Up(); err != nil {
+			t.Fatalf("failed to apply migrations: %v", err)
+		}
+	}
+	return app
+}
+
+// User creates a user with the given username, the email is <username>@example.com
+func User(t testing.TB, app *pocketbase.PocketBase, username string) *models.Record {
+	t.Helper()
+	collection, err := app.Dao().FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("failed to find users collection: %v", err)
+	}
+	user := models.NewRecord(collection)
+	user.SetUsername(username)
+	user.SetEmail(username + "@example.com")
+	user.SetPassword("password123")
+	if err := app.Dao().SaveRecord(user); err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+// Record creates a record of a collection with the given fields
+func Record(t testing.TB, app *pocketbase.PocketBase, collection string, data map[string]any) *models.Record {
+	t.Helper()
+	c, err := app.Dao().FindCollectionByNameOrId(collection)
+	if err != nil {
+		t.Fatalf("failed to find collection %s: %v", collection, err)
+	}
+	record := models.NewRecord(c)
+	record.Load(data)
+	if err := app.Dao().SaveRecord(record); err != nil {
+		t.Fatalf("failed to create %s record: %v", collection, err)
+	}
+	return record
+}
@@ -0,0 +1,64 @@
+package textutil
+
+import (
+	"strings"
+	"unicode"
+)
+
+// IsCJK reports whether r is a Chinese, Japanese or Korean character.
+// These scripts don't separate words with spaces, so each rune counts as a word.
+func IsCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Words splits text into word tokens.
+// Latin words are runs of letters and digits, CJK characters are single tokens.
+func Words(text string) []string {
+	words := make([]string, 0)
+	start := -1
+	for i, r := range text {
+		switch {
+		case IsCJK(r):
+			if start >= 0 {
+				words = append(words, text[start:i])
+				start = -1
+			}
+			words = append(words, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '_':
+			if start < 0 {
+				start = i
+			}
+		default:
+			if start >= 0 {
+				words = append(words, text[start:i])
+				start = -1
+			}
+		}
+	}
+	if start >= 0 {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// SegmentSeparator is placed around CJK characters before full-text indexing.
+// A zero-width space is a separator for the FTS5 unicode61 tokenizer and
+// stays invisible if it ends up in a displayed snippet.
+const SegmentSeparator = "\u200b"
+
+// SegmentCJK separates every CJK character so a word tokenizer indexes it on its own
+func SegmentCJK(text string) string {
+	var sb strings.Builder
+	sb.Grow(len(text) + len(text)/2)
+
+	prevCJK := false
+	for i, r := range text {
+		cjk := IsCJK(r)
+		if i > 0 && (cjk || prevCJK) {
+			sb.WriteString(SegmentSeparator)
+		}
+		sb.WriteRune(r)
+		prevCJK = cjk
+	}
+	return sb.String()
+}
@@ -0,0 +1,72 @@
+package textutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsCJK(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want bool
+	}{
+		{'a', false},
+		{'1', false},
+		{'中', true},
+		{'あ', true},
+		{'カ', true},
+		{'한', true},
+		{'。', false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCJK(tt.r); got != tt.want {
+			t.Errorf("IsCJK(%q) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"hello world", []string{"hello", "world"}},
+		{"don't stop", []string{"don't", "stop"}},
+		{"今天很好", []string{"今", "天", "很", "好"}},
+		{"go语言 rocks!", []string{"go", "语", "言", "rocks"}},
+		{"  ,.;  ", nil},
+	}
+
+	for _, tt := range tests {
+		got := Words(tt.text)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("Words(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSegmentCJK(t *testing.T) {
+	sep := SegmentSeparator
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"hello world", "hello world"},
+		{"今天", "今" + sep + "天"},
+		{"go语言", "go" + sep + "语" + sep + "言"},
+		{"天气 good", "天" + sep + "气" + sep + " good"},
+	}
+
+	for _, tt := range tests {
+		got := SegmentCJK(tt.text)
+		if got != tt.want {
+			t.Errorf("SegmentCJK(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if strings.ReplaceAll(got, sep, "") != tt.text {
+			t.Errorf("SegmentCJK(%q) does not round-trip", tt.text)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package textutil
+
+import (
+	"html"
+	"strings"
+)
+
+// blockTags are tags that end a line of text when rendered by the editor
+var blockTags = map[string]bool{
+	"p": true, "br": true, "div": true, "li": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "tr": true,
+}
+
+// StripHTML converts editor HTML into plain text.
+// Block-level tags become newlines and HTML entities are decoded.
+func StripHTML(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '<' {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '>')
+		if end < 0 {
+			sb.WriteString(s[i:])
+			break
+		}
+
+		if blockTags[tagName(s[i+1:i+end])] {
+			sb.WriteByte('\n')
+		}
+		i += end
+	}
+
+	text := html.UnescapeString(sb.String())
+
+	// Collapse runs of blank lines left behind by nested blocks
+	lines := strings.Split(text, "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// tagName extracts the lower-cased element name from the inside of a tag
+func tagName(tag string) string {
+	tag = strings.TrimPrefix(tag, "/")
+	if i := strings.IndexAny(tag, " \t\n/"); i >= 0 {
+		tag = tag[:i]
+	}
+	return strings.ToLower(tag)
+}
+
+// TextToHTML converts plain text into editor HTML.
+// Blank lines separate paragraphs, single newlines become line breaks.
+func TextToHTML(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var sb strings.Builder
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		lines := strings.Split(paragraph, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(strings.TrimRight(line, " \t"))
+		}
+		sb.WriteString("<p>")
+		sb.WriteString(strings.Join(lines, "<br>"))
+		sb.WriteString("</p>")
+	}
+	return sb.String()
+}
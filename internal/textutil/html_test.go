@@ -0,0 +1,55 @@
+package textutil
+
+import "testing"
+
+func TestStripHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"empty", "", ""},
+		{"plain", "just text", "just text"},
+		{"paragraphs", "<p>first</p><p>second</p>", "first\n\nsecond"},
+		{"inline", "<p>a <strong>bold</strong> word</p>", "a bold word"},
+		{"line break", "one<br>two<br/>three", "one\ntwo\nthree"},
+		{"entities", "<p>Tom &amp; Jerry &lt;3</p>", "Tom & Jerry <3"},
+		{"nested blocks", "<ul><li><p>item</p></li></ul><p></p><p>after</p>", "item\n\nafter"},
+		{"attributes", `<p class="x">styled</p><img src="a.png">`, "styled"},
+		{"unclosed tag", "text <b", "text <b"},
+		{"cjk", "<p>今天</p><p>天气很好</p>", "今天\n\n天气很好"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripHTML(tt.html); got != tt.want {
+				t.Errorf("StripHTML(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"blank", " \n\n ", ""},
+		{"single line", "quick note", "<p>quick note</p>"},
+		{"paragraphs", "first\n\nsecond", "<p>first</p><p>second</p>"},
+		{"line break", "one\ntwo", "<p>one<br>two</p>"},
+		{"windows newlines", "one\r\ntwo\r\n\r\nthree", "<p>one<br>two</p><p>three</p>"},
+		{"extra blank lines", "\n\na\n\n\n\nb\n", "<p>a</p><p>b</p>"},
+		{"escaped", "Tom & Jerry <3", "<p>Tom &amp; Jerry &lt;3</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TextToHTML(tt.text); got != tt.want {
+				t.Errorf("TextToHTML(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
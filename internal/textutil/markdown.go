@@ -0,0 +1,336 @@
+package textutil
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingLine   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	ruleLine      = regexp.MustCompile(`^ {0,3}([-*_])( *[-*_]){2,} *$`)
+	bulletItem    = regexp.MustCompile(`^( *)[-*+]\s+(.*)$`)
+	orderedItem   = regexp.MustCompile(`^( *)\d{1,9}[.)]\s+(.*)$`)
+	fenceLine     = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	autoLink      = regexp.MustCompile(`^<(https?://[^\s<>]+)>`)
+	unsafeURL     = regexp.MustCompile(`(?i)^\s*(javascript|vbscript|data):`)
+	markdownPunct = "\\`*_{}[]()#+-.!|~<>\"'=:"
+)
+
+// MarkdownToHTML converts Markdown into editor HTML.
+// It covers the CommonMark blocks and inline styles journaling apps write: headings, paragraphs,
+// lists, quotes, code, rules, emphasis, links and images. Single newlines become line breaks
+// like in TextToHTML, raw HTML is escaped.
+func MarkdownToHTML(md string) string {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	md = strings.ReplaceAll(md, "\t", "    ")
+	return markdownBlocks(strings.Split(md, "\n"))
+}
+
+func markdownBlocks(lines []string) string {
+	var sb strings.Builder
+	var paragraph []string
+
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		sb.WriteString("<p>")
+		for i, line := range paragraph {
+			if i > 0 {
+				sb.WriteString("<br>")
+			}
+			sb.WriteString(markdownInline(line))
+		}
+		sb.WriteString("</p>")
+		paragraph = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " ")
+		trimmed := strings.TrimLeft(line, " ")
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case fenceLine.MatchString(line):
+			flush()
+			fence := fenceLine.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimLeft(lines[i], " "), fence); i++ {
+				code = append(code, lines[i])
+			}
+			sb.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+
+		case headingLine.MatchString(trimmed) && len(line)-len(trimmed) < 4:
+			flush()
+			m := headingLine.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			sb.WriteString("<h" + level + ">" + markdownInline(m[2]) + "</h" + level + ">")
+
+		case ruleLine.MatchString(line):
+			flush()
+			sb.WriteString("<hr>")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quoted []string
+			for ; i < len(lines); i++ {
+				next := strings.TrimLeft(lines[i], " ")
+				if !strings.HasPrefix(next, ">") {
+					i--
+					break
+				}
+				next = strings.TrimPrefix(next, ">")
+				quoted = append(quoted, strings.TrimPrefix(next, " "))
+			}
+			sb.WriteString("<blockquote>" + markdownBlocks(quoted) + "</blockquote>")
+
+		case bulletItem.MatchString(line) || orderedItem.MatchString(line):
+			flush()
+			list, consumed := markdownList(lines[i:])
+			sb.WriteString(list)
+			i += consumed - 1
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return sb.String()
+}
+
+// markdownList renders the list starting at lines[0] and returns how many lines it used.
+// Lines indented deeper than the marker belong to the item, which allows nested lists.
+func markdownList(lines []string) (string, int) {
+	itemPattern := bulletItem
+	tag := "ul"
+	if !bulletItem.MatchString(lines[0]) {
+		itemPattern, tag = orderedItem, "ol"
+	}
+	indent := len(itemPattern.FindStringSubmatch(lines[0])[1])
+
+	var sb strings.Builder
+	sb.WriteString("<" + tag + ">")
+
+	var item []string
+	writeItem := func() {
+		if item == nil {
+			return
+		}
+		body := markdownBlocks(item)
+		// A single paragraph is written without <p>, like a tight list
+		if strings.HasPrefix(body, "<p>") && strings.Count(body, "<p>") == 1 {
+			body = strings.Replace(strings.TrimPrefix(body, "<p>"), "</p>", "", 1)
+		}
+		sb.WriteString("<li>" + body + "</li>")
+		item = nil
+	}
+
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " ")
+		if m := itemPattern.FindStringSubmatch(line); m != nil && len(m[1]) == indent {
+			writeItem()
+			item = []string{m[2]}
+			continue
+		}
+		if line == "" {
+			// A blank line ends the list unless an indented line continues it
+			if i+1 < len(lines) && leadingSpaces(lines[i+1]) > indent {
+				item = append(item, "")
+				continue
+			}
+			break
+		}
+		if leadingSpaces(line) > indent {
+			item = append(item, line[min(len(line), indent+2):])
+			continue
+		}
+		if bulletItem.MatchString(line) || orderedItem.MatchString(line) {
+			// A list of the other kind at the same level starts a new list
+			break
+		}
+		// A lazy continuation line of the item's paragraph
+		item = append(item, strings.TrimLeft(line, " "))
+	}
+	writeItem()
+
+	sb.WriteString("</" + tag + ">")
+	return sb.String(), i
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// markdownInline converts the inline syntax of a line of text
+func markdownInline(s string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(markdownPunct, s[i+1]) >= 0:
+			sb.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			n := runLength(s[i:], '`')
+			delimiter := s[i : i+n]
+			if end := strings.Index(s[i+n:], delimiter); end >= 0 {
+				code := strings.TrimSpace(s[i+n : i+n+end])
+				sb.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += n + end + n
+				continue
+			}
+			sb.WriteString(delimiter)
+			i += n
+			continue
+
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if alt, url, n, ok := markdownLink(s[i+1:]); ok {
+				if !unsafeURL.MatchString(url) {
+					sb.WriteString(`<img src="` + html.EscapeString(url) + `" alt="` + html.EscapeString(StripHTML(markdownInline(alt))) + `">`)
+				}
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if text, url, n, ok := markdownLink(s[i:]); ok {
+				if unsafeURL.MatchString(url) {
+					sb.WriteString(markdownInline(text))
+				} else {
+					sb.WriteString(`<a href="` + html.EscapeString(url) + `">` + markdownInline(text) + `</a>`)
+				}
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if m := autoLink.FindStringSubmatch(s[i:]); m != nil {
+				url := html.EscapeString(m[1])
+				sb.WriteString(`<a href="` + url + `">` + url + `</a>`)
+				i += len(m[0])
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if out, n, ok := markdownEmphasis(s, i); ok {
+				sb.WriteString(out)
+				i += n
+				continue
+			}
+			// An unmatched delimiter run is written as text
+			n := runLength(s[i:], c)
+			sb.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+
+		sb.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return sb.String()
+}
+
+// markdownLink parses [text](url "title") at the start of s
+func markdownLink(s string) (text, url string, n int, ok bool) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s) && closeText < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeText = i
+			}
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0, false
+	}
+
+	depth = 0
+	for i := closeText + 1; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				target := strings.TrimSpace(s[closeText+2 : i])
+				if strings.HasPrefix(target, "<") {
+					if end := strings.IndexByte(target, '>'); end > 0 {
+						target = target[1:end]
+					}
+				} else if space := strings.IndexAny(target, " \t"); space >= 0 {
+					// Drop the optional title
+					target = target[:space]
+				}
+				return s[1:closeText], target, i + 1, true
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// markdownEmphasis converts the emphasis opened by the delimiter run at s[i]
+func markdownEmphasis(s string, i int) (string, int, bool) {
+	c := s[i]
+	n := min(runLength(s[i:], c), 3)
+	if c == '~' && n != 2 {
+		return "", 0, false
+	}
+	if i+n >= len(s) || s[i+n] == ' ' {
+		return "", 0, false
+	}
+	// Underscores inside words, like snake_case, are not emphasis
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0, false
+	}
+
+	delimiter := s[i : i+n]
+	for from := i + n; ; {
+		end := strings.Index(s[from:], delimiter)
+		if end < 0 {
+			return "", 0, false
+		}
+		end += from
+		after := end + n
+		if s[end-1] != ' ' && end > i+n && (c != '_' || after >= len(s) || !isWordByte(s[after])) {
+			inner := markdownInline(s[i+n : end])
+			switch {
+			case c == '~':
+				inner = "<s>" + inner + "</s>"
+			case n == 1:
+				inner = "<em>" + inner + "</em>"
+			case n == 2:
+				inner = "<strong>" + inner + "</strong>"
+			default:
+				inner = "<strong><em>" + inner + "</em></strong>"
+			}
+			return inner, after - i, true
+		}
+		from = end + 1
+	}
+}
+
+func runLength(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
@@ -0,0 +1,36 @@
+package textutil
+
+import "testing"
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"paragraphs", "first\nline\n\nsecond", "<p>first<br>line</p><p>second</p>"},
+		{"headings", "# Title\n\n### Part ###", "<h1>Title</h1><h3>Part</h3>"},
+		{"not a heading", "#hashtag", "<p>#hashtag</p>"},
+		{"emphasis", "**bold**, *it*, _it_, ***both*** and ~~gone~~", "<p><strong>bold</strong>, <em>it</em>, <em>it</em>, <strong><em>both</em></strong> and <s>gone</s></p>"},
+		{"no emphasis", "snake_case_name, 2 * 3 * 4 and a lone *", "<p>snake_case_name, 2 * 3 * 4 and a lone *</p>"},
+		{"code", "use `a < b` here\n\n```go\nx := 1 < 2\n```", "<p>use <code>a &lt; b</code> here</p><pre><code>x := 1 &lt; 2</code></pre>"},
+		{"links", "[site](https://example.com \"Title\") and <https://a.example>", `<p><a href="https://example.com">site</a> and <a href="https://a.example">https://a.example</a></p>`},
+		{"unsafe link", "[click](javascript:alert(1))", "<p>click</p>"},
+		{"image", "![a *cat*](photos/cat 1.jpg)\n![](<photos/dog 1.jpg>)", `<p><img src="photos/cat" alt="a cat"><br><img src="photos/dog 1.jpg" alt=""></p>`},
+		{"escapes", `1\. not a list \*star\* <b>`, "<p>1. not a list *star* &lt;b&gt;</p>"},
+		{"bullets", "- one\n- **two**\n  more\n- three", "<ul><li>one</li><li><strong>two</strong><br>more</li><li>three</li></ul>"},
+		{"nested", "1. first\n   - sub\n2. second", "<ol><li>first<ul><li>sub</li></ul></li><li>second</li></ol>"},
+		{"list then text", "* a\n\nafter", "<ul><li>a</li></ul><p>after</p>"},
+		{"quote", "> quoted\n> **text**\n\nplain", "<blockquote><p>quoted<br><strong>text</strong></p></blockquote><p>plain</p>"},
+		{"rule", "above\n\n---\n\nbelow", "<p>above</p><hr><p>below</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MarkdownToHTML(tt.md); got != tt.want {
+				t.Errorf("MarkdownToHTML(%q) =\n%s\nwant\n%s", tt.md, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package trash
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/logger"
+)
+
+// Collections lists the collections that support soft delete
+var Collections = []string{"diaries", "media"}
+
+// purgeBatchSize is the number of trashed records loaded at once when purging
+const purgeBatchSize = 200
+
+// TrashService manages soft-deleted diaries and media
+type TrashService struct {
+	app           *pocketbase.PocketBase
+	configService *config.ConfigService
+}
+
+// Item represents a record in the trash
+type Item struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	Title      string `json:"title"`
+	DeletedAt  string `json:"deleted_at"`
+	PurgeAt    string `json:"purge_at,omitempty"`
+}
+
+// NewTrashService creates a new TrashService
+func NewTrashService(app *pocketbase.PocketBase) *TrashService {
+	return &TrashService{
+		app:           app,
+		configService: config.NewConfigService(app),
+	}
+}
+
+// IsTrashable reports whether a collection supports soft delete
+func IsTrashable(collection string) bool {
+	for _, name := range Collections {
+		if name == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTrashed reports whether a record has been moved to the trash
+func IsTrashed(record *models.Record) bool {
+	return !record.GetDateTime("deleted_at").IsZero()
+}
+
+// MoveToTrash marks a record as deleted without removing it
+func (s *TrashService) MoveToTrash(record *models.Record) error {
+	record.Set("deleted_at", types.NowDateTime())
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return fmt.Errorf("failed to move record to trash: %w", err)
+	}
+	logger.Info("[TrashService] moved %s %s to trash", record.Collection().Name, record.Id)
+	return nil
+}
+
+// Restore takes a record out of the trash.
+// A day can hold several diary entries, so a restored diary never conflicts with live ones.
+func (s *TrashService) Restore(record *models.Record) error {
+	record.Set("deleted_at", "")
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return fmt.Errorf("failed to restore record: %w", err)
+	}
+	logger.Info("[TrashService] restored %s %s from trash", record.Collection().Name, record.Id)
+	return nil
+}
+
+// Purge permanently deletes a record
+func (s *TrashService) Purge(record *models.Record) error {
+	if err := s.app.Dao().DeleteRecord(record); err != nil {
+		return fmt.Errorf("failed to delete record: %w", err)
+	}
+	return nil
+}
+
+// FindTrashed loads a trashed record owned by the user
+func (s *TrashService) FindTrashed(userID, collection, id string) (*models.Record, error) {
+	if !IsTrashable(collection) {
+		return nil, fmt.Errorf("collection %s has no trash", collection)
+	}
+
+	record, err := s.app.Dao().FindRecordById(collection, id)
+	if err != nil {
+		return nil, fmt.Errorf("record not found: %w", err)
+	}
+	if record.GetString("owner") != userID || !IsTrashed(record) {
+		return nil, fmt.Errorf("record %s is not in the trash", id)
+	}
+	return record, nil
+}
+
+// List returns the user's trashed records, most recently deleted first
+func (s *TrashService) List(userID string) ([]Item, error) {
+	retention := s.retentionDays(userID)
+
+	items := make([]Item, 0)
+	for _, collection := range Collections {
+		records, err := s.app.Dao().FindRecordsByFilter(
+			collection,
+			"owner = {:owner} && deleted_at != ''",
+			"-deleted_at",
+			-1,
+			0,
+			map[string]any{"owner": userID},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch trashed %s: %w", collection, err)
+		}
+
+		for _, record := range records {
+			deletedAt := record.GetDateTime("deleted_at")
+			item := Item{
+				ID:         record.Id,
+				Collection: collection,
+				Title:      itemTitle(record),
+				DeletedAt:  deletedAt.String(),
+			}
+			if retention > 0 {
+				item.PurgeAt = deletedAt.Time().AddDate(0, 0, retention).UTC().Format(types.DefaultDateLayout)
+			}
+			items = append(items, item)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt > items[j].DeletedAt
+	})
+	return items, nil
+}
+
+// PurgeExpired permanently deletes trashed records older than their owner's retention.
+// Only records past the shortest configured retention are loaded, in batches.
+func (s *TrashService) PurgeExpired() (int, error) {
+	now := time.Now().UTC()
+	minRetention := s.minRetentionDays()
+	if minRetention <= 0 {
+		return 0, nil // everyone keeps their trash forever
+	}
+	cutoff := now.AddDate(0, 0, -minRetention).Format(types.DefaultDateLayout)
+
+	retentionByUser := make(map[string]int)
+	purged := 0
+
+	for _, collection := range Collections {
+		// Records that are kept stay in the result set, so skip past them
+		offset := 0
+		for {
+			records, err := s.app.Dao().FindRecordsByFilter(
+				collection,
+				"deleted_at != '' && deleted_at <= {:cutoff}",
+				"deleted_at",
+				purgeBatchSize,
+				offset,
+				map[string]any{"cutoff": cutoff},
+			)
+			if err != nil {
+				return purged, fmt.Errorf("failed to fetch trashed %s: %w", collection, err)
+			}
+
+			for _, record := range records {
+				owner := record.GetString("owner")
+				retention, ok := retentionByUser[owner]
+				if !ok {
+					retention = s.retentionDays(owner)
+					retentionByUser[owner] = retention
+				}
+
+				// retention <= 0 keeps the record forever
+				if retention <= 0 || record.GetDateTime("deleted_at").Time().AddDate(0, 0, retention).After(now) {
+					offset++
+					continue
+				}
+
+				if err := s.Purge(record); err != nil {
+					logger.Error("[TrashService] failed to purge %s %s: %v", collection, record.Id, err)
+					offset++
+					continue
+				}
+				purged++
+			}
+
+			if len(records) < purgeBatchSize {
+				break
+			}
+		}
+	}
+
+	return purged, nil
+}
+
+// StartPurgeScheduler periodically purges expired trash in the background
+func (s *TrashService) StartPurgeScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := s.PurgeExpired()
+			if err != nil {
+				logger.Error("[TrashService] purge failed: %v", err)
+			} else if purged > 0 {
+				logger.Info("[TrashService] purged %d expired records", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// retentionDays returns how long a user's trash is kept, 0 means forever
+func (s *TrashService) retentionDays(userID string) int {
+	days, err := s.configService.GetInt(userID, "trash.retentionDays")
+	if err != nil || days < 0 {
+		return 30
+	}
+	return days
+}
+
+// minRetentionDays returns the shortest retention among all users, 0 if nobody purges.
+// Users without the setting use the registry default.
+func (s *TrashService) minRetentionDays() int {
+	minDays := 0
+	if days, ok := config.GetDefault("trash.retentionDays").(int); ok {
+		minDays = days
+	}
+
+	records, err := s.app.Dao().FindRecordsByFilter(
+		"user_settings",
+		"key = 'trash.retentionDays'",
+		"",
+		-1,
+		0,
+	)
+	if err != nil {
+		return minDays
+	}
+
+	for _, record := range records {
+		days := s.retentionDays(record.GetString("user"))
+		if days > 0 && (minDays <= 0 || days < minDays) {
+			minDays = days
+		}
+	}
+	return minDays
+}
+
+// itemTitle returns a human readable label for a trashed record
+func itemTitle(record *models.Record) string {
+	if record.Collection().Name == "diaries" {
+		date := record.GetString("date")
+		if len(date) >= 10 {
+			return date[:10]
+		}
+		return date
+	}
+	if name := record.GetString("name"); name != "" {
+		return name
+	}
+	return record.GetString("file")
+}
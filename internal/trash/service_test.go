@@ -0,0 +1,167 @@
+package trash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/testapp"
+)
+
+// setRetention stores a user's trash retention, bypassing the validation of the config service
+func setRetention(t *testing.T, app *pocketbase.PocketBase, user *models.Record, days int) {
+	t.Helper()
+	testapp.Record(t, app, "user_settings", map[string]any{
+		"user": user.Id, "key": "trash.retentionDays", "value": days,
+	})
+}
+
+// trashedDiary creates a diary of a user that was moved to the trash the given number of days ago
+func trashedDiary(t *testing.T, app *pocketbase.PocketBase, owner *models.Record, daysAgo int) *models.Record {
+	t.Helper()
+	deletedAt, _ := types.ParseDateTime(time.Now().UTC().AddDate(0, 0, -daysAgo))
+	return testapp.Record(t, app, "diaries", map[string]any{
+		"owner": owner.Id, "date": "2024-01-01 00:00:00.000Z", "content": "<p>gone</p>", "deleted_at": deletedAt,
+	})
+}
+
+// exists reports whether a record is still stored
+func exists(app *pocketbase.PocketBase, record *models.Record) bool {
+	_, err := app.Dao().FindRecordById(record.Collection().Name, record.Id)
+	return err == nil
+}
+
+func TestRestore(t *testing.T) {
+	app := testapp.New(t)
+	alice := testapp.User(t, app, "alice")
+	bob := testapp.User(t, app, "bob")
+	service := NewTrashService(app)
+
+	diary := testapp.Record(t, app, "diaries", map[string]any{
+		"owner": alice.Id, "date": "2024-03-01 00:00:00.000Z", "content": "<p>kept</p>",
+	})
+	media := testapp.Record(t, app, "media", map[string]any{
+		"owner": alice.Id, "name": "photo.jpg", "file": "photo_abc.jpg",
+	})
+
+	for _, record := range []*models.Record{diary, media} {
+		collection := record.Collection().Name
+		if _, err := service.FindTrashed(alice.Id, collection, record.Id); err == nil {
+			t.Errorf("live %s found in the trash", collection)
+		}
+		if err := service.MoveToTrash(record); err != nil {
+			t.Fatalf("MoveToTrash(%s) = %v", collection, err)
+		}
+		if _, err := service.FindTrashed(bob.Id, collection, record.Id); err == nil {
+			t.Errorf("trashed %s found in the trash of another user", collection)
+		}
+
+		trashed, err := service.FindTrashed(alice.Id, collection, record.Id)
+		if err != nil {
+			t.Fatalf("FindTrashed(%s) = %v", collection, err)
+		}
+		if err := service.Restore(trashed); err != nil {
+			t.Fatalf("Restore(%s) = %v", collection, err)
+		}
+
+		restored, err := app.Dao().FindRecordById(collection, record.Id)
+		if err != nil {
+			t.Fatalf("failed to load restored %s: %v", collection, err)
+		}
+		if IsTrashed(restored) {
+			t.Errorf("restored %s is still trashed", collection)
+		}
+		if _, err := service.FindTrashed(alice.Id, collection, record.Id); err == nil {
+			t.Errorf("restored %s found in the trash", collection)
+		}
+	}
+
+	items, err := service.List(alice.Id)
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	if len(items) != 0 {
+		t.Errorf("List() = %+v after restoring everything", items)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	app := testapp.New(t)
+	service := NewTrashService(app)
+
+	// alice keeps the default of 30 days, bob 7 days and carol forever
+	alice := testapp.User(t, app, "alice")
+	bob := testapp.User(t, app, "bob")
+	carol := testapp.User(t, app, "carol")
+	setRetention(t, app, bob, 7)
+	setRetention(t, app, carol, 0)
+
+	aliceRecent := trashedDiary(t, app, alice, 10)
+	aliceExpired := trashedDiary(t, app, alice, 40)
+	bobRecent := trashedDiary(t, app, bob, 3)
+	bobExpired := trashedDiary(t, app, bob, 10)
+	carolOld := trashedDiary(t, app, carol, 400)
+	live := testapp.Record(t, app, "diaries", map[string]any{
+		"owner": bob.Id, "date": "2024-01-01 00:00:00.000Z", "content": "<p>live</p>",
+	})
+
+	purged, err := service.PurgeExpired()
+	if err != nil {
+		t.Fatalf("PurgeExpired() = %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("PurgeExpired() purged %d records, want 2", purged)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		record *models.Record
+		kept   bool
+	}{
+		{"alice within the default retention", aliceRecent, true},
+		{"alice past the default retention", aliceExpired, false},
+		{"bob within a 7 day retention", bobRecent, true},
+		{"bob past a 7 day retention", bobExpired, false},
+		{"carol keeping the trash forever", carolOld, true},
+		{"live diary", live, true},
+	} {
+		if got := exists(app, tt.record); got != tt.kept {
+			t.Errorf("%s: kept = %v, want %v", tt.name, got, tt.kept)
+		}
+	}
+}
+
+func TestMinRetentionDays(t *testing.T) {
+	app := testapp.New(t)
+	service := NewTrashService(app)
+
+	// Users without the setting use the default
+	alice := testapp.User(t, app, "alice")
+	if got := service.minRetentionDays(); got != 30 {
+		t.Errorf("minRetentionDays() = %d with no settings, want the default 30", got)
+	}
+
+	// Keeping the trash forever doesn't lower the minimum
+	setRetention(t, app, alice, 0)
+	if got := service.minRetentionDays(); got != 30 {
+		t.Errorf("minRetentionDays() = %d with a forever retention, want 30", got)
+	}
+
+	// Invalid negative settings fall back to the default instead of purging everything
+	setRetention(t, app, testapp.User(t, app, "bob"), -5)
+	if got := service.retentionDays(testapp.User(t, app, "dave").Id); got != 30 {
+		t.Errorf("retentionDays() = %d for a user without the setting, want 30", got)
+	}
+	if got := service.minRetentionDays(); got != 30 {
+		t.Errorf("minRetentionDays() = %d with a negative retention, want 30", got)
+	}
+
+	// The shortest positive retention wins
+	setRetention(t, app, testapp.User(t, app, "carol"), 7)
+	if got := service.minRetentionDays(); got != 7 {
+		t.Errorf("minRetentionDays() = %d, want 7", got)
+	}
+}
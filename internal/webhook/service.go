@@ -0,0 +1,561 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/songtianlun/diarum/internal/logger"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Dispatcher tuning
+const (
+	queueSize     = 256
+	pollInterval  = 15 * time.Second
+	sendBatchSize = 50
+	pruneInterval = time.Hour
+	// deliveryRetention is how long the delivery log is kept
+	deliveryRetention = 30 * 24 * time.Hour
+)
+
+// maxNameLength mirrors the max length of the webhooks.name field
+const maxNameLength = 100
+
+// ErrNotFound is returned for webhooks and deliveries that don't exist or belong to another user
+var ErrNotFound = errors.New("webhook not found")
+
+// Webhook describes a stored webhook, the secret is only returned when it is created
+type Webhook struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Enabled bool     `json:"enabled"`
+	Created string   `json:"created"`
+	Updated string   `json:"updated"`
+}
+
+// queuedEvent is an event waiting to be turned into deliveries
+type queuedEvent struct {
+	userID  string
+	event   string
+	data    json.RawMessage
+	created time.Time
+}
+
+// Delivery describes an entry of the delivery log
+type Delivery struct {
+	ID             string `json:"id"`
+	Webhook        string `json:"webhook"`
+	Event          string `json:"event"`
+	Payload        string `json:"payload"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	NextAttempt    string `json:"next_attempt,omitempty"`
+	ResponseStatus int    `json:"response_status,omitempty"`
+	Error          string `json:"error,omitempty"`
+	DurationMs     int    `json:"duration_ms"`
+	Created        string `json:"created"`
+	Updated        string `json:"updated"`
+}
+
+// WebhookService queues events and delivers them to the webhooks of their owner
+type WebhookService struct {
+	app     *pocketbase.PocketBase
+	client  *http.Client
+	events  chan queuedEvent
+	wake    chan struct{}
+	started atomic.Bool
+}
+
+// NewWebhookService creates a new WebhookService, Start must be called to deliver events
+func NewWebhookService(app *pocketbase.PocketBase) *WebhookService {
+	return &WebhookService{
+		app:    app,
+		client: NewClient(),
+		events: make(chan queuedEvent, queueSize),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Create stores a new enabled webhook and returns it with its signing secret
+func (s *WebhookService) Create(userID, name, url string, events []string) (string, *Webhook, error) {
+	record, err := s.validate(nil, name, url, events)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	record.Set("owner", userID)
+	record.Set("secret", secret)
+	record.Set("enabled", true)
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return "", nil, fmt.Errorf("failed to save webhook: %w", err)
+	}
+
+	logger.Info("[WebhookService] created webhook %s for user %s", record.Id, userID)
+	hook := toWebhook(record)
+	return secret, &hook, nil
+}
+
+// Update changes the name, URL, events and enabled state of a webhook
+func (s *WebhookService) Update(userID, id, name, url string, events []string, enabled bool) (*Webhook, error) {
+	record, err := s.Find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.validate(record, name, url, events); err != nil {
+		return nil, err
+	}
+
+	record.Set("enabled", enabled)
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return nil, fmt.Errorf("failed to save webhook: %w", err)
+	}
+
+	hook := toWebhook(record)
+	return &hook, nil
+}
+
+// Delete removes a webhook together with its delivery log
+func (s *WebhookService) Delete(userID, id string) error {
+	record, err := s.Find(userID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.app.Dao().DeleteRecord(record); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	logger.Info("[WebhookService] deleted webhook %s of user %s", id, userID)
+	return nil
+}
+
+// List returns the webhooks of a user, newest first
+func (s *WebhookService) List(userID string) ([]Webhook, error) {
+	records, err := s.app.Dao().FindRecordsByFilter(
+		"webhooks",
+		"owner = {:owner}",
+		"-created",
+		-1,
+		0,
+		map[string]any{"owner": userID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+
+	hooks := make([]Webhook, 0, len(records))
+	for _, record := range records {
+		hooks = append(hooks, toWebhook(record))
+	}
+	return hooks, nil
+}
+
+// Find returns a webhook record of a user
+func (s *WebhookService) Find(userID, id string) (*models.Record, error) {
+	record, err := s.app.Dao().FindRecordById("webhooks", id)
+	if err != nil || record.GetString("owner") != userID {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// FindDelivery returns a delivery of a webhook
+func (s *WebhookService) FindDelivery(hook *models.Record, id string) (*models.Record, error) {
+	record, err := s.app.Dao().FindRecordById("webhook_deliveries", id)
+	if err != nil || record.GetString("webhook") != hook.Id {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// validate checks webhook input and sets it on record, a new record is created when record is nil.
+// Dao.SaveRecord skips collection validation, so every field is checked here.
+func (s *WebhookService) validate(record *models.Record, name, url string, events []string) (*models.Record, error) {
+	name = strings.TrimSpace(name)
+	url = strings.TrimSpace(url)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len([]rune(name)) > maxNameLength {
+		return nil, fmt.Errorf("name must be at most %d characters", maxNameLength)
+	}
+	if err := ValidateURL(url); err != nil {
+		return nil, err
+	}
+	events, err := NormalizeEvents(events)
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		collection, err := s.app.Dao().FindCollectionByNameOrId("webhooks")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find webhooks collection: %w", err)
+		}
+		record = models.NewRecord(collection)
+	}
+	record.Set("name", name)
+	record.Set("url", url)
+	record.Set("events", events)
+	return record, nil
+}
+
+// Emit queues an event of a user.
+// It doesn't touch the database, so it is safe to call from model hooks running inside a transaction.
+// Events are only queued once Start was called, so commands that don't serve don't fill the queue,
+// and they are dropped with a warning when the queue is full.
+func (s *WebhookService) Emit(userID, event string, data any) {
+	if s == nil || userID == "" || !s.started.Load() {
+		return
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		logger.Warn("[WebhookService] failed to encode %s event: %v", event, err)
+		return
+	}
+
+	select {
+	case s.events <- queuedEvent{userID: userID, event: event, data: raw, created: time.Now()}:
+	default:
+		logger.Warn("[WebhookService] queue full, dropped %s event of user %s", event, userID)
+	}
+}
+
+// Start runs the dispatcher in the background.
+// Queued events become pending deliveries, which are sent right away and retried on failure.
+// Pending deliveries survive restarts and are picked up by the periodic poll.
+func (s *WebhookService) Start() {
+	if s.started.Swap(true) {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+
+		for {
+			select {
+			case e := <-s.events:
+				s.enqueue(e)
+				s.sendDue()
+			case <-s.wake:
+				s.sendDue()
+			case <-ticker.C:
+				s.sendDue()
+				if time.Since(lastPrune) > pruneInterval {
+					s.prune()
+					lastPrune = time.Now()
+				}
+			}
+		}
+	}()
+}
+
+// enqueue creates a pending delivery for every enabled webhook of the user subscribed to the event
+func (s *WebhookService) enqueue(e queuedEvent) {
+	hooks, err := s.app.Dao().FindRecordsByFilter(
+		"webhooks",
+		"owner = {:owner} && enabled = true",
+		"",
+		-1,
+		0,
+		map[string]any{"owner": e.userID},
+	)
+	if err != nil {
+		logger.Error("[WebhookService] failed to fetch webhooks of user %s: %v", e.userID, err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if !subscribed(hook, e.event) {
+			continue
+		}
+		if _, err := s.createDelivery(hook, e.event, e.data, e.created, ""); err != nil {
+			logger.Error("[WebhookService] failed to queue %s for webhook %s: %v", e.event, hook.Id, err)
+		}
+	}
+}
+
+// createDelivery stores a pending delivery, which the dispatcher picks up
+func (s *WebhookService) createDelivery(hook *models.Record, event string, data json.RawMessage, created time.Time, payloadID string) (*models.Record, error) {
+	record, err := s.newDelivery(hook, event, data, created, payloadID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// newDelivery prepares an unsaved pending delivery. The payload id is the delivery id,
+// unless payloadID is given to resend the payload of an earlier delivery.
+func (s *WebhookService) newDelivery(hook *models.Record, event string, data json.RawMessage, created time.Time, payloadID string) (*models.Record, error) {
+	collection, err := s.app.Dao().FindCollectionByNameOrId("webhook_deliveries")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook_deliveries collection: %w", err)
+	}
+
+	record := models.NewRecord(collection)
+	record.RefreshId()
+	if payloadID == "" {
+		payloadID = record.Id
+	}
+
+	payload, err := json.Marshal(Payload{
+		ID:      payloadID,
+		Event:   event,
+		Created: created.UTC().Format(time.RFC3339),
+		Data:    data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	record.Set("webhook", hook.Id)
+	record.Set("owner", hook.GetString("owner"))
+	record.Set("event", event)
+	record.Set("payload", string(payload))
+	record.Set("status", StatusPending)
+	record.Set("attempts", 0)
+	record.Set("next_attempt", types.NowDateTime())
+	return record, nil
+}
+
+// sendDue attempts every pending delivery whose next attempt is due
+func (s *WebhookService) sendDue() {
+	deliveries, err := s.app.Dao().FindRecordsByFilter(
+		"webhook_deliveries",
+		"status = {:status} && next_attempt <= {:now}",
+		"next_attempt",
+		sendBatchSize,
+		0,
+		map[string]any{"status": StatusPending, "now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		logger.Error("[WebhookService] failed to fetch pending deliveries: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		hook, err := s.app.Dao().FindRecordById("webhooks", delivery.GetString("webhook"))
+		if err != nil {
+			// The webhook was deleted while the delivery was pending, the cascade removes it
+			continue
+		}
+		s.attempt(delivery, hook, true)
+	}
+}
+
+// attempt sends a delivery once and records the outcome.
+// When retry is set a failure schedules the next attempt until MaxAttempts is reached,
+// otherwise the delivery fails right away.
+func (s *WebhookService) attempt(delivery, hook *models.Record, retry bool) error {
+	attempts := delivery.GetInt("attempts") + 1
+	delivery.Set("attempts", attempts)
+
+	var result Result
+	var err error
+	if hook.GetBool("enabled") || !retry {
+		result, err = Send(
+			context.Background(),
+			s.client,
+			hook.GetString("url"),
+			hook.GetString("secret"),
+			delivery.GetString("event"),
+			delivery.Id,
+			[]byte(delivery.GetString("payload")),
+		)
+	} else {
+		err = fmt.Errorf("webhook is disabled")
+		retry = false
+	}
+
+	delivery.Set("response_status", result.Status)
+	delivery.Set("duration_ms", result.Duration.Milliseconds())
+
+	switch {
+	case err == nil:
+		delivery.Set("status", StatusDelivered)
+		delivery.Set("error", "")
+		delivery.Set("next_attempt", "")
+	case retry && attempts < MaxAttempts:
+		delivery.Set("status", StatusPending)
+		delivery.Set("error", err.Error())
+		delivery.Set("next_attempt", time.Now().Add(Backoff(attempts)).UTC())
+	default:
+		delivery.Set("status", StatusFailed)
+		delivery.Set("error", err.Error())
+		delivery.Set("next_attempt", "")
+	}
+
+	if saveErr := s.app.Dao().SaveRecord(delivery); saveErr != nil {
+		logger.Error("[WebhookService] failed to save delivery %s: %v", delivery.Id, saveErr)
+	}
+	if err != nil {
+		logger.Debug("[WebhookService] delivery %s to webhook %s failed (attempt %d): %v", delivery.Id, hook.Id, attempts, err)
+	}
+	return err
+}
+
+// Test sends a ping to a webhook right away and returns the logged delivery.
+// Pings are not retried, a failed ping shows the status the receiver answered.
+// The delivery is only saved after the attempt, so the dispatcher never sends it too.
+func (s *WebhookService) Test(hook *models.Record) (*Delivery, error) {
+	data, _ := json.Marshal(map[string]any{
+		"webhook": hook.Id,
+		"name":    hook.GetString("name"),
+	})
+
+	delivery, err := s.newDelivery(hook, EventPing, data, time.Now(), "")
+	if err != nil {
+		return nil, err
+	}
+	s.attempt(delivery, hook, false)
+	if delivery.IsNew() {
+		return nil, fmt.Errorf("failed to save delivery")
+	}
+
+	result := toDelivery(delivery)
+	return &result, nil
+}
+
+// Redeliver queues the payload of an earlier delivery again as a new delivery.
+// The payload keeps its id, so receivers can recognize the repeat.
+func (s *WebhookService) Redeliver(hook, delivery *models.Record) (*Delivery, error) {
+	var payload struct {
+		ID      string          `json:"id"`
+		Created string          `json:"created"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(delivery.GetString("payload")), &payload); err != nil {
+		return nil, fmt.Errorf("stored payload is invalid: %w", err)
+	}
+	created, err := time.Parse(time.RFC3339, payload.Created)
+	if err != nil {
+		created = delivery.Created.Time()
+	}
+
+	record, err := s.createDelivery(hook, delivery.GetString("event"), payload.Data, created, payload.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	result := toDelivery(record)
+	return &result, nil
+}
+
+// Deliveries returns the latest deliveries of a webhook, newest first
+func (s *WebhookService) Deliveries(hookID string, limit int) ([]Delivery, error) {
+	records, err := s.app.Dao().FindRecordsByFilter(
+		"webhook_deliveries",
+		"webhook = {:webhook}",
+		"-created",
+		limit,
+		0,
+		map[string]any{"webhook": hookID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deliveries: %w", err)
+	}
+
+	deliveries := make([]Delivery, 0, len(records))
+	for _, record := range records {
+		deliveries = append(deliveries, toDelivery(record))
+	}
+	return deliveries, nil
+}
+
+// prune removes deliveries older than the retention period
+func (s *WebhookService) prune() {
+	cutoff, err := types.ParseDateTime(time.Now().Add(-deliveryRetention))
+	if err != nil {
+		return
+	}
+
+	result, err := s.app.Dao().DB().NewQuery(
+		"DELETE FROM webhook_deliveries WHERE created < {:cutoff} AND status != {:pending}",
+	).Bind(map[string]any{
+		"cutoff":  cutoff.String(),
+		"pending": StatusPending,
+	}).Execute()
+	if err != nil {
+		logger.Error("[WebhookService] failed to prune deliveries: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		logger.Info("[WebhookService] pruned %d old deliveries", n)
+	}
+}
+
+// subscribed reports whether a webhook record subscribes to an event, pings reach every webhook
+func subscribed(hook *models.Record, event string) bool {
+	if event == EventPing {
+		return true
+	}
+	for _, e := range hook.GetStringSlice("events") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// toWebhook converts a webhooks record, leaving out the secret
+func toWebhook(record *models.Record) Webhook {
+	return Webhook{
+		ID:      record.Id,
+		Name:    record.GetString("name"),
+		URL:     record.GetString("url"),
+		Events:  record.GetStringSlice("events"),
+		Enabled: record.GetBool("enabled"),
+		Created: record.Created.String(),
+		Updated: record.Updated.String(),
+	}
+}
+
+// toDelivery converts a webhook_deliveries record
+func toDelivery(record *models.Record) Delivery {
+	return Delivery{
+		ID:             record.Id,
+		Webhook:        record.GetString("webhook"),
+		Event:          record.GetString("event"),
+		Payload:        record.GetString("payload"),
+		Status:         record.GetString("status"),
+		Attempts:       record.GetInt("attempts"),
+		NextAttempt:    record.GetDateTime("next_attempt").String(),
+		ResponseStatus: record.GetInt("response_status"),
+		Error:          record.GetString("error"),
+		DurationMs:     record.GetInt("duration_ms"),
+		Created:        record.Created.String(),
+		Updated:        record.Updated.String(),
+	}
+}
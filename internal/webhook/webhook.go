@@ -0,0 +1,275 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Events a webhook can subscribe to
+const (
+	EventDiaryCreated  = "diary.created"
+	EventDiaryUpdated  = "diary.updated"
+	EventDiaryDeleted  = "diary.deleted"
+	EventMediaUploaded = "media.uploaded"
+	EventVectorsBuilt  = "vectors.built"
+	EventChatReplied   = "chat.replied"
+
+	// EventPing is only sent by the test endpoint, every webhook receives it
+	EventPing = "ping"
+)
+
+// Events lists the events a webhook can subscribe to
+var Events = []string{
+	EventDiaryCreated,
+	EventDiaryUpdated,
+	EventDiaryDeleted,
+	EventMediaUploaded,
+	EventVectorsBuilt,
+	EventChatReplied,
+}
+
+// Request headers of a delivery
+const (
+	HeaderEvent     = "X-Diarum-Event"
+	HeaderDelivery  = "X-Diarum-Delivery"
+	HeaderTimestamp = "X-Diarum-Timestamp"
+	HeaderSignature = "X-Diarum-Signature"
+)
+
+// Retry policy: a failed delivery is retried with exponential backoff,
+// 30s, 1m, 2m, 4m ... capped at maxBackoff, until MaxAttempts is reached.
+const (
+	MaxAttempts = 8
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// deliveryTimeout bounds a single delivery attempt
+const deliveryTimeout = 10 * time.Second
+
+// maxResponseBody is the part of a receiver's response read before the connection is reused,
+// the response itself is discarded
+const maxResponseBody = 2048
+
+// resolveTimeout bounds the lookup of a webhook host when its URL is saved
+const resolveTimeout = 5 * time.Second
+
+// ErrBlockedAddress is returned for webhook hosts on loopback, private, link-local
+// or unspecified addresses, so webhooks can't reach the server's own network
+var ErrBlockedAddress = errors.New("webhook URL must not point to a local or private address")
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID      string `json:"id"`
+	Event   string `json:"event"`
+	Created string `json:"created"`
+	Data    any    `json:"data"`
+}
+
+// Result is the outcome of a delivery attempt
+type Result struct {
+	Status   int
+	Duration time.Duration
+}
+
+// ValidEvent reports whether event is an event a webhook can subscribe to
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeEvents trims, dedupes and sorts events, rejecting unknown ones
+func NormalizeEvents(events []string) ([]string, error) {
+	seen := map[string]bool{}
+	result := make([]string, 0, len(events))
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "" || seen[event] {
+			continue
+		}
+		if !ValidEvent(event) {
+			return nil, fmt.Errorf("unknown event %q", event)
+		}
+		seen[event] = true
+		result = append(result, event)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("at least one event is required")
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// ValidateURL checks that a webhook URL is an absolute http or https URL
+// whose host doesn't resolve to a blocked address
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use http or https")
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrBlockedAddress
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedIP(ip) {
+			return ErrBlockedAddress
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("webhook host %s can't be resolved", host)
+	}
+	for _, addr := range addrs {
+		if blockedIP(addr.IP) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+// blockedIP reports whether a webhook must not connect to ip
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast()
+}
+
+// dialControl refuses connections to blocked addresses. It runs after DNS resolution,
+// so a host that resolved to a public address when it was saved can't be rebound to a local one.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || blockedIP(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// NewClient creates the HTTP client deliveries are sent with.
+// It doesn't use a proxy, which would hide the address it connects to, and checks every
+// address it dials, including those of redirects.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: dialControl,
+	}
+	return &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: deliveryTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// GenerateSecret creates a new signing secret
+func GenerateSecret() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(bytes), nil
+}
+
+// Sign computes the signature of a delivery: the hex HMAC-SHA256 of "<timestamp>.<body>"
+// keyed with the webhook secret. Receivers recompute it and compare in constant time,
+// and reject old timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff returns the delay before the next attempt after attempt failed ones
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := baseBackoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// Send posts a signed payload to a webhook URL.
+// Any 2xx response counts as delivered, other statuses and transport errors are returned as errors.
+// Only the status of the response is kept, its body is never stored or shown.
+func Send(ctx context.Context, client *http.Client, url, secret, event, deliveryID string, body []byte) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid webhook request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Diarum-Webhook/1")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(start)}, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	result := Result{Status: resp.StatusCode, Duration: time.Since(start)}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, fmt.Errorf("receiver answered %d", resp.StatusCode)
+	}
+	return result, nil
+}
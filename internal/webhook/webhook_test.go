@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"ping"}`)
+	signature := Sign("secret", 1700000000, body)
+
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Fatalf("signature %q lacks the sha256= prefix", signature)
+	}
+	if !Verify("secret", 1700000000, body, signature) {
+		t.Error("valid signature rejected")
+	}
+	if Verify("other", 1700000000, body, signature) {
+		t.Error("signature accepted with the wrong secret")
+	}
+	if Verify("secret", 1700000001, body, signature) {
+		t.Error("signature accepted with a different timestamp")
+	}
+	if Verify("secret", 1700000000, []byte(`{"event":"pong"}`), signature) {
+		t.Error("signature accepted for a different body")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{8, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestValidEvent(t *testing.T) {
+	if !ValidEvent(EventDiaryCreated) {
+		t.Error("diary.created rejected")
+	}
+	if ValidEvent(EventPing) || ValidEvent("diary.exploded") {
+		t.Error("unsubscribable event accepted")
+	}
+}
+
+func TestNormalizeEvents(t *testing.T) {
+	events, err := NormalizeEvents([]string{" media.uploaded", "diary.created", "media.uploaded", ""})
+	if err != nil {
+		t.Fatalf("NormalizeEvents failed: %v", err)
+	}
+	if strings.Join(events, ",") != "diary.created,media.uploaded" {
+		t.Errorf("events = %v", events)
+	}
+
+	if _, err := NormalizeEvents([]string{"diary.created", "ping"}); err == nil {
+		t.Error("ping accepted as a subscription")
+	}
+	if _, err := NormalizeEvents(nil); err == nil {
+		t.Error("empty events accepted")
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	// Hosts are IP literals, so the test doesn't depend on DNS
+	for _, raw := range []string{"https://93.184.216.34/hook", "http://[2606:4700::1111]:8080/x?y=1"} {
+		if err := ValidateURL(raw); err != nil {
+			t.Errorf("ValidateURL(%q) = %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"", "example.com/hook", "ftp://example.com", "https://", "javascript:alert(1)"} {
+		if err := ValidateURL(raw); err == nil {
+			t.Errorf("ValidateURL(%q) accepted", raw)
+		}
+	}
+}
+
+func TestSendSignsRequest(t *testing.T) {
+	body := []byte(`{"id":"d1","event":"diary.created"}`)
+
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	result, err := Send(context.Background(), server.Client(), server.URL, "secret", EventDiaryCreated, "d1", body)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if result.Status != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", result.Status)
+	}
+
+	if received.Method != http.MethodPost {
+		t.Errorf("method = %s, want POST", received.Method)
+	}
+	if got := received.Header.Get(HeaderEvent); got != EventDiaryCreated {
+		t.Errorf("event header = %q", got)
+	}
+	if got := received.Header.Get(HeaderDelivery); got != "d1" {
+		t.Errorf("delivery header = %q", got)
+	}
+	if string(receivedBody) != string(body) {
+		t.Errorf("body = %s", receivedBody)
+	}
+
+	timestamp, err := strconv.ParseInt(received.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header: %v", err)
+	}
+	if !Verify("secret", timestamp, receivedBody, received.Header.Get(HeaderSignature)) {
+		t.Error("receiver could not verify the signature")
+	}
+}
+
+func TestSendReportsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, strings.Repeat("x", maxResponseBody*2))
+	}))
+	defer server.Close()
+
+	result, err := Send(context.Background(), server.Client(), server.URL, "secret", EventPing, "d1", []byte(`{}`))
+	if err == nil {
+		t.Fatal("500 response reported as delivered")
+	}
+	if result.Status != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", result.Status)
+	}
+
+	server.Close()
+	if _, err := Send(context.Background(), http.DefaultClient, server.URL, "secret", EventPing, "d1", []byte(`{}`)); err == nil {
+		t.Error("unreachable receiver reported as delivered")
+	}
+}
+
+func TestValidateURLBlocksLocalAddresses(t *testing.T) {
+	for _, raw := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8090/hook",
+		"http://api.localhost/hook",
+		"http://10.0.0.5/hook",
+		"https://192.168.1.1/hook",
+		"http://172.16.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0:8090/hook",
+		"http://[::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if err := ValidateURL(raw); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("ValidateURL(%q) = %v, want ErrBlockedAddress", raw, err)
+		}
+	}
+
+}
+
+func TestClientRefusesLocalAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	_, err := Send(context.Background(), NewClient(), server.URL, "secret", EventPing, "d1", []byte(`{}`))
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Send to %s = %v, want ErrBlockedAddress", server.URL, err)
+	}
+	if called {
+		t.Error("receiver on a loopback address was called")
+	}
+}
@@ -13,16 +13,28 @@ import (
 	"time"
 
 	"github.com/songtianlun/diarum/internal/api"
+	"github.com/songtianlun/diarum/internal/changes"
 	"github.com/songtianlun/diarum/internal/config"
+	"github.com/songtianlun/diarum/internal/dateutil"
 	"github.com/songtianlun/diarum/internal/embedding"
+	"github.com/songtianlun/diarum/internal/jobs"
 	"github.com/songtianlun/diarum/internal/logger"
 	_ "github.com/songtianlun/diarum/internal/migrations"
+	"github.com/songtianlun/diarum/internal/ratelimit"
+	"github.com/songtianlun/diarum/internal/revision"
+	"github.com/songtianlun/diarum/internal/search"
 	"github.com/songtianlun/diarum/internal/static"
+	"github.com/songtianlun/diarum/internal/stats"
+	"github.com/songtianlun/diarum/internal/trash"
+	"github.com/songtianlun/diarum/internal/webhook"
 
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
+	"github.com/pocketbase/pocketbase/tools/hook"
 	"github.com/spf13/cobra"
 )
 
@@ -131,6 +143,113 @@ func main() {
 		Automigrate: true, // Auto-run migrations on startup
 	})
 
+	// Keep the full-text search index in sync with diaries.
+	// Model hooks also cover writes made outside HTTP requests, like imports and restores.
+	app.OnModelAfterCreate("diaries").Add(func(e *core.ModelEvent) error {
+		if record, ok := e.Model.(*models.Record); ok {
+			if err := search.IndexDiary(e.Dao, record); err != nil {
+				logger.Error("[Search] %v", err)
+			}
+		}
+		return nil
+	})
+	app.OnModelAfterUpdate("diaries").Add(func(e *core.ModelEvent) error {
+		if record, ok := e.Model.(*models.Record); ok {
+			if err := search.IndexDiary(e.Dao, record); err != nil {
+				logger.Error("[Search] %v", err)
+			}
+		}
+		return nil
+	})
+	app.OnModelAfterDelete("diaries").Add(func(e *core.ModelEvent) error {
+		if err := search.RemoveDiary(e.Dao, e.Model.GetId()); err != nil {
+			logger.Error("[Search] %v", err)
+		}
+		return nil
+	})
+
+	// Drop cached writing statistics whenever a diary or media record changes
+	app.OnModelAfterCreate("diaries", "media").Add(func(e *core.ModelEvent) error {
+		stats.InvalidateRecord(e.Model)
+		return nil
+	})
+	app.OnModelAfterUpdate("diaries", "media").Add(func(e *core.ModelEvent) error {
+		stats.InvalidateRecord(e.Model)
+		return nil
+	})
+	app.OnModelAfterDelete("diaries", "media").Add(func(e *core.ModelEvent) error {
+		stats.InvalidateRecord(e.Model)
+		return nil
+	})
+
+	// Record diary and media changes for delta sync
+	trackChange := func(e *core.ModelEvent, deleted bool) error {
+		if record, ok := e.Model.(*models.Record); ok {
+			if err := changes.Track(e.Dao, record, deleted); err != nil {
+				logger.Error("[Sync] %v", err)
+			}
+		}
+		return nil
+	}
+	app.OnModelAfterCreate("diaries", "media").Add(func(e *core.ModelEvent) error {
+		return trackChange(e, false)
+	})
+	app.OnModelAfterUpdate("diaries", "media").Add(func(e *core.ModelEvent) error {
+		return trackChange(e, false)
+	})
+	app.OnModelAfterDelete("diaries", "media").Add(func(e *core.ModelEvent) error {
+		return trackChange(e, true)
+	})
+
+	// Emit webhook events for diary, media and AI changes.
+	// Events are queued in memory and delivered by the webhook service once the server runs,
+	// trashing a diary counts as a delete and restoring it as a create.
+	webhookService := webhook.NewWebhookService(app)
+	app.OnModelAfterCreate("diaries").Add(func(e *core.ModelEvent) error {
+		if record, ok := e.Model.(*models.Record); ok && !trash.IsTrashed(record) {
+			webhookService.Emit(record.GetString("owner"), webhook.EventDiaryCreated, record.PublicExport())
+		}
+		return nil
+	})
+	app.OnModelAfterUpdate("diaries").Add(func(e *core.ModelEvent) error {
+		record, ok := e.Model.(*models.Record)
+		if !ok {
+			return nil
+		}
+		event := webhook.EventDiaryUpdated
+		switch wasTrashed := trash.IsTrashed(record.OriginalCopy()); {
+		case trash.IsTrashed(record) && !wasTrashed:
+			event = webhook.EventDiaryDeleted
+		case !trash.IsTrashed(record) && wasTrashed:
+			event = webhook.EventDiaryCreated
+		case trash.IsTrashed(record):
+			return nil
+		}
+		webhookService.Emit(record.GetString("owner"), event, record.PublicExport())
+		return nil
+	})
+	app.OnModelAfterDelete("diaries").Add(func(e *core.ModelEvent) error {
+		if record, ok := e.Model.(*models.Record); ok && !trash.IsTrashed(record) {
+			webhookService.Emit(record.GetString("owner"), webhook.EventDiaryDeleted, map[string]any{
+				"id":   record.Id,
+				"date": record.GetString("date"),
+			})
+		}
+		return nil
+	})
+	app.OnModelAfterCreate("media").Add(func(e *core.ModelEvent) error {
+		if record, ok := e.Model.(*models.Record); ok {
+			webhookService.Emit(record.GetString("owner"), webhook.EventMediaUploaded, record.PublicExport())
+		}
+		return nil
+	})
+	app.OnModelAfterCreate("ai_messages").Add(func(e *core.ModelEvent) error {
+		if record, ok := e.Model.(*models.Record); ok && record.GetString("role") == "assistant" {
+			webhookService.Emit(record.GetString("owner"), webhook.EventChatReplied, record.PublicExport())
+		}
+		return nil
+	})
+
 	// Add version command
 	app.RootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -140,6 +259,15 @@ func main() {
 		},
 	})
 
+	// Add MCP command, the HTTP transport is served at /api/v1/mcp
+	app.RootCmd.AddCommand(mcpCommand(app))
+
+	// Add commands to script backups, migrations and account management on the server
+	app.RootCmd.AddCommand(exportCommand(app))
+	app.RootCmd.AddCommand(importCommand(app))
+	app.RootCmd.AddCommand(reindexCommand(app))
+	app.RootCmd.AddCommand(usersCommand(app))
+
 	// Register custom routes and serve embedded frontend
 	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
 		// Print data directory information
@@ -159,78 +287,154 @@ func main() {
 		var embeddingService *embedding.EmbeddingService
 		if vectorDB != nil {
 			embeddingService = embedding.NewEmbeddingService(app, vectorDB)
+			embeddingService.OnBuildComplete().Add(func(e *embedding.BuildEvent) error {
+				webhookService.Emit(e.UserID, webhook.EventVectorsBuilt, map[string]any{
+					"mode":   e.Mode,
+					"result": e.Result,
+				})
+				return nil
+			})
 		}
 
-		// Initialize config service for checking AI settings
-		configService := config.NewConfigService(app)
+		// Start delivering webhook events
+		webhookService.Start()
 
-		// Add diary create hook for auto vector build
-		app.OnRecordAfterCreateRequest("diaries").Add(func(e *core.RecordCreateEvent) error {
-			userID := e.Record.GetString("owner")
-			if userID == "" {
-				return nil
-			}
+		// Run background export and import jobs, failing those a previous run left unfinished
+		jobService := jobs.NewJobService(app)
+		jobService.Start()
 
-			// Check if AI is enabled for this user
-			enabled, _ := configService.GetBool(userID, "ai.enabled")
-			if !enabled || embeddingService == nil {
-				return nil
+		// Rate limits per route group, defaults can be overridden with DIARUM_RATE_LIMIT_<GROUP>
+		rateLimits, warnings := ratelimit.NewLimits(os.Getenv)
+		for _, warning := range warnings {
+			log.Printf("Warning: Ignoring invalid rate limit %s", warning)
+		}
+		log.Printf("Rate limits: %s", rateLimits)
+
+		// Initialize revision service for diary history
+		revisionService := revision.NewRevisionService(app)
+
+		// Initialize trash service and purge expired trash in the background
+		trashService := trash.NewTrashService(app)
+		trashService.StartPurgeScheduler(time.Hour)
+
+		// Reject diary updates based on an outdated version. Clients send the updated timestamp
+		// they last saw as If-Match or as the updated field, a stale write gets a 409 with the
+		// server copy and a suggested merge. Writes without a version are applied as before.
+		app.OnRecordBeforeUpdateRequest("diaries").Add(func(e *core.RecordUpdateEvent) error {
+			var content *string
+			if _, ok := apis.RequestInfo(e.HttpContext).Data["content"]; ok {
+				value := e.Record.GetString("content")
+				content = &value
 			}
+			conflict, err := api.DiaryWriteConflict(e.HttpContext, app.Dao(), revisionService, e.Record.OriginalCopy(), content)
+			if err != nil {
+				return err
+			}
+			if conflict {
+				return hook.StopPropagation
+			}
+			return nil
+		})
+		app.OnRecordViewRequest("diaries").Add(func(e *core.RecordViewEvent) error {
+			e.HttpContext.Response().Header().Set("ETag", api.DiaryETag(e.Record))
+			return nil
+		})
+		app.OnRecordAfterUpdateRequest("diaries").Add(func(e *core.RecordUpdateEvent) error {
+			e.HttpContext.Response().Header().Set("ETag", api.DiaryETag(e.Record))
+			return nil
+		})
 
-			// Run incremental vector build in background
-			go func() {
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-				defer cancel()
-
-				logger.Info("[AutoVectorBuild] triggered by diary create for user: %s", userID)
-				result, err := embeddingService.BuildIncrementalVectors(ctx, userID)
-				if err != nil {
-					logger.Error("[AutoVectorBuild] failed for user %s: %v", userID, err)
-					return
-				}
-				logger.Info("[AutoVectorBuild] completed for user %s: %d built, %d failed", userID, result.Success, result.Failed)
-			}()
+		// Store diary dates as calendar days in the owner's timezone.
+		// Clients send either a plain day or an instant, the latter is converted with the owner's setting
+		// and also fills the entry time when none is given.
+		configService := config.NewConfigService(app)
+		normalizeDiaryDate := func(record *models.Record) error {
+			loc := configService.GetLocation(record.GetString("owner"))
+			value := record.GetString("date")
+			date, ok := dateutil.NormalizeDate(value, loc)
+			if !ok {
+				return apis.NewBadRequestError("Invalid diary date", nil)
+			}
+			if record.GetString("time") == "" {
+				record.Set("time", dateutil.ClockOf(value, loc))
+			}
+			record.Set("date", date)
+			return nil
+		}
+		app.OnRecordBeforeCreateRequest("diaries").Add(func(e *core.RecordCreateEvent) error {
+			return normalizeDiaryDate(e.Record)
+		})
+		app.OnRecordBeforeUpdateRequest("diaries").Add(func(e *core.RecordUpdateEvent) error {
+			return normalizeDiaryDate(e.Record)
+		})
 
+		// Add diary create hook for auto vector build
+		app.OnRecordAfterCreateRequest("diaries").Add(func(e *core.RecordCreateEvent) error {
+			embeddingService.ScheduleIncrementalBuild(e.Record.GetString("owner"), "diary create")
 			return nil
 		})
 
 		// Add diary update hook for auto vector build
 		app.OnRecordAfterUpdateRequest("diaries").Add(func(e *core.RecordUpdateEvent) error {
-			userID := e.Record.GetString("owner")
-			if userID == "" {
-				return nil
+			embeddingService.ScheduleIncrementalBuild(e.Record.GetString("owner"), "diary update")
+			return nil
+		})
+
+		// Add diary update hook for revision history
+		app.OnRecordAfterUpdateRequest("diaries").Add(func(e *core.RecordUpdateEvent) error {
+			if err := revisionService.SnapshotOnUpdate(e.Record.OriginalCopy(), e.Record, api.DiaryWriteBased(e.HttpContext)); err != nil {
+				logger.Error("[Revision] failed to snapshot diary %s: %v", e.Record.Id, err)
 			}
+			return nil
+		})
 
-			// Check if AI is enabled for this user
-			enabled, _ := configService.GetBool(userID, "ai.enabled")
-			if !enabled || embeddingService == nil {
+		// Move diaries and media to the trash instead of deleting them.
+		// The request is answered with 204 here and propagation stops, so the record is
+		// not deleted and OnRecordAfterDeleteRequest hooks don't run for a soft delete.
+		// Deleting a record that is already in the trash, or passing ?permanent=true,
+		// deletes it through the regular PocketBase flow.
+		app.OnRecordBeforeDeleteRequest("diaries", "media").Add(func(e *core.RecordDeleteEvent) error {
+			if trash.IsTrashed(e.Record) || e.HttpContext.QueryParam("permanent") == "true" {
 				return nil
 			}
 
-			// Run incremental vector build in background
-			go func() {
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-				defer cancel()
+			if err := trashService.MoveToTrash(e.Record); err != nil {
+				return apis.NewBadRequestError("Failed to move record to trash", err)
+			}
 
-				logger.Info("[AutoVectorBuild] triggered by diary update for user: %s", userID)
-				result, err := embeddingService.BuildIncrementalVectors(ctx, userID)
-				if err != nil {
-					logger.Error("[AutoVectorBuild] failed for user %s: %v", userID, err)
-					return
+			if e.Record.Collection().Name == "diaries" {
+				if err := embeddingService.DeleteDiaryVector(context.Background(), e.Record.GetString("owner"), e.Record.Id); err != nil {
+					logger.Warn("[Trash] failed to remove vector for diary %s: %v", e.Record.Id, err)
 				}
-				logger.Info("[AutoVectorBuild] completed for user %s: %d built, %d failed", userID, result.Success, result.Failed)
-			}()
+			}
+
+			if err := e.HttpContext.NoContent(http.StatusNoContent); err != nil {
+				return err
+			}
+			return hook.StopPropagation
+		})
 
+		// Remove vector documents of permanently deleted diaries
+		app.OnModelAfterDelete("diaries").Add(func(e *core.ModelEvent) error {
+			record, ok := e.Model.(*models.Record)
+			if !ok {
+				return nil
+			}
+			if err := embeddingService.DeleteDiaryVector(context.Background(), record.GetString("owner"), record.Id); err != nil {
+				logger.Warn("[Trash] failed to remove vector for diary %s: %v", record.Id, err)
+			}
 			return nil
 		})
 
 		// Register API routes
-		api.RegisterDiaryRoutes(app, e)
-		api.RegisterSettingsRoutes(app, e)
-		api.RegisterAIRoutes(app, e, embeddingService)
-		api.RegisterExportImportRoutes(app, e, embeddingService)
-		api.RegisterPublicRoutes(app, e)
-		api.RegisterVersionRoutes(e, Version, Name)
+		api.RegisterRoutes(app, e, api.Options{
+			EmbeddingService: embeddingService,
+			WebhookService:   webhookService,
+			JobService:       jobService,
+			RateLimits:       rateLimits,
+			Version:          Version,
+			Name:             Name,
+		})
 
 		// Serve embedded frontend static files with SPA fallback
 		staticFS, err := static.GetFS()
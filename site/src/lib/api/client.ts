@@ -26,6 +26,7 @@ export interface User {
 export interface Diary {
 	id?: string;
 	date: string;
+	time?: string;
 	content: string;
 	mood?: string;
 	weather?: string;
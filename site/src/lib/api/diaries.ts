@@ -72,6 +72,29 @@ export async function getDiaryByDate(date: string): Promise<Diary | null> {
 	}
 }
 
+/**
+ * Get all entries of a day, ordered by time
+ */
+export async function getDiaryEntriesByDate(date: string): Promise<Diary[]> {
+	try {
+		const response = await fetch(`/api/diaries/by-date/${date}`, {
+			headers: {
+				'Authorization': `Bearer ${pb.authStore.token}`
+			}
+		});
+
+		if (!response.ok) {
+			return [];
+		}
+
+		const data = await response.json();
+		return data.entries || [];
+	} catch (error) {
+		console.error('Error fetching diary entries:', error);
+		return [];
+	}
+}
+
 /**
  * Create or update diary
  */
@@ -82,8 +105,8 @@ export async function saveDiary(diary: Partial<Diary>): Promise<boolean> {
 			throw new Error('Not authenticated');
 		}
 
-		// Use custom API to get diary by date first
-		const existing = await getDiaryByDate(diary.date!);
+		// Update the given entry, or the first entry of the day
+		const existing = diary.id ? diary : await getDiaryByDate(diary.date!);
 
 		if (existing && existing.id) {
 			// Update existing diary
@@ -101,6 +124,7 @@ export async function saveDiary(diary: Partial<Diary>): Promise<boolean> {
 			};
 
 			// Only add optional fields if they have values
+			if (diary.time) data.time = diary.time;
 			if (diary.mood) data.mood = diary.mood;
 			if (diary.weather) data.weather = diary.weather;
 
@@ -3,7 +3,23 @@ import { pb } from './client';
 export interface ApiTokenStatus {
 	exists: boolean;
 	enabled: boolean;
+}
+
+export interface ApiToken {
+	id: string;
+	name: string;
+	prefix: string;
+	scopes: string[];
+	expires?: string;
+	last_used?: string;
+	last_ip?: string;
+	revoked?: string;
+	created: string;
+}
+
+export interface CreatedApiToken {
 	token: string;
+	details: ApiToken;
 }
 
 export interface SyncSettings {
@@ -12,7 +28,7 @@ export interface SyncSettings {
 }
 
 /**
- * Get API token status and value
+ * Get API access status
  */
 export async function getApiToken(): Promise<ApiTokenStatus> {
 	try {
@@ -23,20 +39,20 @@ export async function getApiToken(): Promise<ApiTokenStatus> {
 		});
 
 		if (!response.ok) {
-			throw new Error('Failed to get API token');
+			throw new Error('Failed to get API status');
 		}
 
 		return await response.json();
 	} catch (error) {
-		console.error('Error fetching API token:', error);
-		return { exists: false, enabled: false, token: '' };
+		console.error('Error fetching API status:', error);
+		return { exists: false, enabled: false };
 	}
 }
 
 /**
- * Toggle API token enabled/disabled
+ * Toggle API access enabled/disabled
  */
-export async function toggleApiToken(): Promise<ApiTokenStatus> {
+export async function toggleApiToken(): Promise<boolean> {
 	try {
 		const response = await fetch('/api/settings/api-token/toggle', {
 			method: 'POST',
@@ -46,39 +62,74 @@ export async function toggleApiToken(): Promise<ApiTokenStatus> {
 		});
 
 		if (!response.ok) {
-			throw new Error('Failed to toggle API token');
+			throw new Error('Failed to toggle API access');
 		}
 
 		const data = await response.json();
-		return { exists: true, enabled: data.enabled, token: data.token };
+		return data.enabled;
 	} catch (error) {
-		console.error('Error toggling API token:', error);
+		console.error('Error toggling API access:', error);
 		throw error;
 	}
 }
 
 /**
- * Reset API token (generate new one)
+ * List API tokens and the scopes a token can be granted
  */
-export async function resetApiToken(): Promise<ApiTokenStatus> {
+export async function listApiTokens(): Promise<{ tokens: ApiToken[]; scopes: string[] }> {
 	try {
-		const response = await fetch('/api/settings/api-token/reset', {
-			method: 'POST',
+		const response = await fetch('/api/settings/api-tokens', {
 			headers: {
 				'Authorization': `Bearer ${pb.authStore.token}`
 			}
 		});
 
 		if (!response.ok) {
-			throw new Error('Failed to reset API token');
+			throw new Error('Failed to list API tokens');
 		}
 
-		const data = await response.json();
-		return { exists: true, enabled: data.enabled, token: data.token };
+		return await response.json();
 	} catch (error) {
-		console.error('Error resetting API token:', error);
-		throw error;
+		console.error('Error listing API tokens:', error);
+		return { tokens: [], scopes: [] };
+	}
+}
+
+/**
+ * Create an API token, the secret is only returned once
+ */
+export async function createApiToken(name: string, scopes: string[], expiresInDays: number): Promise<CreatedApiToken> {
+	const response = await fetch('/api/settings/api-tokens', {
+		method: 'POST',
+		headers: {
+			'Authorization': `Bearer ${pb.authStore.token}`,
+			'Content-Type': 'application/json'
+		},
+		body: JSON.stringify({ name, scopes, expires_in_days: expiresInDays })
+	});
+
+	const data = await response.json();
+	if (!response.ok) {
+		throw new Error(data.message || 'Failed to create API token');
+	}
+	return data;
+}
+
+/**
+ * Revoke an API token
+ */
+export async function revokeApiToken(id: string): Promise<ApiToken> {
+	const response = await fetch(`/api/settings/api-tokens/${id}/revoke`, {
+		method: 'POST',
+		headers: {
+			'Authorization': `Bearer ${pb.authStore.token}`
+		}
+	});
+
+	if (!response.ok) {
+		throw new Error('Failed to revoke API token');
 	}
+	return await response.json();
 }
 
 /**
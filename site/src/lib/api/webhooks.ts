@@ -0,0 +1,116 @@
+import { pb } from './client';
+
+export interface Webhook {
+	id: string;
+	name: string;
+	url: string;
+	events: string[];
+	enabled: boolean;
+	created: string;
+	updated: string;
+}
+
+export interface CreatedWebhook {
+	secret: string;
+	webhook: Webhook;
+}
+
+export interface WebhookDelivery {
+	id: string;
+	webhook: string;
+	event: string;
+	payload: string;
+	status: 'pending' | 'delivered' | 'failed';
+	attempts: number;
+	next_attempt?: string;
+	response_status?: number;
+	error?: string;
+	duration_ms: number;
+	created: string;
+	updated: string;
+}
+
+async function request<T>(path: string, init: RequestInit = {}, fallbackError: string): Promise<T> {
+	const response = await fetch(path, {
+		...init,
+		headers: {
+			'Authorization': `Bearer ${pb.authStore.token}`,
+			...(init.body ? { 'Content-Type': 'application/json' } : {})
+		}
+	});
+
+	if (response.status === 204) {
+		return undefined as T;
+	}
+
+	const data = await response.json();
+	if (!response.ok) {
+		throw new Error(data.message || fallbackError);
+	}
+	return data;
+}
+
+/**
+ * List webhooks and the events they can subscribe to
+ */
+export async function listWebhooks(): Promise<{ webhooks: Webhook[]; events: string[] }> {
+	try {
+		return await request('/api/webhooks', {}, 'Failed to list webhooks');
+	} catch (error) {
+		console.error('Error listing webhooks:', error);
+		return { webhooks: [], events: [] };
+	}
+}
+
+/**
+ * Create a webhook, the signing secret is only returned once
+ */
+export async function createWebhook(name: string, url: string, events: string[]): Promise<CreatedWebhook> {
+	return request('/api/webhooks', {
+		method: 'POST',
+		body: JSON.stringify({ name, url, events })
+	}, 'Failed to create webhook');
+}
+
+/**
+ * Update a webhook, fields left out keep their value
+ */
+export async function updateWebhook(id: string, changes: Partial<Pick<Webhook, 'name' | 'url' | 'events' | 'enabled'>>): Promise<Webhook> {
+	return request(`/api/webhooks/${id}`, {
+		method: 'PUT',
+		body: JSON.stringify(changes)
+	}, 'Failed to update webhook');
+}
+
+/**
+ * Delete a webhook and its delivery log
+ */
+export async function deleteWebhook(id: string): Promise<void> {
+	return request(`/api/webhooks/${id}`, { method: 'DELETE' }, 'Failed to delete webhook');
+}
+
+/**
+ * Send a ping to a webhook and return the delivery
+ */
+export async function testWebhook(id: string): Promise<WebhookDelivery> {
+	return request(`/api/webhooks/${id}/test`, { method: 'POST' }, 'Failed to test webhook');
+}
+
+/**
+ * List the latest deliveries of a webhook
+ */
+export async function listWebhookDeliveries(id: string, limit = 20): Promise<WebhookDelivery[]> {
+	const data = await request<{ deliveries: WebhookDelivery[] }>(
+		`/api/webhooks/${id}/deliveries?limit=${limit}`,
+		{},
+		'Failed to list deliveries'
+	);
+	return data.deliveries;
+}
+
+/**
+ * Queue the payload of a delivery again
+ */
+export async function redeliverWebhook(id: string, deliveryId: string): Promise<WebhookDelivery> {
+	return request(`/api/webhooks/${id}/deliveries/${deliveryId}/redeliver`, { method: 'POST' }, 'Failed to redeliver');
+}